@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// runCheck implements the "check" subcommand: it loads the configuration,
+// logs in to Vaultwarden and syncs the vault once, printing a pass/fail line
+// per step without starting the HTTP server. Unlike startup there are no
+// retries, so misconfiguration fails fast. It returns the process exit code.
+func runCheck(out io.Writer) int {
+	pass := func(format string, args ...any) {
+		fmt.Fprintf(out, "PASS  "+format+"\n", args...)
+	}
+	fail := func(format string, args ...any) int {
+		fmt.Fprintf(out, "FAIL  "+format+"\n", args...)
+		fmt.Fprintln(out, "check failed")
+		return 1
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail("configuration: %v", err)
+	}
+	pass("configuration loaded (%d API keys, %d allowed IPs)", len(cfg.APIKeys), len(cfg.AllowedIPs))
+	if cfg.AllowedIPsFile != "" {
+		wl, err := ipwhitelist.New(nil, false)
+		if err == nil {
+			err = wl.SetAllowedFile(cfg.AllowedIPsFile)
+		}
+		if err != nil {
+			return fail("ALLOWED_IPS_FILE: %v", err)
+		}
+		pass("ALLOWED_IPS_FILE loaded (%s)", cfg.AllowedIPsFile)
+	}
+	logger.SetRedactNames(cfg.RedactNames)
+
+	if cfg.VaultwardenEmail == "" || cfg.VaultwardenPassword == "" {
+		return fail("credentials: VAULTWARDEN_EMAIL and VAULTWARDEN_PASSWORD are required")
+	}
+	mode := "password"
+	if cfg.VaultwardenClientID != "" && cfg.VaultwardenClientSecret != "" {
+		mode = "API key"
+	}
+	pass("credentials set (%s login)", mode)
+
+	api := vaultwarden.NewAPIClient(cfg.VaultwardenURL, cfg.VaultwardenEmail, cfg.VaultwardenPassword,
+		cfg.VaultwardenClientID, cfg.VaultwardenClientSecret)
+	client := vaultwarden.NewClient(api, cfg.CacheTTL, cfg.SyncInterval, clientOptions(cfg)...)
+	defer client.Close()
+
+	if err := client.Initialize(); err != nil {
+		return fail("login and sync with %s: %v", cfg.VaultwardenURL, err)
+	}
+	names, err := client.ListSecrets(vaultwarden.SecretFilter{}, 0)
+	if err != nil {
+		return fail("list secrets: %v", err)
+	}
+	pass("logged in and synced %s (%d secrets)", cfg.VaultwardenURL, len(names))
+
+	if len(cfg.PreloadSecrets) > 0 {
+		if errs := client.Preload(cfg.PreloadSecrets); len(errs) > 0 {
+			return fail("PRELOAD_SECRETS: %d of %d names not resolved", len(errs), len(cfg.PreloadSecrets))
+		}
+		pass("PRELOAD_SECRETS resolved (%d names)", len(cfg.PreloadSecrets))
+	}
+
+	if cfg.StartupSelftestSecret != "" {
+		if err := client.SelfTest(cfg.StartupSelftestSecret); err != nil {
+			return fail("STARTUP_SELFTEST_SECRET: %v", err)
+		}
+		pass("STARTUP_SELFTEST_SECRET resolved")
+	}
+
+	if err := client.Ready(); err != nil {
+		return fail("readiness: %v", err)
+	}
+	pass("server reachable")
+
+	fmt.Fprintln(out, "check passed")
+	return 0
+}
@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/audit"
 	"github.com/Turbootzz/vaultwarden-api/internal/auth"
 	"github.com/Turbootzz/vaultwarden-api/internal/config"
+	"github.com/Turbootzz/vaultwarden-api/internal/grpcapi"
 	"github.com/Turbootzz/vaultwarden-api/internal/handlers"
+	"github.com/Turbootzz/vaultwarden-api/internal/headerguard"
 	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
+	"github.com/Turbootzz/vaultwarden-api/internal/validators"
 	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"github.com/Turbootzz/vaultwarden-api/internal/version"
+	"github.com/Turbootzz/vaultwarden-api/internal/webhook"
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
@@ -21,55 +34,179 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
 )
 
+// allowedIPsFilePollInterval is how often ALLOWED_IPS_FILE is checked for changes.
+const allowedIPsFilePollInterval = 10 * time.Second
+
+// whitelistCleanupInterval is how often expired temporary whitelist entries
+// are removed. They stop applying at their expiry regardless.
+const whitelistCleanupInterval = 30 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Stdout))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q (usage: %s [check])\n", os.Args[1], os.Args[0])
+			os.Exit(2)
+		}
+	}
+
 	// Load configuration.
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		logger.Error.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	logger.Info.Printf("Starting Vaultwarden API on port %s (environment: %s)", cfg.Port, cfg.Environment)
+	logger.Info.Printf("Starting Vaultwarden API %s on port %s (environment: %s)", version.Version, cfg.Port, cfg.Environment)
 
-	// Initialize Vaultwarden client.
-	email := os.Getenv("VAULTWARDEN_EMAIL")
-	password := os.Getenv("VAULTWARDEN_PASSWORD")
-	clientID := os.Getenv("VAULTWARDEN_CLIENT_ID")
-	clientSecret := os.Getenv("VAULTWARDEN_CLIENT_SECRET")
+	response.SetEnvelope(cfg.ResponseEnvelope)
+	logger.SetRedactNames(cfg.RedactNames)
 
-	if email == "" || password == "" {
-		logger.Error.Fatal("VAULTWARDEN_EMAIL and VAULTWARDEN_PASSWORD are required")
+	if cfg.InsecureTLS {
+		logger.Warn.Println("**************************************************************")
+		logger.Warn.Println("VAULTWARDEN_INSECURE_TLS is enabled: the Vaultwarden certificate")
+		logger.Warn.Println("is NOT verified and the connection can be intercepted. Use this")
+		logger.Warn.Println("for local development against a self-signed server only.")
+		logger.Warn.Println("**************************************************************")
 	}
 
-	syncInterval := parseDurationEnv("SYNC_INTERVAL", "5m")
+	// Initialize Vaultwarden client.
+	if cfg.VaultwardenEmail == "" || cfg.VaultwardenPassword == "" {
+		logger.Error.Fatal("VAULTWARDEN_EMAIL and VAULTWARDEN_PASSWORD are required")
+	}
 
 	vaultClient, err := vaultwarden.InitializeClient(
 		cfg.VaultwardenURL,
-		email,
-		password,
-		clientID,
-		clientSecret,
+		cfg.VaultwardenEmail,
+		cfg.VaultwardenPassword,
+		cfg.VaultwardenClientID,
+		cfg.VaultwardenClientSecret,
 		cfg.CacheTTL,
-		syncInterval,
+		cfg.SyncInterval,
+		clientOptions(cfg)...,
 	)
 	if err != nil {
 		logger.Error.Fatalf("Failed to initialize Vaultwarden client: %v", err)
 	}
+	vaultClient.Preload(cfg.PreloadSecrets)
+	if cfg.StartupSelftestSecret != "" {
+		if err := vaultClient.SelfTest(cfg.StartupSelftestSecret); err != nil {
+			logger.Error.Fatalf("Startup self-test failed (STARTUP_SELFTEST_SECRET): %v", err)
+		}
+		logger.Info.Println("Startup self-test passed")
+	}
+
+	// Security event webhook (no-op when WEBHOOK_URL is empty).
+	events := webhook.New(cfg.WebhookURL)
+
+	// Secret access audit log (disabled when AUDIT_LOG is empty).
+	var auditLog *audit.Logger
+	switch cfg.AuditLog {
+	case "":
+	case "stdout":
+		auditLog = audit.New(audit.NewWriterSink(os.Stdout))
+	default:
+		sink, err := audit.OpenFile(cfg.AuditLog)
+		if err != nil {
+			logger.Error.Fatalf("Failed to open audit log: %v", err)
+		}
+		auditLog = audit.New(sink)
+	}
 
 	// Initialize handlers.
-	h := handlers.NewHandler(vaultClient)
+	handlerOpts := []handlers.Option{
+		handlers.WithValueSizeWarning(cfg.SecretSizeWarnBytes),
+		handlers.WithWebhook(events),
+		handlers.WithAudit(auditLog),
+	}
+	if cfg.HealthVerbose {
+		handlerOpts = append(handlerOpts, handlers.WithVerboseHealth())
+	}
+	var tokenSigner *auth.TokenSigner
+	if cfg.TokenSigningKey != nil {
+		tokenSigner = auth.NewTokenSigner(cfg.TokenSigningKey)
+		handlerOpts = append(handlerOpts, handlers.WithTokenSigner(tokenSigner, cfg.TokenMaxTTL))
+	}
+	if cfg.ResponseEncryptionKey != nil {
+		block, err := aes.NewCipher(cfg.ResponseEncryptionKey)
+		if err != nil {
+			logger.Error.Fatalf("Failed to initialize response encryption: %v", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			logger.Error.Fatalf("Failed to initialize response encryption: %v", err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithResponseEncryption(aead))
+	}
 
 	// Initialize IP whitelist.
-	ipWhitelist, err := ipwhitelist.New(cfg.AllowedIPs, cfg.EnableGitHubIPRanges)
+	ipWhitelist, err := ipwhitelist.New(cfg.AllowedIPs, false)
 	if err != nil {
 		logger.Error.Fatalf("Failed to initialize IP whitelist: %v", err)
 	}
-
-	// Start periodic GitHub IP range updates.
-	var stopIPUpdate func()
+	ipWhitelist.SetBlocked(cfg.BlockedIPs)
+	if cfg.AllowedIPsFile != "" {
+		if err := ipWhitelist.SetAllowedFile(cfg.AllowedIPsFile); err != nil {
+			logger.Error.Fatalf("Failed to load ALLOWED_IPS_FILE: %v", err)
+		}
+	}
+	providers := cfg.IPRangeProviders
 	if cfg.EnableGitHubIPRanges {
-		stopIPUpdate = ipWhitelist.StartPeriodicUpdate(24 * time.Hour)
+		github, err := ipwhitelist.GitHubProvider(cfg.GitHubIPRangeTypes...)
+		if err != nil {
+			logger.Error.Fatalf("Failed to initialize IP whitelist: %v", err)
+		}
+		providers = append([]ipwhitelist.RangeProvider{github}, providers...)
+	}
+	// With IP_RANGE_STARTUP_JITTER the first fetch moves to the updater below,
+	// so instances restarted together do not all fetch at once; static rules
+	// apply right away meanwhile.
+	addProvider := ipWhitelist.AddRangeProvider
+	if cfg.IPRangeStartupJitter > 0 {
+		addProvider = ipWhitelist.RegisterRangeProvider
+	}
+	for _, provider := range providers {
+		if err := addProvider(provider); err != nil {
+			logger.Error.Fatalf("Failed to add IP range provider: %v", err)
+		}
+	}
+
+	if cfg.AllowDynamicWhitelist {
+		handlerOpts = append(handlerOpts, handlers.WithDynamicWhitelist(ipWhitelist, cfg.DynamicWhitelistMaxTTL))
+	}
+	h := handlers.NewHandler(vaultClient, handlerOpts...)
+
+	// Start periodic GitHub / provider IP range updates (no-op without any).
+	stopIPUpdate := ipWhitelist.StartPeriodicUpdate(24*time.Hour, cfg.IPRangeRefreshJitter, cfg.IPRangeStartupJitter)
+	// Reload ALLOWED_IPS_FILE when it changes (no-op without one).
+	stopAllowedFileWatch := ipWhitelist.WatchAllowedFile(allowedIPsFilePollInterval)
+	stopWhitelistCleanup := func() {}
+	if cfg.AllowDynamicWhitelist {
+		stopWhitelistCleanup = ipWhitelist.StartTemporaryCleanup(whitelistCleanupInterval, func(te ipwhitelist.TemporaryEntry) {
+			auditLog.Record(audit.Event{Kind: audit.KindWhitelist, Entry: te.Entry, Expires: &te.Expires, Outcome: audit.OutcomeExpired})
+		})
+	}
+
+	// stopBackground stops every background goroutine once the server is down.
+	stopBackground := func() {
+		stopIPUpdate()
+		stopAllowedFileWatch()
+		stopWhitelistCleanup()
+		vaultClient.Close()
+		events.Close()
+		auditLog.Close()
+	}
+
+	// Client IP resolution: X-Forwarded-For only counts from trusted proxies.
+	trustedProxies := getTrustedProxies(cfg)
+	proxyChain, err := ipwhitelist.NewProxyChain(trustedProxies, ipwhitelist.WithForwardedIndex(cfg.XFFIndex))
+	if err != nil {
+		logger.Error.Fatalf("Failed to initialize trusted proxies: %v", err)
 	}
 
 	// Create Fiber app with security configurations.
@@ -78,67 +215,208 @@ func main() {
 		DisableStartupMessage:   false,
 		ReadTimeout:             cfg.ReadTimeout,
 		WriteTimeout:            cfg.WriteTimeout,
+		BodyLimit:               cfg.MaxBodySize,
 		ServerHeader:            "",
 		ErrorHandler:            customErrorHandler(cfg.IsProd()),
 		EnableTrustedProxyCheck: true,
-		TrustedProxies:          getTrustedProxies(),
+		TrustedProxies:          trustedProxies,
 		ProxyHeader:             fiber.HeaderXForwardedFor,
 		// Avoid empty c.IP() when header is missing (e.g. behind a trusted proxy)
 		EnableIPValidation: true,
 	})
 
+	var inFlight atomic.Int64
+	app.Use(countInFlight(&inFlight))
+	app.Use(requestID())
+	app.Use(proxyChain.Middleware())
+	if cfg.HeaderGuard {
+		app.Use(headerguard.Middleware(headerguard.Config{
+			MaxHeaderBytes:    cfg.HeaderMaxBytes,
+			BlockedUserAgents: cfg.BlockedUserAgents,
+		}))
+	}
 	app.Use(helmet.New())
 	app.Use(recover.New())
 	app.Use(compress.New(compress.Config{
 		Level: compress.LevelBestSpeed,
 	}))
 
+	corsMethods := cfg.CORSAllowedMethods
+	if corsMethods == "" {
+		corsMethods = "GET,POST"
+		if cfg.AllowWrites {
+			corsMethods += ",PUT"
+		}
+	}
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.CORSAllowedOrigins,
-		AllowMethods:     "GET,POST",
-		AllowHeaders:     "Authorization,Content-Type",
+		AllowMethods:     corsMethods,
+		AllowHeaders:     cfg.CORSAllowedHeaders,
+		ExposeHeaders:    "X-Request-ID,X-Cache",
 		AllowCredentials: false,
 	}))
 
 	// Public routes.
 	app.Get("/health", h.HealthCheck)
+	app.Get("/ready", h.Ready)
 
 	// Protected routes.
-	api := app.Group("/")
-	api.Use(ipWhitelist.Middleware())
-	api.Use(limiter.New(limiter.Config{
-		Max:        cfg.RateLimitMax,
-		Expiration: cfg.RateLimitWindow,
-		// Whitelisted/trusted IPs bypass rate limiting entirely.
-		Next: func(c *fiber.Ctx) bool {
-			return ipWhitelist.IsAllowed(c.IP())
+	keyStore := auth.NewStore(cfg.APIKeys, auth.WithKeyHeader(cfg.APIKeyHeader))
+	rateLimiter := newSwappableHandler(newRateLimiter(cfg, ipWhitelist, keyStore))
+
+	notifyAuthFailure := func(c *fiber.Ctx, reason, providedKey string) {
+		events.Notify(webhook.Event{
+			Type:           webhook.EventAuthFailure,
+			ClientIP:       ipwhitelist.ClientIP(c),
+			Reason:         reason,
+			KeyFingerprint: webhook.Fingerprint(providedKey),
+		})
+	}
+
+	routes := &routeRegistry{
+		app:     app,
+		policy:  cfg.RouteAuth,
+		guard:   []fiber.Handler{ipWhitelist.Middleware(), rateLimiter.Handler()},
+		authMid: auth.Middleware(keyStore, auth.WithFailureHook(notifyAuthFailure)),
+	}
+	if tokenSigner != nil {
+		routes.tokenMid = auth.SignedToken(tokenSigner)
+	}
+
+	routes.addTokenRoute(fiber.MethodGet, "/secret/:name", auth.TierKey, h.GetSecret)
+	routes.add(fiber.MethodHead, "/secret/:name", auth.TierKey, h.SecretExists)
+	routes.add(fiber.MethodPost, "/secret", auth.TierKey, h.PostSecret)
+	routes.add(fiber.MethodGet, "/secret/:name/full", auth.TierKey, h.GetSecretDetail)
+	routes.add(fiber.MethodGet, "/secret/id/:id", auth.TierKey, h.GetSecretByID)
+	routes.add(fiber.MethodGet, "/secrets", auth.TierKey, h.ListSecrets)
+	routes.add(fiber.MethodGet, "/validate/:name", auth.TierKey, h.ValidateSecretName)
+	routes.add(fiber.MethodPost, "/secrets/batch", auth.TierKey, h.BatchGetSecrets)
+	// /refresh and /sync both download the whole vault, so they share one
+	// sync budget.
+	syncLimiter := newSwappableHandler(newSyncRateLimiter(cfg, keyStore))
+	routes.add(fiber.MethodPost, "/refresh", auth.TierKey, syncLimiter.Handler(), h.RefreshCache)
+	routes.add(fiber.MethodPost, "/sync", auth.TierKey, syncLimiter.Handler(), h.SyncVault)
+	routes.add(fiber.MethodGet, "/cache", auth.TierAdmin, h.ListCache)
+	routes.add(fiber.MethodGet, "/version", auth.TierPublic, h.Version)
+	routes.add(fiber.MethodGet, "/auth/status", auth.TierKey, h.AuthStatus)
+	routes.add(fiber.MethodGet, "/", auth.TierPublic, h.Root)
+	if tokenSigner != nil {
+		routes.addPrivate(fiber.MethodPost, "/token", auth.TierKey, h.IssueToken)
+	}
+
+	// Writes are opt-in so read-only deployments cannot modify the vault.
+	if cfg.AllowWrites {
+		routes.add(fiber.MethodPut, "/secret/:name", auth.TierAdmin, h.UpdateSecret)
+		logger.Warn.Println("ALLOW_WRITES is enabled: PUT /secret/:name can change vault items")
+	}
+
+	// The export is opt-in and guarded beyond ROUTE_AUTH: the handler insists on
+	// an unscoped admin key, and requireAllowRules refuses it whenever a reload
+	// has left the IP whitelist without rules.
+	if cfg.AllowExport {
+		routes.add(fiber.MethodGet, "/export", auth.TierAdmin, requireAllowRules(ipWhitelist), h.ExportSecrets)
+		logger.Warn.Println("**************************************************************")
+		logger.Warn.Println("ALLOW_EXPORT is enabled: GET /export?confirm=yes streams EVERY")
+		logger.Warn.Println("secret in the vault (encrypted) to a global admin key from a")
+		logger.Warn.Println("whitelisted IP. Disable it again once the backup is taken.")
+		logger.Warn.Println("**************************************************************")
+	}
+
+	// Temporary whitelist entries are opt-in, need an unscoped admin key (checked
+	// by the handlers) and, like the export, an existing whitelist to extend.
+	if cfg.AllowDynamicWhitelist {
+		routes.add(fiber.MethodPost, "/whitelist", auth.TierAdmin, requireAllowRules(ipWhitelist), h.AddWhitelistEntry)
+		routes.add(fiber.MethodDelete, "/whitelist", auth.TierAdmin, requireAllowRules(ipWhitelist), h.RemoveWhitelistEntry)
+		routes.add(fiber.MethodGet, "/whitelist", auth.TierAdmin, requireAllowRules(ipWhitelist), h.ListWhitelistEntries)
+		logger.Warn.Printf("ALLOW_DYNAMIC_WHITELIST is enabled: POST /whitelist can allow extra IPs for up to %v", cfg.DynamicWhitelistMaxTTL)
+	}
+
+	// Prometheus metrics: public like /health unless gated behind the IP
+	// whitelist (and rate limiter), in which case ROUTE_AUTH can also apply.
+	if cfg.MetricsEnabled {
+		if cfg.MetricsIPWhitelist {
+			routes.add(fiber.MethodGet, "/metrics", auth.TierPublic, metrics.Handler())
+		} else {
+			app.Get("/metrics", metrics.Handler())
+		}
+	}
+	if err := routes.validate(); err != nil {
+		logger.Error.Fatalf("Invalid ROUTE_AUTH: %v", err)
+	}
+
+	// Anything no route matched; must stay the last registration.
+	app.Use(h.NotFound)
+
+	// The optional gRPC server shares the vault client, keys and whitelist
+	// with the REST routes, on a port of its own.
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			logger.Error.Fatalf("Failed to listen on GRPC_PORT: %v", err)
+		}
+		grpcServer = grpcapi.NewServer(vaultClient, keyStore,
+			grpcapi.WithIPWhitelist(ipWhitelist),
+			grpcapi.WithAudit(auditLog),
+			grpcapi.WithWebhook(events),
+		)
+		go func() {
+			logger.Info.Printf("gRPC server listening on port %s", cfg.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Error.Printf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+
+	// Live reload of the reloadable configuration subset.
+	cfgReloader := &reloader{
+		cfg:         cfg,
+		load:        loadConfig,
+		ipWhitelist: ipWhitelist,
+		keyStore:    keyStore,
+		limiter:     rateLimiter,
+		newLimiter: func(c *config.Config) fiber.Handler {
+			return newRateLimiter(c, ipWhitelist, keyStore)
 		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "too many requests, please slow down",
-			})
+		syncLimiter: syncLimiter,
+		newSyncLimiter: func(c *config.Config) fiber.Handler {
+			return newSyncRateLimiter(c, keyStore)
 		},
-	}))
-	api.Use(auth.Middleware(auth.NewStore(cfg.APIKeys)))
-
-	api.Get("/secret/:name", h.GetSecret)
-	api.Post("/refresh", h.RefreshCache)
+	}
+	go func() {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		for range hupChan {
+			logger.Info.Println("SIGHUP received, reloading configuration...")
+			cfgReloader.reload()
+		}
+	}()
 
-	// Graceful shutdown.
+	// Graceful shutdown. Listen returns as soon as the listener is closed, so
+	// main waits on shutdownDone for the drain to finish (or time out).
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 
-		logger.Info.Println("Shutting down gracefully...")
-
-		vaultClient.Stop()
-
-		if stopIPUpdate != nil {
-			stopIPUpdate()
-		}
-
-		if err := app.Shutdown(); err != nil {
+		logger.Info.Printf("Shutting down gracefully (timeout %v)...", cfg.ShutdownTimeout)
+
+		// Drain in-flight requests first, REST and gRPC alike; background
+		// workers are stopped once Listen returns below. Connections still
+		// busy at the deadline are dropped when the process exits.
+		grpcStopped := make(chan struct{})
+		go func() {
+			defer close(grpcStopped)
+			stopGRPC(grpcServer, cfg.ShutdownTimeout)
+		}()
+		err := app.ShutdownWithTimeout(cfg.ShutdownTimeout)
+		<-grpcStopped
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			logger.Warn.Printf("Shutdown timeout reached with %d requests still in flight; abandoning them", inFlight.Load())
+		case err != nil:
 			logger.Error.Printf("Error during shutdown: %v", err)
 		}
 	}()
@@ -146,39 +424,128 @@ func main() {
 	// Start server.
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	if err := app.Listen(addr); err != nil {
-		if stopIPUpdate != nil {
-			stopIPUpdate()
+		if grpcServer != nil {
+			grpcServer.Stop()
 		}
+		stopBackground()
 		logger.Error.Printf("Failed to start server: %v", err)
 		os.Exit(1)
 	}
+
+	<-shutdownDone
+	stopBackground()
+	logger.Info.Println("Shutdown complete")
 }
 
-// parseDurationEnv reads a duration from an env var with a fallback.
-func parseDurationEnv(key, fallback string) time.Duration {
-	s := os.Getenv(key)
-	if s == "" {
-		s = fallback
+// newRateLimiter builds the rate limiter from the current configuration.
+// Requests presenting a valid API key are counted per key name, so one noisy
+// consumer cannot starve others behind the same address; anything else
+// (including invalid keys, so guessing stays limited) is counted per client IP.
+func newRateLimiter(cfg *config.Config, ipWhitelist *ipwhitelist.IPWhitelist, keyStore *auth.Store) fiber.Handler {
+	// RATE_LIMIT_EXEMPT names the networks that bypass the limiter; without
+	// it, every whitelisted IP does.
+	exempt := ipWhitelist
+	if len(cfg.RateLimitExempt) > 0 {
+		var err error
+		if exempt, err = ipwhitelist.New(cfg.RateLimitExempt, false); err != nil {
+			logger.Error.Printf("Invalid RATE_LIMIT_EXEMPT: %v", err)
+			exempt = ipWhitelist
+		}
 	}
-	d, err := time.ParseDuration(s)
-	if err != nil {
-		return 5 * time.Minute
+
+	return limiter.New(limiter.Config{
+		Max:        cfg.RateLimitMax,
+		Expiration: cfg.RateLimitWindow,
+		Next: func(c *fiber.Ctx) bool {
+			return exempt.IsAllowed(ipwhitelist.ClientIP(c))
+		},
+		KeyGenerator: rateLimitKey(keyStore),
+		LimitReached: func(c *fiber.Ctx) error {
+			return response.Error(c, fiber.StatusTooManyRequests, "too many requests, please slow down")
+		},
+	})
+}
+
+// newSyncRateLimiter builds the extra limiter for POST /sync and POST /refresh: every call costs a
+// full vault download and decryption, so it gets its own, much lower budget
+// (SYNC_RATE_LIMIT_MAX per RATE_LIMIT_WINDOW) that RATE_LIMIT_EXEMPT does not
+// lift.
+func newSyncRateLimiter(cfg *config.Config, keyStore *auth.Store) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:          cfg.SyncRateLimitMax,
+		Expiration:   cfg.RateLimitWindow,
+		KeyGenerator: rateLimitKey(keyStore),
+		LimitReached: func(c *fiber.Ctx) error {
+			return response.Error(c, fiber.StatusTooManyRequests, "too many sync requests, please slow down")
+		},
+	})
+}
+
+// rateLimitKey counts requests presenting a valid API key per key name and
+// anything else per client IP.
+func rateLimitKey(keyStore *auth.Store) func(*fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		if key, ok := keyStore.Identify(c); ok {
+			return "key:" + key.Name
+		}
+		return "ip:" + ipwhitelist.ClientIP(c)
+	}
+}
+
+// loadConfig loads the configuration from CONFIG_FILE when set (with env vars
+// taking precedence over file values), or from the environment alone.
+func loadConfig() (*config.Config, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return config.LoadFromFile(path)
 	}
-	return d
+	return config.Load()
 }
 
-// getTrustedProxies returns the list of trusted proxy IPs.
-func getTrustedProxies() []string {
+// clientOptions maps the configuration onto vault client options.
+func clientOptions(cfg *config.Config) []vaultwarden.ClientOption {
+	return []vaultwarden.ClientOption{
+		vaultwarden.WithSyncBeforeFetch(cfg.SyncBeforeFetchMaxAge),
+		vaultwarden.WithTTLOverrides(cfg.CacheTTLOverrides),
+		vaultwarden.WithSyncOnMiss(cfg.SyncOnMiss, cfg.SyncOnMissCooldown),
+		vaultwarden.WithFallbackURLs(cfg.VaultwardenFallbackURLs),
+		vaultwarden.WithStaleIfError(cfg.StaleIfError),
+		vaultwarden.WithExcludeTrashed(cfg.ExcludeTrashed),
+		vaultwarden.WithNameMatch(cfg.NameMatch),
+		vaultwarden.WithHTTPConfig(vaultwarden.HTTPConfig{
+			Timeout:            cfg.HTTPTimeout,
+			MaxIdleConns:       cfg.HTTPMaxIdleConns,
+			IdleConnTimeout:    cfg.HTTPIdleConnTimeout,
+			CertPins:           cfg.CertPins,
+			InsecureSkipVerify: cfg.InsecureTLS,
+			ClientCert:         cfg.ClientCert,
+		}),
+		vaultwarden.WithSecretFieldNames(cfg.SecretFieldNames),
+		vaultwarden.WithExtractionOrder(cfg.ExtractionOrder),
+		vaultwarden.WithDevice(cfg.DeviceType, cfg.DeviceName),
+		vaultwarden.WithTokenCacheFile(cfg.TokenCacheFile),
+		vaultwarden.WithTokenRetry(cfg.TokenRetryAttempts, cfg.TokenRetryBaseDelay),
+		vaultwarden.WithSyncRetry(cfg.SyncRetryAttempts, cfg.SyncRetryBaseDelay),
+		vaultwarden.WithMaxVaultItems(cfg.MaxVaultItems),
+		vaultwarden.WithCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown),
+	}
+}
+
+// getTrustedProxies returns the trusted proxy IPs/CIDRs: loopback, the
+// validated TRUSTED_PROXIES entries and the comma-separated legacy
+// TRUSTED_PROXY_IP entries (invalid ones are skipped with a warning).
+func getTrustedProxies(cfg *config.Config) []string {
 	seen := make(map[string]bool)
 	result := []string{}
 
-	for _, ip := range []string{"127.0.0.1", "::1"} {
-		result = append(result, ip)
-		seen[ip] = true
+	for _, ip := range append([]string{"127.0.0.1", "::1"}, cfg.TrustedProxies...) {
+		if !seen[ip] {
+			result = append(result, ip)
+			seen[ip] = true
+		}
 	}
 
-	if proxyIP := os.Getenv("TRUSTED_PROXY_IP"); proxyIP != "" {
-		proxies := strings.Split(proxyIP, ",")
+	if cfg.TrustedProxyIP != "" {
+		proxies := strings.Split(cfg.TrustedProxyIP, ",")
 		for _, proxy := range proxies {
 			trimmed := strings.TrimSpace(proxy)
 			if trimmed == "" || seen[trimmed] {
@@ -208,6 +575,63 @@ func validateIPOrCIDR(s string) error {
 	return nil
 }
 
+// requireAllowRules rejects requests while the whitelist has no allow rules,
+// for routes that must never be open to every address.
+func requireAllowRules(wl *ipwhitelist.IPWhitelist) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !wl.HasAllowRules() {
+			logger.Warn.Printf("%s %s refused: the IP whitelist has no rules (from IP: %s)", c.Method(), c.Path(), ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusForbidden, "access denied: IP whitelist required")
+		}
+		return c.Next()
+	}
+}
+
+// stopGRPC lets the calls in flight on srv finish, for up to timeout, and then
+// closes whatever is left. A nil srv (GRPC_PORT unset) is a no-op.
+func stopGRPC(srv *grpc.Server, timeout time.Duration) {
+	if srv == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warn.Println("Shutdown timeout reached with gRPC calls still in flight; abandoning them")
+		srv.Stop()
+	}
+}
+
+// countInFlight keeps n at the number of requests being handled, for the
+// shutdown log.
+func countInFlight(n *atomic.Int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		n.Add(1)
+		defer n.Add(-1)
+		return c.Next()
+	}
+}
+
+// requestID assigns every request an ID for log correlation: a well-formed
+// incoming X-Request-ID is reused (so IDs can span services), anything else is
+// replaced with a fresh UUID. The ID is echoed in the X-Request-ID response
+// header and included in error bodies.
+func requestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validators.IsValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		response.SetRequestID(c, id)
+		c.Set(fiber.HeaderXRequestID, id)
+		return c.Next()
+	}
+}
+
 // customErrorHandler creates a custom error handler.
 func customErrorHandler(isProd bool) fiber.ErrorHandler {
 	return func(c *fiber.Ctx, err error) error {
@@ -216,15 +640,20 @@ func customErrorHandler(isProd bool) fiber.ErrorHandler {
 			code = e.Code
 		}
 
-		logger.Error.Printf("Request error (status %d): %v", code, err)
+		// Oversized bodies are rejected by fasthttp before any middleware
+		// runs; they are the client's fault, not a server error.
+		if code == fiber.StatusRequestEntityTooLarge {
+			logger.Warn.Printf("Rejected oversized request body from IP: %s", ipwhitelist.ClientIP(c))
+			return response.Error(c, code, "request body too large")
+		}
+
+		logger.With("request_id", response.RequestID(c)).Error.Printf("Request error (status %d): %v", code, err)
 
 		message := "Internal Server Error"
 		if !isProd {
 			message = err.Error()
 		}
 
-		return c.Status(code).JSON(fiber.Map{
-			"error": message,
-		})
+		return response.Error(c, code, message)
 	}
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/config"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// swappableHandler is a middleware whose implementation can be replaced at
+// runtime without re-registering routes.
+type swappableHandler struct {
+	current atomic.Pointer[fiber.Handler]
+}
+
+func newSwappableHandler(h fiber.Handler) *swappableHandler {
+	s := &swappableHandler{}
+	s.Swap(h)
+	return s
+}
+
+// Swap replaces the wrapped handler for all subsequent requests.
+func (s *swappableHandler) Swap(h fiber.Handler) {
+	s.current.Store(&h)
+}
+
+// Handler returns the middleware that dispatches to the current handler.
+func (s *swappableHandler) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return (*s.current.Load())(c)
+	}
+}
+
+// reloader re-reads the configuration on SIGHUP and applies the reloadable
+// subset (IP whitelist, rate limits, API keys) in place. Environment variables
+// of a running process cannot change, so in practice this picks up changes to
+// file-backed sources such as CONFIG_FILE and API_KEYS_FILE.
+type reloader struct {
+	mu          sync.Mutex
+	cfg         *config.Config
+	load        func() (*config.Config, error)
+	ipWhitelist *ipwhitelist.IPWhitelist
+	keyStore    *auth.Store
+	limiter     *swappableHandler
+	newLimiter  func(*config.Config) fiber.Handler
+
+	syncLimiter    *swappableHandler
+	newSyncLimiter func(*config.Config) fiber.Handler
+}
+
+// reload loads a fresh configuration and applies what changed. On a load
+// error the running configuration is kept as-is.
+func (r *reloader) reload() {
+	next, err := r.load()
+	if err != nil {
+		logger.Error.Printf("Config reload failed, keeping current configuration: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.cfg
+	warnNonReloadable(prev, next)
+
+	applied := *prev
+	changed := false
+
+	if !slices.Equal(prev.AllowedIPs, next.AllowedIPs) {
+		r.ipWhitelist.SetAllowed(next.AllowedIPs)
+		applied.AllowedIPs = next.AllowedIPs
+		logger.Info.Printf("Reloaded ALLOWED_IPS (%d -> %d entries)", len(prev.AllowedIPs), len(next.AllowedIPs))
+		changed = true
+	}
+
+	// The file is also watched; reloading here just applies a change at once.
+	if next.AllowedIPsFile != "" && next.AllowedIPsFile == prev.AllowedIPsFile {
+		if err := r.ipWhitelist.Reload(); err != nil {
+			logger.Error.Printf("Failed to reload ALLOWED_IPS_FILE: %v", err)
+		}
+	}
+
+	if !slices.Equal(prev.BlockedIPs, next.BlockedIPs) {
+		r.ipWhitelist.SetBlocked(next.BlockedIPs)
+		applied.BlockedIPs = next.BlockedIPs
+		logger.Info.Printf("Reloaded BLOCKED_IPS (%d -> %d entries)", len(prev.BlockedIPs), len(next.BlockedIPs))
+		changed = true
+	}
+
+	if prev.RateLimitMax != next.RateLimitMax || prev.RateLimitWindow != next.RateLimitWindow ||
+		!slices.Equal(prev.RateLimitExempt, next.RateLimitExempt) {
+		applied.RateLimitMax = next.RateLimitMax
+		applied.RateLimitWindow = next.RateLimitWindow
+		applied.RateLimitExempt = next.RateLimitExempt
+		r.limiter.Swap(r.newLimiter(&applied))
+		logger.Info.Printf("Reloaded rate limit (%d/%v -> %d/%v); counters were reset",
+			prev.RateLimitMax, prev.RateLimitWindow, next.RateLimitMax, next.RateLimitWindow)
+		changed = true
+	}
+
+	if prev.SyncRateLimitMax != next.SyncRateLimitMax || prev.RateLimitWindow != next.RateLimitWindow {
+		applied.SyncRateLimitMax = next.SyncRateLimitMax
+		applied.RateLimitWindow = next.RateLimitWindow
+		r.syncLimiter.Swap(r.newSyncLimiter(&applied))
+		logger.Info.Printf("Reloaded sync rate limit (%d/%v -> %d/%v); counters were reset",
+			prev.SyncRateLimitMax, prev.RateLimitWindow, next.SyncRateLimitMax, next.RateLimitWindow)
+		changed = true
+	}
+
+	if !slices.EqualFunc(prev.APIKeys, next.APIKeys, apiKeyEqual) {
+		r.keyStore.Replace(next.APIKeys)
+		applied.APIKeys = next.APIKeys
+		logger.Info.Printf("Reloaded API keys (%d -> %d keys)", len(prev.APIKeys), len(next.APIKeys))
+		changed = true
+	}
+
+	if prev.RedactNames != next.RedactNames {
+		logger.SetRedactNames(next.RedactNames)
+		applied.RedactNames = next.RedactNames
+		logger.Info.Printf("Reloaded REDACT_NAMES (%t -> %t)", prev.RedactNames, next.RedactNames)
+		changed = true
+	}
+
+	if !changed {
+		logger.Info.Println("Config reloaded: no reloadable settings changed")
+	}
+
+	r.cfg = &applied
+}
+
+// warnNonReloadable logs settings that changed but only take effect on restart.
+func warnNonReloadable(prev, next *config.Config) {
+	warn := func(name string, changed bool) {
+		if changed {
+			logger.Warn.Printf("%s changed but cannot be reloaded; restart to apply", name)
+		}
+	}
+	warn("API_PORT", prev.Port != next.Port)
+	warn("GRPC_PORT", prev.GRPCPort != next.GRPCPort)
+	warn("ALLOWED_IPS_FILE", prev.AllowedIPsFile != next.AllowedIPsFile)
+	warn("ALLOW_DYNAMIC_WHITELIST", prev.AllowDynamicWhitelist != next.AllowDynamicWhitelist)
+	warn("DYNAMIC_WHITELIST_MAX_TTL", prev.DynamicWhitelistMaxTTL != next.DynamicWhitelistMaxTTL)
+	warn("ENVIRONMENT", prev.Environment != next.Environment)
+	warn("VAULTWARDEN_URL", prev.VaultwardenURL != next.VaultwardenURL || !slices.Equal(prev.VaultwardenFallbackURLs, next.VaultwardenFallbackURLs))
+	warn("VAULTWARDEN_EMAIL", prev.VaultwardenEmail != next.VaultwardenEmail)
+	warn("VAULTWARDEN_PASSWORD", prev.VaultwardenPassword != next.VaultwardenPassword)
+	warn("VAULTWARDEN_CLIENT_ID", prev.VaultwardenClientID != next.VaultwardenClientID)
+	warn("VAULTWARDEN_CLIENT_SECRET", prev.VaultwardenClientSecret != next.VaultwardenClientSecret)
+	warn("VAULTWARDEN_ACCESS_TOKEN", prev.VaultwardenToken != next.VaultwardenToken)
+	warn("BW_DEVICE_TYPE", prev.DeviceType != next.DeviceType)
+	warn("BW_DEVICE_NAME", prev.DeviceName != next.DeviceName)
+	warn("TOKEN_CACHE_FILE", prev.TokenCacheFile != next.TokenCacheFile)
+	warn("TOKEN_RETRY_ATTEMPTS", prev.TokenRetryAttempts != next.TokenRetryAttempts)
+	warn("TOKEN_RETRY_BASE_DELAY", prev.TokenRetryBaseDelay != next.TokenRetryBaseDelay)
+	warn("SYNC_RETRY_ATTEMPTS", prev.SyncRetryAttempts != next.SyncRetryAttempts)
+	warn("SYNC_RETRY_BASE_DELAY", prev.SyncRetryBaseDelay != next.SyncRetryBaseDelay)
+	warn("MAX_VAULT_ITEMS", prev.MaxVaultItems != next.MaxVaultItems)
+	warn("CIRCUIT_BREAKER_THRESHOLD", prev.CircuitBreakerThreshold != next.CircuitBreakerThreshold)
+	warn("CIRCUIT_BREAKER_COOLDOWN", prev.CircuitBreakerCooldown != next.CircuitBreakerCooldown)
+	warn("PRELOAD_SECRETS", !slices.Equal(prev.PreloadSecrets, next.PreloadSecrets))
+	warn("STARTUP_SELFTEST_SECRET", prev.StartupSelftestSecret != next.StartupSelftestSecret)
+	warn("SYNC_INTERVAL", prev.SyncInterval != next.SyncInterval)
+	warn("CACHE_TTL", prev.CacheTTL != next.CacheTTL)
+	warn("SYNC_BEFORE_FETCH_MAX_AGE", prev.SyncBeforeFetchMaxAge != next.SyncBeforeFetchMaxAge)
+	warn("CACHE_TTL_OVERRIDES", !maps.Equal(prev.CacheTTLOverrides, next.CacheTTLOverrides))
+	warn("SYNC_ON_MISS", prev.SyncOnMiss != next.SyncOnMiss)
+	warn("SYNC_ON_MISS_COOLDOWN", prev.SyncOnMissCooldown != next.SyncOnMissCooldown)
+	warn("STALE_IF_ERROR", prev.StaleIfError != next.StaleIfError)
+	warn("TRUSTED_PROXY_IP", prev.TrustedProxyIP != next.TrustedProxyIP)
+	warn("TRUSTED_PROXIES", !slices.Equal(prev.TrustedProxies, next.TrustedProxies))
+	warn("XFF_INDEX", prev.XFFIndex != next.XFFIndex)
+	warn("HTTP_TIMEOUT", prev.HTTPTimeout != next.HTTPTimeout)
+	warn("HTTP_MAX_IDLE_CONNS", prev.HTTPMaxIdleConns != next.HTTPMaxIdleConns)
+	warn("HTTP_IDLE_CONN_TIMEOUT", prev.HTTPIdleConnTimeout != next.HTTPIdleConnTimeout)
+	warn("VAULTWARDEN_CERT_PIN", !slices.Equal(prev.CertPins, next.CertPins))
+	warn("VAULTWARDEN_INSECURE_TLS", prev.InsecureTLS != next.InsecureTLS)
+	warn("VAULTWARDEN_CLIENT_CERT", prev.ClientCertFile != next.ClientCertFile)
+	warn("VAULTWARDEN_CLIENT_KEY", prev.ClientKeyFile != next.ClientKeyFile)
+	warn("READ_TIMEOUT", prev.ReadTimeout != next.ReadTimeout)
+	warn("WRITE_TIMEOUT", prev.WriteTimeout != next.WriteTimeout)
+	warn("MAX_BODY_SIZE", prev.MaxBodySize != next.MaxBodySize)
+	warn("SHUTDOWN_TIMEOUT", prev.ShutdownTimeout != next.ShutdownTimeout)
+	warn("HEALTH_VERBOSE", prev.HealthVerbose != next.HealthVerbose)
+	warn("API_KEY_HEADER", prev.APIKeyHeader != next.APIKeyHeader)
+	warn("CORS_ALLOWED_ORIGINS", prev.CORSAllowedOrigins != next.CORSAllowedOrigins)
+	warn("CORS_ALLOWED_METHODS", prev.CORSAllowedMethods != next.CORSAllowedMethods)
+	warn("CORS_ALLOWED_HEADERS", prev.CORSAllowedHeaders != next.CORSAllowedHeaders)
+	warn("ENABLE_GITHUB_IP_RANGES", prev.EnableGitHubIPRanges != next.EnableGitHubIPRanges)
+	warn("GITHUB_IP_RANGE_TYPES", !slices.Equal(prev.GitHubIPRangeTypes, next.GitHubIPRangeTypes))
+	warn("IP_RANGE_STARTUP_JITTER", prev.IPRangeStartupJitter != next.IPRangeStartupJitter)
+	warn("IP_RANGE_REFRESH_JITTER", prev.IPRangeRefreshJitter != next.IPRangeRefreshJitter)
+	warn("IP_RANGE_PROVIDERS", !slices.EqualFunc(prev.IPRangeProviders, next.IPRangeProviders, func(a, b ipwhitelist.RangeProvider) bool {
+		return a.Name == b.Name && a.URL == b.URL && slices.Equal(a.Selectors, b.Selectors)
+	}))
+	warn("NAME_MATCH", prev.NameMatch != next.NameMatch)
+	warn("EXTRACTION_ORDER", !slices.Equal(prev.ExtractionOrder, next.ExtractionOrder))
+	warn("SECRET_FIELD_NAMES", !slices.Equal(prev.SecretFieldNames, next.SecretFieldNames))
+	warn("EXCLUDE_TRASHED", prev.ExcludeTrashed != next.ExcludeTrashed)
+	warn("SECRET_SIZE_WARN_BYTES", prev.SecretSizeWarnBytes != next.SecretSizeWarnBytes)
+	warn("RESPONSE_ENVELOPE", prev.ResponseEnvelope != next.ResponseEnvelope)
+	warn("ALLOW_WRITES", prev.AllowWrites != next.AllowWrites)
+	warn("ALLOW_EXPORT", prev.AllowExport != next.AllowExport)
+	warn("ROUTE_AUTH", !maps.Equal(prev.RouteAuth, next.RouteAuth))
+	warn("HEADER_GUARD", prev.HeaderGuard != next.HeaderGuard)
+	warn("HEADER_MAX_BYTES", prev.HeaderMaxBytes != next.HeaderMaxBytes)
+	warn("BLOCKED_USER_AGENTS", !slices.Equal(prev.BlockedUserAgents, next.BlockedUserAgents))
+	warn("WEBHOOK_URL", prev.WebhookURL != next.WebhookURL)
+	warn("AUDIT_LOG", prev.AuditLog != next.AuditLog)
+	warn("RESPONSE_ENCRYPTION_KEY", !bytes.Equal(prev.ResponseEncryptionKey, next.ResponseEncryptionKey))
+	warn("TOKEN_SIGNING_KEY", !bytes.Equal(prev.TokenSigningKey, next.TokenSigningKey))
+	warn("TOKEN_MAX_TTL", prev.TokenMaxTTL != next.TokenMaxTTL)
+	warn("METRICS_ENABLED", prev.MetricsEnabled != next.MetricsEnabled)
+	warn("METRICS_IP_WHITELIST", prev.MetricsIPWhitelist != next.MetricsIPWhitelist)
+}
+
+// apiKeyEqual reports whether two configured keys are identical, including scope
+// and admin flag.
+func apiKeyEqual(a, b auth.APIKey) bool {
+	return a.Name == b.Name &&
+		a.Key == b.Key &&
+		a.Admin == b.Admin &&
+		slices.Equal(a.Scope.Organizations, b.Scope.Organizations) &&
+		slices.Equal(a.Scope.Collections, b.Scope.Collections)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/config"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReloadSwapsSyncLimiter(t *testing.T) {
+	noop := func(c *fiber.Ctx) error { return c.Next() }
+	cfg := &config.Config{SyncRateLimitMax: 2}
+	next := *cfg
+	next.SyncRateLimitMax = 5
+
+	var built []int
+	r := &reloader{
+		cfg:         cfg,
+		load:        func() (*config.Config, error) { return &next, nil },
+		limiter:     newSwappableHandler(noop),
+		syncLimiter: newSwappableHandler(noop),
+		newLimiter: func(*config.Config) fiber.Handler {
+			t.Error("main limiter rebuilt although its settings did not change")
+			return noop
+		},
+		newSyncLimiter: func(c *config.Config) fiber.Handler {
+			built = append(built, c.SyncRateLimitMax)
+			return noop
+		},
+	}
+
+	r.reload()
+	if len(built) != 1 || built[0] != 5 {
+		t.Fatalf("sync limiter rebuilt with %v, want [5]", built)
+	}
+	if r.cfg.SyncRateLimitMax != 5 {
+		t.Errorf("applied SYNC_RATE_LIMIT_MAX = %d, want 5", r.cfg.SyncRateLimitMax)
+	}
+
+	r.reload()
+	if len(built) != 1 {
+		t.Errorf("sync limiter rebuilt again without a change: %v", built)
+	}
+}
+
+func TestWarnNonReloadable(t *testing.T) {
+	var logs bytes.Buffer
+	prev := logger.Warn.Writer()
+	logger.Warn.SetOutput(&logs)
+	defer logger.Warn.SetOutput(prev)
+
+	tests := map[string]func(*config.Config){
+		"CACHE_TTL":                 func(c *config.Config) { c.CacheTTL = time.Minute },
+		"SYNC_BEFORE_FETCH_MAX_AGE": func(c *config.Config) { c.SyncBeforeFetchMaxAge = time.Minute },
+		"CACHE_TTL_OVERRIDES":       func(c *config.Config) { c.CacheTTLOverrides = map[string]time.Duration{"db": 0} },
+		"RESPONSE_ENVELOPE":         func(c *config.Config) { c.ResponseEnvelope = true },
+		"EXCLUDE_TRASHED":           func(c *config.Config) { c.ExcludeTrashed = true },
+		"SECRET_FIELD_NAMES":        func(c *config.Config) { c.SecretFieldNames = []string{"token"} },
+		"SECRET_SIZE_WARN_BYTES":    func(c *config.Config) { c.SecretSizeWarnBytes = 1 },
+		"VAULTWARDEN_ACCESS_TOKEN":  func(c *config.Config) { c.VaultwardenToken = "t" },
+		"GRPC_PORT":                 func(c *config.Config) { c.GRPCPort = "9090" },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			logs.Reset()
+			next := config.Config{}
+			change(&next)
+			warnNonReloadable(&config.Config{}, &next)
+			if !strings.Contains(logs.String(), name+" changed but cannot be reloaded") {
+				t.Errorf("no warning for %s: %q", name, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// routeRegistry wires routes with the middleware chain for their auth tier.
+// Every route passes the IP whitelist and rate limiter; the configured policy
+// decides whether an API key (and an admin key) is also required.
+type routeRegistry struct {
+	app     *fiber.App
+	policy  auth.RoutePolicy
+	guard   []fiber.Handler // IP whitelist + rate limiter, in that order
+	authMid fiber.Handler
+	// tokenMid accepts signed tokens on routes added with addTokenRoute (nil
+	// when TOKEN_SIGNING_KEY is not set).
+	tokenMid fiber.Handler
+	// routes records what was registered, for validate.
+	routes map[string]registeredRoute
+}
+
+// registeredRoute is what validate needs to know about a registered route.
+type registeredRoute struct {
+	defaultTier auth.Tier
+	private     bool // the policy may not make it public
+}
+
+// add registers a route. defaultTier applies unless the policy overrides it.
+// handlers run after authentication, so route-specific middleware such as an
+// extra rate limit can come before the handler itself.
+func (r *routeRegistry) add(method, path string, defaultTier auth.Tier, handlers ...fiber.Handler) {
+	r.register(method, path, defaultTier, false, false, handlers)
+}
+
+// addTokenRoute is add for a route that also accepts a signed ?token= instead
+// of an API key. Tokens only stand in for the key tier, never for admin.
+func (r *routeRegistry) addTokenRoute(method, path string, defaultTier auth.Tier, handlers ...fiber.Handler) {
+	r.register(method, path, defaultTier, true, false, handlers)
+}
+
+// addPrivate is add for a route that must always require a key, whatever the
+// policy says, such as one that mints credentials. Admin-tier routes are
+// private anyway.
+func (r *routeRegistry) addPrivate(method, path string, defaultTier auth.Tier, handlers ...fiber.Handler) {
+	r.register(method, path, defaultTier, false, true, handlers)
+}
+
+func (r *routeRegistry) register(method, path string, defaultTier auth.Tier, tokens, private bool, handlers []fiber.Handler) {
+	if r.routes == nil {
+		r.routes = make(map[string]registeredRoute)
+	}
+	r.routes[auth.RouteKey(method, path)] = registeredRoute{
+		defaultTier: defaultTier,
+		private:     private || defaultTier == auth.TierAdmin,
+	}
+
+	tier := r.policy.TierFor(method, path, defaultTier)
+	if tier != defaultTier {
+		logger.Info.Printf("Route %s requires %q auth (default %q)", auth.RouteKey(method, path), tier, defaultTier)
+	}
+
+	chain := append([]fiber.Handler{}, r.guard...)
+	switch tier {
+	case auth.TierKey:
+		if tokens && r.tokenMid != nil {
+			chain = append(chain, r.tokenMid)
+		}
+		chain = append(chain, r.authMid)
+	case auth.TierAdmin:
+		chain = append(chain, r.authMid, auth.RequireAdmin())
+	}
+	chain = append(chain, handlers...)
+
+	r.app.Add(method, path, chain...)
+}
+
+// validate checks the policy against the registered routes once they are all
+// added: every entry must name a registered route, so a typo cannot silently
+// leave the default in place, and private routes cannot be made public.
+func (r *routeRegistry) validate() error {
+	for _, key := range slices.Sorted(maps.Keys(r.policy)) {
+		route, ok := r.routes[key]
+		if !ok {
+			return fmt.Errorf("%q matches no route (check the endpoint table; some routes only exist when their feature is enabled)", key)
+		}
+		if r.policy[key] == auth.TierPublic && route.private {
+			return fmt.Errorf("%q cannot be made public (default tier %q)", key, route.defaultTier)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/config"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestRouteGuardOrder checks that the IP whitelist runs before the rate
+// limiter and authentication: a blocked address is refused without using up
+// rate limit budget or being reported as an auth failure.
+func TestRouteGuardOrder(t *testing.T) {
+	const key = "route-order-test-key-000000000000000000000"
+	keyStore := auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})
+
+	// app.Test connections come from 0.0.0.0, outside this whitelist.
+	wl, err := ipwhitelist.New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One request per window; the exemption keeps whitelisted callers counted.
+	cfg := &config.Config{RateLimitMax: 1, RateLimitWindow: time.Minute, RateLimitExempt: []string{"192.0.2.0/24"}}
+
+	authFailures := 0
+	app := fiber.New()
+	routes := &routeRegistry{
+		app:   app,
+		guard: []fiber.Handler{wl.Middleware(), newRateLimiter(cfg, wl, keyStore)},
+		authMid: auth.Middleware(keyStore, auth.WithFailureHook(func(*fiber.Ctx, string, string) {
+			authFailures++
+		})),
+	}
+	routes.add(fiber.MethodGet, "/secret/:name", auth.TierKey, func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	get := func(t *testing.T, apiKey string) int {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secret/db-password", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for range 3 {
+		if status := get(t, "wrong-key"); status != http.StatusForbidden {
+			t.Fatalf("non-whitelisted request: status = %d, want 403", status)
+		}
+		if status := get(t, key); status != http.StatusForbidden {
+			t.Fatalf("non-whitelisted request with a valid key: status = %d, want 403", status)
+		}
+	}
+	if authFailures != 0 {
+		t.Errorf("blocked requests reached authentication (%d failures reported)", authFailures)
+	}
+
+	wl.SetAllowed([]string{"0.0.0.0"})
+	if status := get(t, key); status != http.StatusOK {
+		t.Fatalf("first whitelisted request: status = %d, want 200 (blocked requests used up the budget?)", status)
+	}
+	if status := get(t, key); status != http.StatusTooManyRequests {
+		t.Errorf("second whitelisted request: status = %d, want 429", status)
+	}
+	if status := get(t, "wrong-key"); status != http.StatusUnauthorized || authFailures != 1 {
+		t.Errorf("whitelisted request with a wrong key: status = %d, %d failures reported; want 401 and 1", status, authFailures)
+	}
+
+	// Without allow rules the whitelist lets every address through, here to
+	// the rate limiter, whose budget for this address the wrong key just spent.
+	wl.SetAllowed(nil)
+	if status := get(t, "another-wrong-key"); status != http.StatusTooManyRequests {
+		t.Errorf("request with no allow rules: status = %d, want 429", status)
+	}
+}
+
+func TestRouteRegistryValidate(t *testing.T) {
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	newRoutes := func(policy auth.RoutePolicy) *routeRegistry {
+		r := &routeRegistry{app: fiber.New(), policy: policy, authMid: ok}
+		r.add(fiber.MethodGet, "/secrets", auth.TierKey, ok)
+		r.add(fiber.MethodGet, "/version", auth.TierPublic, ok)
+		r.addPrivate(fiber.MethodPost, "/token", auth.TierKey, ok)
+		r.add(fiber.MethodGet, "/export", auth.TierAdmin, ok)
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		policy  auth.RoutePolicy
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"tighten", auth.RoutePolicy{"GET /secrets": auth.TierAdmin, "GET /version": auth.TierKey}, false},
+		{"loosen key route", auth.RoutePolicy{"GET /secrets": auth.TierPublic}, false},
+		{"unknown route", auth.RoutePolicy{"GET /secret": auth.TierAdmin}, true},
+		{"unknown method", auth.RoutePolicy{"POST /secrets": auth.TierAdmin}, true},
+		{"public token route", auth.RoutePolicy{"POST /token": auth.TierPublic}, true},
+		{"public admin route", auth.RoutePolicy{"GET /export": auth.TierPublic}, true},
+		{"admin route down to key", auth.RoutePolicy{"GET /export": auth.TierKey}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newRoutes(tt.policy).validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
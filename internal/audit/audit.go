@@ -0,0 +1,182 @@
+// Package audit records who accessed which secret and whether it was served,
+// and who changed the IP whitelist at runtime, without ever recording values
+// or blocking the request path.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// queueSize bounds the events waiting to be written; when the sink falls this
+// far behind, further events are dropped with a warning rather than slowing
+// responses down.
+const queueSize = 1024
+
+// Outcomes of a secret access.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeDeleted  = "deleted"
+	OutcomeError    = "error"
+)
+
+// Kinds of event.
+const (
+	KindSecretAccess = "secret_access"
+	KindSecretWrite  = "secret_write"
+	KindWhitelist    = "whitelist"
+)
+
+// Outcomes of a whitelist change.
+const (
+	OutcomeAdded   = "added"
+	OutcomeRemoved = "removed"
+	OutcomeExpired = "expired"
+)
+
+// Event is one secret access, secret write or whitelist change. It never carries the
+// secret value.
+type Event struct {
+	// Kind is "secret_access" (the default), "secret_write" or "whitelist", so audit lines are
+	// easy to tell apart from application logs when both go to stdout.
+	Kind      string    `json:"audit"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+	// KeyName is the name of the API key used (never the key itself).
+	KeyName  string `json:"key,omitempty"`
+	ClientIP string `json:"client_ip"`
+	Route    string `json:"route"`
+	Secret   string `json:"secret,omitempty"`
+	Field    string `json:"field,omitempty"`
+	// Entry and Expires describe a whitelist change.
+	Entry   string     `json:"entry,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Outcome string     `json:"outcome"`
+}
+
+// Sink stores audit events. Write is called from a single goroutine.
+type Sink interface {
+	Write(ev Event) error
+}
+
+// WriterSink writes one JSON object per line to an io.Writer.
+type WriterSink struct {
+	enc *json.Encoder
+	c   io.Closer // closed by Close when the sink owns the writer
+}
+
+// NewWriterSink returns a sink writing JSON lines to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+// OpenFile returns a sink appending JSON lines to path, creating it (mode
+// 0600) if needed. The file is never truncated.
+func OpenFile(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{enc: json.NewEncoder(f), c: f}, nil
+}
+
+// Write implements Sink.
+func (s *WriterSink) Write(ev Event) error {
+	return s.enc.Encode(ev)
+}
+
+// Close closes the underlying file, if the sink opened it.
+func (s *WriterSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
+
+// Logger queues events and writes them to a sink in the background. A nil
+// Logger drops every event, so callers need not check whether auditing is on.
+type Logger struct {
+	sink  Sink
+	queue chan Event
+	done  chan struct{}
+
+	mu     sync.RWMutex // guards closed against sends on the closed queue
+	closed bool
+}
+
+// New starts a logger writing to sink, or returns nil when sink is nil.
+func New(sink Sink) *Logger {
+	if sink == nil {
+		return nil
+	}
+	l := &Logger{
+		sink:  sink,
+		queue: make(chan Event, queueSize),
+		done:  make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Record queues ev for writing. It never blocks: when the queue is full the
+// event is dropped with a warning.
+func (l *Logger) Record(ev Event) {
+	if l == nil {
+		return
+	}
+	if ev.Kind == "" {
+		ev.Kind = KindSecretAccess
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now().UTC()
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.queue <- ev:
+	default:
+		logger.Warn.Printf("Audit event dropped (queue full): %s %s", ev.Route, ev.Outcome)
+	}
+}
+
+// Close writes the queued events, stops the logger and closes the sink if it
+// is an io.Closer. Events recorded after Close are dropped.
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	if c, ok := l.sink.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logger.Warn.Printf("Close audit sink: %v", err)
+		}
+	}
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for ev := range l.queue {
+		if err := l.sink.Write(ev); err != nil {
+			logger.Error.Printf("Audit write failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoggerWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	l := New(sink)
+	l.Record(Event{KeyName: "ci", ClientIP: "203.0.113.7", Route: "GET /secret/:name", Secret: "db-password", Outcome: OutcomeSuccess})
+	l.Record(Event{KeyName: "ci", ClientIP: "203.0.113.7", Route: "GET /secret/:name", Secret: "typo", Outcome: OutcomeNotFound})
+	l.Close()
+	l.Close()                              // idempotent
+	l.Record(Event{Secret: "after-close"}) // dropped, must not panic
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, ev)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if got[0].Kind != "secret_access" || got[0].Timestamp.IsZero() || got[0].Secret != "db-password" || got[1].Outcome != OutcomeNotFound {
+		t.Errorf("events = %+v", got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("audit file mode = %o, want 600", perm)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Record(Event{Secret: "x"})
+	l.Close()
+	if New(nil) != nil {
+		t.Error("New(nil) should return a nil logger")
+	}
+}
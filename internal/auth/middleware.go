@@ -4,7 +4,11 @@ package auth
 import (
 	"crypto/subtle"
 	"strings"
+	"sync"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 )
@@ -23,26 +27,60 @@ func (s Scope) IsEmpty() bool {
 }
 
 // APIKey is a single configured key with its server-side scope.
+// Admin keys may additionally call routes that require the admin tier.
 type APIKey struct {
 	Name  string
 	Key   string
 	Scope Scope
+	Admin bool
 }
 
 // Store holds the configured API keys and resolves a presented key to its scope.
 type Store struct {
+	mu   sync.RWMutex
 	keys []APIKey
+
+	// keyHeader is an extra request header carrying the bare key ("" disables).
+	keyHeader string
+}
+
+// StoreOption configures NewStore.
+type StoreOption func(*Store)
+
+// WithKeyHeader also accepts the key as the bare value of the named header
+// (e.g. X-API-Key), for proxies that strip or rewrite Authorization. A Bearer
+// Authorization header takes precedence when both are present; the header is
+// only consulted when Authorization is missing or not a Bearer credential.
+func WithKeyHeader(name string) StoreOption {
+	return func(s *Store) {
+		s.keyHeader = name
+	}
 }
 
 // NewStore builds a key store from the configured keys.
-func NewStore(keys []APIKey) *Store {
-	return &Store{keys: keys}
+func NewStore(keys []APIKey, opts ...StoreOption) *Store {
+	s := &Store{keys: keys}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Replace atomically swaps the configured keys (e.g. on a config reload).
+// Requests already past authentication are unaffected.
+func (s *Store) Replace(keys []APIKey) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
 }
 
 // Match returns the configured key matching the presented secret, if any.
 // It compares against every key without short-circuiting so that timing does
 // not reveal a key's position in the list.
 func (s *Store) Match(provided string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	var matched APIKey
 	found := false
 	for _, k := range s.keys {
@@ -54,10 +92,47 @@ func (s *Store) Match(provided string) (APIKey, bool) {
 	return matched, found
 }
 
-// ctxKey is the unexported type for the scope stored in the request context.
-type ctxKey struct{}
+// Identify returns the configured key presented in the request, if any,
+// without rejecting anything. It lets middleware running before
+// authentication (the rate limiter) tell callers apart; Middleware still
+// decides whether the request is let through.
+func (s *Store) Identify(c *fiber.Ctx) (APIKey, bool) {
+	provided, reason := s.presentedKey(c)
+	if reason != "" {
+		return APIKey{}, false
+	}
+	key, ok := s.Match(provided)
+	key.Key = ""
+	return key, ok
+}
 
-var scopeKey ctxKey
+// presentedKey returns the key sent as "Authorization: Bearer <key>" or, when
+// that is absent and WithKeyHeader is set, as the custom header. Otherwise it
+// returns the failure reason: missing_header or invalid_format.
+func (s *Store) presentedKey(c *fiber.Ctx) (key, reason string) {
+	authHeader := c.Get("Authorization")
+	scheme, provided, ok := strings.Cut(authHeader, " ")
+	if ok && strings.EqualFold(scheme, "bearer") {
+		return provided, ""
+	}
+	if s.keyHeader != "" {
+		if provided := c.Get(s.keyHeader); provided != "" {
+			return provided, ""
+		}
+	}
+	if authHeader == "" {
+		return "", "missing_header"
+	}
+	return "", "invalid_format"
+}
+
+// ctxKey is the unexported type for values stored in the request context.
+type ctxKey int
+
+const (
+	scopeKey ctxKey = iota
+	identityKey
+)
 
 // ScopeFromCtx returns the authenticated key's scope from the request context.
 func ScopeFromCtx(c *fiber.Ctx) (Scope, bool) {
@@ -65,40 +140,75 @@ func ScopeFromCtx(c *fiber.Ctx) (Scope, bool) {
 	return scope, ok
 }
 
+// KeyFromCtx returns the authenticated key from the request context. The key
+// material itself is blanked; only the name, scope and admin flag are kept.
+func KeyFromCtx(c *fiber.Ctx) (APIKey, bool) {
+	key, ok := c.Locals(identityKey).(APIKey)
+	return key, ok
+}
+
+// FailureHook is called whenever Middleware rejects a request, with the
+// metrics reason (missing_header, invalid_format, invalid_key) and the
+// presented key, which is empty unless the reason is invalid_key. Hooks must
+// not block and must never log or forward the key as-is.
+type FailureHook func(c *fiber.Ctx, reason, providedKey string)
+
+// MiddlewareOption configures Middleware.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	onFailure FailureHook
+}
+
+// WithFailureHook registers a hook called for every rejected request.
+func WithFailureHook(hook FailureHook) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.onFailure = hook
+	}
+}
+
 // Middleware creates an authentication middleware that validates the bearer
-// API key against the store and attaches the matched key's scope to the context.
-func Middleware(store *Store) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// Get the Authorization header
-		authHeader := c.Get("Authorization")
+// API key (or the WithKeyHeader header) against the store and attaches the matched key's scope to the context.
+// Requests already authenticated by SignedToken pass through.
+func Middleware(store *Store, opts ...MiddlewareOption) fiber.Handler {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
-		if authHeader == "" {
-			logger.Warn.Println("Missing Authorization header")
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "missing authorization header",
-			})
+	reject := func(c *fiber.Ctx, reason, providedKey, message string) error {
+		metrics.AuthFailures.WithLabelValues(reason).Inc()
+		if cfg.onFailure != nil {
+			cfg.onFailure(c, reason, providedKey)
 		}
+		return response.Error(c, fiber.StatusUnauthorized, message)
+	}
 
-		// Expected format: "Bearer <API_KEY>"
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			logger.Warn.Println("Invalid Authorization header format")
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "invalid authorization header format",
-			})
+	return func(c *fiber.Ctx) error {
+		if _, ok := KeyFromCtx(c); ok {
+			return c.Next()
 		}
 
-		providedKey := parts[1]
+		// Expected format: "Bearer <API_KEY>", or the key header when enabled.
+		providedKey, reason := store.presentedKey(c)
+		switch reason {
+		case "missing_header":
+			logger.Warn.Println("Missing Authorization header")
+			return reject(c, reason, "", "missing authorization header")
+		case "invalid_format":
+			logger.Warn.Println("Invalid Authorization header format")
+			return reject(c, reason, "", "invalid authorization header format")
+		}
 
 		key, ok := store.Match(providedKey)
 		if !ok {
-			logger.Warn.Printf("Invalid API key from IP: %s", c.IP())
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "invalid api key",
-			})
+			logger.Warn.Printf("Invalid API key from IP: %s", ipwhitelist.ClientIP(c))
+			return reject(c, "invalid_key", providedKey, "invalid api key")
 		}
 
 		c.Locals(scopeKey, key.Scope)
+		key.Key = ""
+		c.Locals(identityKey, key)
 
 		// Authentication successful
 		return c.Next()
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Tier is the authentication level a route requires.
+type Tier string
+
+const (
+	// TierPublic requires no API key (the IP whitelist and rate limit still apply).
+	TierPublic Tier = "public"
+	// TierKey requires any valid API key.
+	TierKey Tier = "key"
+	// TierAdmin requires a valid API key flagged as admin.
+	TierAdmin Tier = "admin"
+)
+
+// ParseTier parses a tier name (public, key, admin).
+func ParseTier(s string) (Tier, error) {
+	switch t := Tier(strings.ToLower(strings.TrimSpace(s))); t {
+	case TierPublic, TierKey, TierAdmin:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown auth tier %q (use public, key or admin)", s)
+}
+
+// RoutePolicy maps a route ("METHOD /path", e.g. "GET /secrets") to the tier it
+// requires. Routes not in the policy keep the default tier they were registered with.
+type RoutePolicy map[string]Tier
+
+// RouteKey builds the policy key for a route.
+func RouteKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// TierFor returns the configured tier for a route, or fallback if not configured.
+func (p RoutePolicy) TierFor(method, path string, fallback Tier) Tier {
+	if t, ok := p[RouteKey(method, path)]; ok {
+		return t
+	}
+	return fallback
+}
+
+// RequireAdmin rejects requests whose authenticated key is not an admin key.
+// It must run after Middleware.
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, ok := KeyFromCtx(c)
+		if !ok || !key.Admin {
+			logger.Warn.Printf("Non-admin key denied on %s %s from IP: %s", c.Method(), c.Path(), ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusForbidden, "admin key required")
+		}
+		return c.Next()
+	}
+}
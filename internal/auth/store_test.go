@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/valyala/fasthttp"
 )
@@ -69,6 +71,21 @@ func TestStoreMatchEmptyStore(t *testing.T) {
 	}
 }
 
+func TestStoreReplace(t *testing.T) {
+	t.Parallel()
+
+	store := testStore()
+	store.Replace([]APIKey{{Name: "rotated", Key: keyScoped}})
+
+	if _, ok := store.Match(keyFull); ok {
+		t.Error("replaced key should no longer match")
+	}
+	got, ok := store.Match(keyScoped)
+	if !ok || got.Name != "rotated" {
+		t.Errorf("Match after Replace = (%+v, %v), want rotated key", got, ok)
+	}
+}
+
 func TestScopeIsEmpty(t *testing.T) {
 	t.Parallel()
 	if !(Scope{}).IsEmpty() {
@@ -134,6 +151,185 @@ func TestMiddleware(t *testing.T) {
 	}
 }
 
+func TestMiddlewareKeyHeader(t *testing.T) {
+	t.Parallel()
+
+	store := NewStore(testStore().keys, WithKeyHeader("X-API-Key"))
+	app := fiber.New()
+	app.Use(Middleware(store))
+	app.Get("/", func(c *fiber.Ctx) error {
+		key, _ := KeyFromCtx(c)
+		return c.SendString(key.Name)
+	})
+
+	tests := []struct {
+		name       string
+		authHeader string
+		keyHeader  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"key header only", "", keyScoped, http.StatusOK, "dev"},
+		{"bearer wins over key header", "Bearer " + keyFull, keyScoped, http.StatusOK, "full"},
+		{"invalid bearer is not retried with key header", "Bearer wrong-key", keyFull, http.StatusUnauthorized, "invalid api key"},
+		{"non-bearer authorization falls back", "Basic dXNlcjpwdw==", keyScoped, http.StatusOK, "dev"},
+		{"unknown key in header", "", "wrong-key", http.StatusUnauthorized, "invalid api key"},
+		{"neither", "", "", http.StatusUnauthorized, "missing authorization header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			if tt.keyHeader != "" {
+				req.Header.Set("X-API-Key", tt.keyHeader)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("got %d %q, want %d with %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	// Without WithKeyHeader the header is ignored.
+	plain := fiber.New()
+	plain.Use(Middleware(testStore()))
+	plain.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", keyFull)
+	resp, err := plain.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d without WithKeyHeader, want 401", resp.StatusCode)
+	}
+}
+
+func TestMiddlewareFailureHook(t *testing.T) {
+	t.Parallel()
+
+	type failure struct{ reason, key string }
+	var got []failure
+	app := fiber.New()
+	app.Use(Middleware(testStore(), WithFailureHook(func(_ *fiber.Ctx, reason, providedKey string) {
+		got = append(got, failure{reason, providedKey})
+	})))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	for _, header := range []string{"", "Token abc", "Bearer wrong-key", "Bearer " + keyFull} {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	want := []failure{{"missing_header", ""}, {"invalid_format", ""}, {"invalid_key", "wrong-key"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hook calls = %v, want %v", got, want)
+	}
+}
+
+func TestMiddlewareLogsResolvedClientIP(t *testing.T) {
+	var logs bytes.Buffer
+	prev := logger.Warn.Writer()
+	logger.Warn.SetOutput(&logs)
+	defer logger.Warn.SetOutput(prev)
+
+	// With ProxyHeader set, Fiber's c.IP() is whatever the client put in
+	// X-Forwarded-For; the log must carry the address the server resolved.
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Use(Middleware(testStore()))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer wrong-key")
+	req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.66")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	resp.Body.Close()
+
+	if out := logs.String(); !strings.Contains(out, "Invalid API key from IP: 0.0.0.0") || strings.Contains(out, "203.0.113.66") {
+		t.Errorf("log = %q, want the socket address, not the forwarded one", out)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Parallel()
+
+	const keyAdmin = "admin-key-2222222222222222222222222222222"
+	store := NewStore([]APIKey{
+		{Name: "full", Key: keyFull},
+		{Name: "ops", Key: keyAdmin, Admin: true},
+	})
+
+	app := fiber.New()
+	app.Get("/admin", Middleware(store), RequireAdmin(), func(c *fiber.Ctx) error {
+		key, _ := KeyFromCtx(c)
+		if key.Key != "" {
+			return c.Status(fiber.StatusInternalServerError).SendString("key material leaked into context")
+		}
+		return c.SendString(key.Name)
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"admin key allowed", keyAdmin, http.StatusOK, "ops"},
+		{"non-admin key forbidden", keyFull, http.StatusForbidden, "admin key required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %q, want substring %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRoutePolicyTierFor(t *testing.T) {
+	t.Parallel()
+
+	policy := RoutePolicy{RouteKey("get", "/secrets"): TierAdmin}
+	if got := policy.TierFor("GET", "/secrets", TierKey); got != TierAdmin {
+		t.Errorf("configured route tier = %q, want admin", got)
+	}
+	if got := policy.TierFor("GET", "/secret/:name", TierKey); got != TierKey {
+		t.Errorf("unconfigured route tier = %q, want fallback key", got)
+	}
+}
+
 func TestScopeFromCtxAbsent(t *testing.T) {
 	t.Parallel()
 	app := fiber.New()
@@ -143,3 +339,49 @@ func TestScopeFromCtxAbsent(t *testing.T) {
 		t.Error("ScopeFromCtx should report false when no scope set")
 	}
 }
+
+func TestStoreIdentify(t *testing.T) {
+	t.Parallel()
+
+	store := testStore()
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		key, ok := store.Identify(c)
+		if !ok {
+			return c.SendString("anonymous")
+		}
+		if key.Key != "" {
+			return c.Status(fiber.StatusInternalServerError).SendString("key material leaked")
+		}
+		return c.SendString(key.Name)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"missing header", "", "anonymous"},
+		{"malformed header", "Token " + keyFull, "anonymous"},
+		{"unknown key", "Bearer wrong-key", "anonymous"},
+		{"known key", "bearer " + keyFull, "full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TokenKeyName is the key name reported (in the audit log, for example) for
+// requests authenticated with a signed token instead of an API key.
+const TokenKeyName = "signed-token"
+
+// Token errors returned by TokenSigner.Verify.
+var (
+	ErrTokenMalformed = errors.New("malformed token")
+	ErrTokenExpired   = errors.New("token expired")
+	ErrTokenScope     = errors.New("token not valid for this secret")
+)
+
+// Token grants read access to one secret until Exp (Unix seconds). Sig is the
+// HMAC-SHA256 of the secret name and expiry, base64url without padding.
+type Token struct {
+	Secret string `json:"secret"`
+	Exp    int64  `json:"exp"`
+	Sig    string `json:"sig"`
+}
+
+// String returns the value passed as ?token=: the expiry and signature. The
+// secret is not part of it, since the request path already names it.
+func (t Token) String() string {
+	return strconv.FormatInt(t.Exp, 10) + "." + t.Sig
+}
+
+// TokenSigner issues and verifies signed tokens.
+type TokenSigner struct {
+	key []byte
+}
+
+// NewTokenSigner returns a signer using key as the HMAC key.
+func NewTokenSigner(key []byte) *TokenSigner {
+	return &TokenSigner{key: key}
+}
+
+// Issue returns a token for secret that expires after ttl.
+func (s *TokenSigner) Issue(secret string, ttl time.Duration) Token {
+	exp := time.Now().Add(ttl).Unix()
+	return Token{Secret: secret, Exp: exp, Sig: s.sign(secret, exp)}
+}
+
+// Verify checks a ?token= value against the requested secret. A token signed
+// for any other secret fails the signature check and returns ErrTokenScope.
+func (s *TokenSigner) Verify(token, secret string) error {
+	rawExp, sig, ok := strings.Cut(token, ".")
+	exp, err := strconv.ParseInt(rawExp, 10, 64)
+	if !ok || err != nil || sig == "" {
+		return ErrTokenMalformed
+	}
+	if time.Now().Unix() >= exp {
+		return ErrTokenExpired
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(secret, exp))) {
+		return ErrTokenScope
+	}
+	return nil
+}
+
+func (s *TokenSigner) sign(secret string, exp int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("secret-token\x00" + secret + "\x00" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedToken authenticates requests carrying ?token= for the :name route
+// parameter, answering 403 for an invalid, expired or wrong-secret token.
+// Requests without the parameter pass through untouched, so Middleware after
+// it still accepts API keys; on success Middleware is skipped.
+func SignedToken(signer *TokenSigner) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token == "" {
+			return c.Next()
+		}
+
+		// Valid secret names never contain '%', so one pass decodes them the
+		// way the handler does.
+		err := ErrTokenScope
+		if name, uerr := url.PathUnescape(c.Params("name")); uerr == nil {
+			err = signer.Verify(token, strings.TrimSpace(name))
+		}
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues("invalid_token").Inc()
+			logger.Warn.Printf("Rejected signed token (%v) from IP: %s", err, ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusForbidden, err.Error())
+		}
+
+		c.Locals(scopeKey, Scope{})
+		c.Locals(identityKey, APIKey{Name: TokenKeyName})
+		return c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTokenSignerVerify(t *testing.T) {
+	t.Parallel()
+
+	signer := NewTokenSigner([]byte("0123456789abcdef0123456789abcdef"))
+	valid := signer.Issue("db-password", time.Minute)
+	expired := signer.Issue("db-password", -time.Second)
+	other := NewTokenSigner([]byte("fedcba9876543210fedcba9876543210")).Issue("db-password", time.Minute)
+
+	tests := []struct {
+		name   string
+		token  string
+		secret string
+		want   error
+	}{
+		{"valid", valid.String(), "db-password", nil},
+		{"other secret", valid.String(), "api-key", ErrTokenScope},
+		{"expired", expired.String(), "db-password", ErrTokenExpired},
+		{"other signing key", other.String(), "db-password", ErrTokenScope},
+		{"extended expiry", strconv.FormatInt(valid.Exp+3600, 10) + "." + valid.Sig, "db-password", ErrTokenScope},
+		{"no signature", strconv.FormatInt(valid.Exp, 10), "db-password", ErrTokenMalformed},
+		{"garbage", "not-a-token", "db-password", ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signer.Verify(tt.token, tt.secret); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedToken(t *testing.T) {
+	t.Parallel()
+
+	signer := NewTokenSigner([]byte("0123456789abcdef0123456789abcdef"))
+	app := fiber.New()
+	app.Get("/secret/:name", SignedToken(signer), Middleware(testStore()), func(c *fiber.Ctx) error {
+		key, _ := KeyFromCtx(c)
+		return c.SendString(key.Name)
+	})
+
+	token := signer.Issue("my secret", time.Minute).String()
+	tests := []struct {
+		name       string
+		target     string
+		bearer     string
+		wantStatus int
+		wantKey    string
+	}{
+		{"token", "/secret/my%20secret?token=" + token, "", http.StatusOK, TokenKeyName},
+		{"token for another secret", "/secret/db-password?token=" + token, "", http.StatusForbidden, ""},
+		{"bad token with valid key", "/secret/my%20secret?token=1.x", keyFull, http.StatusForbidden, ""},
+		{"key without token", "/secret/my%20secret", keyFull, http.StatusOK, "full"},
+		{"neither", "/secret/my%20secret", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantKey != "" {
+				body := make([]byte, 64)
+				n, _ := resp.Body.Read(body)
+				if got := string(body[:n]); got != tt.wantKey {
+					t.Errorf("authenticated as %q, want %q", got, tt.wantKey)
+				}
+			}
+		})
+	}
+}
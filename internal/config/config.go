@@ -3,16 +3,22 @@ package config
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
 )
 
 // Config holds all application configuration
@@ -22,81 +28,498 @@ type Config struct {
 	Environment  string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	MaxBodySize  int // bytes; larger request bodies are rejected with 413
+	// ShutdownTimeout bounds the wait for in-flight requests on SIGTERM.
+	ShutdownTimeout time.Duration
+	// GRPCPort is the port of the gRPC server; empty disables it.
+	GRPCPort string
+	// HealthVerbose allows /health?verbose=true (never in production).
+	HealthVerbose bool
+	// RedactNames hashes secret names in log lines unless LOG_LEVEL=debug.
+	RedactNames bool
 
 	// Security
 	APIKeys              []auth.APIKey
+	APIKeyHeader         string // extra header accepting the bare key ("" disables)
+	RouteAuth            auth.RoutePolicy
 	AllowedIPs           []string
+	AllowedIPsFile       string // watched replacement for AllowedIPs, one entry per line
+	BlockedIPs           []string
 	EnableGitHubIPRanges bool
+	GitHubIPRangeTypes   []string
+	IPRangeProviders     []ipwhitelist.RangeProvider
+	// IPRangeStartupJitter delays the first range fetch by up to this much;
+	// IPRangeRefreshJitter spreads the daily refresh by ± this much.
+	IPRangeStartupJitter time.Duration
+	IPRangeRefreshJitter time.Duration
+	TrustedProxyIP       string
+	TrustedProxies       []string
+	// XFFIndex picks the n-th X-Forwarded-For entry from the right as the
+	// client IP (0 walks past trusted proxies instead).
+	XFFIndex int
+	// HeaderGuard rejects requests with suspicious headers (see headerguard).
+	HeaderGuard       bool
+	HeaderMaxBytes    int
+	BlockedUserAgents []string
 
 	// Vaultwarden
-	VaultwardenURL   string
-	VaultwardenToken string
+	VaultwardenURL          string
+	VaultwardenFallbackURLs []string // further VAULTWARDEN_URL entries, tried in order on failure
+	VaultwardenToken        string
+	VaultwardenEmail        string
+	VaultwardenPassword     string
+	VaultwardenClientID     string
+	VaultwardenClientSecret string
+	SyncInterval            time.Duration
+	DeviceType              int
+	DeviceName              string
+	TokenCacheFile          string
+	TokenRetryAttempts      int
+	TokenRetryBaseDelay     time.Duration
+	SyncRetryAttempts       int
+	SyncRetryBaseDelay      time.Duration
+	MaxVaultItems           int
+	// CircuitBreakerThreshold consecutive upstream failures open the breaker
+	// for CircuitBreakerCooldown (0 disables it).
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// Upstream HTTP client
+	HTTPTimeout         time.Duration
+	HTTPMaxIdleConns    int
+	HTTPIdleConnTimeout time.Duration
+	CertPins            []string
+	InsecureTLS         bool
+	ClientCertFile      string
+	ClientKeyFile       string
+	ClientCert          *tls.Certificate // loaded from ClientCertFile/ClientKeyFile
 
 	// Performance
-	CacheTTL           time.Duration
-	CORSAllowedOrigins string
+	CacheTTL              time.Duration
+	SyncBeforeFetchMaxAge time.Duration
+	CacheTTLOverrides     map[string]time.Duration
+	SyncOnMiss            bool
+	SyncOnMissCooldown    time.Duration
+	StaleIfError          time.Duration
+	CORSAllowedOrigins    string
+	// CORSAllowedMethods and CORSAllowedHeaders are normalized comma lists;
+	// an empty CORSAllowedMethods means the methods of the registered routes.
+	CORSAllowedMethods string
+	CORSAllowedHeaders string
+
+	// Writes
+	AllowWrites bool
+
+	// AllowExport enables GET /export, which streams the whole vault; it
+	// requires RESPONSE_ENCRYPTION_KEY and ALLOWED_IPS.
+	AllowExport bool
+
+	// AllowDynamicWhitelist enables /whitelist, which adds temporary allow
+	// entries of at most DynamicWhitelistMaxTTL; it requires ALLOWED_IPS.
+	AllowDynamicWhitelist  bool
+	DynamicWhitelistMaxTTL time.Duration
+
+	// Lookups
+	ExcludeTrashed   bool
+	SecretFieldNames []string
+	ExtractionOrder  []vaultwarden.ExtractionStep
+	PreloadSecrets   []string
+	// StartupSelftestSecret must resolve at startup or the service exits.
+	StartupSelftestSecret string
+	NameMatch             vaultwarden.NameMatch
+
+	// Monitoring
+	WebhookURL          string
+	AuditLog            string
+	SecretSizeWarnBytes int
+	MetricsEnabled      bool
+	MetricsIPWhitelist  bool
+
+	// Responses
+	ResponseEnvelope bool
+	// ResponseEncryptionKey is the 32-byte AES-256-GCM key from
+	// RESPONSE_ENCRYPTION_KEY (nil disables encrypted responses).
+	ResponseEncryptionKey []byte
+	// TokenSigningKey is the HMAC key from TOKEN_SIGNING_KEY for signed
+	// single-secret tokens (nil disables POST /token and ?token=).
+	TokenSigningKey []byte
+	TokenMaxTTL     time.Duration
 
 	// Rate limiting
 	RateLimitMax    int
 	RateLimitWindow time.Duration
+	RateLimitExempt []string
+	// SyncRateLimitMax is the POST /sync budget per RateLimitWindow.
+	SyncRateLimitMax int
 }
 
 // Load reads configuration from environment variables
 func Load() (*Config, error) {
-	cfg := &Config{
-		Port:        getEnv("API_PORT", "8080"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-
-		VaultwardenURL:   os.Getenv("VAULTWARDEN_URL"),
-		VaultwardenToken: os.Getenv("VAULTWARDEN_ACCESS_TOKEN"),
+	return load(&source{})
+}
 
-		ReadTimeout:        parseDuration(os.Getenv("READ_TIMEOUT"), "10s"),
-		WriteTimeout:       parseDuration(os.Getenv("WRITE_TIMEOUT"), "10s"),
-		CacheTTL:           parseDuration(os.Getenv("CACHE_TTL"), "5m"),
-		CORSAllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"),
+// LoadFromFile reads configuration from a YAML (.yaml, .yml) or JSON (.json)
+// file whose fields are the lower-cased env var names (e.g. vaultwarden_url).
+// Any env var that is set overrides the corresponding file field. The file is
+// validated exactly like the environment, and unknown fields are rejected.
+func LoadFromFile(path string) (*Config, error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &source{path: path, file: values}
+	cfg, err := load(s)
+	if err != nil {
+		return nil, err
+	}
+	if unknown := s.unknownFields(); len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: unknown field(s): %s", path, strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
 
-		EnableGitHubIPRanges: getEnv("ENABLE_GITHUB_IP_RANGES", "false") == "true",
+// load builds and validates a Config from s. An unreadable KEY_FILE is
+// reported in preference to the validation errors its missing value causes.
+func load(s *source) (*Config, error) {
+	cfg, err := build(s)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return cfg, err
+}
 
-		RateLimitMax:    parseInt(getEnv("RATE_LIMIT_MAX", "30"), 30),
-		RateLimitWindow: parseDuration(os.Getenv("RATE_LIMIT_WINDOW"), "1m"),
+// build reads every setting from s and validates the result.
+func build(s *source) (*Config, error) {
+	cfg := &Config{
+		Port:        s.getOr("API_PORT", "8080"),
+		Environment: s.getOr("ENVIRONMENT", "development"),
+
+		VaultwardenURL:   s.get("VAULTWARDEN_URL"),
+		VaultwardenToken: s.get("VAULTWARDEN_ACCESS_TOKEN"),
+
+		VaultwardenEmail:        s.get("VAULTWARDEN_EMAIL"),
+		VaultwardenPassword:     s.get("VAULTWARDEN_PASSWORD"),
+		VaultwardenClientID:     s.get("VAULTWARDEN_CLIENT_ID"),
+		VaultwardenClientSecret: s.get("VAULTWARDEN_CLIENT_SECRET"),
+		SyncInterval:            parseDuration(s.get("SYNC_INTERVAL"), "5m"),
+		DeviceName:              s.getOr("BW_DEVICE_NAME", vaultwarden.DefaultDeviceName),
+		TokenCacheFile:          s.get("TOKEN_CACHE_FILE"),
+		TokenRetryAttempts:      parseInt(s.getOr("TOKEN_RETRY_ATTEMPTS", "3"), 3),
+		TokenRetryBaseDelay:     parseDuration(s.get("TOKEN_RETRY_BASE_DELAY"), "500ms"),
+		SyncRetryAttempts:       parseInt(s.getOr("SYNC_RETRY_ATTEMPTS", "3"), 3),
+		SyncRetryBaseDelay:      parseDuration(s.get("SYNC_RETRY_BASE_DELAY"), "500ms"),
+		MaxVaultItems:           parseInt(s.getOr("MAX_VAULT_ITEMS", "0"), 0),
+
+		HTTPTimeout:         parseDuration(s.get("HTTP_TIMEOUT"), "30s"),
+		HTTPMaxIdleConns:    parseInt(s.getOr("HTTP_MAX_IDLE_CONNS", "100"), 100),
+		HTTPIdleConnTimeout: parseDuration(s.get("HTTP_IDLE_CONN_TIMEOUT"), "90s"),
+
+		ReadTimeout:           parseDuration(s.get("READ_TIMEOUT"), "10s"),
+		WriteTimeout:          parseDuration(s.get("WRITE_TIMEOUT"), "10s"),
+		MaxBodySize:           parseInt(s.getOr("MAX_BODY_SIZE", "65536"), 65536),
+		ShutdownTimeout:       parseDuration(s.get("SHUTDOWN_TIMEOUT"), "15s"),
+		CacheTTL:              parseDuration(s.get("CACHE_TTL"), "5m"),
+		SyncBeforeFetchMaxAge: parseDuration(s.get("SYNC_BEFORE_FETCH_MAX_AGE"), "0s"),
+		SyncOnMiss:            s.getOr("SYNC_ON_MISS", "false") == "true",
+		SyncOnMissCooldown:    parseDuration(s.get("SYNC_ON_MISS_COOLDOWN"), "30s"),
+		StaleIfError:          parseDuration(s.get("STALE_IF_ERROR"), "0s"),
+		CORSAllowedOrigins:    s.getOr("CORS_ALLOWED_ORIGINS", "http://localhost:3000"),
+
+		EnableGitHubIPRanges: s.getOr("ENABLE_GITHUB_IP_RANGES", "false") == "true",
+		IPRangeStartupJitter: max(parseDuration(s.get("IP_RANGE_STARTUP_JITTER"), "0s"), 0),
+		IPRangeRefreshJitter: max(parseDuration(s.get("IP_RANGE_REFRESH_JITTER"), "1h"), 0),
+		TrustedProxyIP:       s.get("TRUSTED_PROXY_IP"),
+		HeaderGuard:          s.getOr("HEADER_GUARD", "false") == "true",
+		HeaderMaxBytes:       parseInt(s.getOr("HEADER_MAX_BYTES", "2048"), 2048),
+
+		RateLimitMax:     parseInt(s.getOr("RATE_LIMIT_MAX", "30"), 30),
+		RateLimitWindow:  parseDuration(s.get("RATE_LIMIT_WINDOW"), "1m"),
+		SyncRateLimitMax: parseInt(s.getOr("SYNC_RATE_LIMIT_MAX", "2"), 2),
+
+		ExcludeTrashed: s.getOr("EXCLUDE_TRASHED", "false") == "true",
+		AllowWrites:    s.getOr("ALLOW_WRITES", "false") == "true",
+
+		WebhookURL:          s.get("WEBHOOK_URL"),
+		AuditLog:            s.get("AUDIT_LOG"),
+		SecretSizeWarnBytes: parseInt(s.getOr("SECRET_SIZE_WARN_BYTES", "65536"), 65536),
+		MetricsEnabled:      s.getOr("METRICS_ENABLED", "true") == "true",
+		MetricsIPWhitelist:  s.getOr("METRICS_IP_WHITELIST", "false") == "true",
+
+		ResponseEnvelope: s.getOr("RESPONSE_ENVELOPE", "false") == "true",
+		RedactNames:      s.getOr("REDACT_NAMES", "false") == "true",
+		TokenMaxTTL:      parseDuration(s.get("TOKEN_MAX_TTL"), "1h"),
 	}
 
 	// Load API keys from API_KEYS_FILE / API_KEYS / legacy API_KEY.
-	apiKeys, err := loadAPIKeys()
+	apiKeys, err := loadAPIKeys(s)
 	if err != nil {
 		return nil, err
 	}
 	cfg.APIKeys = apiKeys
 
-	// Parse allowed IPs
-	if allowedIPsStr := os.Getenv("ALLOWED_IPS"); allowedIPsStr != "" {
-		ips := strings.Split(allowedIPsStr, ",")
-		for _, ip := range ips {
-			trimmed := strings.TrimSpace(ip)
-			if trimmed != "" {
-				if err := validateIPOrCIDR(trimmed); err != nil {
-					return nil, fmt.Errorf("invalid IP in ALLOWED_IPS (%s): %w", trimmed, err)
-				}
-				cfg.AllowedIPs = append(cfg.AllowedIPs, trimmed)
+	// A custom key header for proxies that strip Authorization. Authorization
+	// itself is excluded: it always expects a Bearer credential.
+	cfg.APIKeyHeader = s.get("API_KEY_HEADER")
+	if cfg.APIKeyHeader != "" && (!headerNamePattern.MatchString(cfg.APIKeyHeader) || strings.EqualFold(cfg.APIKeyHeader, "Authorization")) {
+		return nil, s.wrap("API_KEY_HEADER", fmt.Errorf("invalid API_KEY_HEADER %q (want a header name other than Authorization)", cfg.APIKeyHeader))
+	}
+
+	routeAuth, err := parseRouteAuth(s.get("ROUTE_AUTH"))
+	if err != nil {
+		return nil, s.wrap("ROUTE_AUTH", err)
+	}
+	cfg.RouteAuth = routeAuth
+
+	ttlOverrides, err := parseTTLOverrides(s.get("CACHE_TTL_OVERRIDES"))
+	if err != nil {
+		return nil, s.wrap("CACHE_TTL_OVERRIDES", err)
+	}
+	cfg.CacheTTLOverrides = ttlOverrides
+
+	deviceType, err := parseDeviceType(s.get("BW_DEVICE_TYPE"))
+	if err != nil {
+		return nil, s.wrap("BW_DEVICE_TYPE", err)
+	}
+	cfg.DeviceType = deviceType
+
+	nameMatch, err := vaultwarden.ParseNameMatch(s.get("NAME_MATCH"))
+	if err != nil {
+		return nil, s.wrap("NAME_MATCH", fmt.Errorf("invalid NAME_MATCH: %w", err))
+	}
+	cfg.NameMatch = nameMatch
+
+	// Custom field names used when an item has no password (empty keeps the default).
+	for _, name := range strings.Split(s.get("SECRET_FIELD_NAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.SecretFieldNames = append(cfg.SecretFieldNames, name)
+		}
+	}
+
+	extractionOrder, err := vaultwarden.ParseExtractionOrder(s.get("EXTRACTION_ORDER"))
+	if err != nil {
+		return nil, s.wrap("EXTRACTION_ORDER", fmt.Errorf("invalid EXTRACTION_ORDER: %w", err))
+	}
+	cfg.ExtractionOrder = extractionOrder
+
+	// User-Agent substrings rejected by HEADER_GUARD.
+	for _, ua := range strings.Split(s.get("BLOCKED_USER_AGENTS"), ",") {
+		if ua = strings.TrimSpace(ua); ua != "" {
+			cfg.BlockedUserAgents = append(cfg.BlockedUserAgents, ua)
+		}
+	}
+
+	// Secret names resolved once at startup to catch typos early.
+	for _, name := range strings.Split(s.get("PRELOAD_SECRETS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.PreloadSecrets = append(cfg.PreloadSecrets, name)
+		}
+	}
+	cfg.StartupSelftestSecret = strings.TrimSpace(s.get("STARTUP_SELFTEST_SECRET"))
+
+	// GitHub meta range types to whitelist (actions, hooks, api).
+	for _, t := range strings.Split(s.getOr("GITHUB_IP_RANGE_TYPES", ipwhitelist.GitHubRangeActions), ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch t {
+		case "":
+			continue
+		case ipwhitelist.GitHubRangeActions, ipwhitelist.GitHubRangeHooks, ipwhitelist.GitHubRangeAPI:
+			if !slices.Contains(cfg.GitHubIPRangeTypes, t) {
+				cfg.GitHubIPRangeTypes = append(cfg.GitHubIPRangeTypes, t)
 			}
+		default:
+			return nil, s.wrap("GITHUB_IP_RANGE_TYPES", fmt.Errorf("invalid GITHUB_IP_RANGE_TYPES entry %q (want actions, hooks or api)", t))
+		}
+	}
+
+	providers, err := parseRangeProviders(s.get("IP_RANGE_PROVIDERS"))
+	if err != nil {
+		return nil, s.wrap("IP_RANGE_PROVIDERS", err)
+	}
+	cfg.IPRangeProviders = providers
+
+	// Parse IP/CIDR lists: allowed and blocked clients, trusted proxies
+	// (X-Forwarded-For is only honored from these) and networks exempt from
+	// rate limiting.
+	for _, list := range []struct {
+		key string
+		dst *[]string
+	}{
+		{"ALLOWED_IPS", &cfg.AllowedIPs},
+		{"BLOCKED_IPS", &cfg.BlockedIPs},
+		{"TRUSTED_PROXIES", &cfg.TrustedProxies},
+		{"RATE_LIMIT_EXEMPT", &cfg.RateLimitExempt},
+	} {
+		ips, err := parseIPList(s.get(list.key))
+		if err != nil {
+			return nil, s.wrap(list.key, fmt.Errorf("invalid IP in %s %w", list.key, err))
 		}
+		*list.dst = ips
+	}
+
+	cfg.AllowedIPsFile = s.get("ALLOWED_IPS_FILE")
+	if cfg.AllowedIPsFile != "" && len(cfg.AllowedIPs) > 0 {
+		return nil, s.wrap("ALLOWED_IPS_FILE", fmt.Errorf("ALLOWED_IPS and ALLOWED_IPS_FILE are both set; use only one"))
+	}
+
+	if cfg.GRPCPort = s.get("GRPC_PORT"); cfg.GRPCPort != "" {
+		n, err := strconv.Atoi(cfg.GRPCPort)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, s.wrap("GRPC_PORT", fmt.Errorf("GRPC_PORT must be a port number (1-65535)"))
+		}
+		if cfg.GRPCPort == cfg.Port {
+			return nil, s.wrap("GRPC_PORT", fmt.Errorf("GRPC_PORT must differ from API_PORT"))
+		}
+	}
+
+	if raw := s.get("XFF_INDEX"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, s.wrap("XFF_INDEX", fmt.Errorf("XFF_INDEX must be a non-negative integer (0 skips trusted proxies from the right)"))
+		}
+		cfg.XFFIndex = n
 	}
 
 	// Validate required fields
 	if cfg.VaultwardenURL == "" {
+		if s.path != "" {
+			return nil, fmt.Errorf("VAULTWARDEN_URL is required (set the env var or %q in %s)", fileKey("VAULTWARDEN_URL"), s.path)
+		}
 		return nil, fmt.Errorf("VAULTWARDEN_URL is required")
 	}
 
-	// Validate and normalize URL
-	parsedURL, err := url.Parse(cfg.VaultwardenURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid VAULTWARDEN_URL: %w", err)
+	// Validate and normalize the URLs: a comma-separated list is the primary
+	// server followed by replicas to fail over to.
+	allHTTPS := true
+	var serverURLs []string
+	for _, raw := range strings.Split(cfg.VaultwardenURL, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		parsedURL, err := url.Parse(raw)
+		if err != nil {
+			return nil, s.wrap("VAULTWARDEN_URL", fmt.Errorf("invalid VAULTWARDEN_URL: %w", err))
+		}
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			return nil, s.wrap("VAULTWARDEN_URL", fmt.Errorf("VAULTWARDEN_URL must use http or https scheme"))
+		}
+		allHTTPS = allHTTPS && parsedURL.Scheme == "https"
+		// Remove trailing slash for consistency
+		serverURLs = append(serverURLs, strings.TrimSuffix(raw, "/"))
+	}
+	if len(serverURLs) == 0 {
+		return nil, s.wrap("VAULTWARDEN_URL", fmt.Errorf("VAULTWARDEN_URL is required"))
 	}
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return nil, fmt.Errorf("VAULTWARDEN_URL must use http or https scheme")
+	cfg.VaultwardenURL, cfg.VaultwardenFallbackURLs = serverURLs[0], serverURLs[1:]
+
+	// Certificate pins for the Vaultwarden server (comma-separated so a backup
+	// key can be pinned ahead of a rotation).
+	for _, pin := range strings.Split(s.get("VAULTWARDEN_CERT_PIN"), ",") {
+		if pin = strings.TrimSpace(pin); pin == "" {
+			continue
+		}
+		if err := vaultwarden.ValidateCertPin(pin); err != nil {
+			return nil, s.wrap("VAULTWARDEN_CERT_PIN", fmt.Errorf("invalid VAULTWARDEN_CERT_PIN %q: %w", pin, err))
+		}
+		cfg.CertPins = append(cfg.CertPins, pin)
+	}
+	if len(cfg.CertPins) > 0 && !allHTTPS {
+		return nil, s.wrap("VAULTWARDEN_CERT_PIN", fmt.Errorf("VAULTWARDEN_CERT_PIN requires an https VAULTWARDEN_URL"))
+	}
+
+	cfg.CircuitBreakerThreshold = vaultwarden.DefaultBreakerThreshold
+	if raw := s.get("CIRCUIT_BREAKER_THRESHOLD"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, s.wrap("CIRCUIT_BREAKER_THRESHOLD", fmt.Errorf("CIRCUIT_BREAKER_THRESHOLD must be a non-negative integer (0 disables the breaker)"))
+		}
+		cfg.CircuitBreakerThreshold = n
+	}
+	cfg.CircuitBreakerCooldown = parseDuration(s.get("CIRCUIT_BREAKER_COOLDOWN"), "30s")
+	if cfg.CircuitBreakerCooldown <= 0 {
+		return nil, s.wrap("CIRCUIT_BREAKER_COOLDOWN", fmt.Errorf("CIRCUIT_BREAKER_COOLDOWN must be positive"))
+	}
+
+	// Verbose health output exposes internals, so it is for development only.
+	cfg.HealthVerbose = s.getOr("HEALTH_VERBOSE", "false") == "true"
+	if cfg.HealthVerbose && cfg.IsProd() {
+		return nil, s.wrap("HEALTH_VERBOSE", fmt.Errorf("HEALTH_VERBOSE cannot be enabled when ENVIRONMENT=production"))
+	}
+
+	// Skipping TLS verification is a development escape hatch only.
+	cfg.InsecureTLS = s.getOr("VAULTWARDEN_INSECURE_TLS", "false") == "true"
+	if cfg.InsecureTLS && cfg.IsProd() {
+		return nil, s.wrap("VAULTWARDEN_INSECURE_TLS", fmt.Errorf("VAULTWARDEN_INSECURE_TLS cannot be enabled when ENVIRONMENT=production"))
+	}
+
+	// Client certificate for a Vaultwarden behind an mTLS proxy. Both halves are
+	// loaded now so a bad pair stops startup instead of failing every request.
+	cfg.ClientCertFile = s.get("VAULTWARDEN_CLIENT_CERT")
+	cfg.ClientKeyFile = s.get("VAULTWARDEN_CLIENT_KEY")
+	if (cfg.ClientCertFile == "") != (cfg.ClientKeyFile == "") {
+		return nil, fmt.Errorf("VAULTWARDEN_CLIENT_CERT and VAULTWARDEN_CLIENT_KEY must be set together")
+	}
+	if cfg.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load VAULTWARDEN_CLIENT_CERT/VAULTWARDEN_CLIENT_KEY: %w", err)
+		}
+		cfg.ClientCert = &cert
+	}
+
+	if raw := s.get("RESPONSE_ENCRYPTION_KEY"); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != 32 {
+			return nil, s.wrap("RESPONSE_ENCRYPTION_KEY", fmt.Errorf("RESPONSE_ENCRYPTION_KEY must be 32 bytes, base64-encoded (openssl rand -base64 32)"))
+		}
+		cfg.ResponseEncryptionKey = key
+	}
+
+	// The export is only ever sent encrypted, and only to whitelisted addresses.
+	cfg.AllowExport = s.getOr("ALLOW_EXPORT", "false") == "true"
+	if cfg.AllowExport && cfg.ResponseEncryptionKey == nil {
+		return nil, s.wrap("ALLOW_EXPORT", fmt.Errorf("ALLOW_EXPORT requires RESPONSE_ENCRYPTION_KEY"))
+	}
+	if cfg.AllowExport && len(cfg.AllowedIPs) == 0 && cfg.AllowedIPsFile == "" {
+		return nil, s.wrap("ALLOW_EXPORT", fmt.Errorf("ALLOW_EXPORT requires ALLOWED_IPS or ALLOWED_IPS_FILE"))
+	}
+
+	if raw := s.get("TOKEN_SIGNING_KEY"); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) < 32 {
+			return nil, s.wrap("TOKEN_SIGNING_KEY", fmt.Errorf("TOKEN_SIGNING_KEY must be at least 32 bytes, base64-encoded (openssl rand -base64 32)"))
+		}
+		cfg.TokenSigningKey = key
+	}
+	if cfg.TokenMaxTTL <= 0 {
+		return nil, s.wrap("TOKEN_MAX_TTL", fmt.Errorf("TOKEN_MAX_TTL must be positive"))
+	}
+
+	// Temporary entries only extend an existing whitelist; adding one to an
+	// open API would lock everyone else out.
+	cfg.AllowDynamicWhitelist = s.getOr("ALLOW_DYNAMIC_WHITELIST", "false") == "true"
+	cfg.DynamicWhitelistMaxTTL = parseDuration(s.get("DYNAMIC_WHITELIST_MAX_TTL"), "24h")
+	if cfg.AllowDynamicWhitelist && len(cfg.AllowedIPs) == 0 && cfg.AllowedIPsFile == "" {
+		return nil, s.wrap("ALLOW_DYNAMIC_WHITELIST", fmt.Errorf("ALLOW_DYNAMIC_WHITELIST requires ALLOWED_IPS or ALLOWED_IPS_FILE"))
+	}
+	if cfg.DynamicWhitelistMaxTTL <= 0 {
+		return nil, s.wrap("DYNAMIC_WHITELIST_MAX_TTL", fmt.Errorf("DYNAMIC_WHITELIST_MAX_TTL must be positive"))
+	}
+
+	if err := validateOrigins(cfg.CORSAllowedOrigins); err != nil {
+		return nil, s.wrap("CORS_ALLOWED_ORIGINS", fmt.Errorf("invalid CORS_ALLOWED_ORIGINS: %w", err))
+	}
+	if cfg.CORSAllowedMethods, err = parseCORSMethods(s.get("CORS_ALLOWED_METHODS")); err != nil {
+		return nil, s.wrap("CORS_ALLOWED_METHODS", fmt.Errorf("invalid CORS_ALLOWED_METHODS: %w", err))
+	}
+	if cfg.CORSAllowedHeaders, err = parseCORSHeaders(s.getOr("CORS_ALLOWED_HEADERS", DefaultCORSAllowedHeaders)); err != nil {
+		return nil, s.wrap("CORS_ALLOWED_HEADERS", fmt.Errorf("invalid CORS_ALLOWED_HEADERS: %w", err))
+	}
+
+	if cfg.WebhookURL != "" {
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, s.wrap("WEBHOOK_URL", fmt.Errorf("WEBHOOK_URL must be an http or https URL"))
+		}
 	}
-	// Remove trailing slash for consistency
-	cfg.VaultwardenURL = strings.TrimSuffix(cfg.VaultwardenURL, "/")
 
 	return cfg, nil
 }
@@ -106,14 +529,6 @@ func (c *Config) IsProd() bool {
 	return c.Environment == "production"
 }
 
-// getEnv gets an environment variable with a fallback default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
 // parseDuration parses a duration string, falling back to the given default
 // string for empty or malformed input (the fallback is a known-good constant).
 func parseDuration(s, fallback string) time.Duration {
@@ -139,35 +554,42 @@ type apiKeyJSON struct {
 	Key           string   `json:"key"`
 	Organizations []string `json:"organizations"`
 	Collections   []string `json:"collections"`
+	Admin         bool     `json:"admin"`
 }
 
 // loadAPIKeys assembles the configured keys from API_KEYS_FILE (preferred) or
 // API_KEYS (inline JSON), plus a legacy unscoped API_KEY if set. At least one
 // key is required and each must be at least 32 characters.
-func loadAPIKeys() ([]auth.APIKey, error) {
+func loadAPIKeys(s *source) ([]auth.APIKey, error) {
 	var keys []auth.APIKey
+	var origins []string // setting each key came from, for error attribution
+
+	keysFile, inline, legacy := s.get("API_KEYS_FILE"), s.get("API_KEYS"), s.get("API_KEY")
 
-	if path := os.Getenv("API_KEYS_FILE"); path != "" {
-		data, err := os.ReadFile(path)
+	if keysFile != "" {
+		data, err := os.ReadFile(keysFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read API_KEYS_FILE: %w", err)
+			return nil, s.wrap("API_KEYS_FILE", fmt.Errorf("failed to read API_KEYS_FILE: %w", err))
 		}
 		parsed, err := parseAPIKeysJSON(data, "API_KEYS_FILE")
 		if err != nil {
-			return nil, err
+			return nil, s.wrap("API_KEYS_FILE", err)
 		}
 		keys = append(keys, parsed...)
-	} else if raw := os.Getenv("API_KEYS"); raw != "" {
-		parsed, err := parseAPIKeysJSON([]byte(raw), "API_KEYS")
+		origins = append(origins, slices.Repeat([]string{"API_KEYS_FILE"}, len(parsed))...)
+	} else if inline != "" {
+		parsed, err := parseAPIKeysJSON([]byte(inline), "API_KEYS")
 		if err != nil {
-			return nil, err
+			return nil, s.wrap("API_KEYS", err)
 		}
 		keys = append(keys, parsed...)
+		origins = append(origins, slices.Repeat([]string{"API_KEYS"}, len(parsed))...)
 	}
 
-	// Legacy single key remains a full-access (unscoped) key.
-	if legacy := os.Getenv("API_KEY"); legacy != "" {
-		keys = append(keys, auth.APIKey{Name: "legacy", Key: legacy})
+	// Legacy single key remains a full-access (unscoped, admin) key.
+	if legacy != "" {
+		keys = append(keys, auth.APIKey{Name: "legacy", Key: legacy, Admin: true})
+		origins = append(origins, "API_KEY")
 	}
 
 	if len(keys) == 0 {
@@ -177,10 +599,10 @@ func loadAPIKeys() ([]auth.APIKey, error) {
 	seen := make(map[string]struct{}, len(keys))
 	for i, k := range keys {
 		if len(k.Key) < 32 {
-			return nil, fmt.Errorf("API key #%d (%q) must be at least 32 characters for security (run: openssl rand -base64 32)", i+1, k.Name)
+			return nil, s.wrap(origins[i], fmt.Errorf("API key #%d (%q) must be at least 32 characters for security (run: openssl rand -base64 32)", i+1, k.Name))
 		}
 		if _, dup := seen[k.Key]; dup {
-			return nil, fmt.Errorf("duplicate API key material for key #%d (%q): each key must be unique so it cannot silently override another key's scope", i+1, k.Name)
+			return nil, s.wrap(origins[i], fmt.Errorf("duplicate API key material for key #%d (%q): each key must be unique so it cannot silently override another key's scope", i+1, k.Name))
 		}
 		seen[k.Key] = struct{}{}
 	}
@@ -212,19 +634,193 @@ func parseAPIKeysJSON(data []byte, source string) ([]auth.APIKey, error) {
 				Organizations: e.Organizations,
 				Collections:   e.Collections,
 			},
+			Admin: e.Admin,
 		})
 	}
 	return keys, nil
 }
 
+// parseRouteAuth parses ROUTE_AUTH, a comma-separated list of
+// "METHOD /path=tier" entries (e.g. "GET /secrets=admin,POST /refresh=admin").
+// Only the syntax is checked here; the routes themselves are checked once they
+// are registered (routeRegistry.validate in cmd/api).
+func parseRouteAuth(raw string) (auth.RoutePolicy, error) {
+	policy := make(auth.RoutePolicy)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, tierStr, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		path = strings.TrimSpace(path)
+		if !ok || !hasPath || method == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid ROUTE_AUTH entry %q: want \"METHOD /path=tier\"", entry)
+		}
+		tier, err := auth.ParseTier(tierStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ROUTE_AUTH entry %q: %w", entry, err)
+		}
+		policy[auth.RouteKey(method, path)] = tier
+	}
+	return policy, nil
+}
+
+// parseTTLOverrides parses CACHE_TTL_OVERRIDES, a comma-separated list of
+// "name=duration" entries (e.g. "rotating-token=30s,static-cert=24h"). A
+// duration of 0 means the secret is always synced before it is served.
+func parseTTLOverrides(raw string) (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_TTL_OVERRIDES entry %q: want \"name=duration\"", entry)
+		}
+		name := strings.TrimSpace(entry[:i])
+		d, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil || d < 0 || name == "" {
+			return nil, fmt.Errorf("invalid CACHE_TTL_OVERRIDES entry %q: want \"name=duration\"", entry)
+		}
+		overrides[name] = d
+	}
+	return overrides, nil
+}
+
+// maxDeviceType bounds BW_DEVICE_TYPE; Bitwarden device types are small enum values.
+const maxDeviceType = 255
+
+// parseDeviceType parses BW_DEVICE_TYPE, defaulting to the SDK device type.
+func parseDeviceType(raw string) (int, error) {
+	if raw == "" {
+		return vaultwarden.DefaultDeviceType, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || n < 0 || n > maxDeviceType {
+		return 0, fmt.Errorf("invalid BW_DEVICE_TYPE %q: want an integer between 0 and %d", raw, maxDeviceType)
+	}
+	return n, nil
+}
+
+// DefaultCORSAllowedHeaders are the request headers browsers may send
+// cross-origin when CORS_ALLOWED_HEADERS is not set.
+const DefaultCORSAllowedHeaders = "Authorization,Content-Type,X-Request-ID"
+
+// validateOrigins checks a comma-separated CORS origin list: each entry is "*"
+// or an http(s) origin (scheme://host[:port], where the host may start with
+// "*." for any subdomain) without path, query or credentials.
+func validateOrigins(raw string) error {
+	for origin := range strings.SplitSeq(raw, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" || origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("%q is not an origin (want scheme://host[:port])", origin)
+		}
+	}
+	return nil
+}
+
+// corsMethods are the methods CORS_ALLOWED_METHODS may list.
+var corsMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// parseCORSMethods normalizes a comma-separated method list to upper case,
+// rejecting unknown methods.
+func parseCORSMethods(raw string) (string, error) {
+	var methods []string
+	for m := range strings.SplitSeq(raw, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+		if !slices.Contains(corsMethods, m) {
+			return "", fmt.Errorf("unknown method %q", m)
+		}
+		methods = append(methods, m)
+	}
+	return strings.Join(methods, ","), nil
+}
+
+// headerNamePattern matches an HTTP header name (an RFC 9110 token).
+var headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// parseCORSHeaders normalizes a comma-separated header name list.
+func parseCORSHeaders(raw string) (string, error) {
+	var headers []string
+	for h := range strings.SplitSeq(raw, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !headerNamePattern.MatchString(h) {
+			return "", fmt.Errorf("invalid header name %q", h)
+		}
+		headers = append(headers, h)
+	}
+	return strings.Join(headers, ","), nil
+}
+
+// parseRangeProviders parses IP_RANGE_PROVIDERS: comma-separated
+// name=url|selector[|selector...] entries, e.g.
+// "gitlab=https://example.com/ranges.json|prefixes.ipv4|prefixes.ipv6".
+func parseRangeProviders(raw string) ([]ipwhitelist.RangeProvider, error) {
+	var providers []ipwhitelist.RangeProvider
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, "=")
+		parts := strings.Split(rest, "|")
+		if !ok || strings.TrimSpace(name) == "" || len(parts) < 2 {
+			return nil, fmt.Errorf("invalid IP_RANGE_PROVIDERS entry %q (want name=url|selector)", entry)
+		}
+		p := ipwhitelist.RangeProvider{Name: strings.TrimSpace(name), URL: strings.TrimSpace(parts[0])}
+		if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("IP_RANGE_PROVIDERS %s: URL must be http or https", p.Name)
+		}
+		for _, sel := range parts[1:] {
+			if sel = strings.TrimSpace(sel); sel != "" {
+				p.Selectors = append(p.Selectors, sel)
+			}
+		}
+		if len(p.Selectors) == 0 {
+			return nil, fmt.Errorf("IP_RANGE_PROVIDERS %s: at least one selector is required", p.Name)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// parseIPList splits a comma-separated list of IPs and CIDRs, rejecting the
+// first invalid entry. An empty list yields nil.
+func parseIPList(raw string) ([]string, error) {
+	var ips []string
+	for _, entry := range strings.Split(raw, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if err := validateIPOrCIDR(entry); err != nil {
+			return nil, fmt.Errorf("(%s): %w", entry, err)
+		}
+		ips = append(ips, entry)
+	}
+	return ips, nil
+}
+
 // validateIPOrCIDR validates if a string is a valid IP address or CIDR range
 func validateIPOrCIDR(s string) error {
 	// Try parsing as CIDR first
 	if _, _, err := net.ParseCIDR(s); err == nil {
 		return nil
 	}
-	// Try parsing as IP address
-	if net.ParseIP(s) != nil {
+	// Try parsing as IP address (zone identifiers are accepted and ignored)
+	if ipwhitelist.ParseIP(s) != nil {
 		return nil
 	}
 	return fmt.Errorf("not a valid IP address or CIDR range")
@@ -1,10 +1,24 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
 )
 
 const (
@@ -15,7 +29,7 @@ const (
 // clearKeyEnv removes all key-related env vars so each case starts clean.
 func clearKeyEnv(t *testing.T) {
 	t.Helper()
-	for _, k := range []string{"API_KEY", "API_KEYS", "API_KEYS_FILE"} {
+	for _, k := range []string{"API_KEY", "API_KEY_FILE", "API_KEYS", "API_KEYS_FILE"} {
 		t.Setenv(k, "")
 	}
 }
@@ -25,11 +39,11 @@ func TestLoadAPIKeys(t *testing.T) {
 		clearKeyEnv(t)
 		t.Setenv("API_KEY", key32a)
 
-		keys, err := loadAPIKeys()
+		keys, err := loadAPIKeys(&source{})
 		if err != nil {
 			t.Fatalf("loadAPIKeys: %v", err)
 		}
-		if len(keys) != 1 || keys[0].Key != key32a || !keys[0].Scope.IsEmpty() {
+		if len(keys) != 1 || keys[0].Key != key32a || !keys[0].Scope.IsEmpty() || !keys[0].Admin {
 			t.Fatalf("unexpected keys: %+v", keys)
 		}
 	})
@@ -38,7 +52,7 @@ func TestLoadAPIKeys(t *testing.T) {
 		clearKeyEnv(t)
 		t.Setenv("API_KEYS", `[{"name":"dev","key":"`+key32a+`","collections":["Secrets - DEV"]}]`)
 
-		keys, err := loadAPIKeys()
+		keys, err := loadAPIKeys(&source{})
 		if err != nil {
 			t.Fatalf("loadAPIKeys: %v", err)
 		}
@@ -61,7 +75,7 @@ func TestLoadAPIKeys(t *testing.T) {
 		t.Setenv("API_KEYS", `[{"name":"ignored","key":"`+key32a+`"}]`)
 		t.Setenv("API_KEY", key32a)
 
-		keys, err := loadAPIKeys()
+		keys, err := loadAPIKeys(&source{})
 		if err != nil {
 			t.Fatalf("loadAPIKeys: %v", err)
 		}
@@ -76,7 +90,7 @@ func TestLoadAPIKeys(t *testing.T) {
 
 	t.Run("no keys configured", func(t *testing.T) {
 		clearKeyEnv(t)
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error when no keys configured")
 		}
 	})
@@ -84,7 +98,7 @@ func TestLoadAPIKeys(t *testing.T) {
 	t.Run("short key rejected", func(t *testing.T) {
 		clearKeyEnv(t)
 		t.Setenv("API_KEY", "too-short")
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error for short key")
 		}
 	})
@@ -92,7 +106,7 @@ func TestLoadAPIKeys(t *testing.T) {
 	t.Run("malformed JSON rejected", func(t *testing.T) {
 		clearKeyEnv(t)
 		t.Setenv("API_KEYS", `not json`)
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error for malformed JSON")
 		}
 	})
@@ -102,7 +116,7 @@ func TestLoadAPIKeys(t *testing.T) {
 		// "collection" (singular) is a typo for "collections"; must fail loudly
 		// rather than silently leaving the key unscoped (full access).
 		t.Setenv("API_KEYS", `[{"name":"dev","key":"`+key32a+`","collection":["DEV"]}]`)
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error for unknown JSON field")
 		}
 	})
@@ -110,7 +124,7 @@ func TestLoadAPIKeys(t *testing.T) {
 	t.Run("entry missing key rejected", func(t *testing.T) {
 		clearKeyEnv(t)
 		t.Setenv("API_KEYS", `[{"name":"x"}]`)
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error for entry without key")
 		}
 	})
@@ -120,12 +134,65 @@ func TestLoadAPIKeys(t *testing.T) {
 		// Same key string used twice would let one entry silently override the
 		// other's scope in the store.
 		t.Setenv("API_KEYS", `[{"name":"a","key":"`+key32a+`"},{"name":"b","key":"`+key32a+`"}]`)
-		if _, err := loadAPIKeys(); err == nil {
+		if _, err := loadAPIKeys(&source{}); err == nil {
 			t.Error("expected error for duplicate key material")
 		}
 	})
 }
 
+func TestParseRouteAuth(t *testing.T) {
+	t.Parallel()
+
+	policy, err := parseRouteAuth(" GET /secrets=admin, post /refresh=public ,")
+	if err != nil {
+		t.Fatalf("parseRouteAuth: %v", err)
+	}
+	want := auth.RoutePolicy{"GET /secrets": auth.TierAdmin, "POST /refresh": auth.TierPublic}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("policy = %v, want %v", policy, want)
+	}
+
+	for _, bad := range []string{"GET /secrets", "/secrets=admin", "GET secrets=admin", "GET /secrets=root"} {
+		if _, err := parseRouteAuth(bad); err == nil {
+			t.Errorf("parseRouteAuth(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseTTLOverrides(t *testing.T) {
+	t.Parallel()
+
+	got, err := parseTTLOverrides(" rotating-token=30s, Static Cert=24h ,always=0s,")
+	if err != nil {
+		t.Fatalf("parseTTLOverrides: %v", err)
+	}
+	want := map[string]time.Duration{"rotating-token": 30 * time.Second, "Static Cert": 24 * time.Hour, "always": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("overrides = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"token", "=30s", "token=soon", "token=-1s"} {
+		if _, err := parseTTLOverrides(bad); err == nil {
+			t.Errorf("parseTTLOverrides(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseDeviceType(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]int{"": 14, "8": 8, " 0 ": 0, "255": 255} {
+		if got, err := parseDeviceType(in); err != nil || got != want {
+			t.Errorf("parseDeviceType(%q) = (%d, %v), want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"sdk", "-1", "256", "1.5"} {
+		if _, err := parseDeviceType(bad); err == nil {
+			t.Errorf("parseDeviceType(%q): expected error", bad)
+		}
+	}
+}
+
 func TestParseInt(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -181,4 +248,591 @@ func TestLoadRateLimitDefaultsAndOverrides(t *testing.T) {
 			t.Errorf("RateLimitWindow = %v, want 30s", cfg.RateLimitWindow)
 		}
 	})
+
+	t.Run("exempt networks", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_EXEMPT", "10.0.0.0/8, 192.168.1.5")
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if want := []string{"10.0.0.0/8", "192.168.1.5"}; !slices.Equal(cfg.RateLimitExempt, want) {
+			t.Errorf("RateLimitExempt = %v, want %v", cfg.RateLimitExempt, want)
+		}
+
+		t.Setenv("RATE_LIMIT_EXEMPT", "10.0.0.0/33")
+		if _, err := Load(); err == nil {
+			t.Error("Load accepted an invalid RATE_LIMIT_EXEMPT entry")
+		}
+	})
+}
+
+func TestLoadFallbackURLs(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+
+	t.Setenv("VAULTWARDEN_URL", "https://vault-a.example.com/, https://vault-b.example.com")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.VaultwardenURL != "https://vault-a.example.com" || !slices.Equal(cfg.VaultwardenFallbackURLs, []string{"https://vault-b.example.com"}) {
+		t.Errorf("URL = %q, fallbacks %v", cfg.VaultwardenURL, cfg.VaultwardenFallbackURLs)
+	}
+
+	t.Setenv("VAULTWARDEN_URL", "https://vault-a.example.com,ftp://vault-b.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted a non-http fallback URL")
+	}
+}
+
+func TestLoadCertPin(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	const pin = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	tests := []struct {
+		name, url, pins string
+		want            []string
+		wantErr         bool
+	}{
+		{"unset", "https://vault.example.com", "", nil, false},
+		{"pin and backup", "https://vault.example.com", pin + ", " + pin, []string{pin, pin}, false},
+		{"not a hash", "https://vault.example.com", "abc", nil, true},
+		{"plain http", "http://vault.example.com", pin, nil, true},
+		{"plain http replica", "https://vault.example.com,http://vault2.example.com", pin, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VAULTWARDEN_URL", tt.url)
+			t.Setenv("VAULTWARDEN_CERT_PIN", tt.pins)
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(cfg.CertPins, tt.want) {
+				t.Errorf("CertPins = %v, want %v", cfg.CertPins, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadInsecureTLS(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+	t.Setenv("VAULTWARDEN_INSECURE_TLS", "true")
+
+	t.Setenv("ENVIRONMENT", "development")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.InsecureTLS {
+		t.Error("InsecureTLS = false, want true in development")
+	}
+
+	t.Setenv("ENVIRONMENT", "production")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted VAULTWARDEN_INSECURE_TLS in production")
+	}
+}
+
+func TestLoadGRPCPort(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+	t.Setenv("API_PORT", "8080")
+
+	t.Setenv("GRPC_PORT", "9090")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.GRPCPort != "9090" {
+		t.Errorf("GRPCPort = %q, want 9090", cfg.GRPCPort)
+	}
+	for _, bad := range []string{"0", "70000", "grpc", "8080"} {
+		t.Setenv("GRPC_PORT", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted GRPC_PORT=%q", bad)
+		}
+	}
+}
+
+func TestLoadXFFIndex(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	t.Setenv("XFF_INDEX", "2")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.XFFIndex != 2 {
+		t.Errorf("XFFIndex = %d, want 2", cfg.XFFIndex)
+	}
+	for _, bad := range []string{"-1", "last"} {
+		t.Setenv("XFF_INDEX", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted XFF_INDEX=%q", bad)
+		}
+	}
+}
+
+func TestLoadAllowedIPsFile(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	// The file is read by ipwhitelist, not as the ALLOWED_IPS value.
+	t.Setenv("ALLOWED_IPS_FILE", "/nonexistent/allowed-ips")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.AllowedIPsFile != "/nonexistent/allowed-ips" || len(cfg.AllowedIPs) != 0 {
+		t.Errorf("AllowedIPsFile = %q, AllowedIPs = %v", cfg.AllowedIPsFile, cfg.AllowedIPs)
+	}
+
+	t.Setenv("ALLOWED_IPS", "10.0.0.1")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted both ALLOWED_IPS and ALLOWED_IPS_FILE")
+	}
+}
+
+func TestLoadDynamicWhitelist(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	t.Setenv("ALLOW_DYNAMIC_WHITELIST", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted ALLOW_DYNAMIC_WHITELIST without ALLOWED_IPS")
+	}
+
+	t.Setenv("ALLOWED_IPS", "10.0.0.0/8")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.AllowDynamicWhitelist || cfg.DynamicWhitelistMaxTTL != 24*time.Hour {
+		t.Errorf("AllowDynamicWhitelist = %v, DynamicWhitelistMaxTTL = %v", cfg.AllowDynamicWhitelist, cfg.DynamicWhitelistMaxTTL)
+	}
+}
+
+func TestLoadCircuitBreaker(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CircuitBreakerThreshold != 5 || cfg.CircuitBreakerCooldown != 30*time.Second {
+		t.Errorf("defaults = %d, %v, want 5, 30s", cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown)
+	}
+
+	t.Setenv("CIRCUIT_BREAKER_THRESHOLD", "0")
+	if cfg, err := Load(); err != nil || cfg.CircuitBreakerThreshold != 0 {
+		t.Errorf("CIRCUIT_BREAKER_THRESHOLD=0: threshold %v, err %v, want 0 (disabled)", cfg, err)
+	}
+
+	for key, bad := range map[string]string{"CIRCUIT_BREAKER_THRESHOLD": "-1", "CIRCUIT_BREAKER_COOLDOWN": "0s"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, bad)
+			if _, err := Load(); err == nil {
+				t.Errorf("Load accepted %s=%s", key, bad)
+			}
+		})
+	}
+}
+
+func TestLoadAllowExport(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+	t.Setenv("ALLOW_EXPORT", "true")
+
+	t.Setenv("ALLOWED_IPS", "10.0.0.5")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted ALLOW_EXPORT without RESPONSE_ENCRYPTION_KEY")
+	}
+
+	t.Setenv("RESPONSE_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	t.Setenv("ALLOWED_IPS", "")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted ALLOW_EXPORT without ALLOWED_IPS")
+	}
+
+	t.Setenv("ALLOWED_IPS", "10.0.0.5")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.AllowExport {
+		t.Error("AllowExport = false, want true")
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	clearKeyEnv(t)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+	t.Setenv("VAULTWARDEN_PASSWORD", "")
+	t.Setenv("API_KEY_FILE", write("api_key", key32a+"\n"))
+	t.Setenv("VAULTWARDEN_PASSWORD_FILE", write("password", "pa ss\r\n"))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Key != key32a {
+		t.Errorf("APIKeys = %+v, want the key from API_KEY_FILE", cfg.APIKeys)
+	}
+	if cfg.VaultwardenPassword != "pa ss" {
+		t.Errorf("VaultwardenPassword = %q, want %q (trailing newline trimmed)", cfg.VaultwardenPassword, "pa ss")
+	}
+
+	t.Run("both set", func(t *testing.T) {
+		t.Setenv("VAULTWARDEN_PASSWORD", "inline")
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "VAULTWARDEN_PASSWORD_FILE") {
+			t.Errorf("err = %v, want a conflict naming VAULTWARDEN_PASSWORD_FILE", err)
+		}
+	})
+
+	t.Run("unreadable file", func(t *testing.T) {
+		t.Setenv("API_KEY_FILE", filepath.Join(dir, "missing"))
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "API_KEY_FILE") {
+			t.Errorf("err = %v, want a read error naming API_KEY_FILE", err)
+		}
+	})
+}
+
+func TestLoadResponseEncryptionKey(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	t.Setenv("RESPONSE_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.ResponseEncryptionKey) != 32 {
+		t.Errorf("ResponseEncryptionKey has %d bytes, want 32", len(cfg.ResponseEncryptionKey))
+	}
+
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		t.Setenv("RESPONSE_ENCRYPTION_KEY", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted RESPONSE_ENCRYPTION_KEY=%q", bad)
+		}
+	}
+}
+
+func TestLoadExtractionOrder(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !slices.Equal(cfg.ExtractionOrder, vaultwarden.DefaultExtractionOrder) {
+		t.Errorf("ExtractionOrder = %v, want the default", cfg.ExtractionOrder)
+	}
+
+	t.Setenv("EXTRACTION_ORDER", "field:apikey,password")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []vaultwarden.ExtractionStep{{Source: vaultwarden.SourceField, Field: "apikey"}, {Source: vaultwarden.SourcePassword}}
+	if !slices.Equal(cfg.ExtractionOrder, want) {
+		t.Errorf("ExtractionOrder = %v, want %v", cfg.ExtractionOrder, want)
+	}
+
+	t.Setenv("EXTRACTION_ORDER", "password,secret")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted an unknown extraction step")
+	}
+}
+
+func TestLoadAPIKeyHeader(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	t.Setenv("API_KEY_HEADER", "X-API-Key")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.APIKeyHeader != "X-API-Key" {
+		t.Errorf("APIKeyHeader = %q", cfg.APIKeyHeader)
+	}
+	for _, name := range []string{"authorization", "X API Key"} {
+		t.Setenv("API_KEY_HEADER", name)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted API_KEY_HEADER=%q", name)
+		}
+	}
+}
+
+func TestLoadCORS(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CORSAllowedMethods != "" || cfg.CORSAllowedHeaders != DefaultCORSAllowedHeaders {
+		t.Errorf("methods %q, headers %q; want the defaults", cfg.CORSAllowedMethods, cfg.CORSAllowedHeaders)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, http://localhost:3000/")
+	t.Setenv("CORS_ALLOWED_METHODS", "get, post,delete")
+	t.Setenv("CORS_ALLOWED_HEADERS", "Authorization, X-Trace")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CORSAllowedMethods != "GET,POST,DELETE" || cfg.CORSAllowedHeaders != "Authorization,X-Trace" {
+		t.Errorf("methods %q, headers %q", cfg.CORSAllowedMethods, cfg.CORSAllowedHeaders)
+	}
+
+	for key, value := range map[string]string{
+		"CORS_ALLOWED_ORIGINS": "app.example.com",
+		"CORS_ALLOWED_METHODS": "GET,FETCH",
+		"CORS_ALLOWED_HEADERS": "X Trace",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Errorf("Load accepted %s=%q", key, value)
+			}
+		})
+	}
+	for _, origin := range []string{"ftp://example.com", "https://example.com/app", "https://user@example.com"} {
+		t.Setenv("CORS_ALLOWED_ORIGINS", origin)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted origin %q", origin)
+		}
+	}
+}
+
+func TestLoadTokenSigningKey(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	t.Setenv("TOKEN_SIGNING_KEY", base64.StdEncoding.EncodeToString(make([]byte, 48)))
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.TokenSigningKey) != 48 || cfg.TokenMaxTTL != time.Hour {
+		t.Errorf("TokenSigningKey has %d bytes, TokenMaxTTL %v; want 48 and 1h", len(cfg.TokenSigningKey), cfg.TokenMaxTTL)
+	}
+
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		t.Setenv("TOKEN_SIGNING_KEY", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load accepted TOKEN_SIGNING_KEY=%q", bad)
+		}
+	}
+}
+
+func TestLoadClientCert(t *testing.T) {
+	clearKeyEnv(t)
+	t.Setenv("API_KEY", key32a)
+	t.Setenv("VAULTWARDEN_URL", "https://vault.example.com")
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeTestKeyPair(t, certFile, keyFile)
+
+	t.Run("pair", func(t *testing.T) {
+		t.Setenv("VAULTWARDEN_CLIENT_CERT", certFile)
+		t.Setenv("VAULTWARDEN_CLIENT_KEY", keyFile)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if cfg.ClientCert == nil {
+			t.Error("ClientCert not loaded")
+		}
+	})
+	t.Run("cert without key", func(t *testing.T) {
+		t.Setenv("VAULTWARDEN_CLIENT_CERT", certFile)
+		t.Setenv("VAULTWARDEN_CLIENT_KEY", "")
+		if _, err := Load(); err == nil {
+			t.Error("Load accepted a client certificate without a key")
+		}
+	})
+	t.Run("mismatched files", func(t *testing.T) {
+		t.Setenv("VAULTWARDEN_CLIENT_CERT", certFile)
+		t.Setenv("VAULTWARDEN_CLIENT_KEY", certFile)
+		if _, err := Load(); err == nil {
+			t.Error("Load accepted a certificate as its own key")
+		}
+	})
+}
+
+// writeTestKeyPair writes a throwaway self-signed certificate and its key as PEM.
+func writeTestKeyPair(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	clearKeyEnv(t)
+	for _, k := range []string{"VAULTWARDEN_URL", "RATE_LIMIT_MAX", "ALLOWED_IPS", "CACHE_TTL_OVERRIDES"} {
+		t.Setenv(k, "")
+	}
+
+	write := func(t *testing.T, name, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	yamlConfig := `
+vaultwarden_url: https://vault.example.com/
+rate_limit_max: 50
+allowed_ips: [10.0.0.0/8, 192.168.1.10]
+cache_ttl_overrides:
+  rotating-token: 30s
+api_keys:
+  - name: ci
+    key: ` + key32a + `
+    collections: [CI]
+`
+
+	t.Run("yaml", func(t *testing.T) {
+		cfg, err := LoadFromFile(write(t, "config.yaml", yamlConfig))
+		if err != nil {
+			t.Fatalf("LoadFromFile: %v", err)
+		}
+		if cfg.VaultwardenURL != "https://vault.example.com" || cfg.RateLimitMax != 50 {
+			t.Errorf("unexpected config: url=%q max=%d", cfg.VaultwardenURL, cfg.RateLimitMax)
+		}
+		if !reflect.DeepEqual(cfg.AllowedIPs, []string{"10.0.0.0/8", "192.168.1.10"}) {
+			t.Errorf("AllowedIPs = %v", cfg.AllowedIPs)
+		}
+		if cfg.CacheTTLOverrides["rotating-token"] != 30*time.Second {
+			t.Errorf("CacheTTLOverrides = %v", cfg.CacheTTLOverrides)
+		}
+		if len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Name != "ci" || len(cfg.APIKeys[0].Scope.Collections) != 1 {
+			t.Errorf("APIKeys = %+v", cfg.APIKeys)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		cfg, err := LoadFromFile(write(t, "config.json", `{"vaultwarden_url":"https://vault.example.com","api_key":"`+key32b+`","rate_limit_max":40}`))
+		if err != nil {
+			t.Fatalf("LoadFromFile: %v", err)
+		}
+		if cfg.RateLimitMax != 40 || len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Key != key32b {
+			t.Errorf("unexpected config: max=%d keys=%+v", cfg.RateLimitMax, cfg.APIKeys)
+		}
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_MAX", "7")
+		cfg, err := LoadFromFile(write(t, "config.yaml", yamlConfig))
+		if err != nil {
+			t.Fatalf("LoadFromFile: %v", err)
+		}
+		if cfg.RateLimitMax != 7 {
+			t.Errorf("RateLimitMax = %d, want env value 7", cfg.RateLimitMax)
+		}
+	})
+
+	t.Run("env KEY_FILE overrides file KEY", func(t *testing.T) {
+		keyFile := write(t, "api_key", key32b+"\n")
+		t.Setenv("API_KEY_FILE", keyFile)
+		cfg, err := LoadFromFile(write(t, "config.json", `{"vaultwarden_url":"https://vault.example.com","api_key":"`+key32a+`"}`))
+		if err != nil {
+			t.Fatalf("LoadFromFile: %v", err)
+		}
+		if len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Key != key32b {
+			t.Errorf("APIKeys = %+v, want the key from API_KEY_FILE", cfg.APIKeys)
+		}
+	})
+
+	t.Run("KEY and KEY_FILE both in the file", func(t *testing.T) {
+		keyFile := write(t, "api_key", key32b+"\n")
+		_, err := LoadFromFile(write(t, "config.json", `{"vaultwarden_url":"https://vault.example.com","api_key":"`+key32a+`","api_key_file":"`+keyFile+`"}`))
+		if err == nil || !strings.Contains(err.Error(), "API_KEY and API_KEY_FILE are both set") {
+			t.Errorf("err = %v, want a conflict", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name, file, content, wantErr string
+	}{
+		{"unknown field", "config.yaml", "vaultwarden_url: https://vault.example.com\napi_key: " + key32a + "\nrate_limt_max: 5\n", `rate_limt_max`},
+		{"short key", "config.yaml", "vaultwarden_url: https://vault.example.com\napi_key: short\n", `field "api_key"`},
+		{"bad scheme", "config.json", `{"vaultwarden_url":"ftp://vault.example.com","api_key":"` + key32a + `"}`, `field "vaultwarden_url"`},
+		{"bad extension", "config.toml", "", "unsupported config file extension"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFromFile(write(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRangeProviders(t *testing.T) {
+	got, err := parseRangeProviders("gitlab=https://example.com/r.json|prefixes.ipv4|prefixes.ipv6, runners = https://ci.example.com/r.json|cidrs")
+	if err != nil {
+		t.Fatalf("parseRangeProviders: %v", err)
+	}
+	want := []ipwhitelist.RangeProvider{
+		{Name: "gitlab", URL: "https://example.com/r.json", Selectors: []string{"prefixes.ipv4", "prefixes.ipv6"}},
+		{Name: "runners", URL: "https://ci.example.com/r.json", Selectors: []string{"cidrs"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRangeProviders = %+v, want %+v", got, want)
+	}
+
+	for _, raw := range []string{"gitlab", "gitlab=https://example.com/r.json", "gitlab=ftp://example.com|cidrs", "=https://example.com|cidrs"} {
+		if _, err := parseRangeProviders(raw); err == nil {
+			t.Errorf("parseRangeProviders(%q) should fail", raw)
+		}
+	}
 }
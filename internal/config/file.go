@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// source resolves configuration keys. A non-empty environment variable always
+// wins; otherwise the value comes from the config file, if one was loaded.
+type source struct {
+	path string            // config file path, empty for env-only
+	file map[string]string // file values keyed by env var name
+	used map[string]bool   // keys read during load, to detect unknown fields
+	err  error             // first KEY_FILE problem, reported by load
+}
+
+// ownFileSettings are settings whose KEY_FILE name is a setting of its own
+// with a different format, so the generic KEY_FILE lookup must skip them.
+var ownFileSettings = map[string]bool{
+	"API_KEYS":    true, // API_KEYS_FILE is a JSON key list
+	"ALLOWED_IPS": true, // ALLOWED_IPS_FILE is watched and reloaded by ipwhitelist
+}
+
+// get returns the value for an env var name, or "" if it is unset everywhere.
+//
+// Any setting can instead be read from a file named by KEY_FILE (the Docker and
+// Kubernetes secrets convention), keeping values such as passwords out of the
+// process environment. Trailing newlines are trimmed. KEY and KEY_FILE are
+// resolved together, so either one in the environment overrides both in the
+// config file; setting both in the same place is an error.
+func (s *source) get(key string) string {
+	if s.used == nil {
+		s.used = make(map[string]bool)
+	}
+	s.used[key] = true
+	if strings.HasSuffix(key, "_FILE") || ownFileSettings[key] {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return s.file[key]
+	}
+
+	fileSetting := key + "_FILE"
+	s.used[fileSetting] = true
+	value, path := os.Getenv(key), os.Getenv(fileSetting)
+	if value == "" && path == "" {
+		value, path = s.file[key], s.file[fileSetting]
+	}
+	if path == "" {
+		return value
+	}
+	if value != "" {
+		s.fail(fmt.Errorf("%s and %s are both set; use only one", key, fileSetting))
+		return value
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to read %s: %w", fileSetting, err))
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// fail records the first KEY_FILE problem found during load.
+func (s *source) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// getOr returns the value for key, or defaultValue if it is unset everywhere.
+func (s *source) getOr(key, defaultValue string) string {
+	if value := s.get(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// fromFile reports whether the value for key was taken from the config file.
+func (s *source) fromFile(key string) bool {
+	return os.Getenv(key) == "" && os.Getenv(key+"_FILE") == "" && s.file[key] != ""
+}
+
+// wrap attributes a validation error to the file field it came from, so
+// problems in CONFIG_FILE name the offending field rather than an env var the
+// operator never set. Errors for env-sourced values are returned unchanged.
+func (s *source) wrap(key string, err error) error {
+	if err == nil || !s.fromFile(key) {
+		return err
+	}
+	return fmt.Errorf("%s: field %q: %w", s.path, fileKey(key), err)
+}
+
+// unknownFields returns the file fields that no setting consumed, sorted.
+func (s *source) unknownFields() []string {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, fileKey(key))
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// fileKey is the config file spelling of an env var name (API_PORT -> api_port).
+func fileKey(envKey string) string {
+	return strings.ToLower(envKey)
+}
+
+// readConfigFile parses a YAML (.yaml, .yml) or JSON (.json) config file into
+// flat string values keyed by env var name, using the same syntax the env var
+// would accept: lists are comma-joined, maps become "key=value" entries, and
+// lists of objects (api_keys) are re-encoded as JSON.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (want .yaml, .yml or .json)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for field, v := range raw {
+		s, err := flattenValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: field %q: %w", path, field, err)
+		}
+		values[strings.ToUpper(field)] = s
+	}
+	return values, nil
+}
+
+// flattenValue renders a decoded file value in its env var string form.
+func flattenValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		if slices.ContainsFunc(v, func(e any) bool { _, ok := e.(map[string]any); return ok }) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		}
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			s, err := scalarString(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		parts := make([]string, 0, len(v))
+		for _, k := range keys {
+			s, err := scalarString(v[k])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, k+"="+s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return scalarString(v)
+	}
+}
+
+// scalarString renders a string, number or boolean.
+func scalarString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
@@ -0,0 +1,300 @@
+// Package grpcapi serves secrets over gRPC next to the REST API, from the same
+// vault client and with the same API keys, key scopes and IP whitelist.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime/debug"
+	"strings"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/audit"
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/grpcapi/secretsv1"
+	"github.com/Turbootzz/vaultwarden-api/internal/handlers"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/internal/validators"
+	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"github.com/Turbootzz/vaultwarden-api/internal/webhook"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxPrefixResults caps the number of names returned for a prefix, as on
+// GET /secrets?prefix=.
+const maxPrefixResults = 100
+
+// Server implements the Secrets service.
+type Server struct {
+	secretsv1.UnimplementedSecretsServer
+
+	vaultClient *vaultwarden.Client
+	keys        *auth.Store
+	whitelist   *ipwhitelist.IPWhitelist // nil allows every address
+	audit       *audit.Logger            // nil disables the audit log
+	events      *webhook.Notifier        // nil disables webhooks
+}
+
+// Option configures NewServer.
+type Option func(*Server)
+
+// WithIPWhitelist applies the whitelist and denylist to the peer address.
+// There is no proxy in front of gRPC, so forwarded addresses are not used.
+func WithIPWhitelist(wl *ipwhitelist.IPWhitelist) Option {
+	return func(s *Server) {
+		s.whitelist = wl
+	}
+}
+
+// WithAudit records every secret read in the audit log, as the REST routes do.
+func WithAudit(l *audit.Logger) Option {
+	return func(s *Server) {
+		s.audit = l
+	}
+}
+
+// WithWebhook sends the auth_failure and cache_refresh events of the REST
+// routes for gRPC calls too.
+func WithWebhook(n *webhook.Notifier) Option {
+	return func(s *Server) {
+		s.events = n
+	}
+}
+
+// NewServer returns a gRPC server with the Secrets service registered. Every
+// call is checked against the IP whitelist and keys before it is handled.
+func NewServer(vaultClient *vaultwarden.Client, keys *auth.Store, opts ...Option) *grpc.Server {
+	s := &Server{vaultClient: vaultClient, keys: keys}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverPanic, s.authenticate))
+	secretsv1.RegisterSecretsServer(srv, s)
+	return srv
+}
+
+// keyCtxKey is the context key of the authenticated APIKey.
+type keyCtxKey struct{}
+
+// recoverPanic turns a panicking handler into an Internal error, as the
+// recover middleware does for REST, instead of crashing the process.
+func recoverPanic(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error.Printf("Panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// authenticate enforces the IP whitelist, then requires a configured API key
+// as "authorization: Bearer <key>" metadata and attaches it to the context.
+func (s *Server) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ip := peerIP(ctx)
+	if s.whitelist != nil {
+		if s.whitelist.IsBlocked(ip) {
+			logger.Warn.Printf("IP blocked (denylist): %s on gRPC %s", ip, info.FullMethod)
+			return nil, status.Error(codes.PermissionDenied, "access denied: IP blocked")
+		}
+		if s.whitelist.HasAllowRules() && !s.whitelist.IsAllowed(ip) {
+			logger.Warn.Printf("IP blocked (not whitelisted): %s on gRPC %s", ip, info.FullMethod)
+			return nil, status.Error(codes.PermissionDenied, "access denied: IP not whitelisted")
+		}
+	}
+
+	provided, reason := bearerKey(ctx)
+	key, ok := s.keys.Match(provided)
+	if reason == "" && !ok {
+		reason = "invalid_key"
+	}
+	if reason != "" {
+		logger.Warn.Printf("Rejected gRPC %s from IP: %s (%s)", info.FullMethod, ip, reason)
+		metrics.AuthFailures.WithLabelValues(reason).Inc()
+		s.events.Notify(webhook.Event{
+			Type:           webhook.EventAuthFailure,
+			ClientIP:       ip,
+			Reason:         reason,
+			KeyFingerprint: webhook.Fingerprint(provided),
+		})
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid api key")
+	}
+
+	key.Key = ""
+	return handler(context.WithValue(ctx, keyCtxKey{}, key), req)
+}
+
+// bearerKey returns the key from the "authorization" metadata, or the failure
+// reason (missing_header or invalid_format) used by the REST middleware.
+func bearerKey(ctx context.Context) (key, reason string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		return "", "missing_header"
+	}
+	scheme, provided, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", "invalid_format"
+	}
+	return provided, ""
+}
+
+// peerIP returns the address of the calling peer without its port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// scopedFilter returns the lookup filter for the caller's key scope, or false
+// when the scope resolves to nothing and the call must be denied.
+func (s *Server) scopedFilter(ctx context.Context) (vaultwarden.SecretFilter, bool) {
+	var filter vaultwarden.SecretFilter
+	key, ok := ctx.Value(keyCtxKey{}).(auth.APIKey)
+	if !ok {
+		return filter, false // not authenticated: fail closed
+	}
+	return filter, handlers.ApplyScope(s.vaultClient, key.Scope, &filter)
+}
+
+// GetSecret implements secretsv1.SecretsServer.
+func (s *Server) GetSecret(ctx context.Context, req *secretsv1.GetSecretRequest) (*secretsv1.GetSecretResponse, error) {
+	name := strings.TrimSpace(req.GetName())
+	if name == "" || !validators.IsValidSecretName(name) {
+		return nil, status.Error(codes.InvalidArgument, "invalid secret name format")
+	}
+	field := strings.TrimSpace(req.GetField())
+	if field != "" && !validators.IsValidFieldName(field) {
+		return nil, status.Error(codes.InvalidArgument, "invalid field name")
+	}
+
+	filter, ok := s.scopedFilter(ctx)
+	if !ok {
+		logger.Warn.Printf("gRPC GetSecret denied by key scope from IP: %s", peerIP(ctx))
+		return nil, status.Error(codes.NotFound, "secret not found")
+	}
+
+	res, err := s.vaultClient.GetSecretResult(ctx, name, field, filter)
+	s.recordAccess(ctx, name, field, err)
+	if err != nil {
+		return nil, lookupStatus(err)
+	}
+	metrics.SecretValueBytes.Observe(float64(len(res.Value)))
+	return &secretsv1.GetSecretResponse{Name: name, Value: res.Value, Stale: res.Stale}, nil
+}
+
+// ListSecrets implements secretsv1.SecretsServer.
+func (s *Server) ListSecrets(ctx context.Context, req *secretsv1.ListSecretsRequest) (*secretsv1.ListSecretsResponse, error) {
+	prefix := req.GetPrefix()
+	if prefix != "" && !validators.IsValidFilterQueryValue(prefix) {
+		return nil, status.Error(codes.InvalidArgument, "invalid prefix")
+	}
+
+	filter, ok := s.scopedFilter(ctx)
+	if !ok {
+		logger.Warn.Printf("gRPC ListSecrets denied by key scope from IP: %s", peerIP(ctx))
+		return &secretsv1.ListSecretsResponse{}, nil
+	}
+
+	names, err := s.vaultClient.ListSecretsContext(ctx, filter, 0)
+	if err != nil {
+		logger.Error.Printf("Failed to list secrets over gRPC (requested by IP: %s): %v", peerIP(ctx), err)
+		return nil, status.Error(codes.Unavailable, "failed to list secrets")
+	}
+	if prefix == "" {
+		return &secretsv1.ListSecretsResponse{Names: names}, nil
+	}
+
+	resp := &secretsv1.ListSecretsResponse{}
+	for _, name := range names {
+		if len(name) < len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+			continue
+		}
+		if len(resp.Names) == maxPrefixResults {
+			resp.Truncated = true
+			break
+		}
+		resp.Names = append(resp.Names, name)
+	}
+	return resp, nil
+}
+
+// RefreshCache implements secretsv1.SecretsServer.
+func (s *Server) RefreshCache(ctx context.Context, _ *secretsv1.RefreshCacheRequest) (*secretsv1.RefreshCacheResponse, error) {
+	if _, err := s.vaultClient.SyncNow(ctx); err != nil {
+		logger.Error.Printf("gRPC cache refresh sync failed: %v", err)
+		if errors.Is(err, vaultwarden.ErrAuthFailed) {
+			return nil, status.Error(codes.Internal, "vaultwarden authentication failed")
+		}
+		return nil, status.Error(codes.Unavailable, "vaultwarden unavailable")
+	}
+
+	logger.Info.Printf("Cache refresh requested over gRPC (by IP: %s)", peerIP(ctx))
+	s.events.Notify(webhook.Event{Type: webhook.EventCacheRefresh, ClientIP: peerIP(ctx)})
+	return &secretsv1.RefreshCacheResponse{}, nil
+}
+
+// lookupStatus maps a lookup error to the gRPC status matching the REST
+// response for it.
+func lookupStatus(err error) error {
+	switch {
+	case errors.Is(err, vaultwarden.ErrFieldNotFound):
+		return status.Error(codes.NotFound, "field not found")
+	case errors.Is(err, vaultwarden.ErrSecretDeleted):
+		return status.Error(codes.NotFound, "secret deleted")
+	case errors.Is(err, vaultwarden.ErrAuthFailed):
+		return status.Error(codes.Internal, "vaultwarden authentication failed")
+	case errors.Is(err, vaultwarden.ErrUpstreamUnavailable), errors.Is(err, vaultwarden.ErrNotSynced):
+		return status.Error(codes.Unavailable, "vaultwarden unavailable")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.NotFound, "secret not found")
+}
+
+// recordAccess writes an audit event for a read of secretName; err is the
+// lookup error (nil when the read succeeded).
+func (s *Server) recordAccess(ctx context.Context, secretName, field string, err error) {
+	if s.audit == nil {
+		return
+	}
+	ev := audit.Event{
+		ClientIP: peerIP(ctx),
+		Route:    "gRPC " + grpcMethod(ctx),
+		Secret:   secretName,
+		Field:    field,
+	}
+	if key, ok := ctx.Value(keyCtxKey{}).(auth.APIKey); ok {
+		ev.KeyName = key.Name
+	}
+	switch {
+	case err == nil:
+		ev.Outcome = audit.OutcomeSuccess
+	case errors.Is(err, vaultwarden.ErrSecretNotFound), errors.Is(err, vaultwarden.ErrFieldNotFound):
+		ev.Outcome = audit.OutcomeNotFound
+	case errors.Is(err, vaultwarden.ErrSecretDeleted):
+		ev.Outcome = audit.OutcomeDeleted
+	default:
+		ev.Outcome = audit.OutcomeError
+	}
+	s.audit.Record(ev)
+}
+
+// grpcMethod returns the full method name of the call handled in ctx.
+func grpcMethod(ctx context.Context) string {
+	method, _ := grpc.Method(ctx)
+	return method
+}
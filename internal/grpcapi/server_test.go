@@ -0,0 +1,198 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/audit"
+	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/grpcapi/secretsv1"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testOrgID      = "11111111-1111-4111-8111-111111111111"
+	testOtherOrgID = "22222222-2222-4222-8222-222222222222"
+
+	fullKey   = "grpc-full-access-key-0000000000000000000000"
+	scopedKey = "grpc-scoped-key-11111111111111111111111111"
+)
+
+func testClient() *vaultwarden.Client {
+	items := map[string]vaultwarden.DecryptedItem{
+		"cipher-1": {ID: "cipher-1", Type: vaultwarden.CipherTypeLogin, Name: "db-password", Username: "dbuser", Password: "s3cret", OrganizationID: testOrgID},
+		"cipher-2": {ID: "cipher-2", Type: vaultwarden.CipherTypeLogin, Name: "other-password", Password: "other-org", OrganizationID: testOtherOrgID},
+		"cipher-3": {ID: "cipher-3", Type: vaultwarden.CipherTypeLogin, Name: "retired-token", Password: "old", Deleted: true},
+	}
+	nameMaps := vaultwarden.SyncNameMaps{Organizations: map[string]string{testOrgID: "Acme", testOtherOrgID: "Other"}}
+	return vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(items, nameMaps))
+}
+
+type auditSink struct{ events []audit.Event }
+
+func (s *auditSink) Write(ev audit.Event) error {
+	s.events = append(s.events, ev)
+	return nil
+}
+
+// dial serves a Server built with opts over an in-memory listener and returns
+// a client for it.
+func dial(t *testing.T, opts ...Option) secretsv1.SecretsClient {
+	t.Helper()
+	keys := auth.NewStore([]auth.APIKey{
+		{Name: "full", Key: fullKey},
+		{Name: "acme", Key: scopedKey, Scope: auth.Scope{Organizations: []string{"Acme"}}},
+	})
+	srv := NewServer(testClient(), keys, opts...)
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return secretsv1.NewSecretsClient(conn)
+}
+
+func withKey(t *testing.T, key string) context.Context {
+	return metadata.AppendToOutgoingContext(t.Context(), "authorization", "Bearer "+key)
+}
+
+func TestGetSecret(t *testing.T) {
+	client := dial(t)
+
+	tests := []struct {
+		name string
+		key  string
+		req  *secretsv1.GetSecretRequest
+		want string
+		code codes.Code
+	}{
+		{"value", fullKey, &secretsv1.GetSecretRequest{Name: "db-password"}, "s3cret", codes.OK},
+		{"field", fullKey, &secretsv1.GetSecretRequest{Name: "db-password", Field: "username"}, "dbuser", codes.OK},
+		{"missing", fullKey, &secretsv1.GetSecretRequest{Name: "missing"}, "", codes.NotFound},
+		{"deleted", fullKey, &secretsv1.GetSecretRequest{Name: "retired-token"}, "", codes.NotFound},
+		{"invalid name", fullKey, &secretsv1.GetSecretRequest{Name: ".."}, "", codes.InvalidArgument},
+		{"in scope", scopedKey, &secretsv1.GetSecretRequest{Name: "db-password"}, "s3cret", codes.OK},
+		{"out of scope", scopedKey, &secretsv1.GetSecretRequest{Name: "other-password"}, "", codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetSecret(withKey(t, tt.key), tt.req)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err %v)", code, tt.code, err)
+			}
+			if resp.GetValue() != tt.want {
+				t.Errorf("value = %q, want %q", resp.GetValue(), tt.want)
+			}
+		})
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	client := dial(t)
+
+	resp, err := client.ListSecrets(withKey(t, fullKey), &secretsv1.ListSecretsRequest{})
+	if err != nil {
+		t.Fatalf("ListSecrets: %v", err)
+	}
+	if want := []string{"db-password", "other-password"}; !reflect.DeepEqual(resp.GetNames(), want) {
+		t.Errorf("names = %v, want %v", resp.GetNames(), want)
+	}
+
+	resp, err = client.ListSecrets(withKey(t, fullKey), &secretsv1.ListSecretsRequest{Prefix: "DB-"})
+	if err != nil {
+		t.Fatalf("ListSecrets: %v", err)
+	}
+	if want := []string{"db-password"}; !reflect.DeepEqual(resp.GetNames(), want) || resp.GetTruncated() {
+		t.Errorf("prefix names = %v (truncated %t), want %v", resp.GetNames(), resp.GetTruncated(), want)
+	}
+
+	resp, err = client.ListSecrets(withKey(t, scopedKey), &secretsv1.ListSecretsRequest{})
+	if err != nil {
+		t.Fatalf("ListSecrets: %v", err)
+	}
+	if want := []string{"db-password"}; !reflect.DeepEqual(resp.GetNames(), want) {
+		t.Errorf("scoped names = %v, want %v", resp.GetNames(), want)
+	}
+}
+
+func TestRefreshCache(t *testing.T) {
+	client := dial(t)
+	if _, err := client.RefreshCache(withKey(t, fullKey), &secretsv1.RefreshCacheRequest{}); err != nil {
+		t.Fatalf("RefreshCache: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	client := dial(t)
+	req := &secretsv1.GetSecretRequest{Name: "db-password"}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"no metadata", t.Context()},
+		{"wrong scheme", metadata.AppendToOutgoingContext(t.Context(), "authorization", "Basic "+fullKey)},
+		{"unknown key", withKey(t, "not-a-configured-key-000000000000000000")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.GetSecret(tt.ctx, req)
+			if code := status.Code(err); code != codes.Unauthenticated {
+				t.Errorf("code = %v, want Unauthenticated", code)
+			}
+		})
+	}
+}
+
+func TestIPWhitelist(t *testing.T) {
+	// bufconn peers have no IP address, so no allow rule can match them.
+	wl, err := ipwhitelist.New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dial(t, WithIPWhitelist(wl))
+
+	_, err = client.GetSecret(withKey(t, fullKey), &secretsv1.GetSecretRequest{Name: "db-password"})
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("code = %v, want PermissionDenied", code)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	sink := &auditSink{}
+	log := audit.New(sink)
+	client := dial(t, WithAudit(log))
+
+	if _, err := client.GetSecret(withKey(t, fullKey), &secretsv1.GetSecretRequest{Name: "db-password"}); err != nil {
+		t.Fatalf("GetSecret: %v", err)
+	}
+	if _, err := client.GetSecret(withKey(t, fullKey), &secretsv1.GetSecretRequest{Name: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("GetSecret(missing): %v", err)
+	}
+	log.Close()
+
+	want := []string{audit.OutcomeSuccess, audit.OutcomeNotFound}
+	if len(sink.events) != len(want) {
+		t.Fatalf("events = %+v, want %d", sink.events, len(want))
+	}
+	for i, ev := range sink.events {
+		if ev.Outcome != want[i] || ev.KeyName != "full" || ev.Route != "gRPC /secrets.v1.Secrets/GetSecret" {
+			t.Errorf("event %d = %+v, want %s by full on GetSecret", i, ev, want[i])
+		}
+	}
+}
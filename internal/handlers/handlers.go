@@ -2,14 +2,28 @@
 package handlers
 
 import (
+	"bufio"
+	"cmp"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/audit"
 	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
 	"github.com/Turbootzz/vaultwarden-api/internal/validators"
 	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"github.com/Turbootzz/vaultwarden-api/internal/version"
+	"github.com/Turbootzz/vaultwarden-api/internal/webhook"
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -18,23 +32,211 @@ import (
 // Handler contains all HTTP handlers.
 type Handler struct {
 	vaultClient *vaultwarden.Client
+
+	// sizeWarnBytes logs a warning when a returned value exceeds it (0 disables).
+	sizeWarnBytes int
+
+	// events receives security events such as cache refreshes (nil disables).
+	events *webhook.Notifier
+
+	// audit records every secret access (nil disables).
+	audit *audit.Logger
+
+	// sealer encrypts values for clients that ask for it (nil disables).
+	sealer cipher.AEAD
+
+	// tokens signs single-secret tokens for POST /token, valid for at most
+	// tokenMaxTTL (nil disables).
+	tokens      *auth.TokenSigner
+	tokenMaxTTL time.Duration
+
+	// verboseHealth lets GET /health?verbose=true report cache and auth state.
+	verboseHealth bool
+
+	// whitelist takes temporary entries from /whitelist, each for at most
+	// whitelistMaxTTL (nil disables).
+	whitelist       *ipwhitelist.IPWhitelist
+	whitelistMaxTTL time.Duration
+}
+
+// Option configures NewHandler.
+type Option func(*Handler)
+
+// WithValueSizeWarning logs a warning whenever a returned secret value is larger
+// than maxBytes. The value itself is never logged.
+func WithValueSizeWarning(maxBytes int) Option {
+	return func(h *Handler) {
+		h.sizeWarnBytes = maxBytes
+	}
+}
+
+// WithWebhook reports security events (e.g. POST /refresh) to n.
+func WithWebhook(n *webhook.Notifier) Option {
+	return func(h *Handler) {
+		h.events = n
+	}
+}
+
+// WithAudit records every secret access (key, client IP, name, outcome) to l.
+func WithAudit(l *audit.Logger) Option {
+	return func(h *Handler) {
+		h.audit = l
+	}
+}
+
+// WithResponseEncryption lets clients that send X-Response-Encryption receive
+// secret values sealed with aead (AES-256-GCM with the shared key) instead of
+// plaintext.
+func WithResponseEncryption(aead cipher.AEAD) Option {
+	return func(h *Handler) {
+		h.sealer = aead
+	}
+}
+
+// WithTokenSigner lets unscoped keys mint signed tokens for a single secret
+// with POST /token, each valid for at most maxTTL.
+func WithTokenSigner(s *auth.TokenSigner, maxTTL time.Duration) Option {
+	return func(h *Handler) {
+		h.tokens = s
+		h.tokenMaxTTL = maxTTL
+	}
+}
+
+// WithDynamicWhitelist lets unscoped admin keys add temporary entries to wl
+// with POST /whitelist, each valid for at most maxTTL.
+func WithDynamicWhitelist(wl *ipwhitelist.IPWhitelist, maxTTL time.Duration) Option {
+	return func(h *Handler) {
+		h.whitelist = wl
+		h.whitelistMaxTTL = maxTTL
+	}
+}
+
+// WithVerboseHealth lets GET /health?verbose=true add cache settings, the auth
+// mode and the last successful sync time. Meant for development only.
+func WithVerboseHealth() Option {
+	return func(h *Handler) {
+		h.verboseHealth = true
+	}
 }
 
 // NewHandler creates a new handler instance.
-func NewHandler(vaultClient *vaultwarden.Client) *Handler {
-	return &Handler{
+func NewHandler(vaultClient *vaultwarden.Client, opts ...Option) *Handler {
+	h := &Handler{
 		vaultClient: vaultClient,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// HealthCheck handles GET /health.
+// HealthCheck handles GET /health. With WithVerboseHealth, ?verbose=true adds
+// diagnostic detail; the default response never does.
 func (h *Handler) HealthCheck(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
+	body := fiber.Map{
 		"status":  "ok",
 		"service": "vaultwarden-api",
+	}
+	if h.verboseHealth && c.QueryBool("verbose") {
+		d := h.vaultClient.Diagnostics()
+		// What actually bounds snapshot age: lookups sync first past maxAge
+		// (null: never, unless a per-secret override says so), and the
+		// background sync runs every syncInterval.
+		body["cache"] = fiber.Map{
+			"maxAge":       effectiveTTL(d.SyncBeforeFetch, d.SyncBeforeFetch > 0),
+			"ttlOverrides": d.TTLOverrides,
+			"syncInterval": d.SyncInterval.String(),
+			"items":        d.Items,
+		}
+		body["auth"] = fiber.Map{"mode": "none"}
+		if status, ok := h.vaultClient.TokenStatus(); ok {
+			body["auth"] = fiber.Map{"mode": "api", "grant": status.Grant}
+		}
+		body["lastSync"] = nil
+		if !d.LastSync.IsZero() {
+			body["lastSync"] = d.LastSync.UTC().Format(time.RFC3339)
+		}
+	}
+	return response.JSON(c, body)
+}
+
+// Version handles GET /version, reporting which build is running.
+func (h *Handler) Version(c *fiber.Ctx) error {
+	return response.JSON(c, version.Get())
+}
+
+// Root handles GET /: a minimal service descriptor, so probing the root does
+// not fall through to a framework default page.
+func (h *Handler) Root(c *fiber.Ctx) error {
+	return response.JSON(c, fiber.Map{
+		"service": "vaultwarden-api",
+		"version": version.Get().Version,
 	})
 }
 
+// NotFound answers every request no route matched with a plain JSON 404, the
+// same shape as other errors, instead of the framework's "Cannot GET /path".
+func (h *Handler) NotFound(c *fiber.Ctx) error {
+	return response.Error(c, fiber.StatusNotFound, "not found")
+}
+
+// AuthStatus handles GET /auth/status: how the service is logged in to
+// Vaultwarden and when its access token expires, so maintenance can be
+// scheduled without reading logs. Tokens are never included; times are RFC
+// 3339 in UTC, null before the first login.
+func (h *Handler) AuthStatus(c *fiber.Ctx) error {
+	status, ok := h.vaultClient.TokenStatus()
+	if !ok {
+		return response.Error(c, fiber.StatusServiceUnavailable, "not logged in to vaultwarden")
+	}
+	body := fiber.Map{
+		"mode":           "api",
+		"grant":          status.Grant,
+		"tokenExpiresAt": nil,
+		"lastRefresh":    nil,
+	}
+	if !status.ExpiresAt.IsZero() {
+		body["tokenExpiresAt"] = status.ExpiresAt.UTC().Format(time.RFC3339)
+		body["expiresInSeconds"] = max(int(time.Until(status.ExpiresAt).Seconds()), 0)
+	}
+	if !status.LastRefresh.IsZero() {
+		body["lastRefresh"] = status.LastRefresh.UTC().Format(time.RFC3339)
+	}
+	return response.JSON(c, body)
+}
+
+// Ready handles GET /ready. Unlike /health it verifies that secrets can be
+// served: the vault has synced and Vaultwarden answers an authenticated request.
+// Failures return 503 with the failing check; details are only logged.
+func (h *Handler) Ready(c *fiber.Ctx) error {
+	if err := h.vaultClient.Ready(); err != nil {
+		requestLog(c).Warn.Printf("Readiness check failed: %v", err)
+		return response.Error(c, fiber.StatusServiceUnavailable, "not ready: "+readinessReason(err))
+	}
+	body := fiber.Map{
+		"status":  "ready",
+		"service": "vaultwarden-api",
+	}
+	if state, ok := h.vaultClient.BreakerState(); ok {
+		body["circuitBreaker"] = state.String()
+	}
+	return response.JSON(c, body)
+}
+
+// readinessReason maps a readiness error to a message safe to return to clients.
+func readinessReason(err error) string {
+	switch {
+	case errors.Is(err, vaultwarden.ErrNotSynced):
+		return "vault not synced yet"
+	case errors.Is(err, vaultwarden.ErrAuthFailed):
+		return "vaultwarden authentication failed"
+	case errors.Is(err, vaultwarden.ErrCircuitOpen):
+		return "vaultwarden unavailable (circuit breaker open)"
+	default:
+		return "vaultwarden unavailable"
+	}
+}
+
 // decodeSecretPathParam unescapes the name of the secret from the URL path.
 // Mainly used to handle space decodings. Repeats until stable to handle
 // typical double-encoded values (e.g. %2520). Fails if recursive encoding
@@ -58,60 +260,1040 @@ func decodeSecretPathParam(raw string) (string, error) {
 	return "", errors.New("path encoding depth exceeded")
 }
 
-// GetSecret handles GET /secret/:name.
+// GetSecret handles GET /secret/:name. The optional ?field= query selects a
+// specific field (username, totp, a custom field name, ...) instead of the
+// default extraction order. With ?raw=true or Accept: text/plain the bare
+// value is returned as text/plain; errors keep their usual JSON body.
+// ?format=dotenv or ?format=json returns a whole secure note parsed as
+// KEY=value lines instead (see sendNote), ?format=full the whole item as
+// GET /secret/:name/full does, and ?fields=a,b,c several fields at
+// once (see sendFields). ?transform= post-processes the value (see
+// vaultwarden.ParseTransform). ?field=uris and ?field=uri&index=N select login
+// URIs (see sendURIs). ?meta=true adds the effective cache TTL to the JSON
+// response (see fetchSecret).
 func (h *Handler) GetSecret(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAccept)
+
+	secretName, filter, ferr := h.parseLookup(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	field, ferr := parseField(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	var transform vaultwarden.Transform
+	if spec := c.Query("transform"); spec != "" {
+		if c.Query("fields") != "" || c.Query("format") != "" {
+			return response.Error(c, fiber.StatusBadRequest, "transform cannot be combined with fields or format")
+		}
+		var err error
+		if transform, err = vaultwarden.ParseTransform(spec); err != nil {
+			return response.Error(c, fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	if list := c.Query("fields"); list != "" {
+		if field != "" || c.Query("format") != "" {
+			return response.Error(c, fiber.StatusBadRequest, "fields cannot be combined with field or format")
+		}
+		fields, ferr := parseFieldList(c, list)
+		if ferr != nil {
+			return response.Error(c, ferr.Code, ferr.Message)
+		}
+		return h.sendFields(c, secretName, fields, filter)
+	}
+
+	switch format := c.Query("format"); format {
+	case "":
+	case "dotenv", "json", "full":
+		if field != "" {
+			return response.Error(c, fiber.StatusBadRequest, "format cannot be combined with field")
+		}
+		if format == "full" {
+			return h.sendDetail(c, secretName, filter)
+		}
+		return h.sendNote(c, secretName, format, filter)
+	default:
+		return response.Error(c, fiber.StatusBadRequest, "invalid format (use dotenv, json or full)")
+	}
+
+	if strings.EqualFold(field, "uris") || c.Query("index") != "" {
+		return h.sendURIs(c, secretName, field, filter, transform)
+	}
+
+	return h.fetchSecret(c, secretName, field, filter, transform)
+}
+
+// sendURIs serves the login URIs of a secret: all of them as a JSON array
+// for ?field=uris (one per line in raw mode), or the Nth (from 0) for
+// ?field=uri&index=N. An index past the last URI is a 400; an item without
+// URIs a 404.
+func (h *Handler) sendURIs(c *fiber.Ctx, secretName, field string, filter vaultwarden.SecretFilter, transform vaultwarden.Transform) error {
+	all := strings.EqualFold(field, "uris")
+	index := -1
+	if raw := c.Query("index"); raw != "" {
+		if !strings.EqualFold(field, "uri") {
+			return response.Error(c, fiber.StatusBadRequest, "index requires field=uri")
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return response.Error(c, fiber.StatusBadRequest, "invalid index (must be a non-negative integer)")
+		}
+		index = n
+	}
+	if all {
+		if encryptionRequested(c) || transform != nil {
+			return response.Error(c, fiber.StatusBadRequest, "field=uris cannot be combined with transform or response encryption")
+		}
+	}
+
+	uris, stale, err := h.vaultClient.GetSecretURIs(c.Context(), secretName, filter)
+	h.recordAccess(c, secretName, field, err)
+	if err != nil {
+		return lookupError(c, err)
+	}
+	if stale {
+		requestLog(c).Warn.Printf("Serving a stale value, Vaultwarden unavailable (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		c.Set("X-Cache", "stale")
+	}
+
+	if all {
+		if wantsRaw(c) {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			return c.SendString(strings.Join(uris, "\n"))
+		}
+		return response.JSON(c, fiber.Map{"name": secretName, "field": "uris", "value": uris})
+	}
+
+	if index >= len(uris) {
+		return response.Error(c, fiber.StatusBadRequest, fmt.Sprintf("index out of range (secret has %d URIs)", len(uris)))
+	}
+	value := uris[index]
+	if transform != nil {
+		if value, err = transform(value); err != nil {
+			requestLog(c).Warn.Printf("Transform failed: %v (requested by IP: %s)", err, ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	return h.sendValue(c, fiber.Map{"name": secretName, "index": index}, "uri", value)
+}
+
+// SecretExists handles HEAD /secret/:name: 200 when the secret (and ?field=,
+// when given) exists, otherwise the status GET would answer, never with the
+// value. Name validation, filters and key scope apply as for GET.
+func (h *Handler) SecretExists(c *fiber.Ctx) error {
+	secretName, filter, ferr := h.parseLookup(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+	field, ferr := parseField(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	if err := h.vaultClient.HasSecret(c.Context(), secretName, field, filter); err != nil {
+		return lookupError(c, err) // fasthttp drops the body of HEAD responses
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// maxFields caps the number of names accepted by ?fields=.
+const maxFields = 20
+
+// parseFieldList splits and validates a ?fields= list, dropping empty entries
+// and duplicates while keeping the request order.
+func parseFieldList(c *fiber.Ctx, list string) ([]string, *fiber.Error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for f := range strings.SplitSeq(list, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		if !validators.IsValidFieldName(f) {
+			requestLog(c).Warn.Printf("Invalid field name attempted from IP: %s", ipwhitelist.ClientIP(c))
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid field name")
+		}
+		seen[f] = true
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "fields is empty")
+	}
+	if len(fields) > maxFields {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("too many fields (max %d)", maxFields))
+	}
+	return fields, nil
+}
+
+// sendFields sends several fields of one secret as
+// {"name": ..., "fields": {field: value}, "errors": {field: "not found"}}; a
+// field is never in both. Only a failure to resolve the secret itself fails
+// the request. Raw mode does not apply, and response encryption is refused
+// rather than silently skipped.
+func (h *Handler) sendFields(c *fiber.Ctx, secretName string, fields []string, filter vaultwarden.SecretFilter) error {
+	if encryptionRequested(c) {
+		return response.Error(c, fiber.StatusBadRequest, "response encryption cannot be combined with fields")
+	}
+
+	values, missing, err := h.vaultClient.GetSecretFields(c.Context(), secretName, fields, filter)
+	if err != nil {
+		h.recordAccess(c, secretName, "", err)
+		return lookupError(c, err)
+	}
+
+	errs := fiber.Map{}
+	for _, field := range missing {
+		h.recordAccess(c, secretName, field, vaultwarden.ErrFieldNotFound)
+		errs[field] = "not found"
+	}
+	for field, value := range values {
+		h.checkValueSize(c, secretName, value)
+		h.recordAccess(c, secretName, field, nil)
+	}
+	return response.JSON(c, fiber.Map{"name": secretName, "fields": values, "errors": errs})
+}
+
+// sendNote sends the KEY=value pairs of a secure note, as text/plain lines a
+// shell can source (dotenv) or as a JSON object of strings (json). Other item
+// types are rejected with 422, and so is response encryption (400).
+func (h *Handler) sendNote(c *fiber.Ctx, secretName, format string, filter vaultwarden.SecretFilter) error {
+	if encryptionRequested(c) {
+		return response.Error(c, fiber.StatusBadRequest, "response encryption cannot be combined with format="+format)
+	}
+
+	vars, err := h.vaultClient.GetNoteVarsContext(c.Context(), secretName, filter)
+	h.recordAccess(c, secretName, "", err)
+	if errors.Is(err, vaultwarden.ErrNotANote) {
+		requestLog(c).Warn.Printf("Note format requested for a non-note secret (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusUnprocessableEntity, "format="+format+" requires a secure note")
+	}
+	if err != nil {
+		return lookupError(c, err)
+	}
+
+	if format == "dotenv" {
+		out := vaultwarden.FormatDotenv(vars)
+		h.checkValueSize(c, secretName, out)
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(out)
+	}
+
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		values[v.Key] = v.Value
+		h.checkValueSize(c, secretName, v.Value)
+	}
+	return response.JSON(c, values)
+}
+
+// ValidateSecretName handles GET /validate/:name: it reports whether the API
+// would accept name, as {"valid": true} or {"valid": false, "reason": "..."},
+// without contacting Vaultwarden. Whether an item with that name exists is
+// deliberately not checked.
+func (h *Handler) ValidateSecretName(c *fiber.Ctx) error {
+	name, err := decodeSecretPathParam(c.Params("name"))
+	if err != nil {
+		return response.JSON(c, fiber.Map{"valid": false, "reason": "invalid percent-encoding in name"})
+	}
+	if reason := validators.SecretNameProblem(name); reason != "" {
+		return response.JSON(c, fiber.Map{"valid": false, "reason": reason})
+	}
+	return response.JSON(c, fiber.Map{"valid": true})
+}
+
+// secretRequest is the body of POST /secret.
+type secretRequest struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+}
+
+// PostSecret handles POST /secret with a body of {"name": "...", "field": "..."}
+// ("field" optional). It behaves like GET /secret/:name, with the same
+// validation, filters, key scope and raw mode, but keeps the secret name out
+// of URLs and therefore out of access logs and proxy logs.
+func (h *Handler) PostSecret(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAccept)
+
+	var req secretRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		requestLog(c).Warn.Printf("Invalid secret request body from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+
+	secretName, ferr := validateSecretName(c, strings.TrimSpace(req.Name))
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+	filter, ferr := h.parseFilter(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	field := strings.TrimSpace(req.Field)
+	if field != "" && !validators.IsValidFieldName(field) {
+		requestLog(c).Warn.Printf("Invalid field name attempted from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid field name")
+	}
+
+	return h.fetchSecret(c, secretName, field, filter, nil)
+}
+
+// fetchSecret looks up a validated secret name (one field of it when field is
+// set) and sends the value. A sync the lookup waits for is bound to the
+// request context, so it is abandoned when the server shuts down. A value
+// served from an outdated snapshot because Vaultwarden is down (STALE_IF_ERROR)
+// is marked with X-Cache: stale. A non-nil transform is applied to the value
+// before it is sent; a value it cannot process is answered with 422. With
+// ?meta=true the JSON body also carries cache_ttl_effective, the maximum
+// snapshot age the lookup was served under.
+func (h *Handler) fetchSecret(c *fiber.Ctx, secretName, field string, filter vaultwarden.SecretFilter, transform vaultwarden.Transform) error {
+	res, err := h.vaultClient.GetSecretResult(c.Context(), secretName, field, filter)
+	h.recordAccess(c, secretName, field, err)
+	if err != nil {
+		return lookupError(c, err)
+	}
+	if res.Stale {
+		requestLog(c).Warn.Printf("Serving a stale value, Vaultwarden unavailable (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		c.Set("X-Cache", "stale")
+	}
+
+	value := res.Value
+	if transform != nil {
+		if value, err = transform(value); err != nil {
+			requestLog(c).Warn.Printf("Transform failed: %v (requested by IP: %s)", err, ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	body := fiber.Map{"name": secretName}
+	if c.QueryBool("meta") {
+		body["cache_ttl_effective"] = effectiveTTL(h.vaultClient.EffectiveTTL(secretName, filter))
+	}
+	return h.sendValue(c, body, field, value)
+}
+
+// effectiveTTL formats a TTL from vaultwarden.Client.EffectiveTTL for
+// responses: a duration string, or nil when nothing bounds the snapshot age.
+func effectiveTTL(ttl time.Duration, bounded bool) any {
+	if !bounded {
+		return nil
+	}
+	return ttl.String()
+}
+
+// GetSecretByID handles GET /secret/id/:id, fetching an item by its cipher
+// UUID instead of searching by name (for vaults with duplicate names). The
+// ?field= and ?raw= options, placement filters and key scope work as for
+// GET /secret/:name; the response also carries the item's name.
+func (h *Handler) GetSecretByID(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAccept)
+
+	id := strings.ToLower(c.Params("id"))
+	if !validators.IsValidUUID(id) {
+		requestLog(c).Warn.Printf("Invalid secret id format attempted from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid secret id format")
+	}
+
+	filter, ferr := h.parseFilter(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	field, ferr := parseField(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	name, value, err := h.vaultClient.GetSecretByIDContext(c.Context(), id, field, filter)
+	h.recordAccess(c, cmp.Or(name, id), field, err)
+	if err != nil {
+		return lookupError(c, err)
+	}
+
+	return h.sendValue(c, fiber.Map{"id": id, "name": name}, field, value)
+}
+
+// parseField validates the optional ?field= query.
+func parseField(c *fiber.Ctx) (string, *fiber.Error) {
+	field := strings.TrimSpace(c.Query("field"))
+	if field != "" && !validators.IsValidFieldName(field) {
+		requestLog(c).Warn.Printf("Invalid field name attempted from IP: %s", ipwhitelist.ClientIP(c))
+		return "", fiber.NewError(fiber.StatusBadRequest, "invalid field name")
+	}
+	return field, nil
+}
+
+// sendValue writes a looked-up secret value: the bare value when requested
+// (see wantsRaw), otherwise body plus "value" (and "field" when one was selected).
+// A client sending X-Response-Encryption always gets JSON with the value sealed
+// (see sealValue).
+func (h *Handler) sendValue(c *fiber.Ctx, body fiber.Map, field, value string) error {
+	name, _ := body["name"].(string)
+	h.checkValueSize(c, name, value)
+	if field != "" {
+		body["field"] = field
+	}
+
+	c.Vary(headerResponseEncryption)
+	if alg := c.Get(headerResponseEncryption); alg != "" {
+		if h.sealer == nil {
+			return response.Error(c, fiber.StatusBadRequest, "response encryption is not configured")
+		}
+		if !strings.EqualFold(alg, encryptionAlgorithm) {
+			return response.Error(c, fiber.StatusBadRequest, "unsupported response encryption (use "+encryptionAlgorithm+")")
+		}
+		sealed, nonce, err := h.sealValue(name, value)
+		if err != nil {
+			requestLog(c).Error.Printf("Failed to encrypt response: %v", err)
+			return response.Error(c, fiber.StatusInternalServerError, "failed to encrypt response")
+		}
+		body["value"] = sealed
+		body["nonce"] = nonce
+		body["encryption"] = encryptionAlgorithm
+		return response.JSON(c, body)
+	}
+
+	if wantsRaw(c) {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(value)
+	}
+
+	body["value"] = value
+	return response.JSON(c, body)
+}
+
+// Response encryption: a request opts in by sending the header with the
+// algorithm name as its value; only AES-256-GCM is supported.
+const (
+	headerResponseEncryption = "X-Response-Encryption"
+	encryptionAlgorithm      = "aes-256-gcm"
+)
+
+// encryptionRequested reports whether the client sent X-Response-Encryption.
+// Only sendValue can seal a value; responses carrying several values refuse
+// the header rather than answer in plaintext.
+func encryptionRequested(c *fiber.Ctx) bool {
+	c.Vary(headerResponseEncryption)
+	return c.Get(headerResponseEncryption) != ""
+}
+
+// sealValue encrypts value with a fresh random nonce, authenticating the secret
+// name as additional data so a ciphertext cannot be passed off as another
+// secret. It returns the ciphertext (with the GCM tag appended) and the nonce,
+// both base64 (standard encoding).
+func (h *Handler) sealValue(name, value string) (sealed, nonce string, err error) {
+	n := make([]byte, h.sealer.NonceSize())
+	if _, err := rand.Read(n); err != nil {
+		return "", "", err
+	}
+	out := h.sealer.Seal(nil, n, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(out), base64.StdEncoding.EncodeToString(n), nil
+}
+
+// wantsRaw reports whether the client asked for the bare value: ?raw=true, or an
+// Accept header that prefers text/plain over JSON.
+func wantsRaw(c *fiber.Ctx) bool {
+	if raw := c.Query("raw"); raw != "" {
+		return raw == "true" || raw == "1"
+	}
+	if c.Get(fiber.HeaderAccept) == "" {
+		return false
+	}
+	return c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextPlain) == fiber.MIMETextPlain
+}
+
+// GetSecretDetail handles GET /secret/:name/full. It returns the item as a
+// structured object (username, password, uris, totp for logins; card and
+// identity fields for those types) instead of a single extracted value.
+func (h *Handler) GetSecretDetail(c *fiber.Ctx) error {
+	secretName, filter, ferr := h.parseLookup(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	return h.sendDetail(c, secretName, filter)
+}
+
+// sendDetail sends the structured view of a secret, for GET /secret/:name/full
+// and ?format=full. Response encryption is refused, as for sendFields.
+func (h *Handler) sendDetail(c *fiber.Ctx, secretName string, filter vaultwarden.SecretFilter) error {
+	if encryptionRequested(c) {
+		return response.Error(c, fiber.StatusBadRequest, "response encryption cannot be combined with the full item")
+	}
+
+	detail, err := h.vaultClient.GetSecretDetailContext(c.Context(), secretName, filter)
+	h.recordAccess(c, secretName, "", err)
+	if err != nil {
+		return lookupError(c, err)
+	}
+	// Report the requested name, matching GET /secret/:name.
+	detail.Name = secretName
+
+	return response.JSON(c, detail)
+}
+
+// updateRequest is the body of PUT /secret/:name.
+type updateRequest struct {
+	Value string `json:"value"`
+}
+
+// UpdateSecret handles PUT /secret/:name with a body of {"value": "..."}. It
+// sets the password of the matching login item in Vaultwarden; the name,
+// filters and key scope resolve exactly as for GET /secret/:name. The route is
+// only registered when ALLOW_WRITES is enabled.
+func (h *Handler) UpdateSecret(c *fiber.Ctx) error {
+	secretName, filter, ferr := h.parseLookup(c)
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	var req updateRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		requestLog(c).Warn.Printf("Invalid update request body from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+	if req.Value == "" {
+		return response.Error(c, fiber.StatusBadRequest, "value is required")
+	}
+
+	err := h.vaultClient.UpdateSecretContext(c.Context(), secretName, filter, req.Value)
+	h.recordWrite(c, secretName, err)
+	switch {
+	case errors.Is(err, vaultwarden.ErrSecretNotFound), errors.Is(err, vaultwarden.ErrSecretDeleted):
+		return lookupError(c, err)
+	case errors.Is(err, vaultwarden.ErrNotWritable):
+		requestLog(c).Warn.Printf("Update of non-writable secret rejected (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusUnprocessableEntity, "only login passwords can be updated")
+	case err != nil:
+		requestLog(c).Error.Printf("Failed to update secret (requested by IP: %s): %v", ipwhitelist.ClientIP(c), err)
+		return response.Error(c, fiber.StatusBadGateway, "failed to update secret")
+	}
+
+	requestLog(c).Info.Printf("Secret updated (requested by IP: %s)", ipwhitelist.ClientIP(c))
+	h.events.Notify(webhook.Event{Type: webhook.EventSecretUpdate, ClientIP: ipwhitelist.ClientIP(c)})
+	return response.JSON(c, fiber.Map{
+		"name":   secretName,
+		"status": "updated",
+	})
+}
+
+// exportRecord is one line of GET /export: a secret's structured view as JSON,
+// sealed like an encrypted response with the cipher id as additional data.
+type exportRecord struct {
+	ID         string `json:"id"`
+	Data       string `json:"data"`
+	Nonce      string `json:"nonce"`
+	Encryption string `json:"encryption"`
+}
+
+// exportTrailer ends a complete export, so a truncated stream can be told apart.
+type exportTrailer struct {
+	Done  bool `json:"done"`
+	Count int  `json:"count"`
+}
+
+// ExportSecrets handles GET /export?confirm=yes: every live secret, streamed as
+// newline-delimited JSON records sealed with the response encryption key,
+// followed by a trailer with the record count. Only an unscoped admin key may
+// export. The route is only registered when ALLOW_EXPORT is enabled, and every
+// export is logged, audited and reported to the webhook before any data is
+// sent.
+func (h *Handler) ExportSecrets(c *fiber.Ctx) error {
+	key, ok := globalAdminKey(c)
+	if !ok {
+		requestLog(c).Warn.Printf("Export denied to a non-global key from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusForbidden, "export requires an unscoped admin key")
+	}
+	if c.Query("confirm") != "yes" {
+		return response.Error(c, fiber.StatusBadRequest, "export requires ?confirm=yes")
+	}
+	if h.sealer == nil {
+		return response.Error(c, fiber.StatusInternalServerError, "response encryption is not configured")
+	}
+
+	items, err := h.vaultClient.Export()
+	h.recordAccess(c, "*", "", err)
+	if err != nil {
+		requestLog(c).Error.Printf("Export failed (requested by IP: %s): %v", ipwhitelist.ClientIP(c), err)
+		return response.Error(c, fiber.StatusBadGateway, "vaultwarden unavailable")
+	}
+
+	// The stream writer runs after the handler returns, when c is no longer
+	// valid, so everything it needs is copied out first.
+	log := logger.With("request_id", strings.Clone(response.RequestID(c)))
+	ip := strings.Clone(ipwhitelist.ClientIP(c))
+	log.Warn.Printf("VAULT EXPORT started by key %q (requested by IP: %s)", key.Name, ip)
+	h.events.Notify(webhook.Event{Type: webhook.EventExport, ClientIP: ip})
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		count := 0
+		for id, detail := range items {
+			plain, err := json.Marshal(detail)
+			if err != nil {
+				log.Error.Printf("Export aborted after %d secrets: %v", count, err)
+				return
+			}
+			sealed, nonce, err := h.sealValue(id, string(plain))
+			if err != nil {
+				log.Error.Printf("Export aborted after %d secrets: %v", count, err)
+				return
+			}
+			if err := enc.Encode(exportRecord{ID: id, Data: sealed, Nonce: nonce, Encryption: encryptionAlgorithm}); err != nil {
+				log.Warn.Printf("Export aborted after %d secrets: %v", count, err)
+				return
+			}
+			count++
+			if err := w.Flush(); err != nil {
+				log.Warn.Printf("Export aborted after %d secrets: %v", count, err)
+				return
+			}
+		}
+		if err := enc.Encode(exportTrailer{Done: true, Count: count}); err != nil {
+			log.Warn.Printf("Export aborted after %d secrets: %v", count, err)
+			return
+		}
+		log.Warn.Printf("VAULT EXPORT finished: %d secrets sent (requested by IP: %s)", count, ip)
+	})
+	return nil
+}
+
+// globalAdminKey returns the authenticated key if it is an admin key without
+// a scope, the only kind allowed to export or change the whitelist.
+func globalAdminKey(c *fiber.Ctx) (auth.APIKey, bool) {
+	key, ok := auth.KeyFromCtx(c)
+	return key, ok && key.Admin && key.Scope.IsEmpty()
+}
+
+// defaultWhitelistTTL is how long a POST /whitelist entry lasts when the
+// request gives no ttl.
+const defaultWhitelistTTL = time.Hour
+
+// whitelistRequest is the body of POST /whitelist.
+type whitelistRequest struct {
+	// IP is an IP address or CIDR range.
+	IP string `json:"ip"`
+	// TTL is a Go duration ("30m") or a number of seconds; defaults to
+	// defaultWhitelistTTL, capped at the configured maximum.
+	TTL string `json:"ttl"`
+}
+
+// whitelistEntry describes a temporary whitelist entry in responses.
+type whitelistEntry struct {
+	Entry   string    `json:"entry"`
+	Expires time.Time `json:"expires"`
+}
+
+// AddWhitelistEntry handles POST /whitelist: allow an IP or CIDR for a limited
+// time (break-glass access without a redeploy). Only an unscoped admin key may
+// add entries. Entries live in memory only and are removed automatically once
+// they expire; every change is logged and audited.
+func (h *Handler) AddWhitelistEntry(c *fiber.Ctx) error {
+	if _, ok := globalAdminKey(c); !ok {
+		requestLog(c).Warn.Printf("Whitelist change denied to a non-global key from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusForbidden, "whitelist changes require an unscoped admin key")
+	}
+
+	var req whitelistRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		requestLog(c).Warn.Printf("Invalid whitelist request body from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+
+	ttl := min(defaultWhitelistTTL, h.whitelistMaxTTL)
+	if req.TTL != "" {
+		d, err := parseCacheTTL(req.TTL)
+		if err != nil || d == 0 {
+			return response.Error(c, fiber.StatusBadRequest, "invalid ttl")
+		}
+		ttl = d
+	}
+	if ttl > h.whitelistMaxTTL {
+		return response.Error(c, fiber.StatusBadRequest, fmt.Sprintf("ttl exceeds the maximum of %v", h.whitelistMaxTTL))
+	}
+
+	entry, err := h.whitelist.AddTemporary(req.IP, ttl)
+	if err != nil {
+		return response.Error(c, fiber.StatusBadRequest, "ip must be an IP address or CIDR range")
+	}
+	h.recordWhitelistChange(c, entry.Entry, &entry.Expires, audit.OutcomeAdded)
+	requestLog(c).Warn.Printf("Temporary whitelist entry %s added for %v (requested by IP: %s)", entry.Entry, ttl, ipwhitelist.ClientIP(c))
+	return response.JSON(c, whitelistEntry{Entry: entry.Entry, Expires: entry.Expires})
+}
+
+// RemoveWhitelistEntry handles DELETE /whitelist?ip=: remove a temporary entry
+// before it expires. Configured rules cannot be removed this way.
+func (h *Handler) RemoveWhitelistEntry(c *fiber.Ctx) error {
+	if _, ok := globalAdminKey(c); !ok {
+		requestLog(c).Warn.Printf("Whitelist change denied to a non-global key from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusForbidden, "whitelist changes require an unscoped admin key")
+	}
+
+	entry, ok := h.whitelist.RemoveTemporary(c.Query("ip"))
+	if entry == "" {
+		return response.Error(c, fiber.StatusBadRequest, "ip must be an IP address or CIDR range")
+	}
+	if !ok {
+		return response.Error(c, fiber.StatusNotFound, "no temporary whitelist entry for "+entry)
+	}
+	h.recordWhitelistChange(c, entry, nil, audit.OutcomeRemoved)
+	requestLog(c).Warn.Printf("Temporary whitelist entry %s removed (requested by IP: %s)", entry, ipwhitelist.ClientIP(c))
+	return response.JSON(c, fiber.Map{"entry": entry, "removed": true})
+}
+
+// ListWhitelistEntries handles GET /whitelist: the unexpired temporary
+// entries, soonest to expire first.
+func (h *Handler) ListWhitelistEntries(c *fiber.Ctx) error {
+	if _, ok := globalAdminKey(c); !ok {
+		return response.Error(c, fiber.StatusForbidden, "whitelist access requires an unscoped admin key")
+	}
+
+	entries := []whitelistEntry{}
+	for _, te := range h.whitelist.TemporaryEntries() {
+		entries = append(entries, whitelistEntry{Entry: te.Entry, Expires: te.Expires})
+	}
+	return response.JSON(c, fiber.Map{"entries": entries})
+}
+
+// cacheEntry describes a snapshot name in the GET /cache listing.
+type cacheEntry struct {
+	Name              string `json:"name"`
+	CacheTTLEffective any    `json:"cache_ttl_effective"`
+}
+
+// ListCache handles GET /cache: every live name in the snapshot with the
+// effective cache TTL it is served under (a per-secret override or the global
+// default), for checking CACHE_TTL_OVERRIDES. Values are never included.
+func (h *Handler) ListCache(c *fiber.Ctx) error {
+	if _, ok := globalAdminKey(c); !ok {
+		return response.Error(c, fiber.StatusForbidden, "cache listing requires an unscoped admin key")
+	}
+
+	entries := []cacheEntry{}
+	for _, e := range h.vaultClient.CacheEntries(vaultwarden.SecretFilter{}) {
+		entries = append(entries, cacheEntry{Name: e.Name, CacheTTLEffective: effectiveTTL(e.TTL, e.Bounded)})
+	}
+	return response.JSON(c, fiber.Map{"entries": entries})
+}
+
+// maxBatchSize caps the number of names accepted by POST /secrets/batch.
+const maxBatchSize = 50
+
+// batchRequest is the body of POST /secrets/batch.
+type batchRequest struct {
+	Names []string `json:"names"`
+}
+
+// Per-name statuses of a POST /secrets/batch?statuses=true response.
+const (
+	batchFound         = "found"
+	batchNotFound      = "not-found"
+	batchInvalid       = "invalid"
+	batchForbidden     = "forbidden"
+	batchUpstreamError = "upstream-error"
+)
+
+// batchItem is the outcome for one name in a POST /secrets/batch response.
+// Error repeats the reason the flat response gives ("deleted", ...).
+type batchItem struct {
+	Status string  `json:"status"`
+	Value  *string `json:"value,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// BatchGetSecrets handles POST /secrets/batch with a body of
+// {"names": [...]}. All names are resolved against one vault snapshot and
+// share the query filters and key scope of GET /secret/:name. The response is
+// {"results": {name: value}, "errors": {name: reason}}; a name is never in both.
+// With ?statuses=true it is {"items": {name: {"status", "value"?}}} instead,
+// the status being found, not-found, invalid, forbidden or upstream-error.
+// Forbidden means the key's scope denies the whole request; a name outside the
+// scope is not-found, so a scoped key cannot learn which names exist.
+func (h *Handler) BatchGetSecrets(c *fiber.Ctx) error {
+	var req batchRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		requestLog(c).Warn.Printf("Invalid batch request body from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+	if len(req.Names) == 0 {
+		return response.Error(c, fiber.StatusBadRequest, "names is required")
+	}
+	if len(req.Names) > maxBatchSize {
+		requestLog(c).Warn.Printf("Batch of %d names rejected from IP: %s", len(req.Names), ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, fmt.Sprintf("too many names (max %d)", maxBatchSize))
+	}
+	if encryptionRequested(c) {
+		return response.Error(c, fiber.StatusBadRequest, "response encryption cannot be combined with a batch")
+	}
+
+	// Every entry is keyed by the name as requested, while lookups use it
+	// trimmed; requested maps each trimmed name back to its spellings.
+	items := make(map[string]batchItem, len(req.Names))
+	requested := make(map[string][]string, len(req.Names))
+
+	var valid []string
+	for _, raw := range req.Names {
+		name := strings.TrimSpace(raw)
+		if name == "" || !validators.IsValidSecretName(name) {
+			items[raw] = batchItem{Status: batchInvalid, Error: "invalid secret name format"}
+			continue
+		}
+		if _, dup := requested[name]; !dup {
+			valid = append(valid, name)
+		}
+		requested[name] = append(requested[name], raw)
+	}
+	set := func(name string, item batchItem) {
+		for _, raw := range requested[name] {
+			items[raw] = item
+		}
+	}
+
+	filter, err := h.parseSecretFilters(c)
+	if err != nil || !h.applyKeyScope(c, &filter) {
+		// Same obscurity as GET /secret/:name: the flat response reports every
+		// name as not found; with statuses only a scope denial is told apart.
+		requestLog(c).Warn.Printf("Batch request with invalid filters or denied by key scope from IP: %s", ipwhitelist.ClientIP(c))
+		status := batchNotFound
+		if err == nil {
+			status = batchForbidden
+		}
+		for _, name := range valid {
+			set(name, batchItem{Status: status, Error: "not found"})
+		}
+		return sendBatch(c, items)
+	}
+
+	values, lookupErrs := h.vaultClient.GetSecretsContext(c.Context(), valid, filter)
+	for name, value := range values {
+		h.checkValueSize(c, name, value)
+		h.recordAccess(c, name, "", nil)
+		set(name, batchItem{Status: batchFound, Value: &value})
+	}
+	for name, err := range lookupErrs {
+		h.recordAccess(c, name, "", err)
+		set(name, failedItem(err))
+	}
+
+	return sendBatch(c, items)
+}
+
+// failedItem is the batch outcome for a name whose lookup failed with err.
+func failedItem(err error) batchItem {
+	switch {
+	case errors.Is(err, vaultwarden.ErrSecretDeleted):
+		return batchItem{Status: batchNotFound, Error: "deleted"}
+	case errors.Is(err, vaultwarden.ErrAuthFailed), errors.Is(err, vaultwarden.ErrUpstreamUnavailable):
+		return batchItem{Status: batchUpstreamError, Error: readinessReason(err)}
+	default:
+		return batchItem{Status: batchNotFound, Error: "not found"}
+	}
+}
+
+// sendBatch writes the batch outcomes as per-name items with ?statuses=true,
+// otherwise split into the flat results and errors maps.
+func sendBatch(c *fiber.Ctx, items map[string]batchItem) error {
+	if c.QueryBool("statuses") {
+		return response.JSON(c, fiber.Map{"items": items})
+	}
+
+	results := fiber.Map{}
+	errs := fiber.Map{}
+	for name, item := range items {
+		if item.Status == batchFound {
+			results[name] = *item.Value
+		} else {
+			errs[name] = item.Error
+		}
+	}
+	return response.JSON(c, fiber.Map{"results": results, "errors": errs})
+}
+
+// defaultTokenTTL is the lifetime of a signed token when POST /token gives none.
+const defaultTokenTTL = 5 * time.Minute
+
+// tokenRequest is the body of POST /token.
+type tokenRequest struct {
+	Secret string `json:"secret"`
+	// TTL is seconds or a duration string ("90s", "10m"); empty means
+	// defaultTokenTTL, capped at the configured maximum.
+	TTL string `json:"ttl"`
+}
+
+// IssueToken handles POST /token with a body of {"secret": "...", "ttl": "..."}.
+// It returns {"secret", "exp", "sig", "token"}, where token is the ?token=
+// value that lets GET /secret/:name read that one secret, without an API key,
+// until exp (Unix seconds). Only unscoped keys may issue tokens, since a token
+// is not bound to any organization or collection. Whether the secret exists is
+// not checked. The route is only registered when TOKEN_SIGNING_KEY is set.
+func (h *Handler) IssueToken(c *fiber.Ctx) error {
+	// Fail closed like applyKeyScope: a route reconfigured to run without the
+	// auth middleware must not mint tokens for anyone.
+	key, ok := auth.KeyFromCtx(c)
+	if !ok {
+		requestLog(c).Warn.Printf("Unauthenticated token issuance denied from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusUnauthorized, "token issuance requires an API key")
+	}
+	if !key.Scope.IsEmpty() {
+		requestLog(c).Warn.Printf("Scoped key denied token issuance from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusForbidden, "scoped keys cannot issue tokens")
+	}
+
+	var req tokenRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		requestLog(c).Warn.Printf("Invalid token request body from IP: %s", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+	secretName, ferr := validateSecretName(c, strings.TrimSpace(req.Secret))
+	if ferr != nil {
+		return response.Error(c, ferr.Code, ferr.Message)
+	}
+
+	ttl := defaultTokenTTL
+	if req.TTL != "" {
+		d, err := parseCacheTTL(req.TTL)
+		if err != nil || d == 0 {
+			return response.Error(c, fiber.StatusBadRequest, "invalid ttl")
+		}
+		ttl = d
+	}
+	if ttl > h.tokenMaxTTL {
+		return response.Error(c, fiber.StatusBadRequest, fmt.Sprintf("ttl exceeds the maximum of %v", h.tokenMaxTTL))
+	}
+
+	token := h.tokens.Issue(secretName, ttl)
+	requestLog(c).Info.Printf("Signed token issued for %v (requested by IP: %s)", ttl, ipwhitelist.ClientIP(c))
+	return response.JSON(c, fiber.Map{
+		"secret": token.Secret,
+		"exp":    token.Exp,
+		"sig":    token.Sig,
+		"token":  token.String(),
+	})
+}
+
+// parseLookup validates the secret name path parameter and the placement
+// filters shared by the single-secret endpoints, and narrows the filter to the
+// authenticated key's scope. On failure it returns the status and message to send.
+func (h *Handler) parseLookup(c *fiber.Ctx) (string, vaultwarden.SecretFilter, *fiber.Error) {
 	secretName, err := decodeSecretPathParam(c.Params("name"))
 	if err != nil {
-		logger.Warn.Printf("Invalid secret path encoding from IP: %s", c.IP())
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid secret name format",
-		})
+		requestLog(c).Warn.Printf("Invalid secret path encoding from IP: %s", ipwhitelist.ClientIP(c))
+		return "", vaultwarden.SecretFilter{}, fiber.NewError(fiber.StatusBadRequest, "invalid secret name format")
 	}
 
+	secretName, ferr := validateSecretName(c, secretName)
+	if ferr != nil {
+		return "", vaultwarden.SecretFilter{}, ferr
+	}
+
+	filter, ferr := h.parseFilter(c)
+	if ferr != nil {
+		return "", vaultwarden.SecretFilter{}, ferr
+	}
+	return secretName, filter, nil
+}
+
+// validateSecretName checks a requested secret name, whether it came from the
+// path or a request body.
+func validateSecretName(c *fiber.Ctx, secretName string) (string, *fiber.Error) {
 	if secretName == "" {
-		logger.Warn.Println("Secret name not provided")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "secret name is required",
-		})
+		requestLog(c).Warn.Println("Secret name not provided")
+		return "", fiber.NewError(fiber.StatusBadRequest, "secret name is required")
 	}
 
 	if !validators.IsValidSecretName(secretName) {
-		logger.Warn.Printf("Invalid secret name format attempted from IP: %s", c.IP())
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid secret name format",
-		})
+		requestLog(c).Warn.Printf("Invalid secret name format attempted from IP: %s", ipwhitelist.ClientIP(c))
+		return "", fiber.NewError(fiber.StatusBadRequest, "invalid secret name format")
 	}
+	return secretName, nil
+}
 
+// parseFilter builds the lookup filter from the placement query filters, the
+// authenticated key's scope and the X-Cache-TTL header.
+func (h *Handler) parseFilter(c *fiber.Ctx) (vaultwarden.SecretFilter, *fiber.Error) {
 	filter, err := h.parseSecretFilters(c)
 	if err != nil {
 		// Don't leak information about existence of correct filters
 		// Security through obscurity ;)
-		logger.Warn.Printf("Invalid secret filters attempted from IP: %s - %v", c.IP(), err)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "secret not found",
-		})
+		requestLog(c).Warn.Printf("Invalid secret filters attempted from IP: %s - %v", ipwhitelist.ClientIP(c), err)
+		return vaultwarden.SecretFilter{}, fiber.NewError(fiber.StatusNotFound, "secret not found")
 	}
 
 	// Enforce the authenticated key's scope server-side, regardless of query filters.
 	if !h.applyKeyScope(c, &filter) {
-		logger.Warn.Printf("Request denied by key scope from IP: %s", c.IP())
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "secret not found",
-		})
+		requestLog(c).Warn.Printf("Request denied by key scope from IP: %s", ipwhitelist.ClientIP(c))
+		return vaultwarden.SecretFilter{}, fiber.NewError(fiber.StatusNotFound, "secret not found")
 	}
 
-	value, err := h.vaultClient.GetSecret(secretName, filter)
+	if raw := strings.TrimSpace(c.Get("X-Cache-TTL")); raw != "" {
+		maxAge, err := parseCacheTTL(raw)
+		if err != nil {
+			requestLog(c).Warn.Printf("Invalid X-Cache-TTL header from IP: %s", ipwhitelist.ClientIP(c))
+			return vaultwarden.SecretFilter{}, fiber.NewError(fiber.StatusBadRequest, "invalid X-Cache-TTL header")
+		}
+		filter.MaxAge = &maxAge
+	}
+
+	return filter, nil
+}
+
+// parseCacheTTL parses an X-Cache-TTL value: a Go duration ("30s", "5m") or a
+// plain number of seconds. Negative values are rejected.
+func parseCacheTTL(raw string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(raw); err == nil {
+		if secs < 0 {
+			return 0, errors.New("negative TTL")
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
 	if err != nil {
-		logger.Error.Printf("Failed to fetch secret (requested by IP: %s)", c.IP())
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "secret not found",
-		})
+		return 0, err
 	}
+	if d < 0 {
+		return 0, errors.New("negative TTL")
+	}
+	return d, nil
+}
 
-	return c.JSON(fiber.Map{
-		"name":  secretName,
-		"value": value,
-	})
+// lookupError maps a vault lookup error to its response. Only a secret that
+// is genuinely missing is a 404: a sync the lookup needed that failed upstream
+// is a 502, and a session Vaultwarden rejects is a 500 (the caller's own key
+// was fine), so clients and alerting can tell an outage from missing data.
+func lookupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, vaultwarden.ErrFieldNotFound):
+		requestLog(c).Warn.Printf("Requested field not present on secret (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusNotFound, "field not found")
+	case errors.Is(err, vaultwarden.ErrSecretDeleted):
+		requestLog(c).Warn.Printf("Requested secret is in the trash (requested by IP: %s)", ipwhitelist.ClientIP(c))
+		return response.Error(c, fiber.StatusGone, "secret deleted")
+	case errors.Is(err, vaultwarden.ErrAuthFailed):
+		requestLog(c).Error.Printf("Vaultwarden rejected the session while fetching a secret: %v", err)
+		return response.Error(c, fiber.StatusInternalServerError, "vaultwarden authentication failed")
+	case errors.Is(err, vaultwarden.ErrUpstreamUnavailable):
+		requestLog(c).Error.Printf("Vaultwarden unavailable while fetching a secret: %v", err)
+		return response.Error(c, fiber.StatusBadGateway, "vaultwarden unavailable")
+	}
+	requestLog(c).Error.Printf("Failed to fetch secret (requested by IP: %s)", ipwhitelist.ClientIP(c))
+	return response.Error(c, fiber.StatusNotFound, "secret not found")
+}
+
+// checkValueSize records the size of a returned value and flags unusually large
+// ones, which usually point to a vault misconfiguration (e.g. a blob pasted into
+// a field). Only the size is logged.
+func (h *Handler) checkValueSize(c *fiber.Ctx, secretName, value string) {
+	metrics.SecretValueBytes.Observe(float64(len(value)))
+	if h.sizeWarnBytes <= 0 || len(value) <= h.sizeWarnBytes {
+		return
+	}
+	requestLog(c).Warn.Printf("Secret value of %d bytes exceeds the %d byte warning threshold (requested by IP: %s)", len(value), h.sizeWarnBytes, ipwhitelist.ClientIP(c))
+	requestLog(c).Debug.Printf("Oversized secret value for %q", secretName)
 }
 
 func parseUUIDQuery(field, raw string) (string, error) {
@@ -180,11 +1362,19 @@ func (h *Handler) applyKeyScope(c *fiber.Ctx, filter *vaultwarden.SecretFilter)
 		// request. Fail closed rather than silently granting full access.
 		return false
 	}
+	return ApplyScope(h.vaultClient, scope, filter)
+}
+
+// ApplyScope narrows filter to what a key with scope may read, resolving scope
+// names through client's name maps. It returns false when a constrained
+// dimension resolves to nothing, which callers must treat as a denial. The
+// gRPC server uses it too, so both interfaces enforce key scope alike.
+func ApplyScope(client *vaultwarden.Client, scope auth.Scope, filter *vaultwarden.SecretFilter) bool {
 	if scope.IsEmpty() {
 		return true // unscoped key: full access
 	}
 
-	nm := h.vaultClient.NameMaps()
+	nm := client.NameMaps()
 
 	if len(scope.Organizations) > 0 {
 		ids := resolveScopeRefs(scope.Organizations, nm.Organizations)
@@ -204,19 +1394,43 @@ func (h *Handler) applyKeyScope(c *fiber.Ctx, filter *vaultwarden.SecretFilter)
 	return true
 }
 
+// queryWithAlias returns the query value of name, or of its short alias (e.g.
+// ?org= for ?organization_id=). Giving both with different values is an error.
+func queryWithAlias(c *fiber.Ctx, name, alias string) (string, error) {
+	value := strings.TrimSpace(c.Query(name))
+	aliased := strings.TrimSpace(c.Query(alias))
+	switch {
+	case aliased == "":
+		return value, nil
+	case value == "" || strings.EqualFold(value, aliased):
+		return aliased, nil
+	default:
+		return "", fmt.Errorf("use only one of %s and %s", name, alias)
+	}
+}
+
 // parseSecretFilters reads placement query params: at most one of id or name per dimension.
 // Name-based filters are resolved against h.vaultClient.NameMaps(); unknown names fail.
-// Id-based filters are accepted as-is after UUID parsing (existence is not checked here).
+// Id-based filters are accepted as-is after UUID parsing (existence is not checked here);
+// ?org= and ?collection= are short aliases for organization_id and collection_id.
 func (h *Handler) parseSecretFilters(c *fiber.Ctx) (vaultwarden.SecretFilter, error) {
 	var out vaultwarden.SecretFilter
 
-	orgID, err := parseUUIDQuery("organization_id", c.Query("organization_id"))
+	orgIDRaw, err := queryWithAlias(c, "organization_id", "org")
+	if err != nil {
+		return out, err
+	}
+	orgID, err := parseUUIDQuery("organization_id", orgIDRaw)
 	if err != nil {
 		return out, err
 	}
 	orgName := strings.TrimSpace(c.Query("organization_name"))
 
-	colID, err := parseUUIDQuery("collection_id", c.Query("collection_id"))
+	colIDRaw, err := queryWithAlias(c, "collection_id", "collection")
+	if err != nil {
+		return out, err
+	}
+	colID, err := parseUUIDQuery("collection_id", colIDRaw)
 	if err != nil {
 		return out, err
 	}
@@ -263,13 +1477,208 @@ func (h *Handler) parseSecretFilters(c *fiber.Ctx) (vaultwarden.SecretFilter, er
 	return out, nil
 }
 
-// RefreshCache handles POST /refresh.
+// maxPrefixResults caps the number of names returned by a ?prefix= listing.
+const maxPrefixResults = 100
+
+// ListSecrets handles GET /secrets. It returns the names of the secrets
+// visible to the authenticated key, optionally narrowed by the same placement
+// filters as GetSecret, by ?type=login|note|card|identity and by ?prefix=
+// (case-insensitive, e.g. "prod/db/"). Values are never included, except for a
+// prefix listing that explicitly asks for them with ?values=true. Prefix
+// listings return at most maxPrefixResults names and set "truncated" when
+// more matched.
+func (h *Handler) ListSecrets(c *fiber.Ctx) error {
+	prefix := c.Query("prefix")
+	if prefix != "" && !validators.IsValidFilterQueryValue(prefix) {
+		return response.Error(c, fiber.StatusBadRequest, "invalid prefix")
+	}
+	withValues := c.QueryBool("values")
+	if withValues && prefix == "" {
+		// Never dump the whole vault by accident.
+		return response.Error(c, fiber.StatusBadRequest, "values=true requires a prefix")
+	}
+	if withValues && encryptionRequested(c) {
+		return response.Error(c, fiber.StatusBadRequest, "response encryption cannot be combined with values=true")
+	}
+
+	var cipherType int
+	if raw := c.Query("type"); raw != "" {
+		t, ok := vaultwarden.ParseCipherType(raw)
+		if !ok {
+			return response.Error(c, fiber.StatusBadRequest, "invalid type: use login, note, card or identity")
+		}
+		cipherType = t
+	}
+
+	filter, err := h.parseSecretFilters(c)
+	if err != nil {
+		requestLog(c).Warn.Printf("Invalid secret filters attempted from IP: %s - %v", ipwhitelist.ClientIP(c), err)
+		return response.JSON(c, fiber.Map{"names": []string{}})
+	}
+
+	if !h.applyKeyScope(c, &filter) {
+		requestLog(c).Warn.Printf("Request denied by key scope from IP: %s", ipwhitelist.ClientIP(c))
+		return response.JSON(c, fiber.Map{"names": []string{}})
+	}
+
+	names, err := h.vaultClient.ListSecretsContext(c.Context(), filter, cipherType)
+	if err != nil {
+		requestLog(c).Error.Printf("Failed to list secrets (requested by IP: %s): %v", ipwhitelist.ClientIP(c), err)
+		return response.Error(c, fiber.StatusBadGateway, "failed to list secrets")
+	}
+
+	if prefix == "" {
+		return response.JSON(c, fiber.Map{"names": names})
+	}
+
+	matched := []string{}
+	truncated := false
+	for _, name := range names {
+		if len(name) < len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+			continue
+		}
+		if len(matched) == maxPrefixResults {
+			truncated = true
+			break
+		}
+		matched = append(matched, name)
+	}
+	body := fiber.Map{"names": matched, "truncated": truncated}
+
+	if withValues {
+		values, lookupErrs := h.vaultClient.GetSecretsContext(c.Context(), matched, filter)
+		for name, value := range values {
+			h.checkValueSize(c, name, value)
+			h.recordAccess(c, name, "", nil)
+		}
+		// A name listed a moment ago can still fail to resolve (deleted since,
+		// or the upstream went away); report it like a batch does.
+		errs := make(map[string]string, len(lookupErrs))
+		for name, err := range lookupErrs {
+			h.recordAccess(c, name, "", err)
+			errs[name] = failedItem(err).Error
+		}
+		requestLog(c).Info.Printf("Prefix listing returned %d values and %d errors (requested by IP: %s)", len(values), len(errs), ipwhitelist.ClientIP(c))
+		body["values"] = values
+		body["errors"] = errs
+	}
+
+	return response.JSON(c, body)
+}
+
+// RefreshCache handles POST /refresh: a vault sync like POST /sync, coalesced
+// with any already in flight, that answers with a plain status.
 func (h *Handler) RefreshCache(c *fiber.Ctx) error {
-	h.vaultClient.ClearCache()
+	if _, err := h.vaultClient.SyncNow(c.Context()); err != nil {
+		requestLog(c).Error.Printf("Cache refresh sync failed: %v", err)
+		if errors.Is(err, vaultwarden.ErrAuthFailed) {
+			return response.Error(c, fiber.StatusInternalServerError, "vaultwarden authentication failed")
+		}
+		return response.Error(c, fiber.StatusBadGateway, "vaultwarden unavailable")
+	}
 
-	logger.Info.Println("Cache refresh requested")
-	return c.JSON(fiber.Map{
+	requestLog(c).Info.Println("Cache refresh requested")
+	h.events.Notify(webhook.Event{Type: webhook.EventCacheRefresh, ClientIP: ipwhitelist.ClientIP(c)})
+	return response.JSON(c, fiber.Map{
 		"status":  "ok",
 		"message": "cache cleared successfully",
 	})
 }
+
+// SyncVault handles POST /sync: it syncs the vault now, so items created
+// upstream become visible without waiting for the next background sync, and
+// reports whether a sync ran (false when it joined one already in flight) and
+// how long the call took.
+func (h *Handler) SyncVault(c *fiber.Ctx) error {
+	start := time.Now()
+	synced, err := h.vaultClient.SyncNow(c.Context())
+	elapsed := time.Since(start)
+	if err != nil {
+		requestLog(c).Error.Printf("On-demand vault sync failed: %v", err)
+		if errors.Is(err, vaultwarden.ErrAuthFailed) {
+			return response.Error(c, fiber.StatusInternalServerError, "vaultwarden authentication failed")
+		}
+		return response.Error(c, fiber.StatusBadGateway, "vaultwarden unavailable")
+	}
+
+	requestLog(c).Info.Printf("On-demand vault sync (synced: %t) in %v", synced, elapsed)
+	return response.JSON(c, fiber.Map{
+		"status":      "ok",
+		"synced":      synced,
+		"duration_ms": elapsed.Milliseconds(),
+	})
+}
+
+// recordAccess writes an audit event for one secret access; err is the lookup
+// error (nil when the value was served). The value is never recorded.
+//
+// Params and headers point into buffers Fiber reuses once the handler returns,
+// so every string is copied before the event is queued.
+func (h *Handler) recordAccess(c *fiber.Ctx, secretName, field string, err error) {
+	if h.audit == nil {
+		return
+	}
+	h.audit.Record(secretEvent(c, secretName, field, err))
+}
+
+// recordWrite writes an audit event for an update of secretName; err is the
+// update error (nil when the write succeeded). The new value is never recorded.
+func (h *Handler) recordWrite(c *fiber.Ctx, secretName string, err error) {
+	if h.audit == nil {
+		return
+	}
+	ev := secretEvent(c, secretName, "", err)
+	ev.Kind = audit.KindSecretWrite
+	h.audit.Record(ev)
+}
+
+// secretEvent builds the audit event of one secret access or write.
+func secretEvent(c *fiber.Ctx, secretName, field string, err error) audit.Event {
+	ev := audit.Event{
+		RequestID: strings.Clone(response.RequestID(c)),
+		ClientIP:  strings.Clone(ipwhitelist.ClientIP(c)),
+		Route:     c.Method() + " " + c.Route().Path,
+		Secret:    strings.Clone(secretName),
+		Field:     strings.Clone(field),
+	}
+	if key, ok := auth.KeyFromCtx(c); ok {
+		ev.KeyName = strings.Clone(key.Name)
+	}
+	switch {
+	case err == nil:
+		ev.Outcome = audit.OutcomeSuccess
+	case errors.Is(err, vaultwarden.ErrSecretNotFound), errors.Is(err, vaultwarden.ErrFieldNotFound):
+		ev.Outcome = audit.OutcomeNotFound
+	case errors.Is(err, vaultwarden.ErrSecretDeleted):
+		ev.Outcome = audit.OutcomeDeleted
+	default:
+		ev.Outcome = audit.OutcomeError
+	}
+	return ev
+}
+
+// recordWhitelistChange writes an audit event for a temporary whitelist entry
+// added or removed through the API.
+func (h *Handler) recordWhitelistChange(c *fiber.Ctx, entry string, expires *time.Time, outcome string) {
+	if h.audit == nil {
+		return
+	}
+	ev := audit.Event{
+		Kind:      audit.KindWhitelist,
+		RequestID: strings.Clone(response.RequestID(c)),
+		ClientIP:  strings.Clone(ipwhitelist.ClientIP(c)),
+		Route:     c.Method() + " " + c.Route().Path,
+		Entry:     entry,
+		Expires:   expires,
+		Outcome:   outcome,
+	}
+	if key, ok := auth.KeyFromCtx(c); ok {
+		ev.KeyName = strings.Clone(key.Name)
+	}
+	h.audit.Record(ev)
+}
+
+// requestLog returns loggers that tag each line with the request ID.
+func requestLog(c *fiber.Ctx) *logger.Scoped {
+	return logger.With("request_id", response.RequestID(c))
+}
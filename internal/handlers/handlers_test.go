@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/audit"
 	"github.com/Turbootzz/vaultwarden-api/internal/auth"
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
 	"github.com/Turbootzz/vaultwarden-api/internal/vaultwarden"
+	"github.com/Turbootzz/vaultwarden-api/internal/webhook"
 	"github.com/gofiber/fiber/v2"
 	"github.com/valyala/fasthttp"
 )
@@ -35,22 +43,36 @@ func testVaultItems() map[string]vaultwarden.DecryptedItem {
 	return map[string]vaultwarden.DecryptedItem{
 		"cipher-1": {
 			ID:             "cipher-1",
+			Type:           vaultwarden.CipherTypeLogin,
 			Name:           "db-password",
+			Username:       "dbuser",
 			Password:       "s3cret",
+			Totp:           "JBSWY3DPEHPK3PXP",
+			Fields:         map[string]string{"host": "db.internal"},
 			OrganizationID: testOrgID,
 			CollectionIDs:  []string{testColID},
 			FolderID:       testFolderID,
 		},
 		"cipher-2": {
 			ID:             "cipher-2",
+			Type:           vaultwarden.CipherTypeLogin,
 			Name:           "other-password",
 			Password:       "other-org",
 			OrganizationID: testOtherOrgID,
 		},
 		"cipher-3": {
 			ID:       "cipher-3",
+			Type:     vaultwarden.CipherTypeSecureNote,
 			Name:     "my secret",
 			Password: "partial",
+			Notes:    "# app settings\nAPI_URL=https://api.example.com\nGREETING=\"hello world\"\n",
+		},
+		"cipher-4": {
+			ID:       "cipher-4",
+			Type:     vaultwarden.CipherTypeLogin,
+			Name:     "retired-token",
+			Password: "old",
+			Deleted:  true,
 		},
 	}
 }
@@ -68,6 +90,28 @@ func acquireTestCtx(t *testing.T, query string) (*fiber.App, *fiber.Ctx) {
 	return app, ctx
 }
 
+func TestReadyNotSynced(t *testing.T) {
+	// A client that has never synced cannot serve secrets.
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Get("/ready", h.Ready)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/ready", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "vault not synced yet") {
+		t.Errorf("body = %s, want the failing check", body)
+	}
+}
+
 func TestDecodeSecretPathParam(t *testing.T) {
 	t.Parallel()
 
@@ -149,6 +193,29 @@ func TestParseUUIDQuery(t *testing.T) {
 	}
 }
 
+func TestParseCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30s", 30 * time.Second, false},
+		{"45", 45 * time.Second, false},
+		{"0", 0, false},
+		{"-5", 0, true},
+		{"-1m", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCacheTTL(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCacheTTL(%q) = (%v, %v), want (%v, err=%v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
 func TestParseSecretFilters(t *testing.T) {
 	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(nil, testNameMaps())))
 
@@ -208,6 +275,30 @@ func TestParseSecretFilters(t *testing.T) {
 			vaultwarden.SecretFilter{FolderID: "88888888-8888-4888-8888-888888888888"},
 			"",
 		},
+		{
+			"org and collection aliases",
+			"org=" + testOrgID + "&collection=" + testColID,
+			vaultwarden.SecretFilter{OrganizationID: testOrgID, CollectionID: testColID},
+			"",
+		},
+		{
+			"alias repeating the long form",
+			"org=" + testOrgID + "&organization_id=" + testOrgID,
+			vaultwarden.SecretFilter{OrganizationID: testOrgID},
+			"",
+		},
+		{
+			"alias conflicting with the long form",
+			"collection=" + testColID + "&collection_id=88888888-8888-4888-8888-888888888888",
+			vaultwarden.SecretFilter{},
+			"use only one of collection_id and collection",
+		},
+		{
+			"invalid alias uuid",
+			"org=not-a-uuid",
+			vaultwarden.SecretFilter{},
+			"invalid organization_id",
+		},
 	}
 
 	for _, tt := range tests {
@@ -292,6 +383,12 @@ func TestGetSecret(t *testing.T) {
 			wantStatus: http.StatusNotFound,
 			wantBody:   "secret not found",
 		},
+		{
+			name:       "only match is trashed",
+			path:       "/secret/retired-token",
+			wantStatus: http.StatusGone,
+			wantBody:   "secret deleted",
+		},
 		{
 			name:       "success",
 			path:       "/secret/db-password",
@@ -304,6 +401,41 @@ func TestGetSecret(t *testing.T) {
 			wantStatus: http.StatusOK,
 			wantBody:   "partial",
 		},
+		{
+			name:       "field username",
+			path:       "/secret/db-password",
+			query:      "field=username",
+			wantStatus: http.StatusOK,
+			wantBody:   "dbuser",
+		},
+		{
+			name:       "field totp",
+			path:       "/secret/db-password",
+			query:      "field=totp",
+			wantStatus: http.StatusOK,
+			wantBody:   "JBSWY3DPEHPK3PXP",
+		},
+		{
+			name:       "custom field",
+			path:       "/secret/db-password",
+			query:      "field=host",
+			wantStatus: http.StatusOK,
+			wantBody:   "db.internal",
+		},
+		{
+			name:       "missing field does not fall back",
+			path:       "/secret/db-password",
+			query:      "field=port",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "field not found",
+		},
+		{
+			name:       "invalid field name",
+			path:       "/secret/db-password",
+			query:      "field=bad%0aname",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid field name",
+		},
 		{
 			name:       "success with organization filter",
 			path:       "/secret/db-password",
@@ -352,6 +484,116 @@ func TestGetSecret(t *testing.T) {
 // TestGetSecretFailsClosedWithoutAuth verifies that if the handler is reached
 // without the auth middleware (no scope in context), it denies rather than
 // granting full access.
+func TestGetSecretRaw(t *testing.T) {
+	const fullKey = "full-access-key-for-raw-test-000000000000"
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	tests := []struct {
+		name, target, accept string
+		wantStatus           int
+		wantType, wantBody   string
+	}{
+		{"raw query", "/secret/db-password?raw=true", "", http.StatusOK, fiber.MIMETextPlainCharsetUTF8, "s3cret"},
+		{"accept text/plain", "/secret/db-password", "text/plain", http.StatusOK, fiber.MIMETextPlainCharsetUTF8, "s3cret"},
+		{"raw field", "/secret/db-password?raw=1&field=username", "", http.StatusOK, fiber.MIMETextPlainCharsetUTF8, "dbuser"},
+		{"accept json", "/secret/db-password", "application/json", http.StatusOK, fiber.MIMEApplicationJSON, `"value":"s3cret"`},
+		{"accept any", "/secret/db-password", "*/*", http.StatusOK, fiber.MIMEApplicationJSON, `"value":"s3cret"`},
+		{"raw=false wins over accept", "/secret/db-password?raw=false", "text/plain", http.StatusOK, fiber.MIMEApplicationJSON, `"value":"s3cret"`},
+		{"raw not found", "/secret/missing-item?raw=true", "", http.StatusNotFound, fiber.MIMEApplicationJSON, `"error":"secret not found"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+fullKey)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if tt.wantType == fiber.MIMETextPlainCharsetUTF8 {
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want exactly %q", body, tt.wantBody)
+				}
+			} else if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %q, want substring %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetSecretByID(t *testing.T) {
+	const (
+		fullKey  = "full-access-key-for-byid-test-00000000000"
+		orgKey   = "org-scoped-key-for-byid-test-111111111111"
+		dupA     = "0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e01"
+		dupB     = "0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e02"
+		trashed  = "0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e03"
+		personal = "0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e04"
+	)
+	items := map[string]vaultwarden.DecryptedItem{
+		dupA:     {ID: dupA, Type: vaultwarden.CipherTypeLogin, Name: "shared", Password: "first", Username: "a", OrganizationID: testOrgID},
+		dupB:     {ID: dupB, Type: vaultwarden.CipherTypeLogin, Name: "shared", Password: "second", OrganizationID: testOrgID},
+		trashed:  {ID: trashed, Type: vaultwarden.CipherTypeLogin, Name: "old", Password: "x", OrganizationID: testOrgID, Deleted: true},
+		personal: {ID: personal, Type: vaultwarden.CipherTypeLogin, Name: "mine", Password: "y"},
+	}
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(items, testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{
+		{Name: "full", Key: fullKey},
+		{Name: "acme", Key: orgKey, Scope: auth.Scope{Organizations: []string{"Acme"}}},
+	})))
+	app.Get("/secret/id/:id", h.GetSecretByID)
+
+	tests := []struct {
+		name, target, key string
+		wantStatus        int
+		wantBody          string
+	}{
+		{"first duplicate", "/secret/id/" + dupA, fullKey, http.StatusOK, `"value":"first"`},
+		{"second duplicate", "/secret/id/" + dupB, fullKey, http.StatusOK, `"value":"second"`},
+		{"upper-case id", "/secret/id/" + strings.ToUpper(dupB), fullKey, http.StatusOK, `"name":"shared"`},
+		{"field", "/secret/id/" + dupA + "?field=username", fullKey, http.StatusOK, `"value":"a"`},
+		{"raw", "/secret/id/" + dupA + "?raw=true", fullKey, http.StatusOK, "first"},
+		{"unknown id", "/secret/id/0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7eff", fullKey, http.StatusNotFound, "secret not found"},
+		{"trashed", "/secret/id/" + trashed, fullKey, http.StatusGone, "secret deleted"},
+		{"outside scope", "/secret/id/" + personal, orgKey, http.StatusNotFound, "secret not found"},
+		{"inside scope", "/secret/id/" + dupA, orgKey, http.StatusOK, `"value":"first"`},
+		{"not a uuid", "/secret/id/db-password", fullKey, http.StatusBadRequest, "invalid secret id format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %q, want substring %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
 func TestGetSecretFailsClosedWithoutAuth(t *testing.T) {
 	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
 	app := fiber.New()
@@ -447,3 +689,1616 @@ func TestGetSecretScoped(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSecretDetail(t *testing.T) {
+	const fullKey = "full-access-key-for-detail-test-00000000"
+	items := testVaultItems()
+	items["cipher-5"] = vaultwarden.DecryptedItem{
+		ID:   "cipher-5",
+		Type: vaultwarden.CipherTypeCard,
+		Name: "corp-card",
+		Card: &vaultwarden.CardDetail{Number: "4111111111111111", Code: "123"},
+	}
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(items, testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})))
+	app.Get("/secret/:name/full", h.GetSecretDetail)
+
+	get := func(t *testing.T, path string) (int, vaultwarden.SecretDetail) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+fullKey)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var detail vaultwarden.SecretDetail
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+		}
+		return resp.StatusCode, detail
+	}
+
+	status, login := get(t, "/secret/db-password/full")
+	if status != http.StatusOK {
+		t.Fatalf("login status = %d", status)
+	}
+	if login.Type != "login" || login.Username != "dbuser" || login.Password != "s3cret" || login.Totp == "" {
+		t.Errorf("login detail = %+v", login)
+	}
+
+	status, card := get(t, "/secret/corp-card/full")
+	if status != http.StatusOK {
+		t.Fatalf("card status = %d", status)
+	}
+	if card.Card == nil || card.Card.Number != "4111111111111111" {
+		t.Errorf("card detail = %+v", card)
+	}
+
+	if status, _ := get(t, "/secret/retired-token/full"); status != http.StatusGone {
+		t.Errorf("trashed status = %d, want %d", status, http.StatusGone)
+	}
+	if status, _ := get(t, "/secret/missing-item/full"); status != http.StatusNotFound {
+		t.Errorf("missing status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestBatchGetSecrets(t *testing.T) {
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+
+	const (
+		fullKey    = "full-access-batch-000000000000000000000000"
+		orgKey     = "org-scoped-batch-22222222222222222222222222"
+		nowhereKey = "nowhere-scoped-batch-333333333333333333333"
+	)
+	store := auth.NewStore([]auth.APIKey{
+		{Name: "full", Key: fullKey},
+		{Name: "acme", Key: orgKey, Scope: auth.Scope{Organizations: []string{"Acme"}}},
+		{Name: "nowhere", Key: nowhereKey, Scope: auth.Scope{Organizations: []string{"Nowhere"}}},
+	})
+
+	app := fiber.New()
+	app.Use(auth.Middleware(store))
+	app.Post("/secrets/batch", h.BatchGetSecrets)
+
+	type batchResponse struct {
+		Results map[string]string `json:"results"`
+		Errors  map[string]string `json:"errors"`
+	}
+	post := func(t *testing.T, key, body string) (int, batchResponse) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/secrets/batch", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var out batchResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+		}
+		return resp.StatusCode, out
+	}
+
+	t.Run("mixed results", func(t *testing.T) {
+		status, out := post(t, fullKey, `{"names":["db-password","other-password","missing-item","retired-token",".."]}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		want := batchResponse{
+			Results: map[string]string{"db-password": "s3cret", "other-password": "other-org"},
+			Errors: map[string]string{
+				"missing-item":  "not found",
+				"retired-token": "deleted",
+				"..":            "invalid secret name format",
+			},
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("response = %+v, want %+v", out, want)
+		}
+	})
+
+	t.Run("keyed by the name as requested", func(t *testing.T) {
+		_, out := post(t, fullKey, `{"names":[" db-password ","db-password"," missing-item","  "]}`)
+		want := batchResponse{
+			Results: map[string]string{" db-password ": "s3cret", "db-password": "s3cret"},
+			Errors:  map[string]string{" missing-item": "not found", "  ": "invalid secret name format"},
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("response = %+v, want %+v", out, want)
+		}
+	})
+
+	t.Run("scope applies to every name", func(t *testing.T) {
+		_, out := post(t, orgKey, `{"names":["db-password","other-password"]}`)
+		if out.Results["db-password"] != "s3cret" || out.Errors["other-password"] != "not found" {
+			t.Errorf("response = %+v", out)
+		}
+	})
+
+	t.Run("statuses", func(t *testing.T) {
+		post := func(t *testing.T, key, query, body string) map[string]batchItem {
+			t.Helper()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/secrets/batch"+query, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+key)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			var out struct {
+				Items map[string]batchItem `json:"items"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			return out.Items
+		}
+		secret := "s3cret"
+		got := post(t, fullKey, "?statuses=true", `{"names":["db-password","missing-item","retired-token",".."]}`)
+		want := map[string]batchItem{
+			"db-password":   {Status: batchFound, Value: &secret},
+			"missing-item":  {Status: batchNotFound, Error: "not found"},
+			"retired-token": {Status: batchNotFound, Error: "deleted"},
+			"..":            {Status: batchInvalid, Error: "invalid secret name format"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("items = %+v, want %+v", got, want)
+		}
+
+		// A name outside the key's scope is not found, so a scoped key cannot
+		// probe for it; forbidden is reserved for a scope that denies the request.
+		got = post(t, orgKey, "?statuses=true", `{"names":["other-password"]}`)
+		if item := got["other-password"]; item.Status != batchNotFound {
+			t.Errorf("out-of-scope name: item = %+v, want not-found", item)
+		}
+		got = post(t, nowhereKey, "?statuses=true", `{"names":["db-password"]}`)
+		if item := got["db-password"]; item.Status != batchForbidden || item.Value != nil {
+			t.Errorf("scope matching nothing: item = %+v, want forbidden without a value", item)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		tooMany := make([]string, maxBatchSize+1)
+		for i := range tooMany {
+			tooMany[i] = "db-password"
+		}
+		body, _ := json.Marshal(batchRequest{Names: tooMany})
+		for _, b := range []string{`not json`, `{"names":[]}`, string(body)} {
+			if status, _ := post(t, fullKey, b); status != http.StatusBadRequest {
+				t.Errorf("body %.30q: status = %d, want 400", b, status)
+			}
+		}
+	})
+}
+
+func TestValidateSecretName(t *testing.T) {
+	// No vault client: validation must never reach Vaultwarden.
+	h := NewHandler(nil)
+
+	app := fiber.New()
+	app.Get("/validate/:name", h.ValidateSecretName)
+
+	tests := []struct {
+		path      string
+		wantValid bool
+	}{
+		{"/validate/db-password", true},
+		{"/validate/my%20secret", true},
+		{"/validate/a..b", false},
+		{"/validate/semi;colon", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, nil)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		var got struct {
+			Valid  bool   `json:"valid"`
+			Reason string `json:"reason"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d, json %v", tt.path, resp.StatusCode, err)
+		}
+		if got.Valid != tt.wantValid || (got.Reason == "") != tt.wantValid {
+			t.Errorf("%s: got %+v, want valid=%v with a reason when invalid", tt.path, got, tt.wantValid)
+		}
+	}
+}
+
+func TestPostSecret(t *testing.T) {
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+
+	const fullKey = "full-access-post-00000000000000000000000000"
+	store := auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})
+
+	app := fiber.New()
+	app.Use(auth.Middleware(store))
+	app.Post("/secret", h.PostSecret)
+
+	tests := []struct {
+		name, body string
+		wantStatus int
+		want       map[string]string
+	}{
+		{"by name", `{"name":"db-password"}`, http.StatusOK, map[string]string{"name": "db-password", "value": "s3cret"}},
+		{"name with space", `{"name":"my secret"}`, http.StatusOK, map[string]string{"name": "my secret", "value": "partial"}},
+		{"field", `{"name":"db-password","field":"username"}`, http.StatusOK, map[string]string{"name": "db-password", "field": "username", "value": "dbuser"}},
+		{"missing", `{"name":"missing-item"}`, http.StatusNotFound, nil},
+		{"trashed", `{"name":"retired-token"}`, http.StatusGone, nil},
+		{"empty name", `{"name":""}`, http.StatusBadRequest, nil},
+		{"invalid name", `{"name":"../etc"}`, http.StatusBadRequest, nil},
+		{"invalid field", `{"name":"db-password","field":"a\u0000b"}`, http.StatusBadRequest, nil},
+		{"bad body", `not json`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/secret", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+fullKey)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.want == nil {
+				return
+			}
+			var got map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("body = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSecret(t *testing.T) {
+	sink := &auditSink{}
+	auditLog := audit.New(sink)
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())), WithAudit(auditLog))
+
+	const fullKey = "full-access-update-0000000000000000000000"
+	store := auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})
+
+	app := fiber.New()
+	app.Use(auth.Middleware(store))
+	app.Put("/secret/:name", h.UpdateSecret)
+	app.Get("/secret/:name", h.GetSecret)
+
+	put := func(t *testing.T, name, body string) int {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPut, "/secret/"+name, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+fullKey)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name, secret, body string
+		want               int
+	}{
+		{"login updated", "db-password", `{"value":"rotated"}`, http.StatusOK},
+		{"note not writable", "my%20secret", `{"value":"x"}`, http.StatusUnprocessableEntity},
+		{"missing", "missing-item", `{"value":"x"}`, http.StatusNotFound},
+		{"trashed", "retired-token", `{"value":"x"}`, http.StatusGone},
+		{"empty value", "db-password", `{"value":""}`, http.StatusBadRequest},
+		{"bad body", "db-password", `not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := put(t, tt.secret, tt.body); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	auditLog.Close()
+	wantWrites := []struct{ secret, outcome string }{
+		{"db-password", audit.OutcomeSuccess},
+		{"my secret", audit.OutcomeError},
+		{"missing-item", audit.OutcomeNotFound},
+		{"retired-token", audit.OutcomeDeleted},
+	}
+	if len(sink.events) != len(wantWrites) {
+		t.Fatalf("recorded %d audit events, want %d: %+v", len(sink.events), len(wantWrites), sink.events)
+	}
+	for i, w := range wantWrites {
+		ev := sink.events[i]
+		if ev.Kind != audit.KindSecretWrite || ev.Secret != w.secret || ev.Outcome != w.outcome || ev.KeyName != "full" {
+			t.Errorf("audit event %d = %+v, want a %s write of %s by key full", i, ev, w.outcome, w.secret)
+		}
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secret/db-password", nil)
+	req.Header.Set("Authorization", "Bearer "+fullKey)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	var out map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out["value"] != "rotated" {
+		t.Errorf("GET after update = (%v, %v), want value rotated", out, err)
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+
+	const (
+		fullKey = "full-access-0000000000000000000000000000"
+		orgKey  = "org-scoped-2222222222222222222222222222222"
+	)
+	store := auth.NewStore([]auth.APIKey{
+		{Name: "full", Key: fullKey},
+		{Name: "acme", Key: orgKey, Scope: auth.Scope{Organizations: []string{"Acme"}}},
+	})
+
+	app := fiber.New()
+	app.Use(auth.Middleware(store))
+	app.Get("/secrets", h.ListSecrets)
+
+	tests := []struct {
+		name       string
+		key        string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"full access lists all", fullKey, "", http.StatusOK, []string{"db-password", "my secret", "other-password"}},
+		{"type filter", fullKey, "type=note", http.StatusOK, []string{"my secret"}},
+		{"placement filter", fullKey, "folder_name=Work", http.StatusOK, []string{"db-password"}},
+		{"scope limits listing", orgKey, "", http.StatusOK, []string{"db-password"}},
+		{"invalid type", fullKey, "type=ssh", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "/secrets"
+			if tt.query != "" {
+				url += "?" + tt.query
+			}
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if strings.Contains(string(body), "s3cret") {
+				t.Fatalf("listing leaked a secret value: %s", body)
+			}
+			var payload struct {
+				Names []string `json:"names"`
+			}
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			if !reflect.DeepEqual(payload.Names, tt.want) {
+				t.Errorf("names = %v, want %v", payload.Names, tt.want)
+			}
+		})
+	}
+}
+
+func TestListSecretsPrefix(t *testing.T) {
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+
+	const fullKey = "full-access-prefix-00000000000000000000000"
+	store := auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})
+
+	app := fiber.New()
+	app.Use(auth.Middleware(store))
+	app.Get("/secrets", h.ListSecrets)
+
+	type listResponse struct {
+		Names     []string          `json:"names"`
+		Truncated bool              `json:"truncated"`
+		Values    map[string]string `json:"values"`
+		Errors    map[string]string `json:"errors"`
+	}
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       listResponse
+	}{
+		{"names only", "prefix=DB-", http.StatusOK, listResponse{Names: []string{"db-password"}}},
+		{"no match", "prefix=zzz", http.StatusOK, listResponse{Names: []string{}}},
+		{"with values", "prefix=db-&values=true", http.StatusOK, listResponse{
+			Names: []string{"db-password"}, Values: map[string]string{"db-password": "s3cret"}, Errors: map[string]string{},
+		}},
+		{"values need a prefix", "values=true", http.StatusBadRequest, listResponse{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secrets?"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+fullKey)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got listResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSecretNoteFormat(t *testing.T) {
+	const fullKey = "full-access-key-for-note-format-0000000000"
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	tests := []struct {
+		name, target       string
+		wantStatus         int
+		wantType, wantBody string
+	}{
+		{"dotenv", "/secret/my%20secret?format=dotenv", http.StatusOK, fiber.MIMETextPlainCharsetUTF8,
+			"API_URL=https://api.example.com\nGREETING='hello world'\n"},
+		{"json", "/secret/my%20secret?format=json", http.StatusOK, fiber.MIMEApplicationJSON,
+			`{"API_URL":"https://api.example.com","GREETING":"hello world"}`},
+		{"single key", "/secret/my%20secret?field=GREETING&raw=true", http.StatusOK, fiber.MIMETextPlainCharsetUTF8, "hello world"},
+		{"missing key", "/secret/my%20secret?field=NOPE", http.StatusNotFound, fiber.MIMEApplicationJSON, `{"error":"field not found"}`},
+		{"not a note", "/secret/db-password?format=dotenv", http.StatusUnprocessableEntity, fiber.MIMEApplicationJSON,
+			`{"error":"format=dotenv requires a secure note"}`},
+		{"unknown format", "/secret/my%20secret?format=yaml", http.StatusBadRequest, fiber.MIMEApplicationJSON,
+			`{"error":"invalid format (use dotenv, json or full)"}`},
+		{"format with field", "/secret/my%20secret?format=json&field=API_URL", http.StatusBadRequest, fiber.MIMEApplicationJSON,
+			`{"error":"format cannot be combined with field"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+fullKey)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{vaultwarden.ErrSecretNotFound, http.StatusNotFound, "secret not found"},
+		{vaultwarden.ErrFieldNotFound, http.StatusNotFound, "field not found"},
+		{vaultwarden.ErrSecretDeleted, http.StatusGone, "secret deleted"},
+		{fmt.Errorf("sync before fetch: %w", fmt.Errorf("%w: HTTP 503", vaultwarden.ErrUpstreamUnavailable)), http.StatusBadGateway, "vaultwarden unavailable"},
+		{fmt.Errorf("sync before fetch: %w", fmt.Errorf("%w: HTTP 401", vaultwarden.ErrAuthFailed)), http.StatusInternalServerError, "vaultwarden authentication failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error { return lookupError(c, tt.err) })
+
+			resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil), -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("got %d %s, want %d with %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+// auditSink collects audit events in memory.
+type auditSink struct{ events []audit.Event }
+
+func (s *auditSink) Write(ev audit.Event) error {
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	const key = "audit-test-key-000000000000000000000000000"
+	sink := &auditSink{}
+	log := audit.New(sink)
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())), WithAudit(log))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "ci", Key: key}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	for _, target := range []string{"/secret/db-password?field=username", "/secret/missing", "/secret/retired-token"} {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+	}
+	log.Close()
+
+	want := []struct{ secret, field, outcome string }{
+		{"db-password", "username", audit.OutcomeSuccess},
+		{"missing", "", audit.OutcomeNotFound},
+		{"retired-token", "", audit.OutcomeDeleted},
+	}
+	if len(sink.events) != len(want) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(sink.events), len(want), sink.events)
+	}
+	for i, w := range want {
+		ev := sink.events[i]
+		if ev.Secret != w.secret || ev.Field != w.field || ev.Outcome != w.outcome {
+			t.Errorf("event %d = %s/%s/%s, want %s/%s/%s", i, ev.Secret, ev.Field, ev.Outcome, w.secret, w.field, w.outcome)
+		}
+		if ev.KeyName != "ci" || ev.Route != "GET /secret/:name" || ev.ClientIP == "" {
+			t.Errorf("event %d = %+v, want key ci on GET /secret/:name with a client IP", i, ev)
+		}
+	}
+}
+
+func TestResponseEncryptionRefused(t *testing.T) {
+	const apiKey = "encryption-refused-key-000000000000000000"
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())),
+		WithResponseEncryption(aead))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: apiKey}})))
+	app.Get("/secret/:name/full", h.GetSecretDetail)
+	app.Get("/secret/:name", h.GetSecret)
+	app.Get("/secrets", h.ListSecrets)
+	app.Post("/secrets/batch", h.BatchGetSecrets)
+
+	// Responses with more than one value cannot be sealed and must not fall
+	// back to plaintext.
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"full item", http.MethodGet, "/secret/db-password/full", ""},
+		{"format full", http.MethodGet, "/secret/db-password?format=full", ""},
+		{"format json", http.MethodGet, "/secret/my%20secret?format=json", ""},
+		{"format dotenv", http.MethodGet, "/secret/my%20secret?format=dotenv", ""},
+		{"batch", http.MethodPost, "/secrets/batch", `{"names":["db-password"]}`},
+		{"prefix values", http.MethodGet, "/secrets?prefix=db&values=true", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(headerResponseEncryption, encryptionAlgorithm)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "response encryption") {
+				t.Errorf("status = %d, body %s, want 400 refusing response encryption", resp.StatusCode, body)
+			}
+			if strings.Contains(string(body), "s3cret") || strings.Contains(string(body), "api.example.com") {
+				t.Errorf("plaintext value in response: %s", body)
+			}
+		})
+	}
+}
+
+func TestResponseEncryption(t *testing.T) {
+	const apiKey = "encryption-test-key-0000000000000000000000"
+	key := make([]byte, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newApp := func(opts ...Option) *fiber.App {
+		h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())), opts...)
+		app := fiber.New()
+		app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: apiKey}})))
+		app.Get("/secret/:name", h.GetSecret)
+		return app
+	}
+	get := func(t *testing.T, app *fiber.App, target, alg string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		if alg != "" {
+			req.Header.Set("X-Response-Encryption", alg)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		// ?raw=true is overridden: encrypted values always come back as JSON.
+		resp, body := get(t, newApp(WithResponseEncryption(aead)), "/secret/db-password?raw=true", "aes-256-gcm")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body %s", resp.StatusCode, body)
+		}
+		var got struct{ Name, Value, Nonce, Encryption string }
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		if got.Encryption != "aes-256-gcm" || strings.Contains(string(body), "s3cret") {
+			t.Fatalf("body = %s, want an aes-256-gcm sealed value", body)
+		}
+		sealed, _ := base64.StdEncoding.DecodeString(got.Value)
+		nonce, _ := base64.StdEncoding.DecodeString(got.Nonce)
+		plain, err := aead.Open(nil, nonce, sealed, []byte(got.Name))
+		if err != nil || string(plain) != "s3cret" {
+			t.Errorf("decrypted %q (%v), want s3cret", plain, err)
+		}
+		if _, err := aead.Open(nil, nonce, sealed, []byte("other-password")); err == nil {
+			t.Error("ciphertext opened under another secret name")
+		}
+	})
+
+	t.Run("plaintext without header", func(t *testing.T) {
+		_, body := get(t, newApp(WithResponseEncryption(aead)), "/secret/db-password", "")
+		if !strings.Contains(string(body), `"value":"s3cret"`) {
+			t.Errorf("body = %s, want the plaintext value", body)
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		resp, _ := get(t, newApp(WithResponseEncryption(aead)), "/secret/db-password", "rsa")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		resp, body := get(t, newApp(), "/secret/db-password", "aes-256-gcm")
+		if resp.StatusCode != http.StatusBadRequest || strings.Contains(string(body), "s3cret") {
+			t.Errorf("status = %d, body %s, want 400 without the value", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestVersion(t *testing.T) {
+	app := fiber.New()
+	app.Get("/version", NewHandler(nil).Version)
+
+	resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/version", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	var got map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, k := range []string{"version", "commit", "buildTime", "goVersion"} {
+		if got[k] == "" {
+			t.Errorf("%s missing from %v", k, got)
+		}
+	}
+}
+
+func TestRootAndNotFound(t *testing.T) {
+	h := NewHandler(nil)
+	app := fiber.New()
+	app.Get("/", h.Root)
+	app.Get("/health", h.HealthCheck)
+	app.Use(h.NotFound)
+
+	tests := []struct {
+		method     string
+		target     string
+		wantStatus int
+		wantKey    string
+		wantValue  string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "service", "vaultwarden-api"},
+		{http.MethodGet, "/secrte/db-password", http.StatusNotFound, "error", "not found"},
+		{http.MethodDelete, "/health", http.StatusNotFound, "error", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), tt.method, tt.target, nil), -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			var got map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus || got[tt.wantKey] != tt.wantValue {
+				t.Errorf("got %d %v, want %d with %s=%q", resp.StatusCode, got, tt.wantStatus, tt.wantKey, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestAuthStatus(t *testing.T) {
+	get := func(t *testing.T, client *vaultwarden.Client) (int, map[string]any) {
+		t.Helper()
+		app := fiber.New()
+		app.Get("/auth/status", NewHandler(client).AuthStatus)
+		resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/auth/status", nil), -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.StatusCode, got
+	}
+
+	t.Run("before login", func(t *testing.T) {
+		api := vaultwarden.NewAPIClient("https://vault.example.com", "user@example.com", "pw", "id", "secret")
+		status, got := get(t, vaultwarden.NewClient(api, 0, 0))
+		if status != http.StatusOK || got["mode"] != "api" || got["grant"] != "client_credentials" {
+			t.Errorf("got %d %v", status, got)
+		}
+		if v, ok := got["tokenExpiresAt"]; !ok || v != nil {
+			t.Errorf("tokenExpiresAt = %v, want null", v)
+		}
+	})
+
+	t.Run("no api client", func(t *testing.T) {
+		if status, got := get(t, vaultwarden.NewClient(nil, 0, 0)); status != http.StatusServiceUnavailable {
+			t.Errorf("got %d %v, want 503", status, got)
+		}
+	})
+}
+
+func TestHealthCheckVerbose(t *testing.T) {
+	client := vaultwarden.NewClient(nil, 5*time.Minute, 10*time.Minute,
+		vaultwarden.WithState(testVaultItems(), testNameMaps()),
+		vaultwarden.WithSyncBeforeFetch(time.Minute),
+		vaultwarden.WithTTLOverrides(map[string]time.Duration{"db-password": 0}))
+	get := func(t *testing.T, h *Handler, target string) map[string]any {
+		t.Helper()
+		app := fiber.New()
+		app.Get("/health", h.HealthCheck)
+		resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil), -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	if got := get(t, NewHandler(client), "/health?verbose=true"); len(got) != 2 || got["status"] != "ok" {
+		t.Errorf("without WithVerboseHealth: %v, want only status and service", got)
+	}
+	verbose := NewHandler(client, WithVerboseHealth())
+	if got := get(t, verbose, "/health"); len(got) != 2 {
+		t.Errorf("without ?verbose: %v, want only status and service", got)
+	}
+
+	got := get(t, verbose, "/health?verbose=true")
+	cache, _ := got["cache"].(map[string]any)
+	want := map[string]any{"maxAge": "1m0s", "ttlOverrides": float64(1), "syncInterval": "10m0s", "items": float64(len(testVaultItems()))}
+	if !reflect.DeepEqual(cache, want) {
+		t.Errorf("cache = %v, want %v (CACHE_TTL is not used and must not be reported)", cache, want)
+	}
+	if mode, _ := got["auth"].(map[string]any); mode["mode"] != "none" {
+		t.Errorf("auth = %v, want mode none without an API client", got["auth"])
+	}
+	if v, ok := got["lastSync"]; !ok || v != nil {
+		t.Errorf("lastSync = %v, want null before a sync", v)
+	}
+}
+
+func TestSyncVault(t *testing.T) {
+	app := fiber.New()
+	app.Post("/sync", NewHandler(vaultwarden.NewClient(nil, 0, 0)).SyncVault)
+
+	resp, err := app.Test(httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/sync", nil), -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Status     string `json:"status"`
+		Synced     *bool  `json:"synced"`
+		DurationMS *int64 `json:"duration_ms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || got.Status != "ok" || got.Synced == nil || *got.Synced || got.DurationMS == nil {
+		t.Errorf("status %d, body %+v, want ok with synced=false and a duration", resp.StatusCode, got)
+	}
+}
+
+func TestSecretExists(t *testing.T) {
+	const key = "head-test-key-0000000000000000000000000000"
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Head("/secret/:name", h.SecretExists)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/secret/db-password", http.StatusOK},
+		{"/secret/db-password?field=host", http.StatusOK},
+		{"/secret/db-password?field=missing", http.StatusNotFound},
+		{"/secret/nonexistent", http.StatusNotFound},
+		{"/secret/retired-token", http.StatusGone},
+		{"/secret/bad$name", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodHead, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || len(body) != 0 {
+				t.Errorf("status %d, body %q; want %d with no body", resp.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGetSecretURIs(t *testing.T) {
+	const key = "uris-test-key-00000000000000000000000000000"
+	items := map[string]vaultwarden.DecryptedItem{
+		"c1": {ID: "c1", Type: vaultwarden.CipherTypeLogin, Name: "portal", Password: "pw",
+			URI: "https://a.example.com", URIs: []string{"https://a.example.com", "https://b.example.com"}},
+		"c2": {ID: "c2", Type: vaultwarden.CipherTypeLogin, Name: "no-uris", Password: "pw"},
+	}
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(items, testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantValue  any
+	}{
+		{"/secret/portal?field=uris", http.StatusOK, []any{"https://a.example.com", "https://b.example.com"}},
+		{"/secret/portal?field=uri&index=1", http.StatusOK, "https://b.example.com"},
+		{"/secret/portal?field=uri&index=0", http.StatusOK, "https://a.example.com"},
+		{"/secret/portal?field=uri&index=2", http.StatusBadRequest, nil},
+		{"/secret/portal?field=uri&index=-1", http.StatusBadRequest, nil},
+		{"/secret/portal?field=username&index=0", http.StatusBadRequest, nil},
+		{"/secret/portal?index=0", http.StatusBadRequest, nil},
+		{"/secret/portal?field=uris&transform=trim", http.StatusBadRequest, nil},
+		{"/secret/no-uris?field=uris", http.StatusNotFound, nil},
+		{"/secret/no-uris?field=uri&index=0", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%v)", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantValue != nil && !reflect.DeepEqual(body["value"], tt.wantValue) {
+				t.Errorf("value = %v, want %v", body["value"], tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestCacheTTLEffective(t *testing.T) {
+	const (
+		adminKey  = "cache-admin-key-00000000000000000000000000"
+		readerKey = "cache-reader-key-0000000000000000000000000"
+	)
+	newApp := func(syncInterval time.Duration) *fiber.App {
+		vc := vaultwarden.NewClient(nil, 0, syncInterval,
+			vaultwarden.WithState(testVaultItems(), testNameMaps()),
+			vaultwarden.WithTTLOverrides(map[string]time.Duration{"db-password": 30 * time.Second}))
+		h := NewHandler(vc)
+		app := fiber.New()
+		app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{
+			{Name: "admin", Key: adminKey, Admin: true},
+			{Name: "reader", Key: readerKey},
+		})))
+		app.Get("/secret/:name", h.GetSecret)
+		app.Get("/cache", h.ListCache)
+		return app
+	}
+	get := func(t *testing.T, app *fiber.App, target, key string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.StatusCode, body
+	}
+
+	app := newApp(5 * time.Minute)
+	for target, want := range map[string]any{
+		"/secret/db-password?meta=true":    "30s",
+		"/secret/other-password?meta=true": "5m0s",
+	} {
+		status, body := get(t, app, target, readerKey)
+		if status != http.StatusOK || body["cache_ttl_effective"] != want {
+			t.Errorf("%s: status %d, cache_ttl_effective = %v, want %v", target, status, body["cache_ttl_effective"], want)
+		}
+	}
+	if _, body := get(t, app, "/secret/db-password", readerKey); body["cache_ttl_effective"] != nil {
+		t.Errorf("cache_ttl_effective without meta=true: %v", body["cache_ttl_effective"])
+	}
+	if _, body := get(t, newApp(0), "/secret/other-password?meta=true", readerKey); body["cache_ttl_effective"] != nil {
+		t.Errorf("unbounded cache_ttl_effective = %v, want null", body["cache_ttl_effective"])
+	}
+
+	if status, _ := get(t, app, "/cache", readerKey); status != http.StatusForbidden {
+		t.Errorf("GET /cache with a non-admin key: status %d, want 403", status)
+	}
+	status, body := get(t, app, "/cache", adminKey)
+	if status != http.StatusOK {
+		t.Fatalf("GET /cache: status %d", status)
+	}
+	raw, _ := json.Marshal(body)
+	if strings.Contains(string(raw), "s3cret") || strings.Contains(string(raw), "retired-token") {
+		t.Errorf("cache listing leaks a value or a trashed name: %s", raw)
+	}
+	want := `{"entries":[{"cache_ttl_effective":"30s","name":"db-password"},{"cache_ttl_effective":"5m0s","name":"my secret"},{"cache_ttl_effective":"5m0s","name":"other-password"}]}`
+	if string(raw) != want {
+		t.Errorf("GET /cache = %s, want %s", raw, want)
+	}
+}
+
+func TestExportSecrets(t *testing.T) {
+	const (
+		globalKey = "export-global-key-0000000000000000000000000"
+		scopedKey = "export-scoped-key-0000000000000000000000000"
+	)
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newApp := func(opts ...Option) *fiber.App {
+		h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())), opts...)
+		app := fiber.New()
+		app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{
+			{Name: "global", Key: globalKey, Admin: true},
+			{Name: "scoped", Key: scopedKey, Admin: true, Scope: auth.Scope{Organizations: []string{testOrgID}}},
+		})))
+		app.Get("/export", h.ExportSecrets)
+		return app
+	}
+	get := func(t *testing.T, app *fiber.App, target, key string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		resp, body := get(t, newApp(WithResponseEncryption(aead)), "/export?confirm=yes", globalKey)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body %s", resp.StatusCode, body)
+		}
+		if strings.Contains(string(body), "s3cret") || strings.Contains(string(body), "db-password") {
+			t.Fatalf("export contains plaintext: %s", body)
+		}
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		var trailer struct {
+			Done  bool
+			Count int
+		}
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &trailer); err != nil || !trailer.Done || trailer.Count != 3 {
+			t.Fatalf("trailer = %s, want done with 3 secrets (the trashed one excluded)", lines[len(lines)-1])
+		}
+		names := map[string]bool{}
+		for _, line := range lines[:len(lines)-1] {
+			var rec struct{ ID, Data, Nonce, Encryption string }
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("decode %s: %v", line, err)
+			}
+			sealed, _ := base64.StdEncoding.DecodeString(rec.Data)
+			nonce, _ := base64.StdEncoding.DecodeString(rec.Nonce)
+			plain, err := aead.Open(nil, nonce, sealed, []byte(rec.ID))
+			if err != nil {
+				t.Fatalf("open record %s: %v", rec.ID, err)
+			}
+			var detail vaultwarden.SecretDetail
+			if err := json.Unmarshal(plain, &detail); err != nil {
+				t.Fatalf("decode detail: %v", err)
+			}
+			names[detail.Name] = true
+			if detail.Name == "db-password" && detail.Password != "s3cret" {
+				t.Errorf("db-password detail = %+v", detail)
+			}
+		}
+		if len(names) != 3 || !names["db-password"] || names["retired-token"] {
+			t.Errorf("exported %v, want the three live secrets", names)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		target     string
+		key        string
+		wantStatus int
+	}{
+		{"without confirm", []Option{WithResponseEncryption(aead)}, "/export", globalKey, http.StatusBadRequest},
+		{"wrong confirm", []Option{WithResponseEncryption(aead)}, "/export?confirm=true", globalKey, http.StatusBadRequest},
+		{"scoped key", []Option{WithResponseEncryption(aead)}, "/export?confirm=yes", scopedKey, http.StatusForbidden},
+		{"no encryption key", nil, "/export?confirm=yes", globalKey, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, newApp(tt.opts...), tt.target, tt.key)
+			if resp.StatusCode != tt.wantStatus || strings.Contains(string(body), "s3cret") {
+				t.Errorf("status = %d, body %s, want %d", resp.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGetSecretCardAndIdentity(t *testing.T) {
+	const key = "card-test-key-00000000000000000000000000000"
+	items := map[string]vaultwarden.DecryptedItem{
+		"c1": {ID: "c1", Type: vaultwarden.CipherTypeCard, Name: "corp-visa",
+			Card: &vaultwarden.CardDetail{Brand: "Visa", Number: "4111111111111111", ExpMonth: "12", ExpYear: "2030"}},
+		"c2": {ID: "c2", Type: vaultwarden.CipherTypeIdentity, Name: "jane",
+			Identity: &vaultwarden.IdentityDetail{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"}},
+	}
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(items, testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantValue  any
+	}{
+		{"/secret/corp-visa?field=number", http.StatusOK, "4111111111111111"},
+		{"/secret/corp-visa?field=expiry", http.StatusOK, "12/2030"},
+		{"/secret/corp-visa?field=code", http.StatusNotFound, nil},
+		{"/secret/corp-visa?format=full&field=number", http.StatusBadRequest, nil},
+		{"/secret/jane?field=email", http.StatusOK, "jane@example.com"},
+		{"/secret/jane?field=fullName", http.StatusOK, "Jane Doe"},
+		{"/secret/jane?field=phone", http.StatusNotFound, nil},
+		{"/secret/jane?field=favouriteColour", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%v)", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantValue != nil && body["value"] != tt.wantValue {
+				t.Errorf("value = %v, want %v", body["value"], tt.wantValue)
+			}
+		})
+	}
+
+	t.Run("format=full", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secret/corp-visa?format=full", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Name string                 `json:"name"`
+			Type string                 `json:"type"`
+			Card vaultwarden.CardDetail `json:"card"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || body.Name != "corp-visa" || body.Type != "card" ||
+			body.Card.Number != "4111111111111111" || body.Card.ExpMonth != "12" {
+			t.Errorf("status %d, body %+v", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("identity format=full", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secret/jane?format=full", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Type     string                     `json:"type"`
+			Identity vaultwarden.IdentityDetail `json:"identity"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || body.Type != "identity" || body.Identity.Email != "jane@example.com" {
+			t.Errorf("status %d, body %+v", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestGetSecretTransform(t *testing.T) {
+	const key = "transform-test-key-000000000000000000000000"
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantValue  string
+	}{
+		{"/secret/db-password?field=host&transform=base64decode", http.StatusUnprocessableEntity, ""},
+		{"/secret/db-password?field=username&transform=trim", http.StatusOK, "dbuser"},
+		{"/secret/db-password?transform=rot13", http.StatusBadRequest, ""},
+		{"/secret/db-password?transform=trim&fields=host", http.StatusBadRequest, ""},
+		{"/secret/db-password?transform=trim&format=json", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			var body map[string]any
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%v)", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantValue != "" && body["value"] != tt.wantValue {
+				t.Errorf("value = %v, want %q", body["value"], tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestGetSecretFields(t *testing.T) {
+	const key = "fields-test-key-00000000000000000000000000"
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Get("/secret/:name", h.GetSecret)
+
+	get := func(t *testing.T, target string, header ...string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	t.Run("found and missing", func(t *testing.T) {
+		status, body := get(t, "/secret/db-password?fields=host,%20username,port,host")
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (%v)", status, body)
+		}
+		fields, _ := body["fields"].(map[string]any)
+		errs, _ := body["errors"].(map[string]any)
+		if len(fields) != 2 || fields["host"] != "db.internal" || fields["username"] != "dbuser" {
+			t.Errorf("fields = %v", fields)
+		}
+		if len(errs) != 1 || errs["port"] != "not found" {
+			t.Errorf("errors = %v", errs)
+		}
+	})
+
+	var names []string
+	for i := range maxFields + 1 {
+		names = append(names, fmt.Sprintf("f%d", i))
+	}
+	tooManyFields := strings.Join(names, ",")
+
+	tests := []struct {
+		name       string
+		target     string
+		header     []string
+		wantStatus int
+	}{
+		{"missing secret", "/secret/nonexistent?fields=host", nil, http.StatusNotFound},
+		{"deleted secret", "/secret/retired-token?fields=host", nil, http.StatusGone},
+		{"invalid field name", "/secret/db-password?fields=host,bad%01field", nil, http.StatusBadRequest},
+		{"only commas", "/secret/db-password?fields=,,", nil, http.StatusBadRequest},
+		{"with field", "/secret/db-password?fields=host&field=username", nil, http.StatusBadRequest},
+		{"with format", "/secret/db-password?fields=host&format=json", nil, http.StatusBadRequest},
+		{"too many", "/secret/db-password?fields=" + tooManyFields, nil, http.StatusBadRequest},
+		{"encrypted", "/secret/db-password?fields=host", []string{headerResponseEncryption, encryptionAlgorithm}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := get(t, tt.target, tt.header...); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%v)", status, tt.wantStatus, body)
+			}
+		})
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	const (
+		fullKey   = "token-full-key-000000000000000000000000000"
+		scopedKey = "token-scoped-key-0000000000000000000000000"
+	)
+	signer := auth.NewTokenSigner([]byte("0123456789abcdef0123456789abcdef"))
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())),
+		WithTokenSigner(signer, time.Hour))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{
+		{Name: "full", Key: fullKey},
+		{Name: "scoped", Key: scopedKey, Scope: auth.Scope{Organizations: []string{testOrgID}}},
+	})))
+	app.Post("/token", h.IssueToken)
+
+	post := func(t *testing.T, key, body string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/token", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	t.Run("issued token verifies", func(t *testing.T) {
+		status, out := post(t, fullKey, `{"secret": "db-password", "ttl": "90s"}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (%v)", status, out)
+		}
+		exp, _ := out["exp"].(float64)
+		if left := time.Until(time.Unix(int64(exp), 0)); left <= 0 || left > 91*time.Second {
+			t.Errorf("token expires in %v, want about 90s", left)
+		}
+		token, _ := out["token"].(string)
+		if err := signer.Verify(token, "db-password"); err != nil {
+			t.Errorf("Verify(%q) = %v", token, err)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		wantStatus int
+	}{
+		{"scoped key", scopedKey, `{"secret": "db-password"}`, http.StatusForbidden},
+		{"invalid name", fullKey, `{"secret": "../etc"}`, http.StatusBadRequest},
+		{"ttl over maximum", fullKey, `{"secret": "db-password", "ttl": "2h"}`, http.StatusBadRequest},
+		{"invalid ttl", fullKey, `{"secret": "db-password", "ttl": "soon"}`, http.StatusBadRequest},
+		{"invalid body", fullKey, `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, out := post(t, tt.key, tt.body); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%v)", status, tt.wantStatus, out)
+			}
+		})
+	}
+
+	t.Run("no key in context", func(t *testing.T) {
+		// As if ROUTE_AUTH had made the route public: no auth middleware ran.
+		open := fiber.New()
+		open.Post("/token", h.IssueToken)
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/token", strings.NewReader(`{"secret": "db-password"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := open.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusUnauthorized || strings.Contains(string(body), "sig") {
+			t.Errorf("status = %d, body %s; want 401 without a token", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestWhitelistEntries(t *testing.T) {
+	const (
+		globalKey = "whitelist-global-key-00000000000000000000000"
+		scopedKey = "whitelist-scoped-key-00000000000000000000000"
+	)
+	wl, err := ipwhitelist.New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &auditSink{}
+	log := audit.New(sink)
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())),
+		WithAudit(log), WithDynamicWhitelist(wl, 2*time.Hour))
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{
+		{Name: "global", Key: globalKey, Admin: true},
+		{Name: "scoped", Key: scopedKey, Admin: true, Scope: auth.Scope{Organizations: []string{testOrgID}}},
+	})))
+	app.Post("/whitelist", h.AddWhitelistEntry)
+	app.Delete("/whitelist", h.RemoveWhitelistEntry)
+	app.Get("/whitelist", h.ListWhitelistEntries)
+
+	do := func(t *testing.T, method, target, key, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	for _, tc := range []struct {
+		name, key, body string
+		want            int
+	}{
+		{"scoped key", scopedKey, `{"ip":"203.0.113.7"}`, http.StatusForbidden},
+		{"bad body", globalKey, `{`, http.StatusBadRequest},
+		{"bad ip", globalKey, `{"ip":"not-an-ip"}`, http.StatusBadRequest},
+		{"bad ttl", globalKey, `{"ip":"203.0.113.7","ttl":"soon"}`, http.StatusBadRequest},
+		{"ttl over maximum", globalKey, `{"ip":"203.0.113.7","ttl":"3h"}`, http.StatusBadRequest},
+	} {
+		if status, body := do(t, http.MethodPost, "/whitelist", tc.key, tc.body); status != tc.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.name, status, tc.want, body)
+		}
+	}
+	if wl.IsAllowed("203.0.113.7") {
+		t.Fatal("rejected requests changed the whitelist")
+	}
+
+	status, body := do(t, http.MethodPost, "/whitelist", globalKey, `{"ip":"203.0.113.7","ttl":"30m"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"entry":"203.0.113.7/32"`) {
+		t.Fatalf("add: status = %d, body %s", status, body)
+	}
+	if !wl.IsAllowed("203.0.113.7") {
+		t.Error("added entry not allowed")
+	}
+	if status, body := do(t, http.MethodGet, "/whitelist", globalKey, ""); status != http.StatusOK || !strings.Contains(body, "203.0.113.7/32") {
+		t.Errorf("list: status = %d, body %s", status, body)
+	}
+
+	if status, _ := do(t, http.MethodDelete, "/whitelist?ip=203.0.113.7", scopedKey, ""); status != http.StatusForbidden {
+		t.Errorf("remove with scoped key: status = %d, want 403", status)
+	}
+	if status, body := do(t, http.MethodDelete, "/whitelist?ip=203.0.113.7", globalKey, ""); status != http.StatusOK {
+		t.Fatalf("remove: status = %d, body %s", status, body)
+	}
+	if wl.IsAllowed("203.0.113.7") {
+		t.Error("removed entry still allowed")
+	}
+	if status, _ := do(t, http.MethodDelete, "/whitelist?ip=203.0.113.7", globalKey, ""); status != http.StatusNotFound {
+		t.Errorf("second remove: status = %d, want 404", status)
+	}
+	if status, _ := do(t, http.MethodDelete, "/whitelist?ip=10.0.0.0/8", globalKey, ""); status != http.StatusNotFound {
+		t.Errorf("remove of a configured rule: status = %d, want 404", status)
+	}
+	log.Close()
+
+	want := []string{audit.OutcomeAdded, audit.OutcomeRemoved}
+	if len(sink.events) != len(want) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(sink.events), len(want), sink.events)
+	}
+	for i, ev := range sink.events {
+		if ev.Kind != audit.KindWhitelist || ev.Entry != "203.0.113.7/32" || ev.Outcome != want[i] || ev.KeyName != "global" {
+			t.Errorf("event %d = %+v, want %s of 203.0.113.7/32 by global", i, ev, want[i])
+		}
+	}
+	if sink.events[0].Expires == nil {
+		t.Error("add event has no expiry")
+	}
+}
+
+func TestRefreshCacheWebhookClientIP(t *testing.T) {
+	const key = "refresh-webhook-key-0000000000000000000000"
+	received := make(chan webhook.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhook.Event
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	// app.Test connections come from 0.0.0.0, trusted here as the proxy.
+	proxies, err := ipwhitelist.NewProxyChain([]string{"0.0.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := webhook.New(srv.URL)
+	h := NewHandler(vaultwarden.NewClient(nil, 0, 0, vaultwarden.WithState(testVaultItems(), testNameMaps())), WithWebhook(events))
+	app := fiber.New()
+	app.Use(proxies.Middleware())
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "test", Key: key}})))
+	app.Post("/refresh", h.RefreshCache)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	resp.Body.Close()
+	events.Close()
+
+	select {
+	case ev := <-received:
+		if ev.Type != webhook.EventCacheRefresh || ev.ClientIP != "203.0.113.9" {
+			t.Errorf("event = %+v, want cache_refresh from the forwarded client 203.0.113.9", ev)
+		}
+	default:
+		t.Fatal("no webhook event delivered")
+	}
+}
+
+func TestListSecretsPrefixValueErrors(t *testing.T) {
+	// The override makes every lookup of db-password sync first, against a
+	// server that is gone, while listing is served from the snapshot.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	api := vaultwarden.NewAPIClient(srv.URL, "user@example.com", "pw", "id", "secret")
+	client := vaultwarden.NewClient(api, 0, 0,
+		vaultwarden.WithState(testVaultItems(), testNameMaps()),
+		vaultwarden.WithTTLOverrides(map[string]time.Duration{"db-password": time.Nanosecond}),
+		vaultwarden.WithTokenRetry(1, 0))
+	sink := &auditSink{}
+	log := audit.New(sink)
+	h := NewHandler(client, WithAudit(log))
+
+	const fullKey = "full-access-prefix-00000000000000000000000"
+	app := fiber.New()
+	app.Use(auth.Middleware(auth.NewStore([]auth.APIKey{{Name: "full", Key: fullKey}})))
+	app.Get("/secrets", h.ListSecrets)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/secrets?prefix=db-&values=true", nil)
+	req.Header.Set("Authorization", "Bearer "+fullKey)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var got struct {
+		Names  []string          `json:"names"`
+		Values map[string]string `json:"values"`
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(got.Names) != 1 || len(got.Values) != 0 || got.Errors["db-password"] == "" {
+		t.Fatalf("response = %+v, want db-password listed with an error and no value", got)
+	}
+	log.Close()
+	if len(sink.events) != 1 || sink.events[0].Outcome == audit.OutcomeSuccess {
+		t.Errorf("audit events = %+v, want one failed access", sink.events)
+	}
+}
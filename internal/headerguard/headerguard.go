@@ -0,0 +1,84 @@
+// Package headerguard rejects requests whose headers no legitimate client
+// sends: repeated single-valued headers, oversized headers and blocked user
+// agents. It is hardening on top of the IP whitelist and API keys, not a
+// replacement for either.
+package headerguard
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/ipwhitelist"
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultMaxHeaderBytes is the default limit on a single header line.
+const DefaultMaxHeaderBytes = 2048
+
+// singleValued are headers a request may carry at most once; two differing
+// Authorization headers, for example, leave it to each hop which one counts.
+var singleValued = []string{fiber.HeaderAuthorization, fiber.HeaderXRequestID}
+
+// Config selects the checks. The zero value only rejects repeated
+// single-valued headers.
+type Config struct {
+	// MaxHeaderBytes rejects a request with any header whose name and value
+	// together are longer than this (0 disables).
+	MaxHeaderBytes int
+	// BlockedUserAgents are matched case-insensitively as substrings of the
+	// User-Agent header.
+	BlockedUserAgents []string
+}
+
+// Middleware returns a handler answering 400 to requests that fail a check,
+// logging the reason (never the header values).
+func Middleware(cfg Config) fiber.Handler {
+	blocked := make([]string, 0, len(cfg.BlockedUserAgents))
+	for _, ua := range cfg.BlockedUserAgents {
+		if ua = strings.ToLower(strings.TrimSpace(ua)); ua != "" {
+			blocked = append(blocked, ua)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		if reason := check(c, cfg.MaxHeaderBytes, blocked); reason != "" {
+			logger.With("request_id", response.RequestID(c)).Warn.Printf("Rejected request headers (%s) from IP: %s", reason, ipwhitelist.ClientIP(c))
+			return response.Error(c, fiber.StatusBadRequest, "bad request")
+		}
+		return c.Next()
+	}
+}
+
+// check returns why the request's headers are rejected, or "" if they pass.
+func check(c *fiber.Ctx, maxBytes int, blockedAgents []string) string {
+	header := &c.Request().Header
+	for _, name := range singleValued {
+		if n := len(header.PeekAll(name)); n > 1 {
+			return fmt.Sprintf("%d %s headers", n, name)
+		}
+	}
+
+	if maxBytes > 0 {
+		var oversized string
+		header.VisitAll(func(key, value []byte) {
+			if oversized == "" && len(key)+len(value) > maxBytes {
+				oversized = fmt.Sprintf("%s header longer than %d bytes", key, maxBytes)
+			}
+		})
+		if oversized != "" {
+			return oversized
+		}
+	}
+
+	if len(blockedAgents) > 0 {
+		ua := strings.ToLower(c.Get(fiber.HeaderUserAgent))
+		for _, bad := range blockedAgents {
+			if strings.Contains(ua, bad) {
+				return fmt.Sprintf("blocked user agent %q", bad)
+			}
+		}
+	}
+	return ""
+}
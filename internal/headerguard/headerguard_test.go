@@ -0,0 +1,47 @@
+package headerguard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware(Config{MaxHeaderBytes: 256, BlockedUserAgents: []string{" sqlmap ", "Nikto", ""}}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		name       string
+		headers    [][2]string
+		wantStatus int
+	}{
+		{"plain", [][2]string{{"Authorization", "Bearer key"}, {"User-Agent", "curl/8.5.0"}}, http.StatusOK},
+		{"two authorization headers", [][2]string{{"Authorization", "Bearer a"}, {"Authorization", "Bearer b"}}, http.StatusBadRequest},
+		{"two request ids", [][2]string{{"X-Request-ID", "a"}, {"X-Request-ID", "b"}}, http.StatusBadRequest},
+		{"repeated accept is fine", [][2]string{{"Accept", "text/plain"}, {"Accept", "application/json"}}, http.StatusOK},
+		{"oversized header", [][2]string{{"X-Padding", strings.Repeat("a", 300)}}, http.StatusBadRequest},
+		{"header at the limit", [][2]string{{"X-Padding", strings.Repeat("a", 256-len("X-Padding"))}}, http.StatusOK},
+		{"blocked agent", [][2]string{{"User-Agent", "sqlmap/1.7.2#stable (https://sqlmap.org)"}}, http.StatusBadRequest},
+		{"blocked agent any case", [][2]string{{"User-Agent", "Mozilla/5.00 (NIKTO/2.5.0)"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			for _, h := range tt.headers {
+				req.Header.Add(h[0], h[1])
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
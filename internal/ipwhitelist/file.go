@@ -0,0 +1,123 @@
+package ipwhitelist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// SetAllowedFile makes the file at path the source of the static allow rules
+// (replacing any set with SetAllowed) and loads it. The file lists one IP or
+// CIDR per line; blank lines and # comments are ignored. Use Reload or
+// WatchAllowedFile to pick up later changes.
+func (wl *IPWhitelist) SetAllowedFile(path string) error {
+	wl.mu.Lock()
+	wl.allowFile = path
+	wl.mu.Unlock()
+	return wl.Reload()
+}
+
+// Reload re-reads the allow rules file set with SetAllowedFile and atomically
+// replaces the static allow rules. Invalid lines are logged and skipped. If the
+// file cannot be read or holds no valid rule, the current rules are kept: an
+// empty whitelist would allow everyone. Reload is a no-op without a file.
+func (wl *IPWhitelist) Reload() error {
+	wl.mu.RLock()
+	path := wl.allowFile
+	wl.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read allowed IPs file: %w", err)
+	}
+	ips, cidrs := parseRules(readRuleLines(data), "whitelist")
+	if len(ips) == 0 && len(cidrs) == 0 {
+		return fmt.Errorf("allowed IPs file %s has no valid entries, keeping current rules", path)
+	}
+
+	wl.mu.Lock()
+	wl.allowedIPs = ips
+	wl.allowedCIDRs = cidrs
+	wl.mu.Unlock()
+
+	logger.Info.Printf("Loaded %d allow rule(s) from %s", len(ips)+len(cidrs), path)
+	return nil
+}
+
+// readRuleLines returns the non-comment entries of an allow rules file.
+func readRuleLines(data []byte) []string {
+	var rules []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// WatchAllowedFile starts a goroutine that polls the allow rules file every
+// interval and reloads it when its modification time or size changes. Returns
+// a stop function that waits for the goroutine to exit and is safe to call
+// more than once. Without a file set, it does nothing.
+func (wl *IPWhitelist) WatchAllowedFile(interval time.Duration) func() {
+	wl.mu.RLock()
+	path := wl.allowFile
+	wl.mu.RUnlock()
+	if path == "" {
+		return func() {}
+	}
+
+	stamp := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	lastMod, lastSize := stamp()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				mod, size := stamp()
+				if mod.Equal(lastMod) && size == lastSize {
+					continue
+				}
+				lastMod, lastSize = mod, size
+				if err := wl.Reload(); err != nil {
+					logger.Error.Printf("Failed to reload allowed IPs: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	logger.Info.Printf("Watching %s for allow rule changes (every %v)", path, interval)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package ipwhitelist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRules(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllowedFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowed-ips")
+	writeRules(t, path, "# office\n10.0.0.0/8\n\n1.2.3.4 # ci runner\n")
+
+	wl, err := New(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wl.SetAllowedFile(path); err != nil {
+		t.Fatalf("SetAllowedFile: %v", err)
+	}
+	for ip, want := range map[string]bool{"10.1.2.3": true, "1.2.3.4": true, "5.6.7.8": false} {
+		if got := wl.IsAllowed(ip); got != want {
+			t.Errorf("IsAllowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// Invalid lines are skipped; the valid ones replace the old rules.
+	writeRules(t, path, "5.6.7.8\nnot-an-ip\n192.168.0.0/33\n")
+	if err := wl.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	for ip, want := range map[string]bool{"10.1.2.3": false, "1.2.3.4": false, "5.6.7.8": true} {
+		if got := wl.IsAllowed(ip); got != want {
+			t.Errorf("after reload: IsAllowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// A file without any valid rule would allow everyone; it is rejected.
+	writeRules(t, path, "# emptied by mistake\nbogus\n")
+	if err := wl.Reload(); err == nil {
+		t.Error("Reload accepted a file without valid rules")
+	}
+	if !wl.IsAllowed("5.6.7.8") || !wl.HasAllowRules() {
+		t.Error("rejected reload dropped the current rules")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := wl.Reload(); err == nil {
+		t.Error("Reload succeeded on a missing file")
+	}
+	if !wl.IsAllowed("5.6.7.8") {
+		t.Error("failed reload dropped the current rules")
+	}
+}
+
+func TestWatchAllowedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowed-ips")
+	writeRules(t, path, "1.2.3.4\n")
+
+	wl, err := New(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wl.SetAllowedFile(path); err != nil {
+		t.Fatalf("SetAllowedFile: %v", err)
+	}
+	stop := wl.WatchAllowedFile(10 * time.Millisecond)
+	defer stop()
+
+	writeRules(t, path, "5.6.7.8\n")
+	// Make the change visible even on filesystems with coarse timestamps.
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !wl.IsAllowed("5.6.7.8") {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not pick up the rewritten file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if wl.IsAllowed("1.2.3.4") {
+		t.Error("old rule still allowed after the file changed")
+	}
+	stop()
+	stop() // safe to call twice
+}
@@ -1,43 +1,81 @@
-// Package ipwhitelist provides IP-based access control with GitHub Actions support
+// Package ipwhitelist provides IP-based access control with GitHub Actions and
+// other dynamic IP range support
 package ipwhitelist
 
 import (
-	"encoding/json"
-	"fmt"
+	"math/rand/v2"
 	"net"
-	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/response"
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
 	"github.com/gofiber/fiber/v2"
 )
 
 // IPWhitelist manages IP-based access control
 type IPWhitelist struct {
-	mu               sync.RWMutex
-	allowedIPs       map[string]bool
-	allowedCIDRs     []*net.IPNet
-	githubIPRanges   []*net.IPNet
-	enableGitHub     bool
-	lastGitHubUpdate time.Time
+	mu           sync.RWMutex
+	allowedIPs   map[string]bool
+	allowedCIDRs []*net.IPNet
+	blockedIPs   map[string]bool
+	blockedCIDRs []*net.IPNet
+	providers    []*rangeProvider
+	allowFile    string                   // source of the static allow rules, see SetAllowedFile
+	temporary    map[string]temporaryRule // keyed by canonical IP/CIDR, see AddTemporary
 }
 
-// GitHubMeta represents GitHub's API response for IP ranges
-type GitHubMeta struct {
-	Actions []string `json:"actions"`
-}
+// New creates a new IP whitelist. When enableGitHub is set, the built-in GitHub
+// provider whitelists the selected meta ranges (default: actions); more
+// providers can be added with AddRangeProvider.
+func New(allowedIPs []string, enableGitHub bool, githubRangeTypes ...string) (*IPWhitelist, error) {
+	wl := &IPWhitelist{}
+	wl.allowedIPs, wl.allowedCIDRs = parseRules(allowedIPs, "whitelist")
 
-// New creates a new IP whitelist
-func New(allowedIPs []string, enableGitHub bool) (*IPWhitelist, error) {
-	wl := &IPWhitelist{
-		allowedIPs:   make(map[string]bool),
-		enableGitHub: enableGitHub,
+	if enableGitHub {
+		github, err := GitHubProvider(githubRangeTypes...)
+		if err != nil {
+			return nil, err
+		}
+		if err := wl.AddRangeProvider(github); err != nil {
+			return nil, err
+		}
 	}
 
-	// Parse allowed IPs and CIDRs
-	for _, ipStr := range allowedIPs {
+	return wl, nil
+}
+
+// SetAllowed atomically replaces the static allow rules (IPs and CIDRs).
+// GitHub IP ranges are left untouched.
+func (wl *IPWhitelist) SetAllowed(allowedIPs []string) {
+	ips, cidrs := parseRules(allowedIPs, "whitelist")
+
+	wl.mu.Lock()
+	wl.allowedIPs = ips
+	wl.allowedCIDRs = cidrs
+	wl.mu.Unlock()
+}
+
+// SetBlocked atomically replaces the denylist (IPs and CIDRs). Blocked IPs are
+// rejected even when an allow rule or GitHub range covers them.
+func (wl *IPWhitelist) SetBlocked(blockedIPs []string) {
+	ips, cidrs := parseRules(blockedIPs, "denylist")
+
+	wl.mu.Lock()
+	wl.blockedIPs = ips
+	wl.blockedCIDRs = cidrs
+	wl.mu.Unlock()
+}
+
+// parseRules splits IP rules into single IPs and CIDRs, skipping invalid entries.
+// list names the rule set in log messages.
+func parseRules(rules []string, list string) (map[string]bool, []*net.IPNet) {
+	ips := make(map[string]bool)
+	var cidrs []*net.IPNet
+
+	for _, ipStr := range rules {
 		ipStr = strings.TrimSpace(ipStr)
 		if ipStr == "" {
 			continue
@@ -50,43 +88,38 @@ func New(allowedIPs []string, enableGitHub bool) (*IPWhitelist, error) {
 				logger.Warn.Printf("Invalid CIDR '%s': %v", ipStr, err)
 				continue
 			}
-			wl.allowedCIDRs = append(wl.allowedCIDRs, cidr)
-			logger.Info.Printf("Added CIDR to whitelist: %s", ipStr)
+			cidrs = append(cidrs, cidr)
+			logger.Info.Printf("Added CIDR to %s: %s", list, ipStr)
 		} else {
 			// Single IP
-			ip := net.ParseIP(ipStr)
+			ip := ParseIP(ipStr)
 			if ip == nil {
 				logger.Warn.Printf("Invalid IP '%s'", ipStr)
 				continue
 			}
-			wl.allowedIPs[ip.String()] = true
-			logger.Info.Printf("Added IP to whitelist: %s", ipStr)
+			ips[ip.String()] = true
+			logger.Info.Printf("Added IP to %s: %s", list, ipStr)
 		}
 	}
 
-	// Fetch GitHub IP ranges if enabled
-	if enableGitHub {
-		if err := wl.updateGitHubIPRanges(); err != nil {
-			logger.Warn.Printf("Failed to fetch GitHub IP ranges: %v", err)
-		}
-	}
-
-	return wl, nil
+	return ips, cidrs
 }
 
 // Middleware creates a Fiber middleware for IP whitelisting
 func (wl *IPWhitelist) Middleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// If no IPs configured and GitHub not enabled, allow all
-		wl.mu.RLock()
-		hasWhitelist := len(wl.allowedIPs) > 0 || len(wl.allowedCIDRs) > 0 || len(wl.githubIPRanges) > 0
-		wl.mu.RUnlock()
+		clientIP := ClientIP(c)
 
-		if !hasWhitelist {
-			return c.Next()
+		// The denylist applies even when no allow rules are configured.
+		if wl.IsBlocked(clientIP) {
+			logger.Warn.Printf("IP blocked (denylist): %s on %s %s", clientIP, c.Method(), c.Path())
+			return response.Error(c, fiber.StatusForbidden, "access denied: IP blocked")
 		}
 
-		clientIP := c.IP()
+		// If no IPs configured and GitHub not enabled, allow all
+		if !wl.HasAllowRules() {
+			return c.Next()
+		}
 
 		if wl.IsAllowed(clientIP) {
 			logger.Debug.Printf("IP allowed: %s", clientIP)
@@ -94,23 +127,35 @@ func (wl *IPWhitelist) Middleware() fiber.Handler {
 		}
 
 		logger.Warn.Printf("IP blocked (not whitelisted): %s on %s %s", clientIP, c.Method(), c.Path())
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "access denied: IP not whitelisted",
-		})
+		return response.Error(c, fiber.StatusForbidden, "access denied: IP not whitelisted")
 	}
 }
 
-// IsAllowed checks if an IP is whitelisted
+// HasAllowRules reports whether any allow rule (static or dynamic range) is
+// configured, i.e. whether Middleware restricts anyone at all. Temporary
+// entries do not count.
+func (wl *IPWhitelist) HasAllowRules() bool {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+	return len(wl.allowedIPs) > 0 || len(wl.allowedCIDRs) > 0 || wl.hasDynamicRangesLocked()
+}
+
+// IsAllowed checks if an IP is whitelisted. The denylist takes precedence:
+// a blocked IP is never allowed.
 func (wl *IPWhitelist) IsAllowed(ipStr string) bool {
 	wl.mu.RLock()
 	defer wl.mu.RUnlock()
 
-	ip := net.ParseIP(ipStr)
+	ip := ParseIP(ipStr)
 	if ip == nil {
 		return false
 	}
 
-	// Check single IPs (normalize IP for consistent matching)
+	if wl.isBlockedLocked(ip) {
+		return false
+	}
+
+	// Check single IPs (both sides are normalized by ParseIP)
 	if wl.allowedIPs[ip.String()] {
 		return true
 	}
@@ -122,83 +167,147 @@ func (wl *IPWhitelist) IsAllowed(ipStr string) bool {
 		}
 	}
 
-	// Check GitHub IP ranges
-	for _, cidr := range wl.githubIPRanges {
-		if cidr.Contains(ip) {
-			return true
+	// Check dynamic ranges (GitHub and other providers)
+	for _, p := range wl.providers {
+		for _, cidr := range p.ranges {
+			if cidr.Contains(ip) {
+				return true
+			}
 		}
 	}
 
-	return false
+	return wl.allowedTemporarilyLocked(ip)
 }
 
-// updateGitHubIPRanges fetches GitHub Actions IP ranges
-func (wl *IPWhitelist) updateGitHubIPRanges() error {
-	logger.Info.Println("Fetching GitHub Actions IP ranges...")
+// IsBlocked checks if an IP is on the denylist.
+func (wl *IPWhitelist) IsBlocked(ipStr string) bool {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	ip := ParseIP(ipStr)
+	return ip != nil && wl.isBlockedLocked(ip)
+}
 
-	resp, err := client.Get("https://api.github.com/meta")
-	if err != nil {
-		return err
+func (wl *IPWhitelist) isBlockedLocked(ip net.IP) bool {
+	if wl.blockedIPs[ip.String()] {
+		return true
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("github api returned status %d", resp.StatusCode)
+	for _, cidr := range wl.blockedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
 
-	var meta GitHubMeta
-	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
-		return err
+// ParseIP parses an IPv4 or IPv6 address into a canonical form so that equal
+// addresses compare equal whatever their spelling: a zone identifier
+// ("fe80::1%eth0") is dropped, and IPv4-mapped IPv6 ("::ffff:1.2.3.4") becomes
+// the 4-byte IPv4 address. Compressed and expanded IPv6 forms parse to the
+// same address, whose String() is the compressed form. It returns nil if s is
+// not an IP address.
+func ParseIP(s string) net.IP {
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
 	}
-
-	wl.mu.Lock()
-	defer wl.mu.Unlock()
-
-	wl.githubIPRanges = nil
-	for _, cidrStr := range meta.Actions {
-		_, cidr, err := net.ParseCIDR(cidrStr)
-		if err != nil {
-			logger.Warn.Printf("Invalid GitHub CIDR '%s': %v", cidrStr, err)
-			continue
-		}
-		wl.githubIPRanges = append(wl.githubIPRanges, cidr)
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
 	}
-
-	wl.lastGitHubUpdate = time.Now()
-	logger.Info.Printf("Loaded %d GitHub Actions IP ranges", len(wl.githubIPRanges))
-
-	return nil
+	return ip
 }
 
-// StartPeriodicUpdate starts a goroutine that updates GitHub IP ranges periodically
-// Returns a stop function that should be called to clean up the goroutine
-func (wl *IPWhitelist) StartPeriodicUpdate(interval time.Duration) func() {
-	if !wl.enableGitHub {
+// StartPeriodicUpdate starts a goroutine that refreshes the dynamic IP ranges periodically
+// Returns a stop function that should be called to clean up the goroutine. The
+// stop function waits for the goroutine to exit and is safe to call more than once.
+//
+// So that instances started together do not refresh in lockstep, the first
+// refresh happens at a random point in the second half of the interval and
+// every later one after interval ± jitter (see refreshDelay). Providers added
+// with RegisterRangeProvider are first fetched after a random delay of up to
+// startupJitter.
+func (wl *IPWhitelist) StartPeriodicUpdate(interval, jitter, startupJitter time.Duration) func() {
+	wl.mu.RLock()
+	providers := slices.Clone(wl.providers)
+	var pending []*rangeProvider
+	for _, p := range providers {
+		if p.pending {
+			pending = append(pending, p)
+		}
+	}
+	wl.mu.RUnlock()
+	if len(providers) == 0 {
 		return func() {}
 	}
 
-	ticker := time.NewTicker(interval)
 	done := make(chan struct{})
+	exited := make(chan struct{})
 
 	go func() {
-		defer ticker.Stop()
+		defer close(exited)
+
+		if len(pending) > 0 {
+			delay := RandomDelay(startupJitter)
+			logger.Info.Printf("First IP range fetch in %v", delay.Round(time.Millisecond))
+			select {
+			case <-time.After(delay):
+			case <-done:
+				return
+			}
+			for _, p := range pending {
+				if err := wl.updateRanges(p); err != nil {
+					logger.Warn.Printf("Failed to fetch %s IP ranges: %v", p.Name, err)
+				}
+				wl.mu.Lock()
+				p.pending = false
+				wl.mu.Unlock()
+			}
+		}
+
+		timer := time.NewTimer(refreshDelay(interval, jitter, true))
+		defer timer.Stop()
 
 		for {
 			select {
-			case <-ticker.C:
-				if err := wl.updateGitHubIPRanges(); err != nil {
-					logger.Error.Printf("Failed to update GitHub IP ranges: %v", err)
+			case <-timer.C:
+				for _, p := range providers {
+					if err := wl.updateRanges(p); err != nil {
+						logger.Error.Printf("Failed to update %s IP ranges: %v", p.Name, err)
+					}
 				}
+				timer.Reset(refreshDelay(interval, jitter, false))
 			case <-done:
 				return
 			}
 		}
 	}()
 
-	logger.Info.Printf("Started GitHub IP range auto-update (every %v)", interval)
-	return func() { close(done) }
+	logger.Info.Printf("Started IP range auto-update for %d provider(s) (every %v ± %v)", len(providers), interval, jitter)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// refreshDelay returns the wait before the next range refresh: for the first
+// one a random point in [interval/2, interval), afterwards interval plus a
+// random offset in [-jitter, jitter). jitter is capped at interval/2.
+func refreshDelay(interval, jitter time.Duration, first bool) time.Duration {
+	if first {
+		return interval/2 + RandomDelay(interval-interval/2)
+	}
+	jitter = min(max(jitter, 0), interval/2)
+	return interval - jitter + RandomDelay(2*jitter)
+}
+
+// RandomDelay returns a uniformly random duration in [0, limit), or 0 when
+// limit is not positive.
+func RandomDelay(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(limit)))
 }
@@ -0,0 +1,165 @@
+package ipwhitelist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIsAllowed(t *testing.T) {
+	wl, err := New([]string{"1.2.3.4", "2001:0db8:0000:0000:0000:0000:0000:0001", "fe80::1%eth0", "10.0.0.0/8", "2001:db8:ff::/48"}, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"1.2.3.4", true},
+		{"::ffff:1.2.3.4", true},
+		{"::ffff:102:304", true},
+		{"1.2.3.5", false},
+		{"2001:db8::1", true},
+		{"2001:DB8:0:0:0:0:0:1", true},
+		{"2001:db8::1%eth0", true},
+		{"2001:db8::2", false},
+		{"fe80::1", true},
+		{"fe80::1%25wlan0", true},
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"2001:db8:ff:1::9", true},
+		{"2001:db8:fe::9", false},
+		{"not-an-ip", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := wl.IsAllowed(tt.ip); got != tt.want {
+			t.Errorf("IsAllowed(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	t.Parallel()
+
+	const interval = 24 * time.Hour
+	for range 1000 {
+		if d := refreshDelay(interval, time.Hour, true); d < 12*time.Hour || d >= interval {
+			t.Fatalf("first delay = %v, want within [12h, 24h)", d)
+		}
+		if d := refreshDelay(interval, time.Hour, false); d < 23*time.Hour || d >= 25*time.Hour {
+			t.Fatalf("delay = %v, want within [23h, 25h)", d)
+		}
+		if d := refreshDelay(interval, 48*time.Hour, false); d < 12*time.Hour || d >= 36*time.Hour {
+			t.Fatalf("delay with oversized jitter = %v, want within [12h, 36h)", d)
+		}
+	}
+	if d := refreshDelay(interval, 0, false); d != interval {
+		t.Errorf("delay without jitter = %v, want %v", d, interval)
+	}
+	if d := RandomDelay(0); d != 0 {
+		t.Errorf("RandomDelay(0) = %v, want 0", d)
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"::ffff:1.2.3.4", "1.2.3.4"},
+		{"1.2.3.4", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		ip := ParseIP(tt.in)
+		if ip == nil || ip.String() != tt.want {
+			t.Errorf("ParseIP(%q) = %v, want %s", tt.in, ip, tt.want)
+		}
+	}
+	if ip := ParseIP("::ffff:1.2.3.4"); len(ip) != 4 {
+		t.Errorf("IPv4-mapped address should be 4 bytes, got %d", len(ip))
+	}
+	if ParseIP("1.2.3") != nil {
+		t.Error("ParseIP(1.2.3) should be nil")
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	wl, err := New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	wl.SetBlocked([]string{"10.0.0.66", "10.1.0.0/16"})
+
+	for _, ip := range []string{"10.0.0.66", "::ffff:10.0.0.66", "10.1.2.3"} {
+		if wl.IsAllowed(ip) {
+			t.Errorf("IsAllowed(%s) = true, want the denylist to take precedence", ip)
+		}
+		if !wl.IsBlocked(ip) {
+			t.Errorf("IsBlocked(%s) = false, want true", ip)
+		}
+	}
+	if !wl.IsAllowed("10.0.0.67") || wl.IsBlocked("10.0.0.67") {
+		t.Error("10.0.0.67 should be allowed and not blocked")
+	}
+
+	app := fiber.New()
+	open, _ := New(nil, false)
+	open.SetBlocked([]string{"0.0.0.0"})
+	app.Use(open.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	// Without allow rules everyone is allowed, except the denylist.
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("status = %d, want 403 for a blocked peer", resp.StatusCode)
+	}
+}
+
+func TestUpdateGitHubIPRangesETag(t *testing.T) {
+	var hits, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"actions":["4.0.0.0/24"],"hooks":["5.0.0.0/24"],"api":["6.0.0.0/24"]}`))
+	}))
+	defer srv.Close()
+
+	prev := githubMetaURL
+	githubMetaURL = srv.URL
+	defer func() { githubMetaURL = prev }()
+
+	wl, err := New(nil, true, GitHubRangeActions, GitHubRangeHooks)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := wl.updateRanges(wl.providers[0]); err != nil {
+		t.Fatalf("second update: %v", err)
+	}
+
+	if hits != 2 || notModified != 1 {
+		t.Errorf("hits = %d, 304s = %d; want 2 requests, the second answered 304", hits, notModified)
+	}
+	for ip, want := range map[string]bool{"4.0.0.1": true, "5.0.0.1": true, "6.0.0.1": false} {
+		if got := wl.IsAllowed(ip); got != want {
+			t.Errorf("IsAllowed(%s) = %v after 304, want %v", ip, got, want)
+		}
+	}
+
+	if _, err := New(nil, true, "pages"); err == nil {
+		t.Error("New should reject an unknown range type")
+	}
+}
@@ -0,0 +1,135 @@
+package ipwhitelist
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clientIPKey is the fiber.Ctx locals key holding the resolved client IP.
+type clientIPKey struct{}
+
+// ProxyChain resolves the real client IP of a request. X-Forwarded-For is only
+// honored when the direct peer is a trusted proxy; the chain is then walked
+// from the right, skipping trusted proxies, so the client IP is the last hop a
+// trusted proxy saw. Entries a client prepends itself are never used.
+type ProxyChain struct {
+	trusted []*net.IPNet
+
+	// index, when positive, picks the index-th X-Forwarded-For entry from the
+	// right instead of walking past trusted proxies (see WithForwardedIndex).
+	index int
+}
+
+// ProxyOption configures NewProxyChain.
+type ProxyOption func(*ProxyChain)
+
+// WithForwardedIndex takes the client IP from a fixed position: the n-th
+// X-Forwarded-For entry counted from the right (1 is the rightmost), for
+// deployments behind n proxies whose addresses are not known in advance.
+// The header is still only honored from a trusted peer. A chain with fewer
+// entries yields its leftmost one; an unparsable entry yields the peer. Zero
+// keeps the default walk.
+func WithForwardedIndex(n int) ProxyOption {
+	return func(p *ProxyChain) {
+		p.index = max(n, 0)
+	}
+}
+
+// NewProxyChain creates a resolver trusting the given IPs and CIDRs. Loopback
+// addresses are always trusted.
+func NewProxyChain(trusted []string, opts ...ProxyOption) (*ProxyChain, error) {
+	p := &ProxyChain{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for _, entry := range append([]string{"127.0.0.0/8", "::1/128"}, trusted...) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			p.trusted = append(p.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		p.trusted = append(p.trusted, cidr)
+	}
+	return p, nil
+}
+
+// Trusted reports whether ip is a trusted proxy.
+func (p *ProxyChain) Trusted(ip net.IP) bool {
+	for _, cidr := range p.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP for a connection from peer carrying the given
+// X-Forwarded-For value. An untrusted peer is the client, whatever it claims.
+// If the chain holds an unparsable entry, the last trusted hop before it is
+// returned. With WithForwardedIndex the entry at that position is returned
+// instead, trusted or not.
+func (p *ProxyChain) Resolve(peer net.IP, forwardedFor string) net.IP {
+	if ip4 := peer.To4(); ip4 != nil {
+		peer = ip4
+	}
+	if peer == nil || forwardedFor == "" || !p.Trusted(peer) {
+		return peer
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	if p.index > 0 {
+		i := max(len(hops)-p.index, 0)
+		if ip := ParseIP(strings.TrimSpace(hops[i])); ip != nil {
+			return ip
+		}
+		return peer
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !p.Trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware resolves the client IP once per request; read it with ClientIP.
+// It must run before any middleware that uses ClientIP.
+func (p *ProxyChain) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := p.Resolve(c.Context().RemoteIP(), c.Get(fiber.HeaderXForwardedFor))
+		if ip != nil {
+			c.Locals(clientIPKey{}, ip.String())
+		}
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client IP resolved by ProxyChain.Middleware, falling
+// back to the socket peer address when the middleware is not installed.
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return ParseIP(c.Context().RemoteIP().String()).String()
+}
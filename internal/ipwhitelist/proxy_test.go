@@ -0,0 +1,97 @@
+package ipwhitelist
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProxyChainResolve(t *testing.T) {
+	p, err := NewProxyChain([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("NewProxyChain: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		peer string
+		xff  string
+		want string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9", "1.2.3.4", "203.0.113.9"},
+		{"trusted peer without header", "10.0.0.5", "", "10.0.0.5"},
+		{"trusted peer", "10.0.0.5", "198.51.100.7", "198.51.100.7"},
+		{"spoofed leftmost entry", "10.0.0.5", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "127.0.0.1", "1.2.3.4, 198.51.100.7, 10.1.1.1, 192.0.2.1", "198.51.100.7"},
+		{"all hops trusted", "10.0.0.5", "10.0.0.6, 10.0.0.7", "10.0.0.6"},
+		{"garbage hop", "10.0.0.5", "1.2.3.4, nonsense, 10.0.0.6", "10.0.0.6"},
+		{"mapped peer", "::ffff:10.0.0.5", "198.51.100.7", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Resolve(net.ParseIP(tt.peer), tt.xff); got.String() != tt.want {
+				t.Errorf("Resolve(%s, %q) = %s, want %s", tt.peer, tt.xff, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewProxyChain([]string{"not-an-ip"}); err == nil {
+		t.Error("NewProxyChain should reject an invalid entry")
+	}
+}
+
+func TestProxyChainResolveIndex(t *testing.T) {
+	p, err := NewProxyChain([]string{"10.0.0.0/8"}, WithForwardedIndex(2))
+	if err != nil {
+		t.Fatalf("NewProxyChain: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		peer string
+		xff  string
+		want string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9", "1.2.3.4, 5.6.7.8", "203.0.113.9"},
+		{"second from right", "10.0.0.5", "1.2.3.4, 198.51.100.7, 203.0.113.50", "198.51.100.7"},
+		{"trusted entry at index is kept", "10.0.0.5", "198.51.100.7, 10.0.0.6", "198.51.100.7"},
+		{"short chain yields leftmost", "10.0.0.5", "198.51.100.7", "198.51.100.7"},
+		{"garbage at index yields peer", "10.0.0.5", "1.2.3.4, nonsense, 203.0.113.50", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Resolve(net.ParseIP(tt.peer), tt.xff); got.String() != tt.want {
+				t.Errorf("Resolve(%s, %q) = %s, want %s", tt.peer, tt.xff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareIgnoresSpoofedHeader(t *testing.T) {
+	proxies, err := NewProxyChain(nil)
+	if err != nil {
+		t.Fatalf("NewProxyChain: %v", err)
+	}
+	wl, err := New([]string{"1.2.3.4"}, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(proxies.Middleware(), wl.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	// The test connection's peer is not a trusted proxy, so a whitelisted
+	// address in X-Forwarded-For must not grant access.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderXForwardedFor, "1.2.3.4")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("status = %d, want 403 for a spoofed X-Forwarded-For", resp.StatusCode)
+	}
+}
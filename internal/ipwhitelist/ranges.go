@@ -0,0 +1,205 @@
+package ipwhitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// githubMetaURL is GitHub's meta API endpoint (a variable for tests).
+var githubMetaURL = "https://api.github.com/meta"
+
+// GitHub meta range types that can be whitelisted.
+const (
+	GitHubRangeActions = "actions"
+	GitHubRangeHooks   = "hooks"
+	GitHubRangeAPI     = "api"
+)
+
+// RangeProvider describes a JSON document listing CIDRs to whitelist, such as
+// GitHub's meta API or a CI vendor's published runner ranges.
+type RangeProvider struct {
+	// Name identifies the provider in logs.
+	Name string
+	// URL is fetched on startup and on every periodic update.
+	URL string
+	// Selectors are dot-separated paths to the CIDRs in the document, e.g.
+	// "actions" or "prefixes.ip_prefix". Arrays met along a path are walked
+	// element by element, and the values found may be a string or an array of
+	// strings. A leading "$." is ignored.
+	Selectors []string
+}
+
+// rangeProvider is a RangeProvider with its fetched state, guarded by the
+// whitelist's mutex.
+type rangeProvider struct {
+	RangeProvider
+	ranges     []*net.IPNet
+	etag       string
+	lastUpdate time.Time
+	// pending is set until the first fetch of a provider added with
+	// RegisterRangeProvider has been attempted.
+	pending bool
+}
+
+// GitHubProvider returns the built-in provider for the given GitHub meta range
+// types (default: actions).
+func GitHubProvider(rangeTypes ...string) (RangeProvider, error) {
+	for _, t := range rangeTypes {
+		if !slices.Contains([]string{GitHubRangeActions, GitHubRangeHooks, GitHubRangeAPI}, t) {
+			return RangeProvider{}, fmt.Errorf("unknown GitHub IP range type %q", t)
+		}
+	}
+	if len(rangeTypes) == 0 {
+		rangeTypes = []string{GitHubRangeActions}
+	}
+	return RangeProvider{Name: "GitHub", URL: githubMetaURL, Selectors: rangeTypes}, nil
+}
+
+// AddRangeProvider registers a provider and fetches its ranges once. A failed
+// first fetch is logged, not returned, so an unreachable provider does not
+// block startup; the periodic update retries it.
+func (wl *IPWhitelist) AddRangeProvider(p RangeProvider) error {
+	rp, err := wl.addProvider(p, false)
+	if err != nil {
+		return err
+	}
+	if err := wl.updateRanges(rp); err != nil {
+		logger.Warn.Printf("Failed to fetch %s IP ranges: %v", p.Name, err)
+	}
+	return nil
+}
+
+// RegisterRangeProvider registers a provider without fetching it; its first
+// fetch is left to StartPeriodicUpdate. Until that fetch has been attempted the
+// provider counts as an allow rule that matches nothing, so the whitelist
+// stays closed to everyone but the static rules rather than open to all.
+func (wl *IPWhitelist) RegisterRangeProvider(p RangeProvider) error {
+	_, err := wl.addProvider(p, true)
+	return err
+}
+
+func (wl *IPWhitelist) addProvider(p RangeProvider, pending bool) (*rangeProvider, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("IP range provider needs a name")
+	}
+	if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("IP range provider %s: URL must be http or https", p.Name)
+	}
+	if len(p.Selectors) == 0 {
+		return nil, fmt.Errorf("IP range provider %s: at least one selector is required", p.Name)
+	}
+
+	rp := &rangeProvider{RangeProvider: p, pending: pending}
+	wl.mu.Lock()
+	wl.providers = append(wl.providers, rp)
+	wl.mu.Unlock()
+	return rp, nil
+}
+
+// hasDynamicRangesLocked reports whether any provider has loaded ranges or is
+// still waiting for its first fetch. The caller must hold wl.mu.
+func (wl *IPWhitelist) hasDynamicRangesLocked() bool {
+	for _, p := range wl.providers {
+		if len(p.ranges) > 0 || p.pending {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRanges fetches a provider's ranges. The ETag of the last response is
+// sent as If-None-Match, so an unchanged document costs a 304 and keeps the
+// current ranges without reparsing.
+func (wl *IPWhitelist) updateRanges(p *rangeProvider) error {
+	logger.Info.Printf("Fetching %s IP ranges...", p.Name)
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	wl.mu.RLock()
+	etag := p.etag
+	wl.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		wl.mu.Lock()
+		p.lastUpdate = time.Now()
+		wl.mu.Unlock()
+		logger.Info.Printf("%s IP ranges unchanged", p.Name)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", p.URL, resp.StatusCode)
+	}
+
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	var ranges []*net.IPNet
+	for _, selector := range p.Selectors {
+		path := strings.Split(strings.TrimPrefix(selector, "$."), ".")
+		for _, cidrStr := range selectStrings(doc, path) {
+			_, cidr, err := net.ParseCIDR(cidrStr)
+			if err != nil {
+				logger.Warn.Printf("Invalid %s CIDR '%s': %v", p.Name, cidrStr, err)
+				continue
+			}
+			ranges = append(ranges, cidr)
+		}
+	}
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	p.ranges = ranges
+	p.etag = resp.Header.Get("ETag")
+	p.lastUpdate = time.Now()
+	logger.Info.Printf("Loaded %d %s IP ranges (%s)", len(ranges), p.Name, strings.Join(p.Selectors, ", "))
+
+	return nil
+}
+
+// selectStrings collects the strings at path in a decoded JSON value, walking
+// arrays element by element.
+func selectStrings(v any, path []string) []string {
+	if arr, ok := v.([]any); ok {
+		var out []string
+		for _, elem := range arr {
+			out = append(out, selectStrings(elem, path)...)
+		}
+		return out
+	}
+	if len(path) == 0 {
+		if s, ok := v.(string); ok {
+			return []string{s}
+		}
+		return nil
+	}
+	if obj, ok := v.(map[string]any); ok {
+		return selectStrings(obj[path[0]], path[1:])
+	}
+	return nil
+}
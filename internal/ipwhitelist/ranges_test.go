@@ -0,0 +1,111 @@
+package ipwhitelist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSelectStrings(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{
+		"cidrs": ["1.0.0.0/24"],
+		"prefixes": [{"ip_prefix": "2.0.0.0/24"}, {"ip_prefix": "3.0.0.0/24"}, {"other": "x"}],
+		"nested": {"ipv4": ["4.0.0.0/24", 5]}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path []string
+		want []string
+	}{
+		{[]string{"cidrs"}, []string{"1.0.0.0/24"}},
+		{[]string{"prefixes", "ip_prefix"}, []string{"2.0.0.0/24", "3.0.0.0/24"}},
+		{[]string{"nested", "ipv4"}, []string{"4.0.0.0/24"}},
+		{[]string{"missing"}, nil},
+	}
+	for _, tt := range tests {
+		if got := selectStrings(doc, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectStrings(%v) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAddRangeProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"prefixes":[{"ip_prefix":"7.0.0.0/24"},{"ip_prefix":"2001:db8::/32"}]}`))
+	}))
+	defer srv.Close()
+
+	wl, err := New(nil, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := wl.AddRangeProvider(RangeProvider{Name: "runners", URL: srv.URL, Selectors: []string{"$.prefixes.ip_prefix"}}); err != nil {
+		t.Fatalf("AddRangeProvider: %v", err)
+	}
+	for ip, want := range map[string]bool{"7.0.0.9": true, "2001:db8::5": true, "8.0.0.1": false} {
+		if got := wl.IsAllowed(ip); got != want {
+			t.Errorf("IsAllowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if err := wl.AddRangeProvider(RangeProvider{Name: "bad", URL: "ftp://x", Selectors: []string{"a"}}); err == nil {
+		t.Error("AddRangeProvider should reject a non-http URL")
+	}
+}
+
+func TestRegisterRangeProviderDefersFetch(t *testing.T) {
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write([]byte(`{"prefixes":[{"ip_prefix":"7.0.0.0/24"}]}`))
+	}))
+	defer srv.Close()
+
+	wl, err := New([]string{"10.0.0.1"}, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := wl.RegisterRangeProvider(RangeProvider{Name: "runners", URL: srv.URL, Selectors: []string{"prefixes.ip_prefix"}}); err != nil {
+		t.Fatalf("RegisterRangeProvider: %v", err)
+	}
+	if fetches.Load() != 0 {
+		t.Fatal("RegisterRangeProvider fetched synchronously")
+	}
+	// Static rules apply at once; everyone else waits for the fetch.
+	if !wl.IsAllowed("10.0.0.1") || wl.IsAllowed("7.0.0.9") || !wl.HasAllowRules() {
+		t.Error("pending provider: want static rules only, and the whitelist closed")
+	}
+
+	stop := wl.StartPeriodicUpdate(time.Hour, 0, 20*time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for !wl.IsAllowed("7.0.0.9") {
+		if time.Now().After(deadline) {
+			t.Fatal("deferred fetch did not happen")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestRegisterRangeProviderClosesEmptyWhitelist(t *testing.T) {
+	wl, err := New(nil, false)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := wl.RegisterRangeProvider(RangeProvider{Name: "runners", URL: "https://ranges.example.com", Selectors: []string{"a"}}); err != nil {
+		t.Fatalf("RegisterRangeProvider: %v", err)
+	}
+	if !wl.HasAllowRules() {
+		t.Error("a pending provider left the whitelist open to everyone")
+	}
+}
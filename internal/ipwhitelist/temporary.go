@@ -0,0 +1,174 @@
+package ipwhitelist
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// temporaryRule is an allow rule added at runtime that lapses at expires.
+type temporaryRule struct {
+	network *net.IPNet
+	expires time.Time
+}
+
+// TemporaryEntry describes a time-limited allow rule.
+type TemporaryEntry struct {
+	Entry   string    // canonical IP or CIDR
+	Expires time.Time // when the rule stops applying
+}
+
+// AddTemporary allows entry (an IP or CIDR) for ttl, on top of the configured
+// rules. Adding an entry that is already present replaces its expiry. The
+// returned entry holds the canonical form and expiry.
+//
+// Temporary entries do not count as allow rules for HasAllowRules: they extend
+// an existing whitelist and never turn an open one into a restrictive one.
+func (wl *IPWhitelist) AddTemporary(entry string, ttl time.Duration) (TemporaryEntry, error) {
+	if ttl <= 0 {
+		return TemporaryEntry{}, fmt.Errorf("ttl must be positive")
+	}
+	network, err := parseNetwork(entry)
+	if err != nil {
+		return TemporaryEntry{}, err
+	}
+
+	te := TemporaryEntry{Entry: network.String(), Expires: time.Now().Add(ttl)}
+	wl.mu.Lock()
+	if wl.temporary == nil {
+		wl.temporary = make(map[string]temporaryRule)
+	}
+	wl.temporary[te.Entry] = temporaryRule{network: network, expires: te.Expires}
+	wl.mu.Unlock()
+	return te, nil
+}
+
+// RemoveTemporary removes a temporary entry before it expires. It reports
+// whether the entry was present (and not yet expired).
+func (wl *IPWhitelist) RemoveTemporary(entry string) (string, bool) {
+	network, err := parseNetwork(entry)
+	if err != nil {
+		return "", false
+	}
+	key := network.String()
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	rule, ok := wl.temporary[key]
+	if !ok {
+		return key, false
+	}
+	delete(wl.temporary, key)
+	return key, time.Now().Before(rule.expires)
+}
+
+// TemporaryEntries returns the unexpired temporary entries, soonest to expire
+// first.
+func (wl *IPWhitelist) TemporaryEntries() []TemporaryEntry {
+	now := time.Now()
+	wl.mu.RLock()
+	entries := make([]TemporaryEntry, 0, len(wl.temporary))
+	for key, rule := range wl.temporary {
+		if now.Before(rule.expires) {
+			entries = append(entries, TemporaryEntry{Entry: key, Expires: rule.expires})
+		}
+	}
+	wl.mu.RUnlock()
+
+	slices.SortFunc(entries, func(a, b TemporaryEntry) int {
+		if c := a.Expires.Compare(b.Expires); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Entry, b.Entry)
+	})
+	return entries
+}
+
+// allowedTemporarilyLocked reports whether an unexpired temporary entry covers
+// ip. Expired entries stop applying right away, before cleanup removes them.
+func (wl *IPWhitelist) allowedTemporarilyLocked(ip net.IP) bool {
+	now := time.Now()
+	for _, rule := range wl.temporary {
+		if now.Before(rule.expires) && rule.network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExpired drops the temporary entries that have expired and returns
+// them.
+func (wl *IPWhitelist) removeExpired(now time.Time) []TemporaryEntry {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	var expired []TemporaryEntry
+	for key, rule := range wl.temporary {
+		if !now.Before(rule.expires) {
+			delete(wl.temporary, key)
+			expired = append(expired, TemporaryEntry{Entry: key, Expires: rule.expires})
+		}
+	}
+	return expired
+}
+
+// StartTemporaryCleanup starts a goroutine that removes expired temporary
+// entries every interval, calling onExpire (if not nil) for each one. Returns
+// a stop function that waits for the goroutine to exit and is safe to call
+// more than once.
+func (wl *IPWhitelist) StartTemporaryCleanup(interval time.Duration, onExpire func(TemporaryEntry)) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, te := range wl.removeExpired(now) {
+					logger.Info.Printf("Temporary whitelist entry expired: %s", te.Entry)
+					if onExpire != nil {
+						onExpire(te)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// parseNetwork parses an IP or CIDR into a network; a single IP becomes a
+// /32 (IPv4) or /128 (IPv6).
+func parseNetwork(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		return network, nil
+	}
+	ip := ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", entry)
+	}
+	bits := 8 * len(ip)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
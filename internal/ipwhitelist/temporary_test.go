@@ -0,0 +1,99 @@
+package ipwhitelist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemporaryEntries(t *testing.T) {
+	wl, err := New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := wl.AddTemporary("not-an-ip", time.Hour); err == nil {
+		t.Error("AddTemporary accepted an invalid entry")
+	}
+	if _, err := wl.AddTemporary("1.2.3.4", 0); err == nil {
+		t.Error("AddTemporary accepted a zero ttl")
+	}
+
+	single, err := wl.AddTemporary("::ffff:1.2.3.4", time.Hour)
+	if err != nil {
+		t.Fatalf("AddTemporary: %v", err)
+	}
+	if single.Entry != "1.2.3.4/32" {
+		t.Errorf("entry = %q, want 1.2.3.4/32", single.Entry)
+	}
+	if _, err := wl.AddTemporary("192.168.5.0/24", time.Minute); err != nil {
+		t.Fatalf("AddTemporary: %v", err)
+	}
+	for ip, want := range map[string]bool{"1.2.3.4": true, "192.168.5.9": true, "10.1.1.1": true, "8.8.8.8": false} {
+		if got := wl.IsAllowed(ip); got != want {
+			t.Errorf("IsAllowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if entries := wl.TemporaryEntries(); len(entries) != 2 || entries[0].Entry != "192.168.5.0/24" {
+		t.Errorf("TemporaryEntries = %+v, want the /24 (expiring first) then 1.2.3.4/32", entries)
+	}
+
+	if entry, ok := wl.RemoveTemporary("1.2.3.4"); !ok || entry != "1.2.3.4/32" {
+		t.Errorf("RemoveTemporary = %q, %v", entry, ok)
+	}
+	if wl.IsAllowed("1.2.3.4") {
+		t.Error("removed entry still allowed")
+	}
+	if _, ok := wl.RemoveTemporary("10.0.0.0/8"); ok {
+		t.Error("RemoveTemporary removed a configured rule")
+	}
+	if !wl.IsAllowed("10.1.1.1") {
+		t.Error("configured rule lost")
+	}
+}
+
+func TestTemporaryEntriesDoNotOpenWhitelist(t *testing.T) {
+	wl, err := New(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wl.AddTemporary("1.2.3.4", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if wl.HasAllowRules() {
+		t.Error("a temporary entry made an open whitelist restrictive")
+	}
+}
+
+func TestTemporaryEntryExpiry(t *testing.T) {
+	wl, err := New([]string{"10.0.0.0/8"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wl.AddTemporary("1.2.3.4", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wl.AddTemporary("5.6.7.8", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := make(chan TemporaryEntry, 1)
+	stop := wl.StartTemporaryCleanup(5*time.Millisecond, func(te TemporaryEntry) { expired <- te })
+	defer stop()
+
+	select {
+	case te := <-expired:
+		if te.Entry != "1.2.3.4/32" {
+			t.Errorf("expired %q, want 1.2.3.4/32", te.Entry)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expired entry was not cleaned up")
+	}
+	if wl.IsAllowed("1.2.3.4") {
+		t.Error("expired entry still allowed")
+	}
+	if !wl.IsAllowed("5.6.7.8") {
+		t.Error("unexpired entry removed")
+	}
+	stop()
+	stop() // safe to call twice
+}
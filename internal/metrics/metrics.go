@@ -0,0 +1,110 @@
+// Package metrics defines the Prometheus metrics exported on GET /metrics.
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vaultwarden_api"
+
+// Registry holds every metric of the service plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// SecretLookups counts secret lookups that reached the vault snapshot.
+	SecretLookups = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "secret_lookups_total",
+		Help:      "Secret lookups against the vault snapshot.",
+	})
+
+	// LookupErrors counts failed lookups by reason (not_found, deleted,
+	// field_not_found, sync_failed).
+	LookupErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "secret_lookup_errors_total",
+		Help:      "Failed secret lookups by reason.",
+	}, []string{"reason"})
+
+	// CacheHits counts lookups served from the existing snapshot.
+	CacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Lookups served from the synced snapshot without syncing first.",
+	})
+
+	// CacheMisses counts lookups that had to sync the vault first.
+	CacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Lookups that synced the vault before being served.",
+	})
+
+	// AuthFailures counts rejected API key authentications by reason
+	// (missing_header, invalid_format, invalid_key, invalid_token).
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Rejected API key authentications by reason.",
+	}, []string{"reason"})
+
+	// UpstreamDuration observes the latency of Vaultwarden HTTP requests by
+	// endpoint (prelogin, token, sync, other).
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of requests to the Vaultwarden server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// UpstreamCircuitState is the state of the Vaultwarden circuit breaker:
+	// 0 closed, 1 open, 2 half-open.
+	UpstreamCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_circuit_state",
+		Help:      "Vaultwarden circuit breaker state (0 closed, 1 open, 2 half-open).",
+	})
+
+	// UpstreamCircuitRejections counts upstream requests failed fast by the
+	// open circuit breaker.
+	UpstreamCircuitRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_circuit_rejections_total",
+		Help:      "Vaultwarden requests not sent because the circuit breaker was open.",
+	})
+
+	// SecretValueBytes observes the size of returned secret values. Values
+	// themselves are never recorded.
+	SecretValueBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "secret_value_bytes",
+		Help:      "Size of returned secret values in bytes.",
+		Buckets:   prometheus.ExponentialBuckets(16, 4, 8), // 16 B .. 256 KiB
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SecretLookups,
+		LookupErrors,
+		CacheHits,
+		CacheMisses,
+		AuthFailures,
+		UpstreamDuration,
+		UpstreamCircuitState,
+		UpstreamCircuitRejections,
+		SecretValueBytes,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
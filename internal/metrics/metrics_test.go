@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	AuthFailures.WithLabelValues("invalid_key").Inc()
+	UpstreamDuration.WithLabelValues("sync").Observe(0.05)
+
+	app := fiber.New()
+	app.Get("/metrics", Handler())
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`vaultwarden_api_auth_failures_total{reason="invalid_key"}`,
+		`vaultwarden_api_upstream_request_duration_seconds_count{endpoint="sync"}`,
+		"vaultwarden_api_secret_lookups_total",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
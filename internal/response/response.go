@@ -0,0 +1,78 @@
+// Package response renders JSON response bodies, optionally wrapped in a
+// uniform envelope shared by every endpoint.
+package response
+
+import (
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var envelope atomic.Bool
+
+// SetEnvelope enables or disables the envelope for all subsequent responses.
+//
+// With the envelope enabled, success bodies are rendered as
+// {"success": true, "data": {...}} and errors as
+// {"success": false, "error": {"message": "..."}}. Disabled (the default),
+// success bodies are the bare data and errors are {"error": "..."}.
+func SetEnvelope(enabled bool) {
+	envelope.Store(enabled)
+}
+
+// Enveloped reports whether the envelope is enabled.
+func Enveloped() bool {
+	return envelope.Load()
+}
+
+// JSON writes a success body with the status already set on c (200 by default).
+func JSON(c *fiber.Ctx, data any) error {
+	if !envelope.Load() {
+		return c.JSON(data)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// Error writes an error body with the given status. When the request has an
+// ID (see RequestID) it is included as "request_id", so a client can quote it
+// when reporting the failure.
+func Error(c *fiber.Ctx, status int, message string) error {
+	c.Status(status)
+	id := RequestID(c)
+	if !envelope.Load() {
+		body := fiber.Map{
+			"error": message,
+		}
+		if id != "" {
+			body["request_id"] = id
+		}
+		return c.JSON(body)
+	}
+	detail := fiber.Map{
+		"message": message,
+	}
+	if id != "" {
+		detail["request_id"] = id
+	}
+	return c.JSON(fiber.Map{
+		"success": false,
+		"error":   detail,
+	})
+}
+
+// requestIDKey is the fiber.Ctx locals key holding the request ID.
+type requestIDKey struct{}
+
+// SetRequestID stores the ID of the current request.
+func SetRequestID(c *fiber.Ctx, id string) {
+	c.Locals(requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the current request, or "" if none was set.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,80 @@
+package response
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestEnvelope(t *testing.T) {
+	app := fiber.New()
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return JSON(c, fiber.Map{"name": "db"})
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return Error(c, fiber.StatusNotFound, "secret not found")
+	})
+	app.Get("/fail-id", func(c *fiber.Ctx) error {
+		SetRequestID(c, "req-1")
+		return Error(c, fiber.StatusNotFound, "secret not found")
+	})
+
+	tests := []struct {
+		name       string
+		envelope   bool
+		path       string
+		wantStatus int
+		want       map[string]any
+	}{
+		{"bare success", false, "/ok", http.StatusOK, map[string]any{"name": "db"}},
+		{"bare error", false, "/fail", http.StatusNotFound, map[string]any{"error": "secret not found"}},
+		{
+			"bare error with request id", false, "/fail-id", http.StatusNotFound,
+			map[string]any{"error": "secret not found", "request_id": "req-1"},
+		},
+		{
+			"enveloped success", true, "/ok", http.StatusOK,
+			map[string]any{"success": true, "data": map[string]any{"name": "db"}},
+		},
+		{
+			"enveloped error", true, "/fail", http.StatusNotFound,
+			map[string]any{"success": false, "error": map[string]any{"message": "secret not found"}},
+		},
+		{
+			"enveloped error with request id", true, "/fail-id", http.StatusNotFound,
+			map[string]any{"success": false, "error": map[string]any{"message": "secret not found", "request_id": "req-1"}},
+		},
+	}
+
+	t.Cleanup(func() { SetEnvelope(false) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetEnvelope(tt.envelope)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, nil)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			var got map[string]any
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("body = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
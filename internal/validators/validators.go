@@ -2,8 +2,11 @@
 package validators
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
 const SecretNameMaxLength = 255
@@ -11,21 +14,33 @@ const SecretNameMaxLength = 255
 var SecretNamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9 _\-\./]*[a-zA-Z0-9])?$`)
 
 func IsValidSecretName(name string) bool {
-	if len(name) == 0 || len(name) > SecretNameMaxLength {
-		return false
+	return SecretNameProblem(name) == ""
+}
+
+// SecretNameProblem explains why name is not a valid secret name, or returns
+// "" if it is. The checks are those of IsValidSecretName.
+func SecretNameProblem(name string) string {
+	if len(name) == 0 {
+		return "name is empty"
+	}
+	if len(name) > SecretNameMaxLength {
+		return fmt.Sprintf("name is longer than %d characters", SecretNameMaxLength)
 	}
 
-	if strings.Contains(name, "..") || strings.Contains(name, "\x00") {
-		return false
+	if strings.Contains(name, "..") {
+		return `name contains ".."`
 	}
 
 	for _, ch := range name {
 		if ch < 32 || ch > 126 {
-			return false
+			return "name contains control or non-ASCII characters"
 		}
 	}
 
-	return SecretNamePattern.MatchString(name)
+	if !SecretNamePattern.MatchString(name) {
+		return "name must start and end with a letter or digit and contain only letters, digits, spaces and _ - . /"
+	}
+	return ""
 }
 
 func SanitizeSecretName(name string) (string, bool) {
@@ -57,3 +72,27 @@ func IsValidFilterQueryValue(s string) bool {
 	}
 	return true
 }
+
+// IsValidFieldName reports whether s is acceptable as a requested field name
+// (built-in or custom). Custom field names are free-form, so only length and
+// control characters are restricted.
+func IsValidFieldName(s string) bool {
+	return IsValidFilterQueryValue(s)
+}
+
+// IsValidUUID reports whether s is a UUID in the canonical 36-character form
+// Vaultwarden uses for IDs (e.g. 3f1b2c4d-...). Braced and urn: forms are rejected.
+func IsValidUUID(s string) bool {
+	return len(s) == 36 && uuid.Validate(s) == nil
+}
+
+// RequestIDMaxLength bounds client-supplied X-Request-ID values.
+const RequestIDMaxLength = 128
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// IsValidRequestID reports whether s is safe to reuse as a request ID in logs
+// and responses: 1-128 characters of letters, digits and . _ : -
+func IsValidRequestID(s string) bool {
+	return len(s) <= RequestIDMaxLength && requestIDPattern.MatchString(s)
+}
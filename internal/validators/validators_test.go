@@ -40,3 +40,77 @@ func TestIsValidFilterQueryValue(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidUUID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e01", true},
+		{"0B9A4F4E-1D2C-4E0F-9A55-2F1C3B6D7E01", true},
+		{"", false},
+		{"db-password", false},
+		{"0b9a4f4e1d2c4e0f9a552f1c3b6d7e01", false},
+		{"{0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e01}", false},
+		{"urn:uuid:0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e01", false},
+		{"0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7eZZ", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidUUID(tt.input); got != tt.want {
+			t.Errorf("IsValidUUID(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"0b9a4f4e-1d2c-4e0f-9a55-2f1c3b6d7e01", true},
+		{"ci-run.1234:step_2", true},
+		{"", false},
+		{"has space", false},
+		{"inject\nINFO: forged", false},
+		{strings.Repeat("a", RequestIDMaxLength), true},
+		{strings.Repeat("a", RequestIDMaxLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := IsValidRequestID(tt.input); got != tt.want {
+			t.Errorf("IsValidRequestID(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSecretNameProblem(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"db-password", false},
+		{"my secret/prod.v2", false},
+		{"", true},
+		{strings.Repeat("a", SecretNameMaxLength+1), true},
+		{"a..b", true},
+		{"tab\tname", true},
+		{"café", true},
+		{"-leading", true},
+		{"trailing.", true},
+		{"semi;colon", true},
+	}
+	for _, tt := range tests {
+		reason := SecretNameProblem(tt.input)
+		if (reason != "") != tt.wantErr {
+			t.Errorf("SecretNameProblem(%q) = %q, wantErr %v", tt.input, reason, tt.wantErr)
+		}
+		if IsValidSecretName(tt.input) != (reason == "") {
+			t.Errorf("IsValidSecretName(%q) disagrees with SecretNameProblem", tt.input)
+		}
+	}
+}
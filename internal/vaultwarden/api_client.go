@@ -1,14 +1,18 @@
 package vaultwarden
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
@@ -72,16 +76,18 @@ type SyncFolder struct {
 
 // SyncCipher represents an encrypted vault item from the sync response.
 type SyncCipher struct {
-	ID             string      `json:"id"`
-	Type           int         `json:"type"`
-	OrganizationID *string     `json:"organizationId"`
-	CollectionIDs  []string    `json:"collectionIds"`
-	FolderID       *string     `json:"folderId"`
-	Name           string      `json:"name"`
-	Notes          *string     `json:"notes"`
-	Login          *SyncLogin  `json:"login"`
-	Card           *SyncCard   `json:"card"`
-	Fields         []SyncField `json:"fields"`
+	ID             string        `json:"id"`
+	Type           int           `json:"type"`
+	OrganizationID *string       `json:"organizationId"`
+	CollectionIDs  []string      `json:"collectionIds"`
+	FolderID       *string       `json:"folderId"`
+	Name           string        `json:"name"`
+	Notes          *string       `json:"notes"`
+	Login          *SyncLogin    `json:"login"`
+	Card           *SyncCard     `json:"card"`
+	Identity       *SyncIdentity `json:"identity"`
+	Fields         []SyncField   `json:"fields"`
+	DeletedDate    *string       `json:"deletedDate"`
 }
 
 // SyncLogin contains encrypted login data.
@@ -89,6 +95,7 @@ type SyncLogin struct {
 	Username *string `json:"username"`
 	Password *string `json:"password"`
 	URI      *string `json:"uri"`
+	Totp     *string `json:"totp"`
 	URIs     []struct {
 		URI *string `json:"uri"`
 	} `json:"uris"`
@@ -97,10 +104,35 @@ type SyncLogin struct {
 // SyncCard contains encrypted card data.
 type SyncCard struct {
 	CardholderName *string `json:"cardholderName"`
+	Brand          *string `json:"brand"`
 	Number         *string `json:"number"`
+	ExpMonth       *string `json:"expMonth"`
+	ExpYear        *string `json:"expYear"`
 	Code           *string `json:"code"`
 }
 
+// SyncIdentity contains encrypted identity data.
+type SyncIdentity struct {
+	Title          *string `json:"title"`
+	FirstName      *string `json:"firstName"`
+	MiddleName     *string `json:"middleName"`
+	LastName       *string `json:"lastName"`
+	Address1       *string `json:"address1"`
+	Address2       *string `json:"address2"`
+	Address3       *string `json:"address3"`
+	City           *string `json:"city"`
+	State          *string `json:"state"`
+	PostalCode     *string `json:"postalCode"`
+	Country        *string `json:"country"`
+	Company        *string `json:"company"`
+	Email          *string `json:"email"`
+	Phone          *string `json:"phone"`
+	SSN            *string `json:"ssn"`
+	Username       *string `json:"username"`
+	PassportNumber *string `json:"passportNumber"`
+	LicenseNumber  *string `json:"licenseNumber"`
+}
+
 // SyncField contains encrypted custom field data.
 type SyncField struct {
 	Name  *string `json:"name"`
@@ -108,6 +140,14 @@ type SyncField struct {
 	Type  int     `json:"type"`
 }
 
+// Bitwarden custom field types.
+const (
+	FieldTypeText    = 0
+	FieldTypeHidden  = 1
+	FieldTypeBoolean = 2
+	FieldTypeLinked  = 3
+)
+
 // Bitwarden cipher types.
 const (
 	CipherTypeLogin      = 1
@@ -116,21 +156,55 @@ const (
 	CipherTypeIdentity   = 4
 )
 
+// cipherTypeNames maps the public type names accepted by the API to cipher types.
+var cipherTypeNames = map[string]int{
+	"login":    CipherTypeLogin,
+	"note":     CipherTypeSecureNote,
+	"card":     CipherTypeCard,
+	"identity": CipherTypeIdentity,
+}
+
+// ParseCipherType maps a type name (login, note, card, identity) to its cipher type.
+func ParseCipherType(name string) (int, bool) {
+	t, ok := cipherTypeNames[strings.ToLower(strings.TrimSpace(name))]
+	return t, ok
+}
+
 // APIClient communicates directly with the Vaultwarden HTTP API.
 type APIClient struct {
 	baseURL      string
+	fallbackURLs []string     // replicas tried after baseURL (see do)
+	activeServer atomic.Int32 // index into baseURL+fallbackURLs of the server in use
 	email        string
 	password     string
 	clientID     string // Optional: for API key login (bypasses 2FA)
 	clientSecret string // Optional: for API key login (bypasses 2FA)
 	httpClient   *http.Client
 	deviceID     string
+	deviceType   int
+	deviceName   string
+
+	tokenRetryAttempts  int
+	tokenRetryBaseDelay time.Duration
+	syncRetryAttempts   int
+	syncRetryBaseDelay  time.Duration
+	// maxItems fails a sync returning more ciphers than this (0 disables).
+	maxItems int
+
+	// breaker fails upstream requests fast while Vaultwarden keeps failing
+	// (nil disables).
+	breaker *breaker
 
 	mu           sync.RWMutex
 	accessToken  string
 	refreshToken string
 	tokenExpiry  time.Time
+	tokenSetAt   time.Time // when the current access token was obtained or loaded
 	symKey       SymmetricKey
+	orgKeys      map[string]SymmetricKey // organization keys from the last sync
+
+	// tokenCacheFile persists the access token across restarts (empty disables).
+	tokenCacheFile string
 }
 
 // NewAPIClient creates a new Vaultwarden API client.
@@ -142,10 +216,16 @@ func NewAPIClient(baseURL, email, password, clientID, clientSecret string) *APIC
 		password:     password,
 		clientID:     clientID,
 		clientSecret: clientSecret,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		deviceID: uuid.New().String(),
+		httpClient:   newHTTPClient(DefaultHTTPConfig()),
+		deviceID:     uuid.New().String(),
+		deviceType:   DefaultDeviceType,
+		deviceName:   DefaultDeviceName,
+
+		tokenRetryAttempts:  DefaultTokenRetryAttempts,
+		tokenRetryBaseDelay: DefaultTokenRetryBaseDelay,
+		syncRetryAttempts:   DefaultSyncRetryAttempts,
+		syncRetryBaseDelay:  DefaultSyncRetryBaseDelay,
+		breaker:             newBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
 	}
 }
 
@@ -167,43 +247,44 @@ func (ac *APIClient) Authenticate() error {
 		return fmt.Errorf("derive master key: %w", err)
 	}
 
-	// Step 3: Login.
-	var tokenResp *TokenResponse
-	if ac.clientID != "" && ac.clientSecret != "" {
-		// API key login — bypasses 2FA.
-		logger.Info.Println("Using API key authentication (2FA bypass)")
-		tokenResp, err = ac.loginWithAPIKey()
-	} else {
-		// Password login — requires no 2FA or 2FA handling.
-		hashedPassword := HashPassword(ac.password, masterKey)
-		tokenResp, err = ac.loginWithPassword(hashedPassword)
-	}
-	if err != nil {
-		return fmt.Errorf("login: %w", err)
+	// A persisted access token that is still valid skips the token endpoint;
+	// the encrypted symmetric key then comes from the profile.
+	var encryptedKey string
+	if ac.loadCachedToken() {
+		logger.Info.Println("Reusing cached access token")
+		if encryptedKey, err = ac.fetchProfileKey(); err != nil {
+			logger.Warn.Printf("Cached access token not accepted, logging in: %v", err)
+			encryptedKey = ""
+		}
 	}
 
-	// Step 4: Get the encrypted symmetric key.
-	// API key login doesn't return the Key in the token response,
-	// so we get it from the sync/profile endpoint.
-	encryptedKey := tokenResp.Key
 	if encryptedKey == "" {
-		// Fetch from sync profile.
-		ac.mu.Lock()
-		ac.accessToken = tokenResp.AccessToken
-		ac.refreshToken = tokenResp.RefreshToken
-		ac.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-		ac.mu.Unlock()
-
-		encryptedKey, err = ac.fetchProfileKey()
+		// Step 3: Login.
+		var tokenResp *TokenResponse
+		if ac.hasAPIKey() {
+			// API key login — bypasses 2FA.
+			logger.Info.Println("Using API key authentication (2FA bypass)")
+			tokenResp, err = ac.loginWithAPIKey()
+		} else {
+			// Password login — requires no 2FA or 2FA handling.
+			hashedPassword := HashPassword(ac.password, masterKey)
+			tokenResp, err = ac.loginWithPassword(hashedPassword)
+		}
 		if err != nil {
-			return fmt.Errorf("fetch profile key: %w", err)
+			return fmt.Errorf("login: %w", err)
+		}
+		ac.setToken(tokenResp)
+
+		// Step 4: Get the encrypted symmetric key.
+		// API key login doesn't return the Key in the token response,
+		// so we get it from the sync/profile endpoint.
+		encryptedKey = tokenResp.Key
+		if encryptedKey == "" {
+			encryptedKey, err = ac.fetchProfileKey()
+			if err != nil {
+				return fmt.Errorf("fetch profile key: %w", err)
+			}
 		}
-	} else {
-		ac.mu.Lock()
-		ac.accessToken = tokenResp.AccessToken
-		ac.refreshToken = tokenResp.RefreshToken
-		ac.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-		ac.mu.Unlock()
 	}
 
 	// Step 5: Decrypt the symmetric key.
@@ -220,8 +301,28 @@ func (ac *APIClient) Authenticate() error {
 	return nil
 }
 
-// RefreshAccessToken uses the refresh token to get a new access token.
+// RefreshAccessToken gets a new access token with the refresh token. If that
+// fails and API key credentials are set, it falls back to a client_credentials
+// login, which needs no key derivation; in password mode the caller must
+// re-authenticate.
 func (ac *APIClient) RefreshAccessToken() error {
+	err := ac.refreshWithToken()
+	if err == nil || !ac.hasAPIKey() {
+		return err
+	}
+
+	logger.Warn.Printf("Token refresh failed, logging in with client credentials: %v", err)
+	tokenResp, loginErr := ac.loginWithAPIKey()
+	if loginErr != nil {
+		return fmt.Errorf("%w (client credentials login: %v)", err, loginErr)
+	}
+	ac.setToken(tokenResp)
+	return nil
+}
+
+// refreshWithToken runs the refresh_token grant. A rotated refresh token in
+// the response replaces the current one (see setToken).
+func (ac *APIClient) refreshWithToken() error {
 	ac.mu.RLock()
 	rt := ac.refreshToken
 	ac.mu.RUnlock()
@@ -233,10 +334,11 @@ func (ac *APIClient) RefreshAccessToken() error {
 	data := url.Values{
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {rt},
-		"client_id":     {"web"},
+		// The refresh token is bound to the client it was issued to.
+		"client_id": {ac.tokenClientID()},
 	}
 
-	resp, err := ac.httpClient.PostForm(ac.baseURL+"/identity/connect/token", data)
+	resp, err := ac.postToken(data)
 	if err != nil {
 		return fmt.Errorf("refresh request: %w", err)
 	}
@@ -252,29 +354,78 @@ func (ac *APIClient) RefreshAccessToken() error {
 		return fmt.Errorf("decode refresh response: %w", err)
 	}
 
+	ac.setToken(&tokenResp)
+
+	logger.Debug.Println("Token refreshed successfully")
+	return nil
+}
+
+// hasAPIKey reports whether API key (client_credentials) login is configured.
+func (ac *APIClient) hasAPIKey() bool {
+	return ac.clientID != "" && ac.clientSecret != ""
+}
+
+// tokenClientID is the OAuth client_id used to log in: the API key's client
+// ID, or "web" for password login.
+func (ac *APIClient) tokenClientID() string {
+	if ac.hasAPIKey() {
+		return ac.clientID
+	}
+	return "web"
+}
+
+// setToken stores the tokens from a token response (keeping the current
+// refresh token if none was issued) and persists the access token when a
+// token cache file is configured.
+func (ac *APIClient) setToken(tokenResp *TokenResponse) {
 	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
 	ac.accessToken = tokenResp.AccessToken
 	if tokenResp.RefreshToken != "" {
 		ac.refreshToken = tokenResp.RefreshToken
 	}
-	ac.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-	ac.mu.Unlock()
+	ac.tokenSetAt = time.Now()
+	ac.tokenExpiry = ac.tokenSetAt.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	ac.saveTokenLocked()
+}
 
-	logger.Debug.Println("Token refreshed successfully")
-	return nil
+// TokenStatus describes the current session without exposing any token.
+type TokenStatus struct {
+	// Grant is the login method: "client_credentials" (API key) or "password".
+	Grant     string
+	ExpiresAt time.Time
+	// LastRefresh is when this process last obtained (or loaded from the token
+	// cache file) its access token; zero before the first login.
+	LastRefresh time.Time
 }
 
+// TokenStatus returns the login method and access token timing.
+func (ac *APIClient) TokenStatus() TokenStatus {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	grant := "password"
+	if ac.hasAPIKey() {
+		grant = "client_credentials"
+	}
+	return TokenStatus{Grant: grant, ExpiresAt: ac.tokenExpiry, LastRefresh: ac.tokenSetAt}
+}
+
+// tokenRefreshMargin is how long before expiry an access token is refreshed.
+const tokenRefreshMargin = 60 * time.Second
+
 // EnsureValidToken refreshes the access token if it's expired or about to expire.
 func (ac *APIClient) EnsureValidToken() error {
 	ac.mu.RLock()
 	expiry := ac.tokenExpiry
 	ac.mu.RUnlock()
 
-	// Refresh 60 seconds before actual expiry.
-	if time.Now().After(expiry.Add(-60 * time.Second)) {
+	// Refresh shortly before actual expiry.
+	if time.Now().After(expiry.Add(-tokenRefreshMargin)) {
 		logger.Debug.Println("Token expiring soon, refreshing...")
 		if err := ac.RefreshAccessToken(); err != nil {
-			// If refresh fails, try full re-authentication.
+			// If refresh (and any client credentials fallback) fails, try
+			// full re-authentication.
 			logger.Warn.Println("Token refresh failed, attempting full re-authentication")
 			return ac.Authenticate()
 		}
@@ -399,11 +550,55 @@ func LookupIDByName(idToName map[string]string, target string) (id string, ok bo
 	return matches[0], true
 }
 
+// Ping checks that the server is reachable and the session is valid with a
+// lightweight authenticated request (GET /api/accounts/revision-date).
+func (ac *APIClient) Ping() error {
+	if err := ac.EnsureValidToken(); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+
+	ac.mu.RLock()
+	token := ac.accessToken
+	ac.mu.RUnlock()
+
+	req, err := http.NewRequest("GET", ac.baseURL+"/api/accounts/revision-date", nil)
+	if err != nil {
+		return fmt.Errorf("create ping request: %w", err)
+	}
+	ac.authorize(req, token)
+
+	resp, err := ac.do(req)
+	if errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: HTTP %d", ErrAuthFailed, resp.StatusCode)
+	default:
+		return fmt.Errorf("%w: HTTP %d", ErrUpstreamUnavailable, resp.StatusCode)
+	}
+}
+
 // Sync fetches and decrypts all vault items and returns them along with maps of decrypted
 // organization, folder, and collection names.
 func (ac *APIClient) Sync() ([]DecryptedItem, SyncNameMaps, error) {
+	return ac.SyncContext(context.Background())
+}
+
+// SyncContext is Sync bounded by ctx: the request and its retries are
+// abandoned once ctx is done. Failures wrap ErrAuthFailed when the session
+// cannot be established or is rejected, and ErrUpstreamUnavailable otherwise.
+func (ac *APIClient) SyncContext(ctx context.Context) ([]DecryptedItem, SyncNameMaps, error) {
 	if err := ac.EnsureValidToken(); err != nil {
-		return nil, emptySyncNameMaps(), fmt.Errorf("ensure valid token: %w", err)
+		return nil, emptySyncNameMaps(), fmt.Errorf("%w: ensure valid token: %w", ErrAuthFailed, err)
 	}
 
 	ac.mu.RLock()
@@ -411,15 +606,9 @@ func (ac *APIClient) Sync() ([]DecryptedItem, SyncNameMaps, error) {
 	key := ac.symKey
 	ac.mu.RUnlock()
 
-	req, err := http.NewRequest("GET", ac.baseURL+"/api/sync", nil)
-	if err != nil {
-		return nil, emptySyncNameMaps(), fmt.Errorf("create sync request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := ac.httpClient.Do(req)
+	resp, err := ac.getSync(ctx, token)
 	if err != nil {
-		return nil, emptySyncNameMaps(), fmt.Errorf("sync request: %w", err)
+		return nil, emptySyncNameMaps(), fmt.Errorf("%w: sync request: %w", ErrUpstreamUnavailable, err)
 	}
 
 	if resp.StatusCode == http.StatusUnauthorized {
@@ -430,16 +619,15 @@ func (ac *APIClient) Sync() ([]DecryptedItem, SyncNameMaps, error) {
 
 		// Token might be invalid, try to refresh and retry once.
 		if err := ac.RefreshAccessToken(); err != nil {
-			return nil, emptySyncNameMaps(), fmt.Errorf("sync auth failed, refresh failed: %w", err)
+			return nil, emptySyncNameMaps(), fmt.Errorf("%w: sync auth failed, refresh failed: %w", ErrAuthFailed, err)
 		}
 		ac.mu.RLock()
 		token = ac.accessToken
 		ac.mu.RUnlock()
 
-		req.Header.Set("Authorization", "Bearer "+token)
-		resp, err = ac.httpClient.Do(req)
+		resp, err = ac.getSync(ctx, token)
 		if err != nil {
-			return nil, emptySyncNameMaps(), fmt.Errorf("sync retry: %w", err)
+			return nil, emptySyncNameMaps(), fmt.Errorf("%w: sync retry: %w", ErrUpstreamUnavailable, err)
 		}
 	}
 	defer func() {
@@ -450,12 +638,16 @@ func (ac *APIClient) Sync() ([]DecryptedItem, SyncNameMaps, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, emptySyncNameMaps(), fmt.Errorf("sync failed (HTTP %d): %s", resp.StatusCode, string(body))
+		kind := ErrUpstreamUnavailable
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			kind = ErrAuthFailed
+		}
+		return nil, emptySyncNameMaps(), fmt.Errorf("%w: sync failed (HTTP %d): %s", kind, resp.StatusCode, string(body))
 	}
 
-	var syncResp SyncResponse
-	if err := json.NewDecoder(resp.Body).Decode(&syncResp); err != nil {
-		return nil, emptySyncNameMaps(), fmt.Errorf("decode sync response: %w", err)
+	syncResp, err := decodeSyncResponse(resp.Body, ac.maxItems)
+	if err != nil {
+		return nil, emptySyncNameMaps(), fmt.Errorf("%w: decode sync response: %w", ErrUpstreamUnavailable, err)
 	}
 
 	// Decrypt org keys if organizations are present.
@@ -502,6 +694,10 @@ func (ac *APIClient) Sync() ([]DecryptedItem, SyncNameMaps, error) {
 
 	logger.Info.Printf("Synced and decrypted %d vault items", len(items))
 
+	ac.mu.Lock()
+	ac.orgKeys = orgKeys
+	ac.mu.Unlock()
+
 	nameMaps := buildSyncNameMaps(syncResp, key, orgKeys)
 
 	logger.Info.Printf(
@@ -522,19 +718,26 @@ type DecryptedItem struct {
 	Username       string
 	Password       string
 	Notes          string
-	URI            string
-	Fields         map[string]string
+	URI            string   // first URI
+	URIs           []string // all URIs, in vault order
+	Totp           string
+	Card           *CardDetail
+	Identity       *IdentityDetail
+	Fields         map[string]string // custom fields by name; Hidden wins over other types on a name clash
+	FieldTypes     map[string]int    // type of each entry in Fields (missing means Text)
 	OrganizationID string
 	CollectionIDs  []string
 	FolderID       string
+	Deleted        bool // soft-deleted (in the trash)
 }
 
 // decryptCipher decrypts a single vault cipher into a DecryptedItem.
 func decryptCipher(c SyncCipher, key SymmetricKey) (DecryptedItem, error) {
 	item := DecryptedItem{
-		ID:     c.ID,
-		Type:   c.Type,
-		Fields: make(map[string]string),
+		ID:         c.ID,
+		Type:       c.Type,
+		Fields:     make(map[string]string),
+		FieldTypes: make(map[string]int),
 	}
 
 	var err error
@@ -557,8 +760,53 @@ func decryptCipher(c SyncCipher, key SymmetricKey) (DecryptedItem, error) {
 		if c.Login.URI != nil {
 			item.URI, _ = DecryptStr(*c.Login.URI, key)
 		}
-		if item.URI == "" && len(c.Login.URIs) > 0 && c.Login.URIs[0].URI != nil {
-			item.URI, _ = DecryptStr(*c.Login.URIs[0].URI, key)
+		if c.Login.Totp != nil {
+			item.Totp, _ = DecryptStr(*c.Login.Totp, key)
+		}
+		for _, u := range c.Login.URIs {
+			if uri := decryptOptional(u.URI, key); uri != "" {
+				item.URIs = append(item.URIs, uri)
+			}
+		}
+		if item.URI == "" && len(item.URIs) > 0 {
+			item.URI = item.URIs[0]
+		}
+		if item.URI != "" && len(item.URIs) == 0 {
+			item.URIs = []string{item.URI}
+		}
+	}
+
+	if c.Card != nil {
+		item.Card = &CardDetail{
+			CardholderName: decryptOptional(c.Card.CardholderName, key),
+			Brand:          decryptOptional(c.Card.Brand, key),
+			Number:         decryptOptional(c.Card.Number, key),
+			ExpMonth:       decryptOptional(c.Card.ExpMonth, key),
+			ExpYear:        decryptOptional(c.Card.ExpYear, key),
+			Code:           decryptOptional(c.Card.Code, key),
+		}
+	}
+
+	if id := c.Identity; id != nil {
+		item.Identity = &IdentityDetail{
+			Title:          decryptOptional(id.Title, key),
+			FirstName:      decryptOptional(id.FirstName, key),
+			MiddleName:     decryptOptional(id.MiddleName, key),
+			LastName:       decryptOptional(id.LastName, key),
+			Address1:       decryptOptional(id.Address1, key),
+			Address2:       decryptOptional(id.Address2, key),
+			Address3:       decryptOptional(id.Address3, key),
+			City:           decryptOptional(id.City, key),
+			State:          decryptOptional(id.State, key),
+			PostalCode:     decryptOptional(id.PostalCode, key),
+			Country:        decryptOptional(id.Country, key),
+			Company:        decryptOptional(id.Company, key),
+			Email:          decryptOptional(id.Email, key),
+			Phone:          decryptOptional(id.Phone, key),
+			SSN:            decryptOptional(id.SSN, key),
+			Username:       decryptOptional(id.Username, key),
+			PassportNumber: decryptOptional(id.PassportNumber, key),
+			LicenseNumber:  decryptOptional(id.LicenseNumber, key),
 		}
 	}
 
@@ -570,9 +818,16 @@ func decryptCipher(c SyncCipher, key SymmetricKey) (DecryptedItem, error) {
 		if f.Value != nil {
 			value, _ = DecryptStr(*f.Value, key)
 		}
-		if name != "" {
-			item.Fields[name] = value
+		if name == "" {
+			continue
+		}
+		// Keep the Hidden field when several fields share a name, so the
+		// result does not depend on field order in the vault.
+		if _, seen := item.Fields[name]; seen && item.FieldTypes[name] == FieldTypeHidden && f.Type != FieldTypeHidden {
+			continue
 		}
+		item.Fields[name] = value
+		item.FieldTypes[name] = f.Type
 	}
 
 	if c.OrganizationID != nil {
@@ -584,18 +839,30 @@ func decryptCipher(c SyncCipher, key SymmetricKey) (DecryptedItem, error) {
 	if c.FolderID != nil {
 		item.FolderID = strings.TrimSpace(*c.FolderID)
 	}
+	item.Deleted = c.DeletedDate != nil && *c.DeletedDate != ""
 
 	return item, nil
 }
 
+// decryptOptional decrypts an optional EncString, returning "" when it is absent
+// or cannot be decrypted.
+func decryptOptional(enc *string, key SymmetricKey) string {
+	if enc == nil {
+		return ""
+	}
+	s, _ := DecryptStr(*enc, key)
+	return s
+}
+
 // prelogin fetches KDF parameters for the given email.
 func (ac *APIClient) prelogin() (*PreloginResponse, error) {
 	body := fmt.Sprintf(`{"email":"%s"}`, ac.email)
-	resp, err := ac.httpClient.Post(
-		ac.baseURL+"/identity/accounts/prelogin",
-		"application/json",
-		strings.NewReader(body),
-	)
+	req, err := http.NewRequest(http.MethodPost, ac.baseURL+"/identity/accounts/prelogin", strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create prelogin request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ac.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("prelogin request: %w", err)
 	}
@@ -622,9 +889,9 @@ func (ac *APIClient) loginWithPassword(hashedPassword string) (*TokenResponse, e
 		"password":         {hashedPassword},
 		"scope":            {"api offline_access"},
 		"client_id":        {"web"},
-		"deviceType":       {"14"},
+		"deviceType":       {strconv.Itoa(ac.deviceType)},
 		"deviceIdentifier": {ac.deviceID},
-		"deviceName":       {"vaultwarden-api"},
+		"deviceName":       {ac.deviceName},
 	}
 
 	return ac.doTokenRequest(data)
@@ -637,9 +904,9 @@ func (ac *APIClient) loginWithAPIKey() (*TokenResponse, error) {
 		"client_id":        {ac.clientID},
 		"client_secret":    {ac.clientSecret},
 		"scope":            {"api"},
-		"deviceType":       {"14"},
+		"deviceType":       {strconv.Itoa(ac.deviceType)},
 		"deviceIdentifier": {ac.deviceID},
-		"deviceName":       {"vaultwarden-api"},
+		"deviceName":       {ac.deviceName},
 	}
 
 	return ac.doTokenRequest(data)
@@ -647,7 +914,7 @@ func (ac *APIClient) loginWithAPIKey() (*TokenResponse, error) {
 
 // doTokenRequest sends a token request and parses the response.
 func (ac *APIClient) doTokenRequest(data url.Values) (*TokenResponse, error) {
-	resp, err := ac.httpClient.PostForm(ac.baseURL+"/identity/connect/token", data)
+	resp, err := ac.postToken(data)
 	if err != nil {
 		return nil, fmt.Errorf("token request: %w", err)
 	}
@@ -677,9 +944,9 @@ func (ac *APIClient) fetchProfileKey() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("create sync request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	ac.authorize(req, token)
 
-	resp, err := ac.httpClient.Do(req)
+	resp, err := ac.do(req)
 	if err != nil {
 		return "", fmt.Errorf("sync request: %w", err)
 	}
@@ -690,8 +957,9 @@ func (ac *APIClient) fetchProfileKey() (string, error) {
 		return "", fmt.Errorf("sync failed (HTTP %d): %s", resp.StatusCode, string(body))
 	}
 
-	var syncResp SyncResponse
-	if err := json.NewDecoder(resp.Body).Decode(&syncResp); err != nil {
+	// Only the profile is needed here, so the item limit does not apply.
+	syncResp, err := decodeSyncResponse(resp.Body, 0)
+	if err != nil {
 		return "", fmt.Errorf("decode sync: %w", err)
 	}
 
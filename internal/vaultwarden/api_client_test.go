@@ -7,7 +7,11 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 )
 
 const (
@@ -235,3 +239,187 @@ func TestLookupIDByName(t *testing.T) {
 		}
 	})
 }
+
+func TestDecryptCipher_structured(t *testing.T) {
+	key := testUserKey()
+	enc := func(s string) *string {
+		v := mustEncryptType2Cipher(t, s, key)
+		return &v
+	}
+
+	login := SyncCipher{
+		ID:   "login",
+		Type: CipherTypeLogin,
+		Name: *enc("web"),
+		Login: &SyncLogin{
+			Username: enc("alice"),
+			URIs: []struct {
+				URI *string `json:"uri"`
+			}{{URI: enc("https://a.example")}, {URI: enc("https://b.example")}},
+		},
+	}
+	item, err := decryptCipher(login, key)
+	if err != nil {
+		t.Fatalf("decryptCipher(login): %v", err)
+	}
+	if item.URI != "https://a.example" || len(item.URIs) != 2 || item.URIs[1] != "https://b.example" {
+		t.Errorf("URI = %q, URIs = %v", item.URI, item.URIs)
+	}
+
+	card := SyncCipher{
+		ID:   "card",
+		Type: CipherTypeCard,
+		Name: *enc("visa"),
+		Card: &SyncCard{Number: enc("4111111111111111"), ExpYear: enc("2030")},
+	}
+	item, err = decryptCipher(card, key)
+	if err != nil {
+		t.Fatalf("decryptCipher(card): %v", err)
+	}
+	if item.Card == nil || item.Card.Number != "4111111111111111" || item.Card.ExpYear != "2030" {
+		t.Errorf("Card = %+v", item.Card)
+	}
+
+	identity := SyncCipher{
+		ID:       "identity",
+		Type:     CipherTypeIdentity,
+		Name:     *enc("me"),
+		Identity: &SyncIdentity{FirstName: enc("Alice"), Email: enc("alice@example.com")},
+	}
+	item, err = decryptCipher(identity, key)
+	if err != nil {
+		t.Fatalf("decryptCipher(identity): %v", err)
+	}
+	if item.Identity == nil || item.Identity.FirstName != "Alice" || item.Identity.Email != "alice@example.com" {
+		t.Errorf("Identity = %+v", item.Identity)
+	}
+}
+
+func TestDecryptCipher_hiddenFieldWinsNameClash(t *testing.T) {
+	key := testUserKey()
+	enc := func(s string) *string {
+		v := mustEncryptType2Cipher(t, s, key)
+		return &v
+	}
+
+	// Both orders must give the same result.
+	hidden := SyncField{Name: enc("secret"), Value: enc("hidden-value"), Type: FieldTypeHidden}
+	text := SyncField{Name: enc("secret"), Value: enc("text-value"), Type: FieldTypeText}
+	for _, fields := range [][]SyncField{{text, hidden}, {hidden, text}} {
+		c := SyncCipher{ID: "c1", Type: CipherTypeSecureNote, Name: *enc("note"), Fields: fields}
+		item, err := decryptCipher(c, key)
+		if err != nil {
+			t.Fatalf("decryptCipher: %v", err)
+		}
+		if got := extractSecret(item, DefaultExtractionOrder, DefaultSecretFieldNames); got != "hidden-value" {
+			t.Errorf("extractSecret() = %q, want the Hidden field's value", got)
+		}
+		if item.FieldTypes["secret"] != FieldTypeHidden {
+			t.Errorf("FieldTypes[secret] = %d, want Hidden", item.FieldTypes["secret"])
+		}
+	}
+}
+
+func TestWithDevice(t *testing.T) {
+	var form url.Values
+	var deviceHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/identity/connect/token":
+			_ = r.ParseForm()
+			form = r.PostForm
+			_, _ = w.Write([]byte(`{"access_token":"t","expires_in":3600}`))
+		case "/api/accounts/revision-date":
+			deviceHeader = r.Header.Get("Device-Type")
+		}
+	}))
+	defer srv.Close()
+
+	api := newTestAPIClient(t, srv)
+	api.clientID, api.clientSecret = "user.id", "secret"
+	NewClient(api, 0, 0, WithDevice(8, "ci-runner"))
+
+	if _, err := api.loginWithAPIKey(); err != nil {
+		t.Fatalf("loginWithAPIKey: %v", err)
+	}
+	if form.Get("deviceType") != "8" || form.Get("deviceName") != "ci-runner" {
+		t.Errorf("token request device = (%q, %q), want (8, ci-runner)", form.Get("deviceType"), form.Get("deviceName"))
+	}
+
+	if err := api.Ping(); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if deviceHeader != "8" {
+		t.Errorf("Device-Type header = %q, want 8", deviceHeader)
+	}
+}
+
+func TestTokenStatus(t *testing.T) {
+	ac := NewAPIClient("https://vault.example.com", "user@example.com", "pw", "", "")
+	if st := ac.TokenStatus(); st.Grant != "password" || !st.ExpiresAt.IsZero() || !st.LastRefresh.IsZero() {
+		t.Errorf("before login: %+v, want password grant and zero times", st)
+	}
+
+	before := time.Now()
+	ac.setToken(&TokenResponse{AccessToken: "token", ExpiresIn: 3600})
+	st := ac.TokenStatus()
+	if st.LastRefresh.Before(before) || st.ExpiresAt.Sub(st.LastRefresh) != time.Hour {
+		t.Errorf("after login: %+v, want a refresh now expiring an hour later", st)
+	}
+
+	if got := NewAPIClient("https://vault.example.com", "user@example.com", "pw", "id", "secret").TokenStatus().Grant; got != "client_credentials" {
+		t.Errorf("grant with an API key = %q, want client_credentials", got)
+	}
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+	t.Run("rotates refresh token", func(t *testing.T) {
+		var form url.Values
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			form = r.PostForm
+			_, _ = w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","expires_in":3600}`))
+		}))
+		defer srv.Close()
+
+		ac := NewAPIClient(srv.URL, "user@example.com", "pw", "user.abc", "secret")
+		ac.refreshToken = "old-refresh"
+
+		if err := ac.RefreshAccessToken(); err != nil {
+			t.Fatalf("RefreshAccessToken: %v", err)
+		}
+		if form.Get("grant_type") != "refresh_token" || form.Get("refresh_token") != "old-refresh" || form.Get("client_id") != "user.abc" {
+			t.Errorf("refresh form = %v", form)
+		}
+		if ac.accessToken != "new-access" || ac.refreshToken != "new-refresh" {
+			t.Errorf("tokens = (%q, %q), want rotated", ac.accessToken, ac.refreshToken)
+		}
+	})
+
+	t.Run("falls back to client credentials", func(t *testing.T) {
+		var grants []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			grants = append(grants, r.PostForm.Get("grant_type"))
+			if r.PostForm.Get("grant_type") == "refresh_token" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"cc-access","refresh_token":"cc-refresh","expires_in":3600}`))
+		}))
+		defer srv.Close()
+
+		ac := NewAPIClient(srv.URL, "user@example.com", "pw", "user.abc", "secret")
+		ac.refreshToken = "revoked"
+
+		if err := ac.RefreshAccessToken(); err != nil {
+			t.Fatalf("RefreshAccessToken: %v", err)
+		}
+		if len(grants) != 2 || grants[1] != "client_credentials" {
+			t.Errorf("grants = %v, want refresh_token then client_credentials", grants)
+		}
+		if ac.accessToken != "cc-access" || ac.refreshToken != "cc-refresh" {
+			t.Errorf("tokens = (%q, %q)", ac.accessToken, ac.refreshToken)
+		}
+	})
+}
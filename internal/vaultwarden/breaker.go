@@ -0,0 +1,175 @@
+package vaultwarden
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// Circuit breaker defaults: open after five consecutive upstream failures and
+// try again after 30 seconds.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// BreakerState is the state of the upstream circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every request at once with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe request through after the cooldown;
+	// its outcome closes or re-opens the breaker.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// WithCircuitBreaker makes upstream requests fail fast with ErrCircuitOpen
+// once threshold requests in a row have failed (unreachable server or 5xx,
+// after failover across replicas), until cooldown has passed and a probe
+// request succeeds. A threshold of zero disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		if c.api == nil {
+			return
+		}
+		c.api.breaker = nil
+		if threshold > 0 {
+			c.api.breaker = newBreaker(threshold, cooldown)
+		}
+	}
+}
+
+// BreakerState returns the state of the upstream circuit breaker, or false
+// when it is disabled.
+func (c *Client) BreakerState() (BreakerState, bool) {
+	if c.api == nil || c.api.breaker == nil {
+		return BreakerClosed, false
+	}
+	return c.api.breaker.current(), true
+}
+
+// breaker is a consecutive-failure circuit breaker. A nil breaker allows
+// everything.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the breaker last opened
+	probing  bool      // a half-open probe is in flight
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	metrics.UpstreamCircuitState.Set(float64(BreakerClosed))
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen while the breaker is open, or half-open with
+// its probe already in flight. Otherwise the request may go ahead and its
+// outcome must be reported with record or release.
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		wait := b.cooldown - b.now().Sub(b.openedAt)
+		if wait > 0 {
+			metrics.UpstreamCircuitRejections.Inc()
+			return fmt.Errorf("%w (retrying in %v)", ErrCircuitOpen, wait.Round(time.Second))
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing {
+			metrics.UpstreamCircuitRejections.Inc()
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record reports the outcome of a request allow let through.
+func (b *breaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.state == BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+	case !failed:
+		b.failures = 0
+	case b.state == BreakerClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+// release gives up a request allow let through without a verdict, e.g. when
+// its caller went away. A half-open breaker lets the next request probe.
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// open moves to the open state and restarts the cooldown. b.mu must be held.
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	if b.state != BreakerOpen {
+		logger.Warn.Printf("Vaultwarden circuit breaker open after %d failed requests; failing fast for %v", b.threshold, b.cooldown)
+	}
+	b.setState(BreakerOpen)
+}
+
+// setState records a transition. b.mu must be held.
+func (b *breaker) setState(s BreakerState) {
+	if s == BreakerClosed && b.state != BreakerClosed {
+		logger.Info.Println("Vaultwarden circuit breaker closed: upstream requests succeed again")
+	}
+	b.state = s
+	metrics.UpstreamCircuitState.Set(float64(s))
+}
@@ -0,0 +1,111 @@
+package vaultwarden
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	// A success resets the count, so only consecutive failures open it.
+	for _, failed := range []bool{true, false, true} {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow while closed: %v", err)
+		}
+		b.record(failed)
+	}
+	if got := b.current(); got != BreakerClosed {
+		t.Fatalf("state = %v after non-consecutive failures, want closed", got)
+	}
+	_ = b.allow()
+	b.record(true)
+	if got := b.current(); got != BreakerOpen {
+		t.Fatalf("state = %v after 2 consecutive failures, want open", got)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("allow while open = %v, want ErrCircuitOpen", err)
+	}
+
+	// After the cooldown one probe goes through; a failed probe re-opens.
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after cooldown: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second request while probing = %v, want ErrCircuitOpen", err)
+	}
+	b.record(true)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// An abandoned probe lets the next request probe; a good one closes.
+	now = now.Add(time.Minute)
+	_ = b.allow()
+	b.release()
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after release: %v", err)
+	}
+	b.record(false)
+	if got := b.current(); got != BreakerClosed {
+		t.Errorf("state = %v after a good probe, want closed", got)
+	}
+
+	var disabled *breaker
+	if err := disabled.allow(); err != nil {
+		t.Errorf("nil breaker allow = %v, want nil", err)
+	}
+}
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	var status, hits atomic.Int32
+	status.Store(http.StatusBadGateway)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithSyncRetry(1, 0), WithCircuitBreaker(2, time.Hour))
+	for range 2 {
+		if err := c.api.Ping(); !errors.Is(err, ErrUpstreamUnavailable) || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Ping = %v, want an upstream failure", err)
+		}
+	}
+	if state, ok := c.BreakerState(); !ok || state != BreakerOpen {
+		t.Fatalf("BreakerState = %v, %v, want open", state, ok)
+	}
+
+	status.Store(http.StatusOK)
+	before := hits.Load()
+	if err := c.api.Ping(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Ping while open = %v, want ErrCircuitOpen", err)
+	}
+	if _, _, err := c.api.Sync(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Sync while open = %v, want ErrUpstreamUnavailable", err)
+	}
+	if got := hits.Load(); got != before {
+		t.Errorf("%d requests reached the server while the breaker was open", got-before)
+	}
+
+	c.api.breaker.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if err := c.api.Ping(); err != nil {
+		t.Errorf("Ping after cooldown = %v, want nil", err)
+	}
+	if state, _ := c.BreakerState(); state != BreakerClosed {
+		t.Errorf("BreakerState = %v after a good probe, want closed", state)
+	}
+
+	if _, ok := NewClient(newTestAPIClient(t, srv), 0, 0, WithCircuitBreaker(0, time.Hour)).BreakerState(); ok {
+		t.Error("WithCircuitBreaker(0, ...) left the breaker enabled")
+	}
+}
@@ -0,0 +1,38 @@
+package vaultwarden
+
+import "strings"
+
+// cardField returns the named field of a card item: cardholderName, brand,
+// number, code, expMonth, expYear, or expiry ("MM/YYYY", only when both parts
+// are set). Names are case-insensitive. known is false for any other name, so
+// the caller can fall back to custom fields; a known but empty field returns
+// "" and true.
+func cardField(card *CardDetail, name string) (value string, known bool) {
+	if card == nil {
+		card = &CardDetail{}
+	}
+	switch strings.ToLower(name) {
+	case "cardholdername", "cardholder":
+		return card.CardholderName, true
+	case "brand":
+		return card.Brand, true
+	case "number":
+		return card.Number, true
+	case "code":
+		return card.Code, true
+	case "expmonth":
+		return card.ExpMonth, true
+	case "expyear":
+		return card.ExpYear, true
+	case "expiry":
+		if card.ExpMonth == "" || card.ExpYear == "" {
+			return "", true
+		}
+		month := card.ExpMonth
+		if len(month) == 1 {
+			month = "0" + month
+		}
+		return month + "/" + card.ExpYear, true
+	}
+	return "", false
+}
@@ -3,13 +3,19 @@
 package vaultwarden
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"maps"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
 	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+	"golang.org/x/sync/singleflight"
 )
 
 // Client manages vault access, caching, and background sync.
@@ -23,11 +29,47 @@ type Client struct {
 
 	// nameMaps from the last successful sync (for resolving filter names to UUIDs).
 	nameMaps SyncNameMaps
-
-	stopSync chan struct{}
+	lastSync time.Time
+
+	// syncBeforeFetch is the maximum snapshot age served without syncing first (0 disables).
+	syncBeforeFetch time.Duration
+	// ttlOverrides are per-secret maximum snapshot ages, keyed by lower-cased name.
+	ttlOverrides map[string]time.Duration
+	fetchSyncMu  sync.Mutex
+
+	// nameMatch is how requested names are compared with item names.
+	nameMatch NameMatch
+
+	// secretFieldNames are the custom field names extractSecret prefers, in order.
+	secretFieldNames []string
+	// extractionOrder is where extractSecret looks for a value, first hit wins.
+	extractionOrder []ExtractionStep
+
+	// excludeTrashed hides soft-deleted items from lookups entirely (404 instead of 410).
+	excludeTrashed bool
+
+	// syncOnMiss syncs once and retries when a name is not found, at most once
+	// per missCooldown (see syncAfterMiss).
+	syncOnMiss   bool
+	missCooldown time.Duration
+	missMu       sync.Mutex
+	lastMissSync time.Time
+
+	// flights are the lookups in progress, keyed by lookupKey (see lookupShared).
+	flights singleflight.Group
+
+	// staleIfError is how long past its maximum age a snapshot may still be
+	// served when the sync to refresh it fails (0 disables).
+	staleIfError time.Duration
+
+	stopSync  chan struct{}
+	closeOnce sync.Once
+	workers   sync.WaitGroup // background goroutines, waited for by Close
 }
 
-// ClientOption configures NewClient.
+// ClientOption configures NewClient. Options that tune the connection to
+// Vaultwarden (login, sync, transport, failover) configure the APIClient and
+// are ignored when NewClient is given none, as in tests.
 type ClientOption func(*Client)
 
 // WithState preloads decrypted items and name maps (e.g. unit tests with api set to nil).
@@ -40,6 +82,73 @@ func WithState(items map[string]DecryptedItem, nameMaps SyncNameMaps) ClientOpti
 	}
 }
 
+// WithSyncBeforeFetch makes lookups sync the vault first when the last successful
+// sync is older than maxAge, trading latency for freshness. Zero disables it.
+func WithSyncBeforeFetch(maxAge time.Duration) ClientOption {
+	return func(c *Client) {
+		c.syncBeforeFetch = maxAge
+	}
+}
+
+// WithTTLOverrides sets per-secret freshness requirements, keyed by the
+// requested name (case-insensitive). A lookup of such a name syncs the vault
+// first when the snapshot is older than its duration; 0 means the secret is
+// never served from the snapshot without syncing. Overrides take precedence
+// over WithSyncBeforeFetch in both directions.
+func WithTTLOverrides(overrides map[string]time.Duration) ClientOption {
+	return func(c *Client) {
+		c.ttlOverrides = make(map[string]time.Duration, len(overrides))
+		for name, d := range overrides {
+			c.ttlOverrides[strings.ToLower(name)] = d
+		}
+	}
+}
+
+// DefaultSecretFieldNames are the custom field names GetSecret looks for when an
+// item has no password, in priority order.
+var DefaultSecretFieldNames = []string{"value", "secret", "api_key", "apikey", "token"}
+
+// WithSecretFieldNames replaces DefaultSecretFieldNames. An empty list keeps the default.
+func WithSecretFieldNames(names []string) ClientOption {
+	return func(c *Client) {
+		if len(names) > 0 {
+			c.secretFieldNames = slices.Clone(names)
+		}
+	}
+}
+
+// WithNameMatch sets how requested names are compared with item names
+// (default NameMatchExact).
+func WithNameMatch(mode NameMatch) ClientOption {
+	return func(c *Client) {
+		c.nameMatch = mode
+	}
+}
+
+// WithExcludeTrashed makes lookups ignore items in the trash entirely, so a name
+// that only matches trashed items reports ErrSecretNotFound instead of ErrSecretDeleted.
+func WithExcludeTrashed(exclude bool) ClientOption {
+	return func(c *Client) {
+		c.excludeTrashed = exclude
+	}
+}
+
+// DefaultSyncOnMissCooldown is the minimum time between syncs triggered by
+// lookup misses.
+const DefaultSyncOnMissCooldown = 30 * time.Second
+
+// WithSyncOnMiss makes a lookup that finds nothing sync the vault and try
+// again before reporting ErrSecretNotFound, so items created since the last
+// sync are found right away. Miss-triggered syncs happen at most once per
+// cooldown, so clients asking for names that do not exist cannot make every
+// request download the vault.
+func WithSyncOnMiss(enabled bool, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		c.syncOnMiss = enabled
+		c.missCooldown = cooldown
+	}
+}
+
 // NewClient creates a vault client. Pass WithState to preload cache data without calling Initialize.
 func NewClient(api *APIClient, cacheTTL, syncInterval time.Duration, opts ...ClientOption) *Client {
 	c := &Client{
@@ -49,6 +158,9 @@ func NewClient(api *APIClient, cacheTTL, syncInterval time.Duration, opts ...Cli
 		items:     make(map[string]DecryptedItem),
 		nameMaps:  emptySyncNameMaps(),
 		stopSync:  make(chan struct{}),
+
+		secretFieldNames: DefaultSecretFieldNames,
+		extractionOrder:  DefaultExtractionOrder,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -62,16 +174,75 @@ func (c *Client) Initialize() error {
 		return fmt.Errorf("authenticate: %w", err)
 	}
 
-	if err := c.syncVault(); err != nil {
+	if err := c.syncVault(context.Background()); err != nil {
 		return fmt.Errorf("initial sync: %w", err)
 	}
 
-	// Start background sync.
-	go c.backgroundSync()
+	c.startBackgroundSync()
 
 	return nil
 }
 
+// startBackgroundSync starts the periodic sync goroutine; Close stops it.
+func (c *Client) startBackgroundSync() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		c.backgroundSync()
+	}()
+}
+
+// Ready reports whether secrets can be served: a vault sync has completed and
+// the Vaultwarden server answers an authenticated request. The error wraps
+// ErrNotSynced, ErrAuthFailed or ErrUpstreamUnavailable.
+func (c *Client) Ready() error {
+	c.mu.RLock()
+	synced := !c.lastSync.IsZero()
+	c.mu.RUnlock()
+	if !synced {
+		return ErrNotSynced
+	}
+	if c.api == nil {
+		return nil
+	}
+	return c.api.Ping()
+}
+
+// TokenStatus returns the Vaultwarden session's login method and token timing,
+// or false for a client created without an API client (tests).
+func (c *Client) TokenStatus() (TokenStatus, bool) {
+	if c.api == nil {
+		return TokenStatus{}, false
+	}
+	return c.api.TokenStatus(), true
+}
+
+// Diagnostics is a snapshot of the client's cache state for troubleshooting.
+type Diagnostics struct {
+	// SyncBeforeFetch is the global maximum snapshot age (0 when lookups never
+	// sync first), and TTLOverrides the number of per-secret overrides of it.
+	SyncBeforeFetch time.Duration
+	TTLOverrides    int
+	SyncInterval    time.Duration
+	// Items is the number of vault items in the snapshot, trashed ones included.
+	Items int
+	// LastSync is when the vault last synced successfully; zero before the first sync.
+	LastSync time.Time
+}
+
+// Diagnostics returns the client's cache settings and snapshot state.
+func (c *Client) Diagnostics() Diagnostics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Diagnostics{
+		SyncBeforeFetch: c.syncBeforeFetch,
+		TTLOverrides:    len(c.ttlOverrides),
+		SyncInterval:    c.syncEvery,
+		Items:           len(c.items),
+		LastSync:        c.lastSync,
+	}
+}
+
 // SecretFilter limits lookup by vault placement. Empty fields are ignored (no constraint).
 //
 // The singular fields are client-supplied query filters (use at most one of id vs
@@ -86,6 +257,11 @@ type SecretFilter struct {
 
 	OrganizationIDs []string
 	CollectionIDs   []string
+
+	// MaxAge, when set, tightens the freshness requirement for this lookup: the
+	// vault is synced first if the snapshot is older (0 always syncs). It can
+	// only shorten the configured maximum age, never extend it.
+	MaxAge *time.Duration
 }
 
 func containsFold(ids []string, target string) bool {
@@ -125,52 +301,511 @@ func matchesSecretFilter(item DecryptedItem, f SecretFilter) bool {
 	return true
 }
 
-// GetSecret retrieves a decrypted secret by name.
-// It searches by exact name (case-insensitive), then falls back to partial match.
+// GetSecret retrieves a decrypted secret by name, matched according to the
+// client's NameMatch mode (exact by default).
 func (c *Client) GetSecret(name string, filter SecretFilter) (string, error) {
-	if name == "" {
-		return "", fmt.Errorf("secret name cannot be empty")
+	return c.GetSecretContext(context.Background(), name, filter)
+}
+
+// GetSecretContext is GetSecret bounded by ctx: when the snapshot is too old
+// and the lookup has to sync first, the sync request is abandoned once ctx is
+// done (client gone, deadline passed) and ctx's error is returned. Lookups
+// served from the snapshot never block on ctx.
+func (c *Client) GetSecretContext(ctx context.Context, name string, filter SecretFilter) (string, error) {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return "", err
+	}
+	return extractSecret(item, c.extractionOrder, c.secretFieldNames), nil
+}
+
+// GetSecretField retrieves one specific field of the item matched by name:
+// "password", "username", "notes", "uri", "totp", or the name of a custom field.
+// Built-in field names take precedence over custom fields with the same name.
+// It returns ErrFieldNotFound when the item has no value for that field.
+func (c *Client) GetSecretField(name, field string, filter SecretFilter) (string, error) {
+	return c.GetSecretFieldContext(context.Background(), name, field, filter)
+}
+
+// GetSecretFieldContext is GetSecretField bounded by ctx, as GetSecretContext.
+func (c *Client) GetSecretFieldContext(ctx context.Context, name, field string, filter SecretFilter) (string, error) {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return "", err
+	}
+	value, ok := extractField(item, field)
+	if !ok {
+		metrics.LookupErrors.WithLabelValues("field_not_found").Inc()
+		return "", ErrFieldNotFound
+	}
+	return value, nil
+}
+
+// GetSecretFields looks up several fields of the item matched by name at once,
+// each resolved as by GetSecretFieldContext. Fields the item has no value for
+// are returned in missing (in request order) instead of failing the lookup;
+// err is only set when the item itself cannot be resolved.
+func (c *Client) GetSecretFields(ctx context.Context, name string, fields []string, filter SecretFilter) (values map[string]string, missing []string, err error) {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	values = make(map[string]string, len(fields))
+	for _, field := range fields {
+		value, ok := extractField(item, field)
+		if !ok {
+			metrics.LookupErrors.WithLabelValues("field_not_found").Inc()
+			missing = append(missing, field)
+			continue
+		}
+		values[field] = value
+	}
+	return values, missing, nil
+}
+
+// HasSecret reports whether name (and field, when set) resolves, without
+// extracting or returning any value: nil, or the error GetSecretFieldContext
+// would return.
+func (c *Client) HasSecret(ctx context.Context, name, field string, filter SecretFilter) error {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil || field == "" {
+		return err
+	}
+	if _, ok := extractField(item, field); !ok {
+		return ErrFieldNotFound
+	}
+	return nil
+}
+
+// GetSecretByID retrieves the item with the given cipher ID, bypassing name
+// matching (useful when several items share a name). field selects a field as
+// in GetSecretField; empty means the default extraction order. It returns the
+// item's name with the value. Items outside the filter are ErrSecretNotFound.
+func (c *Client) GetSecretByID(id, field string, filter SecretFilter) (name, value string, err error) {
+	return c.GetSecretByIDContext(context.Background(), id, field, filter)
+}
+
+// GetSecretByIDContext is GetSecretByID bounded by ctx, as GetSecretContext.
+func (c *Client) GetSecretByIDContext(ctx context.Context, id, field string, filter SecretFilter) (name, value string, err error) {
+	// Per-secret TTL overrides are keyed by name and cannot apply here.
+	stale, err := c.refreshFor(ctx, []string{""}, filter)
+	if err != nil {
+		return "", "", err
 	}
 
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	item, ok := c.items[strings.ToLower(id)]
+	c.mu.RUnlock()
+	if !ok && c.syncAfterMiss(ctx) {
+		stale = true
+		c.mu.RLock()
+		item, ok = c.items[strings.ToLower(id)]
+		c.mu.RUnlock()
+	}
+
+	switch {
+	case !ok || !matchesSecretFilter(item, filter) || (item.Deleted && c.excludeTrashed):
+		err = ErrSecretNotFound
+	case item.Deleted:
+		err = ErrSecretDeleted
+	}
+	recordLookup(stale, err)
+	if err != nil {
+		return "", "", err
+	}
+
+	if field == "" {
+		return item.Name, extractSecret(item, c.extractionOrder, c.secretFieldNames), nil
+	}
+	value, ok = extractField(item, field)
+	if !ok {
+		metrics.LookupErrors.WithLabelValues("field_not_found").Inc()
+		return "", "", ErrFieldNotFound
+	}
+	return item.Name, value, nil
+}
+
+// ListSecrets returns the sorted, de-duplicated names of the live (not trashed)
+// items matching the filter and, when cipherType is non-zero, of that cipher type. Values are never
+// included. The list is derived from the same synced snapshot that lookups use.
+func (c *Client) ListSecrets(filter SecretFilter, cipherType int) ([]string, error) {
+	return c.ListSecretsContext(context.Background(), filter, cipherType)
+}
+
+// ListSecretsContext is ListSecrets bounded by ctx, as GetSecretContext.
+func (c *Client) ListSecretsContext(ctx context.Context, filter SecretFilter, cipherType int) ([]string, error) {
+	if c.syncBeforeFetch > 0 {
+		if _, err := c.ensureFresh(ctx, c.syncBeforeFetch); err != nil {
+			return nil, err
+		}
+	}
 
-	key := strings.ToLower(name)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	candidates := make([]DecryptedItem, 0, len(c.items))
+	seen := make(map[string]struct{}, len(c.items))
+	names := make([]string, 0, len(c.items))
 	for _, item := range c.items {
-		if matchesSecretFilter(item, filter) {
-			candidates = append(candidates, item)
+		if item.Deleted || (cipherType != 0 && item.Type != cipherType) {
+			continue
+		}
+		if !matchesSecretFilter(item, filter) {
+			continue
+		}
+		if _, dup := seen[item.Name]; dup {
+			continue
 		}
+		seen[item.Name] = struct{}{}
+		names = append(names, item.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// lookup refreshes the snapshot if required and finds the item matching name.
+// ctx bounds a sync the lookup has to wait for.
+func (c *Client) lookup(ctx context.Context, name string, filter SecretFilter) (DecryptedItem, error) {
+	item, _, err := c.lookupItem(ctx, name, filter, false)
+	return item, err
+}
+
+// lookupItem is lookup that, with allowStale, falls back to the current
+// snapshot when the sync it required failed and the snapshot is still within
+// the stale-if-error grace (see WithStaleIfError). It reports whether it did.
+// Lookups that have to sync first are shared by concurrent identical callers
+// (see lookupShared); the rest only read the snapshot and run directly.
+func (c *Client) lookupItem(ctx context.Context, name string, filter SecretFilter, allowStale bool) (DecryptedItem, bool, error) {
+	if name == "" {
+		return DecryptedItem{}, false, fmt.Errorf("secret name cannot be empty")
 	}
+	if c.needsSync(name, filter) {
+		return c.lookupShared(ctx, name, filter, allowStale)
+	}
+	return c.lookupItemOnce(ctx, name, filter, allowStale)
+}
+
+// needsSync reports whether a lookup of name must sync before reading the
+// snapshot, as ensureFresh would decide now.
+func (c *Client) needsSync(name string, filter SecretFilter) bool {
+	maxAge, required := c.maxAgeFor(name, filter)
+	return required && c.api != nil && (maxAge == 0 || c.snapshotAge() > maxAge)
+}
 
-	// Case 1: Exact match.
-	for _, item := range candidates {
-		if strings.EqualFold(item.Name, name) {
-			return extractSecret(item), nil
+// lookupItemOnce does the work of lookupItem for one caller.
+func (c *Client) lookupItemOnce(ctx context.Context, name string, filter SecretFilter, allowStale bool) (DecryptedItem, bool, error) {
+	stale, err := c.refreshFor(ctx, []string{name}, filter)
+	if err != nil {
+		if !allowStale || !c.withinStaleGrace(err, name, filter) {
+			return DecryptedItem{}, false, err
+		}
+		// refreshFor has already counted the lookup as a failed sync.
+		c.mu.RLock()
+		item, ferr := c.findItemLocked(name, filter)
+		c.mu.RUnlock()
+		if ferr != nil {
+			return DecryptedItem{}, false, err // a miss in an old snapshot proves nothing
 		}
+		logger.Warn.Printf("Serving a value from a %v old snapshot, Vaultwarden unavailable: %v", c.snapshotAge().Round(time.Second), err)
+		return item, true, nil
 	}
-	// Case 2: Partial match
-	for _, item := range candidates {
-		if strings.Contains(strings.ToLower(item.Name), key) {
-			logger.Debug.Printf("Partial match found for secret lookup")
-			return extractSecret(item), nil
+
+	c.mu.RLock()
+	item, err := c.findItemLocked(name, filter)
+	c.mu.RUnlock()
+
+	if errors.Is(err, ErrSecretNotFound) && c.syncAfterMiss(ctx) {
+		stale = true
+		c.mu.RLock()
+		item, err = c.findItemLocked(name, filter)
+		c.mu.RUnlock()
+	}
+
+	recordLookup(stale, err)
+	return item, false, err
+}
+
+// syncAfterMiss syncs the vault after a lookup found nothing and reports
+// whether the caller should look again. It does nothing unless WithSyncOnMiss
+// is set, and within the cooldown of the previous miss-triggered sync. A
+// failed sync is logged and the miss stands.
+func (c *Client) syncAfterMiss(ctx context.Context) bool {
+	if !c.syncOnMiss || c.api == nil {
+		return false
+	}
+
+	c.missMu.Lock()
+	if !c.lastMissSync.IsZero() && time.Since(c.lastMissSync) < c.missCooldown {
+		c.missMu.Unlock()
+		return false
+	}
+	c.lastMissSync = time.Now()
+	c.missMu.Unlock()
+
+	logger.Debug.Println("Secret not in snapshot, syncing before reporting a miss")
+	if _, err := c.SyncNow(ctx); err != nil {
+		logger.Warn.Printf("Sync after lookup miss failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// GetSecrets resolves several names against one snapshot, syncing at most once
+// (to the strictest freshness requirement among the names). Each name ends up in
+// exactly one of the returned maps; errors are the same as GetSecret's.
+func (c *Client) GetSecrets(names []string, filter SecretFilter) (map[string]string, map[string]error) {
+	return c.GetSecretsContext(context.Background(), names, filter)
+}
+
+// GetSecretsContext is GetSecrets bounded by ctx, as GetSecretContext.
+func (c *Client) GetSecretsContext(ctx context.Context, names []string, filter SecretFilter) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(names))
+	errs := make(map[string]error)
+
+	stale, err := c.refreshFor(ctx, names, filter)
+	if err != nil {
+		for _, name := range names {
+			errs[name] = err
+		}
+		return values, errs
+	}
+
+	// One sync covers every name the snapshot is missing.
+	find := func() (missed bool) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		for _, name := range names {
+			if _, done := values[name]; done || name == "" {
+				continue
+			}
+			item, err := c.findItemLocked(name, filter)
+			if err != nil {
+				errs[name] = err
+				missed = missed || errors.Is(err, ErrSecretNotFound)
+				continue
+			}
+			delete(errs, name)
+			values[name] = extractSecret(item, c.extractionOrder, c.secretFieldNames)
+		}
+		return missed
+	}
+	if find() && c.syncAfterMiss(ctx) {
+		stale = true
+		find()
+	}
+
+	for _, name := range names {
+		if name == "" {
+			errs[name] = ErrSecretNotFound
+		}
+		recordLookup(stale, errs[name])
+	}
+	return values, errs
+}
+
+// refreshFor syncs the vault first if any of names requires a fresher snapshot
+// than the current one, and reports whether it was stale.
+func (c *Client) refreshFor(ctx context.Context, names []string, filter SecretFilter) (bool, error) {
+	var maxAge time.Duration
+	required := false
+	for _, name := range names {
+		if d, ok := c.maxAgeFor(name, filter); ok && (!required || d < maxAge) {
+			maxAge, required = d, true
+		}
+	}
+	if !required {
+		return false, nil
+	}
+
+	stale, err := c.ensureFresh(ctx, maxAge)
+	if err != nil {
+		metrics.SecretLookups.Add(float64(len(names)))
+		metrics.LookupErrors.WithLabelValues("sync_failed").Add(float64(len(names)))
+	}
+	return stale, err
+}
+
+// recordLookup updates the lookup metrics for one resolved name.
+func recordLookup(stale bool, err error) {
+	metrics.SecretLookups.Inc()
+	if stale {
+		metrics.CacheMisses.Inc()
+	} else {
+		metrics.CacheHits.Inc()
+	}
+	switch {
+	case errors.Is(err, ErrSecretDeleted):
+		metrics.LookupErrors.WithLabelValues("deleted").Inc()
+	case err != nil:
+		metrics.LookupErrors.WithLabelValues("not_found").Inc()
+	}
+}
+
+// findItemLocked matches name against the snapshot. The caller must hold c.mu.
+// Items in the trash only count when nothing live matches, in which case
+// ErrSecretDeleted is returned so callers can tell "deleted" from "never existed".
+func (c *Client) findItemLocked(name string, filter SecretFilter) (DecryptedItem, error) {
+	var live, trashed []DecryptedItem
+	for _, item := range c.items {
+		if !matchesSecretFilter(item, filter) {
+			continue
+		}
+		if item.Deleted {
+			if !c.excludeTrashed {
+				trashed = append(trashed, item)
+			}
+			continue
+		}
+		live = append(live, item)
+	}
+
+	if item, ok := matchName(live, name, c.nameMatch); ok {
+		return item, nil
+	}
+	if _, ok := matchName(trashed, name, c.nameMatch); ok {
+		return DecryptedItem{}, ErrSecretDeleted
+	}
+	return DecryptedItem{}, ErrSecretNotFound
+}
+
+// maxAgeFor returns how old the snapshot may be when serving name, and false
+// when any age is acceptable. A per-secret override replaces the global
+// setting; a per-request MaxAge can only tighten the result.
+func (c *Client) maxAgeFor(name string, filter SecretFilter) (time.Duration, bool) {
+	maxAge, ok := c.syncBeforeFetch, c.syncBeforeFetch > 0
+	if d, found := c.ttlOverrides[strings.ToLower(name)]; found {
+		maxAge, ok = d, true
+	}
+	if filter.MaxAge != nil && (!ok || *filter.MaxAge < maxAge) {
+		maxAge, ok = *filter.MaxAge, true
+	}
+	return maxAge, ok
+}
+
+// EffectiveTTL returns the maximum snapshot age a lookup of name with filter is
+// served from: the requirement maxAgeFor applies or, when there is none, the
+// background sync interval. It reports false when neither bounds the age.
+func (c *Client) EffectiveTTL(name string, filter SecretFilter) (time.Duration, bool) {
+	if d, ok := c.maxAgeFor(name, filter); ok {
+		return d, true
+	}
+	return c.syncEvery, c.syncEvery > 0
+}
+
+// CacheEntry is a name in the snapshot and its effective TTL (see EffectiveTTL).
+type CacheEntry struct {
+	Name string
+	TTL  time.Duration
+	// Bounded is false when nothing limits the age the name is served at.
+	Bounded bool
+}
+
+// CacheEntries lists the live names in the snapshot matching filter, sorted,
+// with the effective TTL of each. Values are never included.
+func (c *Client) CacheEntries(filter SecretFilter) []CacheEntry {
+	c.mu.RLock()
+	seen := make(map[string]struct{}, len(c.items))
+	names := make([]string, 0, len(c.items))
+	for _, item := range c.items {
+		if item.Deleted || !matchesSecretFilter(item, filter) {
+			continue
+		}
+		if _, dup := seen[item.Name]; dup {
+			continue
 		}
+		seen[item.Name] = struct{}{}
+		names = append(names, item.Name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	entries := make([]CacheEntry, 0, len(names))
+	for _, name := range names {
+		ttl, bounded := c.EffectiveTTL(name, filter)
+		entries = append(entries, CacheEntry{Name: name, TTL: ttl, Bounded: bounded})
+	}
+	return entries
+}
+
+// ensureFresh syncs the vault when the snapshot is older than maxAge and reports
+// whether it was stale. Concurrent callers are serialized and re-check the
+// snapshot, so a burst of stale lookups triggers a single sync (even with
+// maxAge 0, a sync that finished after a caller arrived satisfies it).
+func (c *Client) ensureFresh(ctx context.Context, maxAge time.Duration) (bool, error) {
+	if c.api == nil {
+		return false, nil
+	}
+	if maxAge > 0 && c.snapshotAge() <= maxAge {
+		return false, nil
 	}
 
-	return "", fmt.Errorf("secret not found")
+	arrived := time.Now()
+	c.fetchSyncMu.Lock()
+	defer c.fetchSyncMu.Unlock()
+
+	c.mu.RLock()
+	lastSync := c.lastSync
+	c.mu.RUnlock()
+	if !lastSync.Before(arrived) || (maxAge > 0 && time.Since(lastSync) <= maxAge) {
+		return true, nil // synced by another request while we waited
+	}
+
+	logger.Debug.Println("Vault snapshot is stale, syncing before fetch")
+	if err := c.syncVault(ctx); err != nil {
+		return true, fmt.Errorf("sync before fetch: %w", err)
+	}
+	return true, nil
+}
+
+// snapshotAge returns the time since the last successful sync.
+func (c *Client) snapshotAge() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Since(c.lastSync)
 }
 
-// ClearCache triggers a fresh vault sync.
-func (c *Client) ClearCache() {
-	if err := c.syncVault(); err != nil {
-		logger.Error.Printf("Cache refresh sync failed: %v", err)
+// SyncNow syncs the vault on demand so newly created items become visible
+// before the next background sync. It reports whether this call performed the
+// sync: a caller that waited while another sync finished shares that result
+// instead of starting another one.
+func (c *Client) SyncNow(ctx context.Context) (bool, error) {
+	if c.api == nil {
+		return false, nil
+	}
+
+	arrived := time.Now()
+	c.fetchSyncMu.Lock()
+	defer c.fetchSyncMu.Unlock()
+
+	c.mu.RLock()
+	lastSync := c.lastSync
+	c.mu.RUnlock()
+	if !lastSync.Before(arrived) {
+		return false, nil
+	}
+
+	if err := c.syncVault(ctx); err != nil {
+		return false, err
 	}
+	return true, nil
 }
 
 // Stop stops the background sync goroutine.
+//
+// Deprecated: use Close, which also waits for the goroutine to exit.
 func (c *Client) Stop() {
-	close(c.stopSync)
+	c.Close()
+}
+
+// Close stops the background sync, waits for an in-progress sync to finish and
+// releases pooled upstream connections. It is safe to call more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stopSync)
+		c.workers.Wait()
+		if c.api != nil {
+			c.api.httpClient.CloseIdleConnections()
+		}
+	})
 }
 
 // NameMaps returns a copy of decrypted organization, folder, and collection names
@@ -185,9 +820,10 @@ func (c *Client) NameMaps() SyncNameMaps {
 	}
 }
 
-// syncVault fetches and decrypts all items from the vault.
-func (c *Client) syncVault() error {
-	items, nameMaps, err := c.api.Sync()
+// syncVault fetches and decrypts all items from the vault. ctx bounds the
+// sync request and its retries.
+func (c *Client) syncVault(ctx context.Context) error {
+	items, nameMaps, err := c.api.SyncContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -203,6 +839,7 @@ func (c *Client) syncVault() error {
 	c.mu.Lock()
 	c.items = newItems
 	c.nameMaps = nameMaps
+	c.lastSync = time.Now()
 	c.mu.Unlock()
 
 	return nil
@@ -216,7 +853,7 @@ func (c *Client) backgroundSync() {
 	for {
 		select {
 		case <-ticker.C:
-			if err := c.syncVault(); err != nil {
+			if err := c.syncVault(context.Background()); err != nil {
 				logger.Warn.Printf("Background sync failed: %v", err)
 			} else {
 				logger.Debug.Println("Background vault sync completed")
@@ -228,30 +865,93 @@ func (c *Client) backgroundSync() {
 	}
 }
 
-// extractSecret extracts the most relevant secret value from a decrypted item.
-// Priority: password > field named "value"/"secret"/"api_key" > notes > first field.
-func extractSecret(item DecryptedItem) string {
-	if item.Password != "" {
-		return item.Password
+// extractSecret extracts the most relevant secret value from a decrypted item:
+// the first non-empty step of order (DefaultExtractionOrder unless
+// EXTRACTION_ORDER is set). names are the preferred custom field names.
+func extractSecret(item DecryptedItem, order []ExtractionStep, names []string) string {
+	for _, step := range order {
+		if v := extractStep(item, step, names); v != "" {
+			return v
+		}
 	}
+	return ""
+}
 
-	// Check custom fields by priority.
-	for _, name := range []string{"value", "secret", "api_key", "apikey", "token"} {
-		if v, ok := item.Fields[name]; ok && v != "" {
-			return v
+// firstField returns the name of the first non-empty custom field accepted by
+// match, preferring Hidden fields and then ordering by name, so the result does
+// not depend on map iteration order.
+func firstField(item DecryptedItem, match func(name string) bool) (string, bool) {
+	best, found := "", false
+	for name, v := range item.Fields {
+		if v == "" || !match(name) {
+			continue
 		}
+		if !found || fieldLess(item, name, best) {
+			best, found = name, true
+		}
+	}
+	return best, found
+}
+
+// fieldLess orders custom fields Hidden first, then by name.
+func fieldLess(item DecryptedItem, a, b string) bool {
+	aHidden := item.FieldTypes[a] == FieldTypeHidden
+	bHidden := item.FieldTypes[b] == FieldTypeHidden
+	if aHidden != bHidden {
+		return aHidden
 	}
+	return a < b
+}
 
-	if item.Notes != "" {
-		return item.Notes
+// extractField returns the value of one named field of the item. Built-in
+// names are matched case-insensitively; custom fields are matched exactly
+// first, then case-insensitively. Card and identity items also have their own
+// fields (see cardField and identityField), which take precedence over the
+// others. For secure notes, a name that is not a custom field is looked up
+// among the note's KEY=value lines. Empty values count as missing.
+func extractField(item DecryptedItem, field string) (string, bool) {
+	var (
+		value string
+		known bool
+	)
+	switch item.Type {
+	case CipherTypeCard:
+		value, known = cardField(item.Card, field)
+	case CipherTypeIdentity:
+		value, known = identityField(item.Identity, field)
+	}
+	if known {
+		return value, value != ""
 	}
 
-	// Return first non-empty field value.
-	for _, v := range item.Fields {
-		if v != "" {
-			return v
+	switch strings.ToLower(field) {
+	case "password":
+		value = item.Password
+	case "username":
+		value = item.Username
+	case "notes":
+		value = item.Notes
+	case "uri":
+		value = item.URI
+	case "totp":
+		value = item.Totp
+	default:
+		value = customField(item, field)
+		if value == "" && item.Type == CipherTypeSecureNote {
+			value, _ = noteVar(item.Notes, field)
 		}
 	}
+	return value, value != ""
+}
 
+// customField looks up a custom field by exact name, then case-insensitively
+// (preferring Hidden fields when several names differ only in case).
+func customField(item DecryptedItem, name string) string {
+	if v, ok := item.Fields[name]; ok {
+		return v
+	}
+	if k, ok := firstField(item, func(k string) bool { return strings.EqualFold(k, name) }); ok {
+		return item.Fields[k]
+	}
 	return ""
 }
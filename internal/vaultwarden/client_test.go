@@ -1,8 +1,16 @@
 package vaultwarden
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewClient_withState(t *testing.T) {
@@ -26,6 +34,324 @@ func TestNewClient_withState(t *testing.T) {
 	}
 }
 
+func TestExtractSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		item  DecryptedItem
+		names []string
+		want  string
+	}{
+		{
+			name: "password wins",
+			item: DecryptedItem{Password: "pw", Fields: map[string]string{"value": "v"}},
+			want: "pw",
+		},
+		{
+			name: "hidden named field before text named field",
+			item: DecryptedItem{
+				Fields:     map[string]string{"value": "visible", "token": "hidden"},
+				FieldTypes: map[string]int{"value": FieldTypeText, "token": FieldTypeHidden},
+			},
+			want: "hidden",
+		},
+		{
+			name: "text named field when no hidden one",
+			item: DecryptedItem{Fields: map[string]string{"secret": "s", "other": "o"}, Notes: "n"},
+			want: "s",
+		},
+		{
+			name:  "configured names",
+			item:  DecryptedItem{Fields: map[string]string{"value": "v", "dsn": "postgres://"}},
+			names: []string{"dsn"},
+			want:  "postgres://",
+		},
+		{
+			name: "notes before unnamed fields",
+			item: DecryptedItem{Fields: map[string]string{"other": "o"}, Notes: "n"},
+			want: "n",
+		},
+		{
+			name: "fallback is deterministic",
+			item: DecryptedItem{
+				Fields:     map[string]string{"b": "b", "a": "a", "z": "z"},
+				FieldTypes: map[string]int{"z": FieldTypeHidden},
+			},
+			want: "z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			names := tt.names
+			if names == nil {
+				names = DefaultSecretFieldNames
+			}
+			for range 10 {
+				if got := extractSecret(tt.item, DefaultExtractionOrder, names); got != tt.want {
+					t.Fatalf("extractSecret() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractField(t *testing.T) {
+	t.Parallel()
+
+	item := DecryptedItem{
+		Username: "admin",
+		Password: "pw",
+		Totp:     "otpauth://totp/x",
+		Fields:   map[string]string{"Host": "db.internal", "username": "shadowed", "empty": ""},
+	}
+
+	tests := []struct {
+		field  string
+		want   string
+		wantOK bool
+	}{
+		{"password", "pw", true},
+		{"USERNAME", "admin", true},
+		{"totp", "otpauth://totp/x", true},
+		{"Host", "db.internal", true},
+		{"host", "db.internal", true},
+		{"notes", "", false},
+		{"empty", "", false},
+		{"missing", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			t.Parallel()
+			got, ok := extractField(item, tt.field)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("extractField(%q) = (%q, %v), want (%q, %v)", tt.field, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExtractField_noteVars(t *testing.T) {
+	t.Parallel()
+
+	item := DecryptedItem{
+		Type:   CipherTypeSecureNote,
+		Notes:  "# database\nDB_HOST=db.internal\n\nDB_PASS=\"p@ss word\"\n",
+		Fields: map[string]string{"DB_HOST": "from-field"},
+	}
+
+	tests := []struct {
+		field  string
+		want   string
+		wantOK bool
+	}{
+		{"DB_PASS", "p@ss word", true},
+		{"db_pass", "p@ss word", true},
+		{"DB_HOST", "from-field", true},
+		{"MISSING", "", false},
+		{"database", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := extractField(item, tt.field)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("extractField(%q) = (%q, %v), want (%q, %v)", tt.field, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	login := item
+	login.Type = CipherTypeLogin
+	if got, ok := extractField(login, "DB_PASS"); ok {
+		t.Errorf("login notes parsed as KEY=value: got %q", got)
+	}
+}
+
+func TestExtractField_card(t *testing.T) {
+	t.Parallel()
+
+	item := DecryptedItem{
+		Type:   CipherTypeCard,
+		Card:   &CardDetail{CardholderName: "Jane Doe", Brand: "Visa", Number: "4111111111111111", ExpMonth: "3", ExpYear: "2030"},
+		Fields: map[string]string{"number": "from-field", "pin": "1234"},
+	}
+
+	tests := []struct {
+		field  string
+		want   string
+		wantOK bool
+	}{
+		{"number", "4111111111111111", true},
+		{"Number", "4111111111111111", true},
+		{"expiry", "03/2030", true},
+		{"expMonth", "3", true},
+		{"cardholderName", "Jane Doe", true},
+		{"code", "", false},
+		{"pin", "1234", true},
+	}
+	for _, tt := range tests {
+		got, ok := extractField(item, tt.field)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("extractField(%q) = (%q, %v), want (%q, %v)", tt.field, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	item.Card = &CardDetail{ExpYear: "2030"}
+	if got, ok := extractField(item, "expiry"); ok {
+		t.Errorf("expiry without a month = %q, want missing", got)
+	}
+}
+
+func TestExtractField_identity(t *testing.T) {
+	t.Parallel()
+
+	item := DecryptedItem{
+		Type:     CipherTypeIdentity,
+		Username: "login-user",
+		Identity: &IdentityDetail{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Username: "jdoe"},
+		Fields:   map[string]string{"employee_id": "E-42"},
+	}
+
+	tests := []struct {
+		field  string
+		want   string
+		wantOK bool
+	}{
+		{"firstName", "Jane", true},
+		{"EMAIL", "jane@example.com", true},
+		{"fullName", "Jane Doe", true},
+		{"username", "jdoe", true},
+		{"phone", "", false},
+		{"employee_id", "E-42", true},
+		{"shoeSize", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := extractField(item, tt.field)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("extractField(%q) = (%q, %v), want (%q, %v)", tt.field, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGetSecretField_notFound(t *testing.T) {
+	items := map[string]DecryptedItem{"c1": {ID: "c1", Name: "db", Password: "pw"}}
+	c := NewClient(nil, 0, 0, WithState(items, emptySyncNameMaps()))
+
+	if _, err := c.GetSecretField("db", "username", SecretFilter{}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("missing field error = %v, want ErrFieldNotFound", err)
+	}
+	if _, err := c.GetSecretField("nope", "password", SecretFilter{}); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("missing secret error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestGetSecret_trashed(t *testing.T) {
+	items := map[string]DecryptedItem{
+		"live":    {ID: "live", Name: "api-token", Password: "current"},
+		"trashed": {ID: "trashed", Name: "API-TOKEN", Password: "old", Deleted: true},
+		"gone":    {ID: "gone", Name: "retired", Password: "old", Deleted: true},
+	}
+
+	c := NewClient(nil, 0, 0, WithState(items, emptySyncNameMaps()))
+	if got, err := c.GetSecret("api-token", SecretFilter{}); err != nil || got != "current" {
+		t.Errorf("GetSecret(api-token) = %q, %v; want live item", got, err)
+	}
+	if _, err := c.GetSecret("retired", SecretFilter{}); !errors.Is(err, ErrSecretDeleted) {
+		t.Errorf("trashed-only error = %v, want ErrSecretDeleted", err)
+	}
+	if names, _ := c.ListSecrets(SecretFilter{}, 0); len(names) != 1 || names[0] != "api-token" {
+		t.Errorf("ListSecrets = %v, want only the live item", names)
+	}
+
+	c = NewClient(nil, 0, 0, WithState(items, emptySyncNameMaps()), WithExcludeTrashed(true))
+	if _, err := c.GetSecret("retired", SecretFilter{}); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("excluded trashed error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestMaxAgeFor(t *testing.T) {
+	short, long := 10*time.Second, time.Hour
+	tests := []struct {
+		name       string
+		global     time.Duration
+		overrides  map[string]time.Duration
+		requestTTL *time.Duration
+		wantAge    time.Duration
+		wantOK     bool
+	}{
+		{"nothing configured", 0, nil, nil, 0, false},
+		{"global only", time.Minute, nil, nil, time.Minute, true},
+		{"override replaces global", time.Minute, map[string]time.Duration{"DB": long}, nil, long, true},
+		{"override zero always syncs", 0, map[string]time.Duration{"db": 0}, nil, 0, true},
+		{"request tightens", time.Minute, nil, &short, short, true},
+		{"request cannot loosen", time.Minute, nil, &long, time.Minute, true},
+		{"request without config", 0, nil, &long, long, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, 0, 0, WithSyncBeforeFetch(tt.global), WithTTLOverrides(tt.overrides))
+			age, ok := c.maxAgeFor("db", SecretFilter{MaxAge: tt.requestTTL})
+			if age != tt.wantAge || ok != tt.wantOK {
+				t.Errorf("maxAgeFor() = (%v, %v), want (%v, %v)", age, ok, tt.wantAge, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGetSecret_ttlOverrideZeroAlwaysSyncs(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "fresh", &hits))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0,
+		WithState(map[string]DecryptedItem{}, emptySyncNameMaps()),
+		WithTTLOverrides(map[string]time.Duration{"db-password": 0}))
+
+	for range 2 {
+		if val, err := c.GetSecret("db-password", SecretFilter{}); err != nil || val != "fresh" {
+			t.Fatalf("GetSecret() = (%q, %v), want (fresh, nil)", val, err)
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("sync hits = %d, want 2 (TTL 0 syncs on every lookup)", got)
+	}
+}
+
+func TestExtractDetail(t *testing.T) {
+	login := extractDetail(DecryptedItem{
+		Type:     CipherTypeLogin,
+		Name:     "db",
+		Username: "admin",
+		Password: "pw",
+		URIs:     []string{"https://db.example"},
+		Totp:     "JBSWY3DPEHPK3PXP",
+	})
+	if login.Type != "login" || login.Username != "admin" || login.Password != "pw" ||
+		len(login.URIs) != 1 || login.Totp != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("login detail = %+v", login)
+	}
+
+	card := extractDetail(DecryptedItem{
+		Type:     CipherTypeCard,
+		Name:     "visa",
+		Password: "ignored",
+		Card:     &CardDetail{Number: "4111111111111111"},
+	})
+	if card.Type != "card" || card.Card == nil || card.Card.Number != "4111111111111111" || card.Password != "" {
+		t.Errorf("card detail = %+v", card)
+	}
+
+	identity := extractDetail(DecryptedItem{
+		Type:     CipherTypeIdentity,
+		Name:     "me",
+		Identity: &IdentityDetail{FirstName: "Alice"},
+	})
+	if identity.Type != "identity" || identity.Identity == nil || identity.Identity.FirstName != "Alice" {
+		t.Errorf("identity detail = %+v", identity)
+	}
+}
+
 func TestMatchesSecretFilter(t *testing.T) {
 	t.Parallel()
 
@@ -118,3 +444,432 @@ func TestMatchesSecretFilter_PersonalItemExcludedByOrgScope(t *testing.T) {
 		t.Error("personal item should match an empty (full-access) scope")
 	}
 }
+
+func strPtr(s string) *string { return &s }
+
+// newTestAPIClient returns an APIClient that is already authenticated against
+// srv, so Sync can be exercised without the login flow.
+func newTestAPIClient(t *testing.T, srv *httptest.Server) *APIClient {
+	t.Helper()
+	ac := NewAPIClient(srv.URL, "user@example.com", "pw", "", "")
+	ac.accessToken = "test-token"
+	ac.tokenExpiry = time.Now().Add(time.Hour)
+	ac.symKey = testUserKey()
+	return ac
+}
+
+// testSyncHandler serves a single personal login cipher on /api/sync and
+// counts how many syncs were served.
+func testSyncHandler(t *testing.T, name, password string, hits *atomic.Int32) http.HandlerFunc {
+	t.Helper()
+	body, err := json.Marshal(SyncResponse{
+		Ciphers: []SyncCipher{{
+			ID:    "c1",
+			Type:  CipherTypeLogin,
+			Name:  mustEncryptType2Cipher(t, name, testUserKey()),
+			Login: &SyncLogin{Password: strPtr(mustEncryptType2Cipher(t, password, testUserKey()))},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/sync" {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+func TestGetSecret_syncBeforeFetch(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "fresh", &hits))
+	defer srv.Close()
+
+	stale := map[string]DecryptedItem{"c1": {ID: "c1", Name: "db-password", Password: "stale"}}
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(stale, emptySyncNameMaps()), WithSyncBeforeFetch(time.Minute))
+
+	val, err := c.GetSecret("db-password", SecretFilter{})
+	if err != nil || val != "fresh" {
+		t.Fatalf("GetSecret() = (%q, %v), want (fresh, nil)", val, err)
+	}
+	if _, err := c.GetSecret("db-password", SecretFilter{}); err != nil {
+		t.Fatalf("second GetSecret: %v", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("sync hits = %d, want 1 (second lookup is within max age)", got)
+	}
+}
+
+func TestGetSecret_concurrentMissesShareOneSync(t *testing.T) {
+	var hits atomic.Int32
+	serve := testSyncHandler(t, "db-password", "fresh", &hits)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond) // keep the first sync in flight while the others arrive
+		serve(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0,
+		WithState(map[string]DecryptedItem{}, emptySyncNameMaps()),
+		WithTTLOverrides(map[string]time.Duration{"db-password": 0}))
+
+	const callers = 10
+	start := make(chan struct{})
+	errs := make(chan error, callers)
+	for range callers {
+		go func() {
+			<-start
+			val, err := c.GetSecret("db-password", SecretFilter{})
+			if err == nil && val != "fresh" {
+				err = fmt.Errorf("value = %q, want fresh", val)
+			}
+			errs <- err
+		}()
+	}
+	close(start)
+	for range callers {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("sync hits = %d, want 1 for %d concurrent misses", got, callers)
+	}
+}
+
+func TestGetSecret_sharedLookupSurvivesCancelledLeader(t *testing.T) {
+	var hits atomic.Int32
+	serve := testSyncHandler(t, "db-password", "fresh", &hits)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		serve(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0,
+		WithState(map[string]DecryptedItem{}, emptySyncNameMaps()),
+		WithTTLOverrides(map[string]time.Duration{"db-password": 0}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.GetSecretContext(ctx, "db-password", SecretFilter{})
+		leader <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // let the leader start the shared lookup
+
+	val, err := c.GetSecretContext(context.Background(), "db-password", SecretFilter{})
+	if err != nil {
+		t.Fatalf("follower GetSecretContext: %v", err)
+	}
+	if val != "fresh" {
+		t.Errorf("follower value = %q, want fresh", val)
+	}
+	if err := <-leader; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("leader err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestShare_panicReleasesKey(t *testing.T) {
+	c := NewClient(nil, 0, 0)
+
+	_, _, err := c.share(t.Context(), "k", func() (lookupResult, error) { panic("boom") })
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want the panic as an error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	res, shared, err := c.share(ctx, "k", func() (lookupResult, error) {
+		return lookupResult{item: DecryptedItem{Name: "db"}}, nil
+	})
+	if err != nil || shared || res.item.Name != "db" {
+		t.Errorf("after a panic: res = %+v, shared = %v, err = %v; want a fresh call", res, shared, err)
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	age := time.Minute
+	keys := map[string]string{
+		"plain":      lookupKey("db", SecretFilter{}, false),
+		"stale":      lookupKey("db", SecretFilter{}, true),
+		"other name": lookupKey("DB", SecretFilter{}, false),
+		"collection": lookupKey("db", SecretFilter{CollectionID: "c1"}, false),
+		"org list":   lookupKey("db", SecretFilter{OrganizationIDs: []string{"o1"}}, false),
+		"max age":    lookupKey("db", SecretFilter{MaxAge: &age}, false),
+	}
+	seen := make(map[string]string)
+	for name, key := range keys {
+		if prev, dup := seen[key]; dup {
+			t.Errorf("%s and %s share lookup key %s", prev, name, key)
+		}
+		seen[key] = name
+	}
+}
+
+func TestGetSecretContext_cancelled(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "fresh", &hits))
+	defer srv.Close()
+
+	stale := map[string]DecryptedItem{"c1": {ID: "c1", Name: "db-password", Password: "stale"}}
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(stale, emptySyncNameMaps()),
+		WithTTLOverrides(map[string]time.Duration{"db-password": 0}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := c.GetSecretContext(ctx, "db-password", SecretFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetSecretContext(cancelled) err = %v, want context.Canceled", err)
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("sync hits = %d, want 0 for a cancelled request", got)
+	}
+
+	// Lookups that need no sync are served whatever the context.
+	c2 := NewClient(nil, 0, 0, WithState(stale, emptySyncNameMaps()))
+	if val, err := c2.GetSecretContext(ctx, "db-password", SecretFilter{}); err != nil || val != "stale" {
+		t.Errorf("GetSecretContext from snapshot = (%q, %v), want (stale, nil)", val, err)
+	}
+}
+
+func TestContextVariants_cancelled(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "fresh", &hits))
+	defer srv.Close()
+
+	stale := map[string]DecryptedItem{"c1": {ID: "c1", Type: CipherTypeSecureNote, Name: "db-password", Notes: "A=1"}}
+	// Every lookup needs a sync first, which a cancelled context must abandon.
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(stale, emptySyncNameMaps()),
+		WithSyncBeforeFetch(time.Nanosecond))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, _, byIDErr := c.GetSecretByIDContext(ctx, "c1", "", SecretFilter{})
+	_, listErr := c.ListSecretsContext(ctx, SecretFilter{}, 0)
+	_, batchErrs := c.GetSecretsContext(ctx, []string{"db-password"}, SecretFilter{})
+	_, detailErr := c.GetSecretDetailContext(ctx, "db-password", SecretFilter{})
+	_, noteErr := c.GetNoteVarsContext(ctx, "db-password", SecretFilter{})
+	for name, err := range map[string]error{
+		"GetSecretByIDContext":   byIDErr,
+		"ListSecretsContext":     listErr,
+		"GetSecretsContext":      batchErrs["db-password"],
+		"GetSecretDetailContext": detailErr,
+		"GetNoteVarsContext":     noteErr,
+	} {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s(cancelled) err = %v, want context.Canceled", name, err)
+		}
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("sync hits = %d, want 0 for cancelled requests", got)
+	}
+}
+
+func TestClientReady(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/accounts/revision-date" || r.Header.Get("Authorization") != "Bearer test-token" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0)
+	if err := c.Ready(); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("Ready() before sync = %v, want ErrNotSynced", err)
+	}
+	c.lastSync = time.Now()
+
+	if err := c.Ready(); err != nil {
+		t.Errorf("Ready() = %v, want nil", err)
+	}
+	status.Store(http.StatusUnauthorized)
+	if err := c.Ready(); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Ready() on 401 = %v, want ErrAuthFailed", err)
+	}
+	status.Store(http.StatusBadGateway)
+	if err := c.Ready(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Ready() on 502 = %v, want ErrUpstreamUnavailable", err)
+	}
+
+	srv.Close()
+	if err := c.Ready(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Ready() with server down = %v, want ErrUpstreamUnavailable", err)
+	}
+}
+
+func TestGetSecrets_singleSync(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "fresh", &hits))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0,
+		WithState(map[string]DecryptedItem{}, emptySyncNameMaps()),
+		WithTTLOverrides(map[string]time.Duration{"db-password": 0, "missing": 0}))
+
+	values, errs := c.GetSecrets([]string{"db-password", "missing"}, SecretFilter{})
+	if values["db-password"] != "fresh" {
+		t.Errorf("values = %v, want db-password=fresh", values)
+	}
+	if !errors.Is(errs["missing"], ErrSecretNotFound) || len(errs) != 1 {
+		t.Errorf("errs = %v, want only missing=ErrSecretNotFound", errs)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("sync hits = %d, want 1 for the whole batch", got)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(nil, 0, 0, WithState(map[string]DecryptedItem{
+		"1": {ID: "1", Type: CipherTypeLogin, Name: "db-password", Password: "pw"},
+		"2": {ID: "2", Type: CipherTypeLogin, Name: "old-token", Password: "x", Deleted: true},
+	}, emptySyncNameMaps()), WithNameMatch(NameMatchCaseInsensitive))
+
+	if errs := c.Preload(nil); errs != nil {
+		t.Errorf("Preload(nil) = %v, want nil", errs)
+	}
+	errs := c.Preload([]string{"DB-PASSWORD", "typo", "old-token"})
+	if len(errs) != 2 || !errors.Is(errs["typo"], ErrSecretNotFound) || !errors.Is(errs["old-token"], ErrSecretDeleted) {
+		t.Errorf("Preload errs = %v, want typo not found and old-token deleted", errs)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient(nil, 0, 0, WithState(map[string]DecryptedItem{
+		"1": {ID: "1", Type: CipherTypeLogin, Name: "db-password", Password: "pw"},
+		"2": {ID: "2", Type: CipherTypeLogin, Name: "no-value"},
+	}, emptySyncNameMaps()))
+
+	if err := c.SelfTest("db-password"); err != nil {
+		t.Errorf("SelfTest(db-password) = %v, want nil", err)
+	}
+	if err := c.SelfTest("typo"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("SelfTest(typo) = %v, want ErrSecretNotFound", err)
+	}
+	if err := c.SelfTest("no-value"); err == nil {
+		t.Error("SelfTest accepted a secret without a value")
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "db-password", "pw", &hits))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 5*time.Millisecond)
+	c.startBackgroundSync()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hits.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("background sync never ran")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Close()
+	after := hits.Load()
+	time.Sleep(30 * time.Millisecond)
+	if got := hits.Load(); got != after {
+		t.Errorf("sync hits grew from %d to %d after Close", after, got)
+	}
+
+	// Closing again (or via the deprecated Stop) must not panic.
+	c.Close()
+	c.Stop()
+}
+
+func TestSyncNow(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "new-secret", "created", &hits))
+	defer srv.Close()
+
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(map[string]DecryptedItem{}, emptySyncNameMaps()))
+	if _, err := c.GetSecret("new-secret", SecretFilter{}); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("before sync: err = %v, want ErrSecretNotFound", err)
+	}
+
+	synced, err := c.SyncNow(t.Context())
+	if err != nil || !synced {
+		t.Fatalf("SyncNow = (%t, %v), want (true, nil)", synced, err)
+	}
+	if val, err := c.GetSecret("new-secret", SecretFilter{}); err != nil || val != "created" {
+		t.Errorf("after sync: GetSecret = (%q, %v), want (created, nil)", val, err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("sync hits = %d, want 1", got)
+	}
+
+	// Without an API client (tests, WithState) there is nothing to sync.
+	if synced, err := NewClient(nil, 0, 0).SyncNow(t.Context()); err != nil || synced {
+		t.Errorf("SyncNow without API = (%t, %v), want (false, nil)", synced, err)
+	}
+}
+
+func TestSyncOnMiss(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(testSyncHandler(t, "new-secret", "created", &hits))
+	defer srv.Close()
+
+	newClient := func(enabled bool) *Client {
+		return NewClient(newTestAPIClient(t, srv), 0, 0,
+			WithState(map[string]DecryptedItem{}, emptySyncNameMaps()),
+			WithSyncOnMiss(enabled, time.Hour))
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		hits.Store(0)
+		if _, err := newClient(false).GetSecret("new-secret", SecretFilter{}); !errors.Is(err, ErrSecretNotFound) {
+			t.Errorf("err = %v, want ErrSecretNotFound", err)
+		}
+		if got := hits.Load(); got != 0 {
+			t.Errorf("sync hits = %d, want 0", got)
+		}
+	})
+
+	t.Run("found after sync", func(t *testing.T) {
+		hits.Store(0)
+		if val, err := newClient(true).GetSecret("new-secret", SecretFilter{}); err != nil || val != "created" {
+			t.Errorf("GetSecret = (%q, %v), want (created, nil)", val, err)
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("sync hits = %d, want 1", got)
+		}
+	})
+
+	t.Run("cooldown", func(t *testing.T) {
+		hits.Store(0)
+		c := newClient(true)
+		for range 3 {
+			if _, err := c.GetSecret("never-existed", SecretFilter{}); !errors.Is(err, ErrSecretNotFound) {
+				t.Errorf("err = %v, want ErrSecretNotFound", err)
+			}
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("sync hits = %d, want 1 within the cooldown", got)
+		}
+	})
+
+	t.Run("batch syncs once", func(t *testing.T) {
+		hits.Store(0)
+		values, errs := newClient(true).GetSecrets([]string{"new-secret", "never-existed"}, SecretFilter{})
+		if values["new-secret"] != "created" || !errors.Is(errs["never-existed"], ErrSecretNotFound) || len(errs) != 1 {
+			t.Errorf("GetSecrets = %v, %v", values, errs)
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("sync hits = %d, want 1", got)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -175,6 +176,38 @@ func DecryptStr(s string, key SymmetricKey) (string, error) {
 	return cs.DecryptToString(key)
 }
 
+// EncryptStr encrypts plaintext with key as an AesCbc256_HmacSha256_B64 cipher
+// string ("2.<iv>|<ciphertext>|<mac>"), the format Bitwarden clients write.
+func EncryptStr(plaintext string, key SymmetricKey) (string, error) {
+	if len(key.MacKey) == 0 {
+		return "", errors.New("MAC key required for type 2 encryption")
+	}
+
+	block, err := aes.NewCipher(key.EncKey)
+	if err != nil {
+		return "", fmt.Errorf("aes cipher: %w", err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", fmt.Errorf("generate IV: %w", err)
+	}
+
+	ct := pkcs7Pad([]byte(plaintext), aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, ct)
+
+	mac := hmac.New(sha256.New, key.MacKey)
+	mac.Write(iv)
+	mac.Write(ct)
+
+	return fmt.Sprintf("%d.%s|%s|%s",
+		EncTypeAesCbc256_HmacSha256_B64,
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(ct),
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	), nil
+}
+
 // MakeMasterKey derives the master key from the user's password and email.
 func MakeMasterKey(password, email string, kdfType, iterations int, memory, parallelism *int) ([]byte, error) {
 	salt := []byte(strings.ToLower(strings.TrimSpace(email)))
@@ -333,6 +366,17 @@ func DecryptOrgKey(encryptedOrgKey string, privateKey *rsa.PrivateKey) (Symmetri
 	}, nil
 }
 
+// pkcs7Pad appends PKCS#7 padding (always at least one byte).
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+padLen)
+	copy(padded, data)
+	for i := 0; i < padLen; i++ {
+		padded = append(padded, byte(padLen))
+	}
+	return padded
+}
+
 // pkcs7Unpad removes PKCS#7 padding.
 func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
 	if len(data) == 0 {
@@ -724,3 +724,38 @@ func TestDecryptCipher_PersonalItemStillWorks(t *testing.T) {
 		t.Errorf("got name %q, want %q", item.Name, "PERSONAL_SECRET")
 	}
 }
+
+func TestEncryptStr_RoundTrip(t *testing.T) {
+	key := SymmetricKey{EncKey: make([]byte, 32), MacKey: make([]byte, 32)}
+	if _, err := rand.Read(key.EncKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(key.MacKey); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plaintext := range []string{"", "s3cr3t", "exactly sixteen!", strings.Repeat("x", 100)} {
+		enc, err := EncryptStr(plaintext, key)
+		if err != nil {
+			t.Fatalf("EncryptStr(%q): %v", plaintext, err)
+		}
+		if !strings.HasPrefix(enc, "2.") {
+			t.Errorf("EncryptStr(%q) = %q, want a type 2 cipher string", plaintext, enc)
+		}
+		cs, err := ParseCipherString(enc)
+		if err != nil {
+			t.Fatalf("ParseCipherString: %v", err)
+		}
+		got, err := cs.DecryptToString(key)
+		if err != nil {
+			t.Fatalf("DecryptToString: %v", err)
+		}
+		if got != plaintext {
+			t.Errorf("round trip = %q, want %q", got, plaintext)
+		}
+	}
+
+	if _, err := EncryptStr("x", SymmetricKey{EncKey: key.EncKey}); err == nil {
+		t.Error("expected error without a MAC key")
+	}
+}
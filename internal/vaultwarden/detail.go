@@ -0,0 +1,101 @@
+package vaultwarden
+
+import "context"
+
+// SecretDetail is the structured view of a vault item returned by
+// GET /secret/:name/full. Only the parts relevant to the item's type are set.
+type SecretDetail struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	URIs     []string          `json:"uris,omitempty"`
+	Totp     string            `json:"totp,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Card     *CardDetail       `json:"card,omitempty"`
+	Identity *IdentityDetail   `json:"identity,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// CardDetail holds the decrypted fields of a card item.
+type CardDetail struct {
+	CardholderName string `json:"cardholderName,omitempty"`
+	Brand          string `json:"brand,omitempty"`
+	Number         string `json:"number,omitempty"`
+	ExpMonth       string `json:"expMonth,omitempty"`
+	ExpYear        string `json:"expYear,omitempty"`
+	Code           string `json:"code,omitempty"`
+}
+
+// IdentityDetail holds the decrypted fields of an identity item.
+type IdentityDetail struct {
+	Title          string `json:"title,omitempty"`
+	FirstName      string `json:"firstName,omitempty"`
+	MiddleName     string `json:"middleName,omitempty"`
+	LastName       string `json:"lastName,omitempty"`
+	Address1       string `json:"address1,omitempty"`
+	Address2       string `json:"address2,omitempty"`
+	Address3       string `json:"address3,omitempty"`
+	City           string `json:"city,omitempty"`
+	State          string `json:"state,omitempty"`
+	PostalCode     string `json:"postalCode,omitempty"`
+	Country        string `json:"country,omitempty"`
+	Company        string `json:"company,omitempty"`
+	Email          string `json:"email,omitempty"`
+	Phone          string `json:"phone,omitempty"`
+	SSN            string `json:"ssn,omitempty"`
+	Username       string `json:"username,omitempty"`
+	PassportNumber string `json:"passportNumber,omitempty"`
+	LicenseNumber  string `json:"licenseNumber,omitempty"`
+}
+
+// CipherTypeName returns the public name (login, note, card, identity) of a
+// cipher type, or "unknown".
+func CipherTypeName(cipherType int) string {
+	for name, t := range cipherTypeNames {
+		if t == cipherType {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// GetSecretDetail returns the structured view of the item matching name.
+func (c *Client) GetSecretDetail(name string, filter SecretFilter) (SecretDetail, error) {
+	return c.GetSecretDetailContext(context.Background(), name, filter)
+}
+
+// GetSecretDetailContext is GetSecretDetail bounded by ctx, as GetSecretContext.
+func (c *Client) GetSecretDetailContext(ctx context.Context, name string, filter SecretFilter) (SecretDetail, error) {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return SecretDetail{}, err
+	}
+	return extractDetail(item), nil
+}
+
+// extractDetail maps an item to its structured view by cipher type. Notes and
+// custom fields are included for every type.
+func extractDetail(item DecryptedItem) SecretDetail {
+	d := SecretDetail{
+		Name:  item.Name,
+		Type:  CipherTypeName(item.Type),
+		Notes: item.Notes,
+	}
+	if len(item.Fields) > 0 {
+		d.Fields = item.Fields
+	}
+
+	switch item.Type {
+	case CipherTypeLogin:
+		d.Username = item.Username
+		d.Password = item.Password
+		d.URIs = item.URIs
+		d.Totp = item.Totp
+	case CipherTypeCard:
+		d.Card = item.Card
+	case CipherTypeIdentity:
+		d.Identity = item.Identity
+	}
+	return d
+}
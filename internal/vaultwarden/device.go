@@ -0,0 +1,31 @@
+package vaultwarden
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Device identity sent to Vaultwarden when nothing is configured. Type 14 is
+// "SDK" in the Bitwarden DeviceType enum.
+const (
+	DefaultDeviceType = 14
+	DefaultDeviceName = "vaultwarden-api"
+)
+
+// WithDevice sets the device type and name this service logs in as. Some
+// servers apply policies per device type, so the SDK default may need to
+// change.
+func WithDevice(deviceType int, name string) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.deviceType = deviceType
+			c.api.deviceName = name
+		}
+	}
+}
+
+// authorize sets the bearer token and device type headers on an API request.
+func (ac *APIClient) authorize(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Device-Type", strconv.Itoa(ac.deviceType))
+}
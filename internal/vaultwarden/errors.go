@@ -0,0 +1,37 @@
+package vaultwarden
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Lookup errors returned by Client. Callers should match them with errors.Is.
+var (
+	// ErrSecretNotFound means no vault item matched the name and filter.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrFieldNotFound means the item exists but has no value for the requested field.
+	ErrFieldNotFound = errors.New("field not found")
+	// ErrSecretDeleted means the only items matching the name are in the trash.
+	ErrSecretDeleted = errors.New("secret deleted")
+	// ErrNotWritable means the item exists but cannot be updated through this
+	// service (only login passwords can be written).
+	ErrNotWritable = errors.New("secret not writable")
+	// ErrNotANote means the item exists but is not a secure note, so its body
+	// cannot be returned as KEY=value pairs.
+	ErrNotANote = errors.New("secret is not a secure note")
+)
+
+// Upstream errors returned by readiness checks. Callers should match them with errors.Is.
+var (
+	// ErrNotSynced means no vault sync has completed yet, so nothing can be served.
+	ErrNotSynced = errors.New("vault not synced yet")
+	// ErrUpstreamUnavailable means the Vaultwarden server could not be reached or
+	// answered with an unexpected status.
+	ErrUpstreamUnavailable = errors.New("vaultwarden unavailable")
+	// ErrAuthFailed means the session could not be (re-)established or was rejected.
+	ErrAuthFailed = errors.New("vaultwarden authentication failed")
+	// ErrCircuitOpen means the request was not sent because recent upstream
+	// requests kept failing (see WithCircuitBreaker). It wraps
+	// ErrUpstreamUnavailable.
+	ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUpstreamUnavailable)
+)
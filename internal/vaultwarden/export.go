@@ -0,0 +1,44 @@
+package vaultwarden
+
+import (
+	"context"
+	"iter"
+	"sort"
+)
+
+// Export returns every live (not trashed) item of the snapshot as a structured
+// view, keyed by cipher id and ordered by name, then id. The items are copied
+// out of the snapshot up front (the copies share their strings with it), but
+// each view is only built as the sequence is consumed, so the caller can
+// stream the export without holding the whole rendering in memory or the
+// snapshot lock while it writes.
+func (c *Client) Export() (iter.Seq2[string, SecretDetail], error) {
+	if c.syncBeforeFetch > 0 {
+		if _, err := c.ensureFresh(context.Background(), c.syncBeforeFetch); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.RLock()
+	items := make([]DecryptedItem, 0, len(c.items))
+	for _, item := range c.items {
+		if !item.Deleted {
+			items = append(items, item)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID < items[j].ID
+	})
+	return func(yield func(string, SecretDetail) bool) {
+		for _, item := range items {
+			if !yield(item.ID, extractDetail(item)) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,112 @@
+package vaultwarden
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Extraction step sources. Built-in item fields are named as for ?field=.
+const (
+	SourcePassword = "password"
+	SourceUsername = "username"
+	SourceNotes    = "notes"
+	SourceURI      = "uri"
+	SourceTotp     = "totp"
+	// SourceField is one custom field, named by ExtractionStep.Field.
+	SourceField = "field"
+	// SourcePreferredFields is the custom fields named by WithSecretFieldNames,
+	// in that order, Hidden fields before Text fields.
+	SourcePreferredFields = "fields"
+	// SourceAnyField is any non-empty custom field, Hidden first, then by name.
+	SourceAnyField = "any_field"
+)
+
+// ExtractionStep is one place GetSecret looks for a value.
+type ExtractionStep struct {
+	Source string
+	Field  string // custom field name, only for SourceField
+}
+
+func (s ExtractionStep) String() string {
+	if s.Source == SourceField {
+		return SourceField + ":" + s.Field
+	}
+	return s.Source
+}
+
+// DefaultExtractionOrder is the order GetSecret tries when none is configured:
+// password, the preferred custom fields, notes, then any other custom field.
+var DefaultExtractionOrder = []ExtractionStep{
+	{Source: SourcePassword},
+	{Source: SourcePreferredFields},
+	{Source: SourceNotes},
+	{Source: SourceAnyField},
+}
+
+// ParseExtractionOrder parses an EXTRACTION_ORDER value: a comma-separated list
+// of password, username, notes, uri, totp, fields, any_field and field:NAME,
+// e.g. "field:apikey,password,notes". An empty value returns
+// DefaultExtractionOrder.
+func ParseExtractionOrder(s string) ([]ExtractionStep, error) {
+	var order []ExtractionStep
+	for raw := range strings.SplitSeq(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if source, field, ok := strings.Cut(raw, ":"); ok {
+			field = strings.TrimSpace(field)
+			if !strings.EqualFold(strings.TrimSpace(source), SourceField) || field == "" {
+				return nil, fmt.Errorf("invalid extraction step %q (want field:NAME)", raw)
+			}
+			order = append(order, ExtractionStep{Source: SourceField, Field: field})
+			continue
+		}
+		switch source := strings.ToLower(raw); source {
+		case SourcePassword, SourceUsername, SourceNotes, SourceURI, SourceTotp, SourcePreferredFields, SourceAnyField:
+			order = append(order, ExtractionStep{Source: source})
+		default:
+			return nil, fmt.Errorf("unknown extraction step %q (want password, username, notes, uri, totp, fields, any_field or field:NAME)", raw)
+		}
+	}
+	if len(order) == 0 {
+		return DefaultExtractionOrder, nil
+	}
+	return order, nil
+}
+
+// WithExtractionOrder sets where GetSecret looks for a value, first hit wins.
+// An empty order keeps DefaultExtractionOrder. ?field= lookups are unaffected.
+func WithExtractionOrder(order []ExtractionStep) ClientOption {
+	return func(c *Client) {
+		if len(order) > 0 {
+			c.extractionOrder = order
+		}
+	}
+}
+
+// extractStep returns the value of one extraction step, or "" if item has
+// none. names are the preferred custom field names.
+func extractStep(item DecryptedItem, step ExtractionStep, names []string) string {
+	switch step.Source {
+	case SourcePreferredFields:
+		for _, fieldType := range []int{FieldTypeHidden, FieldTypeText} {
+			for _, name := range names {
+				if v, ok := item.Fields[name]; ok && v != "" && item.FieldTypes[name] == fieldType {
+					return v
+				}
+			}
+		}
+		return ""
+	case SourceAnyField:
+		if name, ok := firstField(item, func(string) bool { return true }); ok {
+			return item.Fields[name]
+		}
+		return ""
+	case SourceField:
+		return customField(item, step.Field)
+	default:
+		value, _ := extractField(item, step.Source)
+		return value
+	}
+}
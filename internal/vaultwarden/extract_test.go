@@ -0,0 +1,72 @@
+package vaultwarden
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractionOrder(t *testing.T) {
+	item := DecryptedItem{
+		Type:     CipherTypeLogin,
+		Username: "svc-user",
+		Password: "the-password",
+		Notes:    "some notes",
+		Fields:   map[string]string{"apikey": "the-api-key", "token": "the-token", "zeta": "last"},
+		FieldTypes: map[string]int{
+			"apikey": FieldTypeHidden,
+			"token":  FieldTypeText,
+			"zeta":   FieldTypeText,
+		},
+	}
+
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"", "the-password"},
+		{"field:apikey,password,notes", "the-api-key"},
+		{"field:APIKEY", "the-api-key"},
+		{"notes,password", "some notes"},
+		{"fields,password", "the-api-key"}, // preferred names, Hidden first
+		{"field:missing,username", "svc-user"},
+		{"uri,totp", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			order, err := ParseExtractionOrder(tt.order)
+			if err != nil {
+				t.Fatalf("ParseExtractionOrder: %v", err)
+			}
+			if got := extractSecret(item, order, DefaultSecretFieldNames); got != tt.want {
+				t.Errorf("extractSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("any_field", func(t *testing.T) {
+		noPreferred := item
+		noPreferred.Password = ""
+		noPreferred.Fields = map[string]string{"zeta": "last", "alpha": "first"}
+		order, _ := ParseExtractionOrder("password,any_field")
+		if got := extractSecret(noPreferred, order, DefaultSecretFieldNames); got != "first" {
+			t.Errorf("extractSecret() = %q, want the first field by name", got)
+		}
+	})
+}
+
+func TestParseExtractionOrder(t *testing.T) {
+	got, err := ParseExtractionOrder(" Field:Api Key , PASSWORD,,any_field ")
+	if err != nil {
+		t.Fatalf("ParseExtractionOrder: %v", err)
+	}
+	want := []ExtractionStep{{Source: SourceField, Field: "Api Key"}, {Source: SourcePassword}, {Source: SourceAnyField}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExtractionOrder = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"secret", "field:", "fields:apikey", "password,nope"} {
+		if _, err := ParseExtractionOrder(bad); err == nil {
+			t.Errorf("ParseExtractionOrder(%q) succeeded", bad)
+		}
+	}
+}
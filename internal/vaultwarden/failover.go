@@ -0,0 +1,114 @@
+package vaultwarden
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// WithFallbackURLs adds replicas of the Vaultwarden server, tried in order
+// after the primary URL when it cannot be reached or answers 5xx. The replicas
+// must share the primary's database and keys, as an HA deployment does, since
+// tokens issued by one are used on the others.
+func WithFallbackURLs(urls []string) ClientOption {
+	return func(c *Client) {
+		if c.api == nil {
+			return
+		}
+		for _, u := range urls {
+			c.api.fallbackURLs = append(c.api.fallbackURLs, strings.TrimSuffix(u, "/"))
+		}
+	}
+}
+
+// do sends req through the circuit breaker: while it is open the request
+// fails at once with ErrCircuitOpen, otherwise the outcome (an error or 5xx
+// counts as a failure) is recorded once every server has been tried.
+func (ac *APIClient) do(req *http.Request) (*http.Response, error) {
+	if err := ac.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := ac.send(req)
+	if req.Context().Err() != nil {
+		ac.breaker.release()
+	} else {
+		ac.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	}
+	return resp, err
+}
+
+// send sends req, which must be addressed to ac.baseURL, to the server currently
+// in use. When that server is unreachable or answers 5xx and fallback URLs are
+// configured, the request is repeated against the next one, and the first
+// server to answer otherwise is used from then on. 4xx answers (a real 404, a
+// rejected token) are returned as they are: another replica would say the same.
+// When every server fails, the last error or 5xx response is returned.
+func (ac *APIClient) send(req *http.Request) (*http.Response, error) {
+	if len(ac.fallbackURLs) == 0 {
+		return ac.httpClient.Do(req)
+	}
+
+	servers := append([]string{ac.baseURL}, ac.fallbackURLs...)
+	suffix, ok := strings.CutPrefix(req.URL.String(), ac.baseURL)
+	if !ok {
+		return ac.httpClient.Do(req)
+	}
+	start := int(ac.activeServer.Load())
+
+	var resp *http.Response
+	var err error
+	for i := range servers {
+		idx := (start + i) % len(servers)
+		attempt, aerr := retarget(req, servers[idx]+suffix, i > 0)
+		if aerr != nil {
+			return nil, aerr
+		}
+		resp, err = ac.httpClient.Do(attempt)
+		if req.Context().Err() != nil || (err == nil && resp.StatusCode < http.StatusInternalServerError) {
+			if err == nil && idx != start && ac.activeServer.CompareAndSwap(int32(start), int32(idx)) {
+				logger.Warn.Printf("Vaultwarden failover: now using %s", servers[idx])
+			}
+			return resp, err
+		}
+		if i == len(servers)-1 || (req.Body != nil && req.GetBody == nil) {
+			break // out of servers, or a body that cannot be sent again
+		}
+
+		logger.Warn.Printf("Vaultwarden server %s failed (%s), trying %s", servers[idx], describeFailure(resp, err), servers[(idx+1)%len(servers)])
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// retarget returns a copy of req addressed to target. The body is re-read
+// through GetBody when the original has already been sent.
+func retarget(req *http.Request, target string, replay bool) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parse server URL: %w", err)
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = ""
+	if replay && req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("replay request body: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// describeFailure summarizes why a server was skipped, for the log.
+func describeFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("HTTP %d", resp.StatusCode)
+}
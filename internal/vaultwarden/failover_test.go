@@ -0,0 +1,112 @@
+package vaultwarden
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	// statusServer answers every request with status, counting hits and
+	// recording the last request body.
+	statusServer := func(status *atomic.Int32, hits *atomic.Int32, body *atomic.Value) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			b, _ := io.ReadAll(r.Body)
+			body.Store(string(b))
+			code := int(status.Load())
+			w.WriteHeader(code)
+			if code == http.StatusOK {
+				_, _ = w.Write([]byte(`{"profile":{},"ciphers":[]}`))
+			}
+		}))
+	}
+	var status1, status2, hits1, hits2 atomic.Int32
+	var body1, body2 atomic.Value
+	primary := statusServer(&status1, &hits1, &body1)
+	defer primary.Close()
+	replica := statusServer(&status2, &hits2, &body2)
+	defer replica.Close()
+
+	newClient := func(fallbacks ...string) *APIClient {
+		ac := NewAPIClient(primary.URL, "user@example.com", "pw", "", "")
+		ac.fallbackURLs = fallbacks
+		ac.accessToken = "token"
+		ac.tokenExpiry = time.Now().Add(time.Hour)
+		ac.syncRetryAttempts = 1
+		return ac
+	}
+	reset := func(s1, s2 int32) {
+		status1.Store(s1)
+		status2.Store(s2)
+		hits1.Store(0)
+		hits2.Store(0)
+	}
+
+	t.Run("5xx fails over and sticks", func(t *testing.T) {
+		reset(http.StatusServiceUnavailable, http.StatusOK)
+		ac := newClient(replica.URL)
+		if _, _, err := ac.Sync(); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		if _, _, err := ac.Sync(); err != nil {
+			t.Fatalf("second Sync: %v", err)
+		}
+		if h1, h2 := hits1.Load(), hits2.Load(); h1 != 1 || h2 != 2 {
+			t.Errorf("hits = primary %d, replica %d; want 1 and 2 (replica kept after failover)", h1, h2)
+		}
+	})
+
+	t.Run("404 does not fail over", func(t *testing.T) {
+		reset(http.StatusNotFound, http.StatusOK)
+		if _, _, err := newClient(replica.URL).Sync(); err == nil {
+			t.Error("Sync succeeded, want the primary's 404")
+		}
+		if h2 := hits2.Load(); h2 != 0 {
+			t.Errorf("replica hit %d times, want 0", h2)
+		}
+	})
+
+	t.Run("unreachable primary", func(t *testing.T) {
+		reset(http.StatusOK, http.StatusOK)
+		ac := newClient(replica.URL)
+		ac.baseURL = "http://127.0.0.1:1"
+		if _, _, err := ac.Sync(); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		if h2 := hits2.Load(); h2 != 1 {
+			t.Errorf("replica hit %d times, want 1", h2)
+		}
+	})
+
+	t.Run("all servers down", func(t *testing.T) {
+		reset(http.StatusBadGateway, http.StatusServiceUnavailable)
+		if _, _, err := newClient(replica.URL).Sync(); err == nil {
+			t.Error("Sync succeeded with every server failing")
+		}
+		if h1, h2 := hits1.Load(), hits2.Load(); h1 != 1 || h2 != 1 {
+			t.Errorf("hits = primary %d, replica %d; want 1 each", h1, h2)
+		}
+	})
+
+	t.Run("request body is replayed", func(t *testing.T) {
+		reset(http.StatusInternalServerError, http.StatusOK)
+		ac := newClient(replica.URL)
+		req, err := http.NewRequest(http.MethodPost, primary.URL+"/identity/connect/token", strings.NewReader("grant_type=refresh_token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ac.do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		resp.Body.Close()
+		if got, _ := body2.Load().(string); got != "grant_type=refresh_token" {
+			t.Errorf("replica received body %q, want the original", got)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package vaultwarden
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// lookupResult is what lookupItemOnce returns, shared through c.flights.
+type lookupResult struct {
+	item  DecryptedItem
+	stale bool
+}
+
+// lookupKey identifies lookups that must resolve to the same item: the name as
+// requested, the scope filter and whether a stale fallback is acceptable.
+func lookupKey(name string, filter SecretFilter, allowStale bool) string {
+	maxAge := "-"
+	if filter.MaxAge != nil {
+		maxAge = filter.MaxAge.String()
+	}
+	return fmt.Sprintf("%q|%q|%q|%q|%q|%q|%s|%t", name,
+		filter.OrganizationID, filter.CollectionID, filter.FolderID,
+		strings.Join(filter.OrganizationIDs, ","), strings.Join(filter.CollectionIDs, ","),
+		maxAge, allowStale)
+}
+
+// lookupShared runs lookupItemOnce for name, or waits for the identical lookup
+// already running and shares its result, so a burst of misses for one name
+// costs one refresh. A waiter whose ctx ends stops waiting; when the shared
+// call failed only because the caller that started it went away, the others
+// run the lookup again rather than inheriting that cancellation.
+func (c *Client) lookupShared(ctx context.Context, name string, filter SecretFilter, allowStale bool) (DecryptedItem, bool, error) {
+	res, shared, err := c.share(ctx, lookupKey(name, filter, allowStale), func() (lookupResult, error) {
+		item, stale, err := c.lookupItemOnce(ctx, name, filter, allowStale)
+		return lookupResult{item: item, stale: stale}, err
+	})
+	if shared {
+		recordLookup(false, err) // served without a refresh of its own
+	}
+	return res.item, res.stale, err
+}
+
+// share runs fn through c.flights and reports whether the result came from
+// another caller's fn. A panic in fn fails every caller sharing it instead of
+// being re-raised by singleflight, where no recover middleware can catch it.
+func (c *Client) share(ctx context.Context, key string, fn func() (lookupResult, error)) (lookupResult, bool, error) {
+	for {
+		ran := false
+		ch := c.flights.DoChan(key, func() (v any, err error) {
+			ran = true
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("lookup panicked: %v", r)
+				}
+			}()
+			return fn()
+		})
+
+		select {
+		case r := <-ch:
+			res, _ := r.Val.(lookupResult)
+			if !ran && isContextErr(r.Err) && ctx.Err() == nil {
+				continue
+			}
+			return res, !ran, r.Err
+		case <-ctx.Done():
+			return lookupResult{}, false, ctx.Err()
+		}
+	}
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,61 @@
+package vaultwarden
+
+import "strings"
+
+// identityField returns the named field of an identity item: any IdentityDetail
+// field by its JSON name (firstName, email, phone, passportNumber, ...), or
+// fullName (first, middle and last name joined by spaces). Names are
+// case-insensitive. known is false for any other name, so the caller can fall
+// back to custom fields; a known but empty field returns "" and true.
+func identityField(id *IdentityDetail, name string) (value string, known bool) {
+	if id == nil {
+		id = &IdentityDetail{}
+	}
+	switch strings.ToLower(name) {
+	case "title":
+		return id.Title, true
+	case "firstname":
+		return id.FirstName, true
+	case "middlename":
+		return id.MiddleName, true
+	case "lastname":
+		return id.LastName, true
+	case "fullname":
+		var parts []string
+		for _, p := range []string{id.FirstName, id.MiddleName, id.LastName} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		return strings.Join(parts, " "), true
+	case "address1":
+		return id.Address1, true
+	case "address2":
+		return id.Address2, true
+	case "address3":
+		return id.Address3, true
+	case "city":
+		return id.City, true
+	case "state":
+		return id.State, true
+	case "postalcode":
+		return id.PostalCode, true
+	case "country":
+		return id.Country, true
+	case "company":
+		return id.Company, true
+	case "email":
+		return id.Email, true
+	case "phone":
+		return id.Phone, true
+	case "ssn":
+		return id.SSN, true
+	case "username":
+		return id.Username, true
+	case "passportnumber":
+		return id.PassportNumber, true
+	case "licensenumber":
+		return id.LicenseNumber, true
+	}
+	return "", false
+}
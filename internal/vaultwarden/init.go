@@ -9,11 +9,11 @@ import (
 
 // InitializeClient creates and initializes a fully authenticated vault client.
 // clientID and clientSecret are optional — if provided, API key login is used (bypasses 2FA).
-func InitializeClient(serverURL, email, password, clientID, clientSecret string, cacheTTL, syncInterval time.Duration) (*Client, error) {
+func InitializeClient(serverURL, email, password, clientID, clientSecret string, cacheTTL, syncInterval time.Duration, opts ...ClientOption) (*Client, error) {
 	logger.Info.Println("Initializing Vaultwarden native API client...")
 
 	api := NewAPIClient(serverURL, email, password, clientID, clientSecret)
-	client := NewClient(api, cacheTTL, syncInterval)
+	client := NewClient(api, cacheTTL, syncInterval, opts...)
 
 	// Authenticate and perform initial sync with retry.
 	maxRetries := 3
@@ -38,3 +38,36 @@ func InitializeClient(serverURL, email, password, clientID, clientSecret string,
 
 	return nil, fmt.Errorf("failed to initialize after %d attempts: %w", maxRetries, lastErr)
 }
+
+// Preload resolves names against the vault snapshot once, right after
+// initialization. Items are decrypted into memory on every sync, so there is
+// nothing left to fetch per name; what this adds is that a missing, trashed or
+// mistyped hot secret is reported in the startup log rather than on its first
+// request. Failures are logged and returned, never fatal.
+func (c *Client) Preload(names []string) map[string]error {
+	if len(names) == 0 {
+		return nil
+	}
+	values, errs := c.GetSecrets(names, SecretFilter{})
+	for _, name := range names {
+		if err, ok := errs[name]; ok {
+			logger.Warn.Printf("Preload: secret %q not resolved: %v", logger.Name(name), err)
+		}
+	}
+	logger.Info.Printf("Preloaded %d/%d secrets", len(values), len(names))
+	return errs
+}
+
+// SelfTest resolves name as GET /secret/:name would and fails unless it yields
+// a non-empty value. Unlike Preload it is meant to abort startup: it proves
+// that the URL, credentials and decryption keys all work end to end.
+func (c *Client) SelfTest(name string) error {
+	value, err := c.GetSecret(name, SecretFilter{})
+	if err != nil {
+		return fmt.Errorf("self-test secret %q: %w", logger.Name(name), err)
+	}
+	if value == "" {
+		return fmt.Errorf("self-test secret %q resolved to an empty value", logger.Name(name))
+	}
+	return nil
+}
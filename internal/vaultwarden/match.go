@@ -0,0 +1,98 @@
+package vaultwarden
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// NameMatch selects how a requested secret name is compared with item names.
+type NameMatch int
+
+const (
+	// NameMatchExact only accepts an item whose name equals the request
+	// exactly. This is the default, so a request never resolves to a different
+	// secret whose name merely contains it.
+	NameMatchExact NameMatch = iota
+	// NameMatchCaseInsensitive matches names ignoring case, then falls back to a
+	// case-insensitive partial match.
+	NameMatchCaseInsensitive
+	// NameMatchNormalized compares names after trimming, lower-casing and
+	// collapsing runs of whitespace, '-' and '_' into a single space, so
+	// "my-secret" finds "My  Secret". Falls back to a partial match on the
+	// normalized names.
+	NameMatchNormalized
+)
+
+// ParseNameMatch parses a NAME_MATCH value: exact, ci or normalized.
+func ParseNameMatch(s string) (NameMatch, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "exact":
+		return NameMatchExact, nil
+	case "ci":
+		return NameMatchCaseInsensitive, nil
+	case "normalized":
+		return NameMatchNormalized, nil
+	default:
+		return 0, fmt.Errorf("unknown name match mode %q (want exact, ci or normalized)", s)
+	}
+}
+
+func (m NameMatch) String() string {
+	switch m {
+	case NameMatchCaseInsensitive:
+		return "ci"
+	case NameMatchNormalized:
+		return "normalized"
+	default:
+		return "exact"
+	}
+}
+
+// normalizeName lower-cases s, trims it and collapses runs of whitespace, '-'
+// and '_' into a single space.
+func normalizeName(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == '_'
+	})
+	return strings.Join(fields, " ")
+}
+
+// matchName finds a full name match, then (except in exact mode) falls back to
+// a partial match, comparing names according to mode.
+func matchName(candidates []DecryptedItem, name string, mode NameMatch) (DecryptedItem, bool) {
+	if mode == NameMatchExact {
+		for _, item := range candidates {
+			if item.Name == name {
+				return item, true
+			}
+		}
+		return DecryptedItem{}, false
+	}
+
+	canon := strings.ToLower
+	if mode == NameMatchNormalized {
+		canon = normalizeName
+	}
+	key := canon(name)
+	if key == "" {
+		return DecryptedItem{}, false
+	}
+
+	// Case 1: Full match.
+	for _, item := range candidates {
+		if canon(item.Name) == key {
+			return item, true
+		}
+	}
+	// Case 2: Partial match
+	for _, item := range candidates {
+		if strings.Contains(canon(item.Name), key) {
+			logger.Debug.Printf("Partial match found for secret lookup")
+			return item, true
+		}
+	}
+	return DecryptedItem{}, false
+}
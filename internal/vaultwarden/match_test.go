@@ -0,0 +1,66 @@
+package vaultwarden
+
+import "testing"
+
+func TestParseNameMatch(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]NameMatch{
+		"":           NameMatchExact,
+		"ci":         NameMatchCaseInsensitive,
+		" EXACT ":    NameMatchExact,
+		"normalized": NameMatchNormalized,
+	} {
+		got, err := ParseNameMatch(in)
+		if err != nil || got != want {
+			t.Errorf("ParseNameMatch(%q) = (%v, %v), want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseNameMatch("fuzzy"); err == nil {
+		t.Error("ParseNameMatch(fuzzy): expected error")
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	t.Parallel()
+
+	items := []DecryptedItem{
+		{ID: "1", Name: "My  Secret"},
+		{ID: "2", Name: "db_password"},
+	}
+
+	tests := []struct {
+		name   string
+		mode   NameMatch
+		query  string
+		wantID string
+	}{
+		{"exact hit", NameMatchExact, "My  Secret", "1"},
+		{"exact is case-sensitive", NameMatchExact, "my  secret", ""},
+		{"exact has no partial match", NameMatchExact, "Secret", ""},
+		{"ci ignores case", NameMatchCaseInsensitive, "MY  SECRET", "1"},
+		{"ci keeps separators", NameMatchCaseInsensitive, "my-secret", ""},
+		{"ci partial", NameMatchCaseInsensitive, "password", "2"},
+		{"normalized dash", NameMatchNormalized, "my-secret", "1"},
+		{"normalized whitespace", NameMatchNormalized, "  my secret ", "1"},
+		{"normalized underscore", NameMatchNormalized, "DB-Password", "2"},
+		{"normalized partial", NameMatchNormalized, "secret", "1"},
+		{"normalized empty key", NameMatchNormalized, "--", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			item, ok := matchName(items, tt.query, tt.mode)
+			if tt.wantID == "" {
+				if ok {
+					t.Errorf("matchName(%q) = %q, want no match", tt.query, item.Name)
+				}
+				return
+			}
+			if !ok || item.ID != tt.wantID {
+				t.Errorf("matchName(%q) = (%q, %v), want item %s", tt.query, item.ID, ok, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package vaultwarden
+
+import (
+	"context"
+	"strings"
+)
+
+// GetNoteVars returns the KEY=value pairs of the secure note matched by name
+// (see ParseNoteVars). It returns ErrNotANote for any other item type.
+func (c *Client) GetNoteVars(name string, filter SecretFilter) ([]NoteVar, error) {
+	return c.GetNoteVarsContext(context.Background(), name, filter)
+}
+
+// GetNoteVarsContext is GetNoteVars bounded by ctx, as GetSecretContext.
+func (c *Client) GetNoteVarsContext(ctx context.Context, name string, filter SecretFilter) ([]NoteVar, error) {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type != CipherTypeSecureNote {
+		return nil, ErrNotANote
+	}
+	return ParseNoteVars(item.Notes), nil
+}
+
+// FormatDotenv renders vars as KEY=value lines that a POSIX shell can source.
+// Values containing anything beyond a conservative set of safe characters are
+// single-quoted, an embedded single quote closing the quotes, escaping it and
+// reopening them. Keys that are not valid shell variable names are left out.
+func FormatDotenv(vars []NoteVar) string {
+	var b strings.Builder
+	for _, v := range vars {
+		if !isShellName(v.Key) {
+			continue
+		}
+		b.WriteString(v.Key)
+		b.WriteByte('=')
+		if isShellSafe(v.Value) {
+			b.WriteString(v.Value)
+		} else {
+			b.WriteByte('\'')
+			b.WriteString(strings.ReplaceAll(v.Value, "'", `'\''`))
+			b.WriteByte('\'')
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// isShellName reports whether s is a valid shell variable name.
+func isShellName(s string) bool {
+	for i, r := range s {
+		if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && (i == 0 || !(r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isShellSafe reports whether s can appear unquoted in a shell assignment.
+func isShellSafe(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("_-.,:/@%+=", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NoteVar is one KEY=value pair parsed from a secure note.
+type NoteVar struct {
+	Key   string
+	Value string
+}
+
+// ParseNoteVars parses a note body written like an .env file: one KEY=value
+// pair per line, with blank lines and lines starting with # ignored. An
+// optional "export " prefix is dropped. Values may be double-quoted (with \n,
+// \", \\ escapes) or single-quoted (taken literally); unquoted values end at
+// " #". Lines without '=' are skipped. When a key repeats, the last value wins
+// but the key keeps its first position.
+func ParseNoteVars(notes string) []NoteVar {
+	var vars []NoteVar
+	index := make(map[string]int)
+
+	for line := range strings.Lines(notes) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		value = parseNoteValue(strings.TrimSpace(value))
+
+		if i, seen := index[key]; seen {
+			vars[i].Value = value
+			continue
+		}
+		index[key] = len(vars)
+		vars = append(vars, NoteVar{Key: key, Value: value})
+	}
+	return vars
+}
+
+// parseNoteValue unquotes a trimmed value from a KEY=value line.
+func parseNoteValue(v string) string {
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return v[1 : len(v)-1]
+	}
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		var b strings.Builder
+		inner := v[1 : len(v)-1]
+		for i := 0; i < len(inner); i++ {
+			if inner[i] != '\\' || i == len(inner)-1 {
+				b.WriteByte(inner[i])
+				continue
+			}
+			i++
+			switch inner[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default: // \" \\ and anything else: the character itself
+				b.WriteByte(inner[i])
+			}
+		}
+		return b.String()
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v
+}
+
+// noteVar looks up key among the KEY=value pairs of a note, exactly first and
+// then case-insensitively.
+func noteVar(notes, key string) (string, bool) {
+	vars := ParseNoteVars(notes)
+	for _, v := range vars {
+		if v.Key == key {
+			return v.Value, true
+		}
+	}
+	for _, v := range vars {
+		if strings.EqualFold(v.Key, key) {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
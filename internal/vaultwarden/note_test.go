@@ -0,0 +1,51 @@
+package vaultwarden
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNoteVars(t *testing.T) {
+	t.Parallel()
+
+	notes := `# Production database
+DB_HOST=db.internal
+export DB_USER = app
+
+DB_PASS="s3cr\"et\nline"
+GREETING='hello #not a comment'
+PORT=5432 # default port
+not a pair
+=no key
+DB_HOST=db2.internal
+EMPTY=
+`
+	want := []NoteVar{
+		{"DB_HOST", "db2.internal"},
+		{"DB_USER", "app"},
+		{"DB_PASS", "s3cr\"et\nline"},
+		{"GREETING", "hello #not a comment"},
+		{"PORT", "5432"},
+		{"EMPTY", ""},
+	}
+	if got := ParseNoteVars(notes); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNoteVars =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFormatDotenv(t *testing.T) {
+	t.Parallel()
+
+	vars := []NoteVar{
+		{"HOST", "db.internal:5432"},
+		{"PASS", "it's a secret"},
+		{"EMPTY", ""},
+		{"CMD", "$(id)"},
+		{"bad-key", "x"},
+		{"1ST", "x"},
+	}
+	want := "HOST=db.internal:5432\nPASS='it'\\''s a secret'\nEMPTY=\nCMD='$(id)'\n"
+	if got := FormatDotenv(vars); got != want {
+		t.Errorf("FormatDotenv =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package vaultwarden
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+)
+
+// WithStaleIfError lets GetSecretResult serve a value from a snapshot that is
+// older than its freshness requirement (SYNC_BEFORE_FETCH_MAX_AGE, a per-secret
+// TTL or X-Cache-TTL) when the sync to refresh it fails because Vaultwarden is
+// unavailable, as long as the snapshot is at most grace past that requirement.
+// Authentication failures are never papered over. Zero disables it.
+func WithStaleIfError(grace time.Duration) ClientOption {
+	return func(c *Client) {
+		c.staleIfError = grace
+	}
+}
+
+// SecretResult is a looked-up value and whether it was served stale.
+type SecretResult struct {
+	Value string
+	// Stale is set when the required sync failed and the value came from an
+	// older snapshot under WithStaleIfError.
+	Stale bool
+}
+
+// GetSecretResult looks up name, or one field of it when field is set, like
+// GetSecretContext and GetSecretFieldContext. Unlike them it may fall back to
+// a stale snapshot when Vaultwarden is down (see WithStaleIfError), and
+// reports when it did.
+func (c *Client) GetSecretResult(ctx context.Context, name, field string, filter SecretFilter) (SecretResult, error) {
+	item, stale, err := c.lookupItem(ctx, name, filter, true)
+	if err != nil {
+		return SecretResult{}, err
+	}
+	if field == "" {
+		return SecretResult{Value: extractSecret(item, c.extractionOrder, c.secretFieldNames), Stale: stale}, nil
+	}
+	value, ok := extractField(item, field)
+	if !ok {
+		metrics.LookupErrors.WithLabelValues("field_not_found").Inc()
+		return SecretResult{}, ErrFieldNotFound
+	}
+	return SecretResult{Value: value, Stale: stale}, nil
+}
+
+// withinStaleGrace reports whether a failed refresh for name may be answered
+// from the current snapshot: Vaultwarden was unavailable (not a rejected
+// login), a snapshot exists, and it is no more than the grace past the
+// maximum age the lookup required.
+func (c *Client) withinStaleGrace(syncErr error, name string, filter SecretFilter) bool {
+	if c.staleIfError <= 0 || !errors.Is(syncErr, ErrUpstreamUnavailable) {
+		return false
+	}
+	c.mu.RLock()
+	lastSync := c.lastSync
+	c.mu.RUnlock()
+	if lastSync.IsZero() {
+		return false
+	}
+	maxAge, _ := c.maxAgeFor(name, filter)
+	return time.Since(lastSync) <= maxAge+c.staleIfError
+}
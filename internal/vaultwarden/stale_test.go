@@ -0,0 +1,75 @@
+package vaultwarden
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetSecretResult_staleIfError(t *testing.T) {
+	var hits atomic.Int32
+	var down atomic.Int32 // HTTP status served while down, 0 when up
+	serve := testSyncHandler(t, "db-password", "s3cret", &hits)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := int(down.Load()); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		serve(w, r)
+	}))
+	defer srv.Close()
+
+	newClient := func(grace time.Duration) *Client {
+		down.Store(0)
+		c := NewClient(newTestAPIClient(t, srv), 0, 0,
+			WithTTLOverrides(map[string]time.Duration{"db-password": 0}),
+			WithSyncRetry(1, 0),
+			WithStaleIfError(grace))
+		// Populate the snapshot with one successful sync.
+		if res, err := c.GetSecretResult(t.Context(), "db-password", "", SecretFilter{}); err != nil || res.Stale {
+			t.Fatalf("first lookup = (%+v, %v), want a fresh value", res, err)
+		}
+		return c
+	}
+
+	t.Run("serves stale within grace", func(t *testing.T) {
+		c := newClient(time.Hour)
+		down.Store(http.StatusServiceUnavailable)
+		res, err := c.GetSecretResult(t.Context(), "db-password", "", SecretFilter{})
+		if err != nil || res.Value != "s3cret" || !res.Stale {
+			t.Errorf("GetSecretResult = (%+v, %v), want stale s3cret", res, err)
+		}
+		// The strict lookups still fail.
+		if _, err := c.GetSecret("db-password", SecretFilter{}); !errors.Is(err, ErrUpstreamUnavailable) {
+			t.Errorf("GetSecret err = %v, want ErrUpstreamUnavailable", err)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		c := newClient(0)
+		down.Store(http.StatusServiceUnavailable)
+		if _, err := c.GetSecretResult(t.Context(), "db-password", "", SecretFilter{}); !errors.Is(err, ErrUpstreamUnavailable) {
+			t.Errorf("err = %v, want ErrUpstreamUnavailable", err)
+		}
+	})
+
+	t.Run("past grace", func(t *testing.T) {
+		c := newClient(time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		down.Store(http.StatusServiceUnavailable)
+		if _, err := c.GetSecretResult(t.Context(), "db-password", "", SecretFilter{}); !errors.Is(err, ErrUpstreamUnavailable) {
+			t.Errorf("err = %v, want ErrUpstreamUnavailable", err)
+		}
+	})
+
+	t.Run("auth failure is not masked", func(t *testing.T) {
+		c := newClient(time.Hour)
+		down.Store(http.StatusForbidden)
+		if _, err := c.GetSecretResult(t.Context(), "db-password", "", SecretFilter{}); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("err = %v, want ErrAuthFailed", err)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package vaultwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrTooManyItems means a sync returned more ciphers than WithMaxVaultItems
+// allows. The sync fails and the previous snapshot is kept.
+var ErrTooManyItems = errors.New("vault exceeds the item limit")
+
+// WithMaxVaultItems makes a sync fail with ErrTooManyItems, before the rest of
+// the response is read, once the vault returns more than limit ciphers. Zero
+// means no limit.
+func WithMaxVaultItems(limit int) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.maxItems = max(limit, 0)
+		}
+	}
+}
+
+// decodeSyncResponse reads a /api/sync response one cipher at a time instead
+// of buffering the whole body first, so the raw JSON of a large vault is never
+// held in memory next to its decoded form. Keys are matched case-insensitively,
+// as encoding/json does, since older Vaultwarden releases used PascalCase.
+// Members other than profile, ciphers, collections and folders are skipped.
+func decodeSyncResponse(r io.Reader, maxItems int) (SyncResponse, error) {
+	var resp SyncResponse
+	dec := json.NewDecoder(r)
+
+	if tok, err := dec.Token(); err != nil {
+		return resp, err
+	} else if tok != json.Delim('{') {
+		return resp, fmt.Errorf("expected an object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return resp, err
+		}
+		key, _ := tok.(string)
+		switch {
+		case strings.EqualFold(key, "ciphers"):
+			resp.Ciphers, err = decodeCiphers(dec, maxItems)
+		case strings.EqualFold(key, "profile"):
+			err = dec.Decode(&resp.Profile)
+		case strings.EqualFold(key, "collections"):
+			err = dec.Decode(&resp.Collections)
+		case strings.EqualFold(key, "folders"):
+			err = dec.Decode(&resp.Folders)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return resp, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	_, err := dec.Token() // closing '}'
+	return resp, err
+}
+
+// decodeCiphers decodes the ciphers array (or null) element by element,
+// stopping with ErrTooManyItems as soon as it holds more than maxItems.
+func decodeCiphers(dec *json.Decoder, maxItems int) ([]SyncCipher, error) {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array, got %v", tok)
+	}
+
+	var ciphers []SyncCipher
+	for dec.More() {
+		if maxItems > 0 && len(ciphers) == maxItems {
+			return nil, fmt.Errorf("%w (more than %d items)", ErrTooManyItems, maxItems)
+		}
+		var c SyncCipher
+		if err := dec.Decode(&c); err != nil {
+			return nil, err
+		}
+		ciphers = append(ciphers, c)
+	}
+	_, err = dec.Token() // closing ']'
+	return ciphers, err
+}
@@ -0,0 +1,117 @@
+package vaultwarden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// syntheticSync returns a /api/sync body with n login ciphers, the members
+// Vaultwarden sends that the decoder skips, and profile after ciphers, as
+// Vaultwarden orders them.
+func syntheticSync(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"ciphers":[`)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id":"cipher-%d","type":1,"organizationId":null,"collectionIds":[],"name":"2.bmFtZQ==|Y2lwaGVydGV4dC0lZA==|bWFj","notes":null,`+
+			`"login":{"username":"2.dXNlcg==|dXNlcm5hbWU=|bWFj","password":"2.cGFzcw==|cGFzc3dvcmQ=|bWFj","uris":[{"uri":"2.dXJp|aHR0cHM6Ly9leGFtcGxlLmNvbQ==|bWFj","match":null}]},`+
+			`"fields":[{"name":"2.Zg==|aG9zdA==|bWFj","value":"2.dg==|ZGIuaW50ZXJuYWw=|bWFj","type":0}],"deletedDate":null,"revisionDate":"2025-01-01T00:00:00Z"}`, i)
+	}
+	b.WriteString(`],"collections":[{"id":"col-1","organizationId":"org-1","name":"2.Yw==|Yw==|bWFj"}],`)
+	b.WriteString(`"domains":{"equivalentDomains":[["example.com","example.org"]]},"folders":[],"object":"sync","policies":[],`)
+	b.WriteString(`"profile":{"id":"user-1","email":"user@example.com","key":"2.a2V5|a2V5|bWFj","organizations":[]},"sends":[]}`)
+	return b.Bytes()
+}
+
+func TestDecodeSyncResponse(t *testing.T) {
+	t.Run("matches encoding/json", func(t *testing.T) {
+		for _, body := range [][]byte{
+			syntheticSync(3),
+			[]byte(`{"Profile":{"Key":"k"},"Ciphers":[{"Id":"a","Name":"n"}],"Folders":[{"Id":"f"}]}`),
+			[]byte(`{"profile":{},"ciphers":null}`),
+		} {
+			var want SyncResponse
+			if err := json.Unmarshal(body, &want); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			got, err := decodeSyncResponse(bytes.NewReader(body), 0)
+			if err != nil {
+				t.Fatalf("decodeSyncResponse: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeSyncResponse(%.60s...) = %+v, want %+v", body, got, want)
+			}
+		}
+	})
+
+	t.Run("stops at the item limit", func(t *testing.T) {
+		body := syntheticSync(1000)
+		r := &countingReader{r: bytes.NewReader(body)}
+		_, err := decodeSyncResponse(r, 10)
+		if !errors.Is(err, ErrTooManyItems) {
+			t.Fatalf("err = %v, want ErrTooManyItems", err)
+		}
+		if r.n >= len(body)/2 {
+			t.Errorf("read %d of %d bytes before giving up", r.n, len(body))
+		}
+	})
+
+	t.Run("at the limit", func(t *testing.T) {
+		got, err := decodeSyncResponse(bytes.NewReader(syntheticSync(10)), 10)
+		if err != nil || len(got.Ciphers) != 10 {
+			t.Errorf("got %d ciphers, err %v; want 10, nil", len(got.Ciphers), err)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, body := range []string{``, `[]`, `{"ciphers":{}}`, `{"ciphers":[{"id":1}]}`, `{"profile":{}`} {
+			if _, err := decodeSyncResponse(strings.NewReader(body), 0); err == nil {
+				t.Errorf("decodeSyncResponse(%q) succeeded", body)
+			}
+		}
+	})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// BenchmarkDecodeSyncResponse compares the streaming decoder with decoding the
+// whole body through json.Decoder, as sync did before, on a 20000-item vault.
+func BenchmarkDecodeSyncResponse(b *testing.B) {
+	body := syntheticSync(20000)
+	b.Run("json.Decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for b.Loop() {
+			var resp SyncResponse
+			if err := json.NewDecoder(bytes.NewReader(body)).Decode(&resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for b.Loop() {
+			if _, err := decodeSyncResponse(bytes.NewReader(body), 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
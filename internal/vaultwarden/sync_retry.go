@@ -0,0 +1,74 @@
+package vaultwarden
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// Vault sync retry defaults: three attempts, waiting 500ms then 1s.
+const (
+	DefaultSyncRetryAttempts  = 3
+	DefaultSyncRetryBaseDelay = 500 * time.Millisecond
+)
+
+// WithSyncRetry sets how often the vault sync request is tried when the server
+// is unreachable or answers 5xx, and the delay before the first retry; each
+// further retry waits twice as long.
+func WithSyncRetry(attempts int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.syncRetryAttempts = max(attempts, 1)
+			c.api.syncRetryBaseDelay = baseDelay
+		}
+	}
+}
+
+// getSync GETs /api/sync with the given token. Network errors and 5xx
+// responses are retried with exponential backoff; any other status (notably
+// 401/403/404) is returned at once, so the caller can refresh the token or
+// report it. The last response is returned as-is and the caller must close its
+// body.
+//
+// Retries never outlive ctx: a retry whose backoff would end past the
+// deadline is not attempted, and the last error is returned instead.
+func (ac *APIClient) getSync(ctx context.Context, token string) (*http.Response, error) {
+	attempts := max(ac.syncRetryAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ac.baseURL+"/api/sync", nil)
+		if err != nil {
+			return nil, fmt.Errorf("create sync request: %w", err)
+		}
+		ac.authorize(req, token)
+
+		resp, err := ac.do(req)
+		if attempt == attempts || ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) || (err == nil && resp.StatusCode < http.StatusInternalServerError) {
+			return resp, err
+		}
+
+		delay := ac.syncRetryBaseDelay << (attempt - 1)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		logger.Warn.Printf("Sync request failed (attempt %d/%d), retrying in %v: %v", attempt, attempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("sync request: %w (last error: %v)", ctx.Err(), err)
+		}
+	}
+}
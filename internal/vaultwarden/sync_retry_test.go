@@ -0,0 +1,93 @@
+package vaultwarden
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSyncRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // served in order; the last one repeats
+		wantErr  error
+		wantHits int32
+	}{
+		{"recovers after two failures", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, nil, 3},
+		{"gives up after attempts", []int{http.StatusInternalServerError}, ErrUpstreamUnavailable, 3},
+		{"forbidden not retried", []int{http.StatusForbidden}, ErrAuthFailed, 1},
+		{"not found not retried", []int{http.StatusNotFound}, ErrUpstreamUnavailable, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(hits.Add(1))
+				status := tt.statuses[min(n, len(tt.statuses))-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write([]byte(`{"profile":{},"ciphers":[]}`))
+				}
+			}))
+			defer srv.Close()
+
+			ac := NewAPIClient(srv.URL, "user@example.com", "pw", "", "")
+			ac.accessToken = "token"
+			ac.tokenExpiry = time.Now().Add(time.Hour)
+			ac.syncRetryBaseDelay = 0
+
+			_, _, err := ac.Sync()
+			if (err == nil) != (tt.wantErr == nil) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("sync endpoint hit %d times, want %d", got, tt.wantHits)
+			}
+		})
+	}
+
+	t.Run("stops at context deadline", func(t *testing.T) {
+		var hits atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		ac := NewAPIClient(srv.URL, "user@example.com", "pw", "", "")
+		ac.accessToken = "token"
+		ac.tokenExpiry = time.Now().Add(time.Hour)
+		ac.syncRetryBaseDelay = time.Second
+
+		ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, _, err := ac.SyncContext(ctx); err == nil {
+			t.Fatal("SyncContext succeeded against a failing server")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("SyncContext took %v, past the 200ms deadline", elapsed)
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("sync endpoint hit %d times, want 1 (backoff exceeds the deadline)", got)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ac := NewAPIClient("http://127.0.0.1:1", "user@example.com", "pw", "", "")
+		ac.accessToken = "token"
+		ac.tokenExpiry = time.Now().Add(time.Hour)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if _, _, err := ac.SyncContext(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	})
+}
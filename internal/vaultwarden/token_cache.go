@@ -0,0 +1,119 @@
+package vaultwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// tokenCache is the on-disk form of a persisted access token. Only the access
+// token and its expiry are stored, never the password, client secret or
+// refresh token; server and email tie the file to one account.
+type tokenCache struct {
+	Server      string    `json:"server"`
+	Email       string    `json:"email"`
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// WithTokenCacheFile persists the access token to path (mode 0600) and reuses
+// it on startup while it is still valid, so restarts do not hit the token
+// endpoint.
+func WithTokenCacheFile(path string) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.tokenCacheFile = path
+		}
+	}
+}
+
+// loadCachedToken adopts the persisted access token if it belongs to this
+// account and is not about to expire. It reports whether a token was loaded.
+func (ac *APIClient) loadCachedToken() bool {
+	if ac.tokenCacheFile == "" {
+		return false
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	data, err := os.ReadFile(ac.tokenCacheFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warn.Printf("Ignoring token cache file: %v", err)
+		}
+		return false
+	}
+
+	var cached tokenCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		logger.Warn.Printf("Ignoring malformed token cache file: %v", err)
+		return false
+	}
+	if cached.Server != ac.baseURL || !strings.EqualFold(cached.Email, ac.email) || cached.AccessToken == "" {
+		logger.Info.Println("Token cache file belongs to another account, ignoring it")
+		return false
+	}
+	if time.Until(cached.ExpiresAt) <= tokenRefreshMargin {
+		logger.Debug.Println("Cached access token expired, logging in")
+		return false
+	}
+
+	ac.accessToken = cached.AccessToken
+	ac.tokenExpiry = cached.ExpiresAt
+	ac.tokenSetAt = time.Now()
+	return true
+}
+
+// saveTokenLocked persists the current access token. The caller must hold ac.mu.
+// Failures are logged; the token cache is an optimization only.
+func (ac *APIClient) saveTokenLocked() {
+	if ac.tokenCacheFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(tokenCache{
+		Server:      ac.baseURL,
+		Email:       ac.email,
+		AccessToken: ac.accessToken,
+		ExpiresAt:   ac.tokenExpiry,
+	})
+	if err == nil {
+		err = writeFileAtomic(ac.tokenCacheFile, data, 0o600)
+	}
+	if err != nil {
+		logger.Warn.Printf("Failed to write token cache file: %v", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package vaultwarden
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	ac := NewAPIClient("https://vault.example.com", "user@example.com", "pw", "id", "client-secret")
+	ac.tokenCacheFile = path
+	ac.setToken(&TokenResponse{AccessToken: "cached-token", RefreshToken: "refresh", ExpiresIn: 3600})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("token cache not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token cache mode = %o, want 600", perm)
+	}
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"pw", "client-secret", "refresh"} {
+		if strings.Contains(string(data), `"`+secret+`"`) {
+			t.Errorf("token cache contains %q: %s", secret, data)
+		}
+	}
+
+	t.Run("reused by the same account", func(t *testing.T) {
+		next := NewAPIClient("https://vault.example.com", "USER@example.com", "pw", "", "")
+		next.tokenCacheFile = path
+		if !next.loadCachedToken() || next.accessToken != "cached-token" {
+			t.Errorf("loadCachedToken = %q, want cached-token", next.accessToken)
+		}
+	})
+
+	t.Run("ignored for another account", func(t *testing.T) {
+		other := NewAPIClient("https://vault.example.com", "other@example.com", "pw", "", "")
+		other.tokenCacheFile = path
+		if other.loadCachedToken() {
+			t.Error("token of another account must not be loaded")
+		}
+	})
+
+	t.Run("ignored once expired", func(t *testing.T) {
+		ac.mu.Lock()
+		ac.tokenExpiry = time.Now().Add(tokenRefreshMargin / 2)
+		ac.saveTokenLocked()
+		ac.mu.Unlock()
+
+		next := NewAPIClient("https://vault.example.com", "user@example.com", "pw", "", "")
+		next.tokenCacheFile = path
+		if next.loadCachedToken() {
+			t.Error("expired token must not be loaded")
+		}
+	})
+}
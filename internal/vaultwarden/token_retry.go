@@ -0,0 +1,65 @@
+package vaultwarden
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// Token endpoint retry defaults: three attempts, waiting 500ms then 1s.
+const (
+	DefaultTokenRetryAttempts  = 3
+	DefaultTokenRetryBaseDelay = 500 * time.Millisecond
+)
+
+// WithTokenRetry sets how often a token request (login or refresh) is tried
+// when the server is unreachable or answers 5xx, and the delay before the first
+// retry; each further retry waits twice as long.
+func WithTokenRetry(attempts int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.tokenRetryAttempts = max(attempts, 1)
+			c.api.tokenRetryBaseDelay = baseDelay
+		}
+	}
+}
+
+// postToken POSTs data to the token endpoint. Network errors and 5xx
+// responses (typically a reverse proxy in front of a restarting server) are
+// retried with exponential backoff; any other status, notably 400/401 for bad
+// credentials, is returned at once. The last response is returned as-is, so
+// the caller reports its status and must close its body.
+//
+// No lock is held here: the caller reads what it needs from ac beforehand, so
+// concurrent callers are never blocked behind the backoff.
+func (ac *APIClient) postToken(data url.Values) (*http.Response, error) {
+	attempts := max(ac.tokenRetryAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, ac.baseURL+"/identity/connect/token", strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("create token request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := ac.do(req)
+		if attempt == attempts || errors.Is(err, ErrCircuitOpen) || (err == nil && resp.StatusCode < http.StatusInternalServerError) {
+			return resp, err
+		}
+
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		delay := ac.tokenRetryBaseDelay << (attempt - 1)
+		logger.Warn.Printf("Token request failed (attempt %d/%d), retrying in %v: %v", attempt, attempts, delay, err)
+		time.Sleep(delay)
+	}
+}
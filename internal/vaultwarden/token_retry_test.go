@@ -0,0 +1,48 @@
+package vaultwarden
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPostTokenRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // served in order; the last one repeats
+		wantErr  bool
+		wantHits int32
+	}{
+		{"recovers after 502", []int{http.StatusBadGateway, http.StatusOK}, false, 2},
+		{"gives up after attempts", []int{http.StatusServiceUnavailable}, true, 3},
+		{"bad credentials not retried", []int{http.StatusBadRequest}, true, 1},
+		{"unauthorized not retried", []int{http.StatusUnauthorized}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(hits.Add(1))
+				status := tt.statuses[min(n, len(tt.statuses))-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write([]byte(`{"access_token":"t","expires_in":3600}`))
+				}
+			}))
+			defer srv.Close()
+
+			ac := NewAPIClient(srv.URL, "user@example.com", "pw", "", "")
+			ac.tokenRetryBaseDelay = 0
+
+			_, err := ac.loginWithPassword("hash")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("token endpoint hit %d times, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package vaultwarden
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrTransformFailed means a transform could not be applied to a value (for
+// example base64decode on a value that is not base64). Its messages never
+// include the value.
+var ErrTransformFailed = errors.New("transform failed")
+
+// Transform post-processes an extracted secret value.
+type Transform func(value string) (string, error)
+
+// maxTransforms caps the steps of one transform chain.
+const maxTransforms = 5
+
+// transforms maps a transform name to a constructor taking the part after
+// "name:" ("" when there is none).
+var transforms = map[string]func(arg string) (Transform, error){
+	"base64decode": noArg("base64decode", base64Decode),
+	"trim":         noArg("trim", func(v string) (string, error) { return strings.TrimSpace(v), nil }),
+	"jsonfield":    jsonField,
+}
+
+// ParseTransform parses a ?transform= value: a comma-separated chain of
+// base64decode, trim and jsonfield:PATH, applied left to right. PATH is a
+// dot-separated list of object keys and array indexes, e.g. "db.hosts.0".
+func ParseTransform(spec string) (Transform, error) {
+	var steps []Transform
+	for raw := range strings.SplitSeq(spec, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(raw, ":")
+		newTransform, ok := transforms[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q (use base64decode, trim or jsonfield:PATH)", name)
+		}
+		step, err := newTransform(arg)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("transform is empty")
+	}
+	if len(steps) > maxTransforms {
+		return nil, fmt.Errorf("too many transforms (max %d)", maxTransforms)
+	}
+	return func(value string) (string, error) {
+		var err error
+		for _, step := range steps {
+			if value, err = step(value); err != nil {
+				return "", err
+			}
+		}
+		return value, nil
+	}, nil
+}
+
+// noArg adapts a transform that takes no argument.
+func noArg(name string, t Transform) func(string) (Transform, error) {
+	return func(arg string) (Transform, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("transform %s takes no argument", name)
+		}
+		return t, nil
+	}
+}
+
+// base64Decode accepts standard and URL-safe base64, padded or not. The result
+// must be text, since values are returned as JSON strings.
+func base64Decode(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(value); err == nil {
+			if !utf8.Valid(decoded) {
+				return "", fmt.Errorf("%w: base64decode: decoded value is not text", ErrTransformFailed)
+			}
+			return string(decoded), nil
+		}
+	}
+	return "", fmt.Errorf("%w: base64decode: value is not base64", ErrTransformFailed)
+}
+
+// jsonField returns a transform extracting path from a JSON value. Strings are
+// returned as-is, other values (numbers, objects, ...) as compact JSON.
+func jsonField(path string) (Transform, error) {
+	if path == "" {
+		return nil, errors.New("transform jsonfield needs a path (jsonfield:PATH)")
+	}
+	keys := strings.Split(path, ".")
+	if slices.Contains(keys, "") {
+		return nil, fmt.Errorf("invalid jsonfield path %q", path)
+	}
+
+	return func(value string) (string, error) {
+		// UseNumber keeps large integers exact instead of rounding them to float64.
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var node any
+		if err := dec.Decode(&node); err != nil || dec.Decode(new(any)) != io.EOF {
+			return "", fmt.Errorf("%w: jsonfield: value is not JSON", ErrTransformFailed)
+		}
+		for _, key := range keys {
+			switch n := node.(type) {
+			case map[string]any:
+				v, ok := n[key]
+				if !ok {
+					return "", fmt.Errorf("%w: jsonfield: %q not found", ErrTransformFailed, path)
+				}
+				node = v
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(n) {
+					return "", fmt.Errorf("%w: jsonfield: %q not found", ErrTransformFailed, path)
+				}
+				node = n[i]
+			default:
+				return "", fmt.Errorf("%w: jsonfield: %q not found", ErrTransformFailed, path)
+			}
+		}
+		if s, ok := node.(string); ok {
+			return s, nil
+		}
+		out, err := json.Marshal(node)
+		if err != nil {
+			return "", fmt.Errorf("%w: jsonfield: %v", ErrTransformFailed, err)
+		}
+		return string(out), nil
+	}, nil
+}
@@ -0,0 +1,56 @@
+package vaultwarden
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		spec    string
+		value   string
+		want    string
+		wantErr bool // transform failed (ErrTransformFailed)
+	}{
+		{"trim", "  padded\n", "padded", false},
+		{"base64decode", "aGVsbG8=", "hello", false},
+		{"base64decode", "aGVsbG8", "hello", false},
+		{"base64decode", "not base64!", "", true},
+		{"base64decode", "//79", "", true}, // decodes to invalid UTF-8
+		{"trim,base64decode", " aGVsbG8= ", "hello", false},
+		{"jsonfield:db.host", `{"db":{"host":"db.internal","port":5432}}`, "db.internal", false},
+		{"jsonfield:db.port", `{"db":{"host":"db.internal","port":5432}}`, "5432", false},
+		{"jsonfield:db", `{"db":{"port":5432}}`, `{"port":5432}`, false},
+		{"jsonfield:keys.1", `{"keys":["a","b"]}`, "b", false},
+		{"jsonfield:id", `{"id":12345678901234567890}`, "12345678901234567890", false},
+		{"jsonfield:keys.2", `{"keys":["a","b"]}`, "", true},
+		{"jsonfield:db.user", `{"db":{}}`, "", true},
+		{"jsonfield:db", `not json`, "", true},
+		{"jsonfield:db", `{"db":1} {"db":2}`, "", true},
+		{"base64decode,jsonfield:token", "eyJ0b2tlbiI6InQxIn0=", "t1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			transform, err := ParseTransform(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseTransform: %v", err)
+			}
+			got, err := transform(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTransformFailed) {
+					t.Errorf("err = %v, want ErrTransformFailed", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", " , ", "rot13", "trim:x", "jsonfield", "jsonfield:a..b", "trim,trim,trim,trim,trim,trim"} {
+		if _, err := ParseTransform(spec); err == nil {
+			t.Errorf("ParseTransform(%q) succeeded, want an error", spec)
+		}
+	}
+}
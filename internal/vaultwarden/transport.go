@@ -0,0 +1,150 @@
+package vaultwarden
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+)
+
+// HTTPConfig tunes the HTTP client used to talk to Vaultwarden.
+type HTTPConfig struct {
+	// Timeout bounds a whole request, including reading the response body.
+	Timeout time.Duration
+	// MaxIdleConns is the size of the keep-alive pool. All requests go to one
+	// host, so it also caps idle connections per host.
+	MaxIdleConns int
+	// IdleConnTimeout closes pooled connections that have been idle this long.
+	IdleConnTimeout time.Duration
+	// CertPins are base64 SHA-256 hashes of a certificate's public key (SPKI).
+	// When set, a TLS connection is only accepted if a certificate the server
+	// presents matches one of them, on top of the usual chain verification.
+	CertPins []string
+	// InsecureSkipVerify disables certificate chain and hostname verification
+	// (development against a self-signed server only). Pins are still checked.
+	InsecureSkipVerify bool
+	// ClientCert is presented to servers (or proxies in front of them) that
+	// require mutual TLS. Nil sends no client certificate.
+	ClientCert *tls.Certificate
+}
+
+// DefaultHTTPConfig returns the settings used when nothing is configured: a 30s
+// timeout and the pool settings of http.DefaultTransport.
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		Timeout:         30 * time.Second,
+		MaxIdleConns:    100,
+		IdleConnTimeout: 90 * time.Second,
+	}
+}
+
+// WithHTTPConfig replaces the HTTP client of the underlying API client.
+func WithHTTPConfig(cfg HTTPConfig) ClientOption {
+	return func(c *Client) {
+		if c.api != nil {
+			c.api.httpClient = newHTTPClient(cfg)
+		}
+	}
+}
+
+// newHTTPClient builds an HTTP client with its own pooled transport, instrumented
+// for upstream latency metrics.
+func newHTTPClient(cfg HTTPConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	if len(cfg.CertPins) > 0 || cfg.InsecureSkipVerify || cfg.ClientCert != nil {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.InsecureSkipVerify, // opt-in; config refuses it in production
+		}
+		if len(cfg.CertPins) > 0 {
+			tlsConfig.VerifyConnection = verifyCertPins(cfg.CertPins)
+		}
+		if cfg.ClientCert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cfg.ClientCert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: timedTransport{base: transport},
+	}
+}
+
+// ValidateCertPin checks that pin is a base64 SHA-256 hash, as printed by
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func ValidateCertPin(pin string) error {
+	sum, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(sum) != sha256.Size {
+		return errors.New("certificate pin must be a base64 SHA-256 hash of the public key")
+	}
+	return nil
+}
+
+// verifyCertPins returns a tls.Config.VerifyConnection hook accepting a
+// connection only if one of the presented certificates (leaf or chain) has a
+// public key matching a pin. Pins that do not decode never match, so a bad pin
+// fails closed.
+func verifyCertPins(pins []string) func(tls.ConnectionState) error {
+	var sums [][]byte
+	for _, pin := range pins {
+		if sum, err := base64.StdEncoding.DecodeString(pin); err == nil {
+			sums = append(sums, sum)
+		}
+	}
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, sum := range sums {
+				if bytes.Equal(spki[:], sum) {
+					return nil
+				}
+			}
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("certificate pin mismatch: no certificate presented")
+		}
+		spki := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		return fmt.Errorf("certificate pin mismatch for %s: server key is %s",
+			cs.ServerName, base64.StdEncoding.EncodeToString(spki[:]))
+	}
+}
+
+// timedTransport records the latency of every upstream request in
+// metrics.UpstreamDuration, labelled by endpoint.
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	metrics.UpstreamDuration.WithLabelValues(upstreamEndpoint(req.URL.Path)).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// upstreamEndpoint maps a request path to a fixed metric label, keeping the
+// label set bounded.
+func upstreamEndpoint(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/identity/accounts/prelogin"):
+		return "prelogin"
+	case strings.HasSuffix(path, "/identity/connect/token"):
+		return "token"
+	case strings.HasSuffix(path, "/api/sync"):
+		return "sync"
+	default:
+		return "other"
+	}
+}
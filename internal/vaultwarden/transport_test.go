@@ -0,0 +1,173 @@
+package vaultwarden
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/identity/accounts/prelogin":   "prelogin",
+		"/vault/identity/connect/token": "token",
+		"/api/sync":                     "sync",
+		"/api/accounts/revision-date":   "other",
+	}
+	for path, want := range tests {
+		if got := upstreamEndpoint(path); got != want {
+			t.Errorf("upstreamEndpoint(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestWithHTTPConfig(t *testing.T) {
+	api := NewAPIClient("http://vault.invalid", "user@example.com", "pw", "", "")
+	if api.httpClient.Timeout != 30*time.Second {
+		t.Errorf("default timeout = %v, want 30s", api.httpClient.Timeout)
+	}
+
+	NewClient(api, 0, 0, WithHTTPConfig(HTTPConfig{
+		Timeout:         5 * time.Second,
+		MaxIdleConns:    8,
+		IdleConnTimeout: time.Minute,
+	}))
+
+	if api.httpClient.Timeout != 5*time.Second {
+		t.Errorf("timeout = %v, want 5s", api.httpClient.Timeout)
+	}
+	transport, ok := api.httpClient.Transport.(timedTransport).base.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport = %T, want *http.Transport", api.httpClient.Transport.(timedTransport).base)
+	}
+	if transport.MaxIdleConns != 8 || transport.MaxIdleConnsPerHost != 8 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("transport pool = (%d, %d, %v), want (8, 8, 1m)",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+}
+
+func TestCertPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	spki := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	goodPin := base64.StdEncoding.EncodeToString(spki[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{"no pin", nil, false},
+		{"matching pin", []string{goodPin}, false},
+		{"backup pin matches", []string{otherPin, goodPin}, false},
+		{"mismatched pin", []string{otherPin}, true},
+		{"undecodable pin fails closed", []string{"not-base64!"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultHTTPConfig()
+			cfg.CertPins = tt.pins
+			client := newHTTPClient(cfg)
+			// Trust the test server's self-signed CA; pinning is checked on top.
+			base := client.Transport.(timedTransport).base.(*http.Transport)
+			if base.TLSClientConfig == nil {
+				base.TLSClientConfig = &tls.Config{}
+			}
+			base.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "certificate pin mismatch") {
+				t.Errorf("err = %v, want a pin mismatch", err)
+			}
+		})
+	}
+
+	if err := ValidateCertPin(goodPin); err != nil {
+		t.Errorf("ValidateCertPin(valid) = %v", err)
+	}
+	if err := ValidateCertPin(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("ValidateCertPin accepted a pin that is not 32 bytes")
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if _, err := newHTTPClient(DefaultHTTPConfig()).Get(srv.URL); err == nil {
+		t.Fatal("self-signed certificate accepted with verification on")
+	}
+
+	cfg := DefaultHTTPConfig()
+	cfg.InsecureSkipVerify = true
+	resp, err := newHTTPClient(cfg).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("InsecureSkipVerify: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientCert(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(cert *tls.Certificate) error {
+		cfg := DefaultHTTPConfig()
+		cfg.InsecureSkipVerify = true
+		cfg.ClientCert = cert
+		resp, err := newHTTPClient(cfg).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(nil); err == nil {
+		t.Error("request without a client certificate accepted by an mTLS server")
+	}
+	cert := selfSignedCert(t)
+	if err := get(&cert); err != nil {
+		t.Errorf("request with a client certificate: %v", err)
+	}
+}
+
+// selfSignedCert returns a throwaway ECDSA certificate for TLS tests.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vaultwarden-api test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,24 @@
+package vaultwarden
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Turbootzz/vaultwarden-api/internal/metrics"
+)
+
+// GetSecretURIs returns every login URI of the item matched by name, in vault
+// order, and whether they came from a stale snapshot (see GetSecretResult). An
+// item without URIs, including any item that is not a login, returns
+// ErrFieldNotFound.
+func (c *Client) GetSecretURIs(ctx context.Context, name string, filter SecretFilter) ([]string, bool, error) {
+	item, stale, err := c.lookupItem(ctx, name, filter, true)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(item.URIs) == 0 {
+		metrics.LookupErrors.WithLabelValues("field_not_found").Inc()
+		return nil, false, ErrFieldNotFound
+	}
+	return slices.Clone(item.URIs), stale, nil
+}
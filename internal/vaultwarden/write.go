@@ -0,0 +1,177 @@
+package vaultwarden
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPasswordHistory is how many previous passwords Bitwarden clients keep.
+const maxPasswordHistory = 5
+
+// UpdateSecret sets the password of the login item that name resolves to
+// (honoring the filter, like GetSecret) and updates the snapshot so the new
+// value is served immediately. Items other than logins return ErrNotWritable.
+func (c *Client) UpdateSecret(name string, filter SecretFilter, password string) error {
+	return c.UpdateSecretContext(context.Background(), name, filter, password)
+}
+
+// UpdateSecretContext is UpdateSecret bounded by ctx: the lookup and the
+// requests to Vaultwarden are abandoned once ctx is done.
+func (c *Client) UpdateSecretContext(ctx context.Context, name string, filter SecretFilter, password string) error {
+	item, err := c.lookup(ctx, name, filter)
+	if err != nil {
+		return err
+	}
+	if item.Type != CipherTypeLogin {
+		return ErrNotWritable
+	}
+
+	if c.api != nil {
+		if err := c.api.UpdatePasswordContext(ctx, item.ID, item.OrganizationID, password); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if cur, ok := c.items[item.ID]; ok {
+		cur.Password = password
+		c.items[item.ID] = cur
+	}
+	c.mu.Unlock()
+
+	return nil
+}
+
+// UpdatePassword replaces the login password of a cipher. The cipher is read
+// back from the server and written with only the password (and its history)
+// changed, so every other encrypted field is preserved byte for byte.
+func (ac *APIClient) UpdatePassword(cipherID, orgID, password string) error {
+	return ac.UpdatePasswordContext(context.Background(), cipherID, orgID, password)
+}
+
+// UpdatePasswordContext is UpdatePassword bounded by ctx.
+func (ac *APIClient) UpdatePasswordContext(ctx context.Context, cipherID, orgID, password string) error {
+	if err := ac.EnsureValidToken(); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+
+	ac.mu.RLock()
+	key, ok := ac.symKey, true
+	if orgID != "" {
+		key, ok = ac.orgKeys[orgID]
+	}
+	ac.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no key for organization %s", orgID)
+	}
+
+	var cipher map[string]any
+	if err := ac.apiRequest(ctx, http.MethodGet, "/api/ciphers/"+cipherID, nil, &cipher); err != nil {
+		return fmt.Errorf("fetch cipher: %w", err)
+	}
+	if k, _ := cipher[jsonKey(cipher, "key")].(string); k != "" {
+		// Per-item keys would need to be unwrapped first; refuse rather than
+		// write a password the vault cannot decrypt.
+		return fmt.Errorf("%w: item uses a per-item encryption key", ErrNotWritable)
+	}
+	login, ok := cipher[jsonKey(cipher, "login")].(map[string]any)
+	if !ok {
+		return ErrNotWritable
+	}
+
+	encrypted, err := EncryptStr(password, key)
+	if err != nil {
+		return fmt.Errorf("encrypt password: %w", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	// Keep the previous password in the item's history, like the official clients.
+	pwKey := jsonKey(login, "password")
+	if old, _ := login[pwKey].(string); old != "" {
+		historyKey := jsonKey(cipher, "passwordHistory")
+		history, _ := cipher[historyKey].([]any)
+		history = append([]any{map[string]any{"password": old, "lastUsedDate": now}}, history...)
+		if len(history) > maxPasswordHistory {
+			history = history[:maxPasswordHistory]
+		}
+		cipher[historyKey] = history
+	}
+	login[pwKey] = encrypted
+	login[jsonKey(login, "passwordRevisionDate")] = now
+
+	// The server rejects the update if the item changed since it was read.
+	cipher["lastKnownRevisionDate"] = cipher[jsonKey(cipher, "revisionDate")]
+
+	if err := ac.apiRequest(ctx, http.MethodPut, "/api/ciphers/"+cipherID, cipher, nil); err != nil {
+		return fmt.Errorf("update cipher: %w", err)
+	}
+	return nil
+}
+
+// apiRequest sends an authenticated JSON request and decodes the response into
+// out (when non-nil). ctx bounds the request.
+func (ac *APIClient) apiRequest(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ac.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	ac.mu.RLock()
+	token := ac.accessToken
+	ac.mu.RUnlock()
+	ac.authorize(req, token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := ac.do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("%w: HTTP %d", ErrAuthFailed, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// jsonKey returns the key in m that matches name case-insensitively (older
+// Vaultwarden versions use PascalCase), or name itself when absent.
+func jsonKey(m map[string]any, name string) string {
+	if _, ok := m[name]; ok {
+		return name
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+package vaultwarden
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUpdateSecret(t *testing.T) {
+	oldPassword := mustEncryptType2Cipher(t, "old", testUserKey())
+	var put map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ciphers/c1" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":           "c1",
+				"type":         CipherTypeLogin,
+				"name":         "2.unchanged",
+				"revisionDate": "2024-01-01T00:00:00Z",
+				"login":        map[string]any{"username": "2.user", "password": oldPassword},
+			})
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &put); err != nil {
+				t.Errorf("PUT body: %v", err)
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	items := map[string]DecryptedItem{
+		"c1": {ID: "c1", Type: CipherTypeLogin, Name: "db-password", Password: "old"},
+		"c2": {ID: "c2", Type: CipherTypeSecureNote, Name: "note", Notes: "text"},
+	}
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(items, emptySyncNameMaps()))
+
+	if err := c.UpdateSecret("db-password", SecretFilter{}, "new"); err != nil {
+		t.Fatalf("UpdateSecret: %v", err)
+	}
+
+	login, _ := put["login"].(map[string]any)
+	enc, _ := login["password"].(string)
+	if got, err := DecryptStr(enc, testUserKey()); err != nil || got != "new" {
+		t.Errorf("written password = (%q, %v), want new", got, err)
+	}
+	if login["username"] != "2.user" || put["name"] != "2.unchanged" {
+		t.Errorf("other fields must be preserved: %v", put)
+	}
+	if put["lastKnownRevisionDate"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("lastKnownRevisionDate = %v", put["lastKnownRevisionDate"])
+	}
+	history, _ := put["passwordHistory"].([]any)
+	if len(history) != 1 || history[0].(map[string]any)["password"] != oldPassword {
+		t.Errorf("passwordHistory = %v, want the old password", history)
+	}
+
+	if val, err := c.GetSecret("db-password", SecretFilter{}); err != nil || val != "new" {
+		t.Errorf("GetSecret after update = (%q, %v), want new", val, err)
+	}
+
+	if err := c.UpdateSecret("note", SecretFilter{}, "x"); !errors.Is(err, ErrNotWritable) {
+		t.Errorf("UpdateSecret(note) = %v, want ErrNotWritable", err)
+	}
+	if err := c.UpdateSecret("missing", SecretFilter{}, "x"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("UpdateSecret(missing) = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestUpdateSecretContext_cancelled(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	items := map[string]DecryptedItem{"c1": {ID: "c1", Type: CipherTypeLogin, Name: "db-password", Password: "old"}}
+	c := NewClient(newTestAPIClient(t, srv), 0, 0, WithState(items, emptySyncNameMaps()))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := c.UpdateSecretContext(ctx, "db-password", SecretFilter{}, "new"); err == nil {
+		t.Fatal("UpdateSecretContext(cancelled) succeeded")
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("server hits = %d, want 0 for a cancelled write", got)
+	}
+	if val, _ := c.GetSecret("db-password", SecretFilter{}); val != "old" {
+		t.Errorf("value after cancelled write = %q, want old", val)
+	}
+}
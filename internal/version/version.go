@@ -0,0 +1,57 @@
+// Package version holds build metadata, set at link time:
+//
+//	go build -ldflags "-X github.com/Turbootzz/vaultwarden-api/internal/version.Version=v2.1.0 \
+//	  -X github.com/Turbootzz/vaultwarden-api/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/Turbootzz/vaultwarden-api/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without -ldflags the commit and build time fall back to the VCS stamp Go
+// embeds when building from a git checkout.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set via -ldflags -X.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is the build metadata reported by GET /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the metadata of the running binary. Fields that are unknown are
+// reported as "unknown".
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
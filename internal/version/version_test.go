@@ -0,0 +1,23 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	orig := [3]string{Version, Commit, BuildTime}
+	t.Cleanup(func() { Version, Commit, BuildTime = orig[0], orig[1], orig[2] })
+
+	Version, Commit, BuildTime = "v2.1.0", "abc123", "2024-05-01T12:00:00Z"
+	want := Info{Version: "v2.1.0", Commit: "abc123", BuildTime: "2024-05-01T12:00:00Z", GoVersion: runtime.Version()}
+	if got := Get(); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	// Test binaries carry no VCS stamp, so unset fields read as unknown.
+	Commit, BuildTime = "", ""
+	if got := Get(); got.Commit != "unknown" || got.BuildTime != "unknown" {
+		t.Errorf("Get() = %+v, want unknown commit and build time", got)
+	}
+}
@@ -0,0 +1,143 @@
+// Package webhook posts security events (cache refreshes, auth failures) to a
+// configured URL without ever blocking the request path.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Turbootzz/vaultwarden-api/pkg/logger"
+)
+
+// Event types.
+const (
+	EventCacheRefresh = "cache_refresh"
+	EventAuthFailure  = "auth_failure"
+	EventExport       = "export"
+	EventSecretUpdate = "secret_update"
+)
+
+const (
+	// deliveryTimeout bounds each POST so a slow receiver cannot pile up work.
+	deliveryTimeout = 5 * time.Second
+	// maxInFlight caps concurrent deliveries; events beyond it are dropped
+	// (e.g. during a burst of failed logins).
+	maxInFlight = 16
+)
+
+// Event is the JSON payload posted to the webhook.
+type Event struct {
+	Type      string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	// Reason is the auth failure reason (missing_header, invalid_format, invalid_key).
+	Reason string `json:"reason,omitempty"`
+	// KeyFingerprint identifies a rejected key without revealing it.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+}
+
+// Notifier delivers events to a webhook URL. A nil Notifier, or one created
+// with an empty URL, silently drops every event.
+type Notifier struct {
+	url    string
+	client *http.Client
+	slots  chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New returns a notifier for url, or nil when url is empty.
+func New(url string) *Notifier {
+	if url == "" {
+		return nil
+	}
+	return &Notifier{
+		url:    url,
+		client: &http.Client{Timeout: deliveryTimeout},
+		slots:  make(chan struct{}, maxInFlight),
+	}
+}
+
+// Notify delivers ev in the background. It never blocks: when too many
+// deliveries are already in flight the event is dropped with a warning.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now().UTC()
+	}
+
+	select {
+	case n.slots <- struct{}{}:
+	default:
+		logger.Warn.Printf("Webhook delivery dropped (%d in flight): %s", maxInFlight, ev.Type)
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer func() {
+			<-n.slots
+			n.wg.Done()
+		}()
+		if err := n.deliver(ev); err != nil {
+			logger.Warn.Printf("Webhook delivery failed for %s: %v", ev.Type, err)
+		}
+	}()
+}
+
+// Close waits for in-flight deliveries to finish (each is bounded by the
+// delivery timeout).
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Fingerprint returns a short, non-reversible identifier for a presented key:
+// the first 12 hex characters of its SHA-256. Equal keys give equal
+// fingerprints, so repeated attempts with the same key can be correlated.
+func Fingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
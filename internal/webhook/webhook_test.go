@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- ev
+	}))
+	defer srv.Close()
+
+	n := New(srv.URL)
+	n.Notify(Event{Type: EventAuthFailure, ClientIP: "203.0.113.7", Reason: "invalid_key", KeyFingerprint: Fingerprint("wrong-key")})
+	n.Close()
+
+	ev := <-received
+	if ev.Type != EventAuthFailure || ev.ClientIP != "203.0.113.7" || ev.Reason != "invalid_key" || ev.Timestamp.IsZero() {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if ev.KeyFingerprint == "" || strings.Contains(ev.KeyFingerprint, "wrong-key") {
+		t.Errorf("KeyFingerprint = %q, want a non-empty hash", ev.KeyFingerprint)
+	}
+}
+
+func TestNotifyDisabled(t *testing.T) {
+	t.Parallel()
+
+	n := New("")
+	if n != nil {
+		t.Fatalf("New(\"\") = %v, want nil", n)
+	}
+	// A nil notifier is a no-op.
+	n.Notify(Event{Type: EventCacheRefresh})
+	n.Close()
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	if got := Fingerprint(""); got != "" {
+		t.Errorf("Fingerprint(\"\") = %q, want empty", got)
+	}
+	a, b := Fingerprint("key-a"), Fingerprint("key-b")
+	if len(a) != 12 || a == b || a != Fingerprint("key-a") {
+		t.Errorf("Fingerprint: a=%q b=%q", a, b)
+	}
+}
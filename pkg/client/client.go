@@ -0,0 +1,297 @@
+// Package client is a Go client for the Vaultwarden API service. It handles
+// Bearer authentication, timeouts, retries and error mapping, and understands
+// both plain and RESPONSE_ENVELOPE responses.
+//
+//	c, err := client.New("https://secrets.internal:8080", os.Getenv("VAULTWARDEN_API_KEY"))
+//	if err != nil { ... }
+//	dsn, err := c.GetSecret(ctx, "DATABASE_URL")
+//	if errors.Is(err, client.ErrNotFound) { ... }
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Errors matched with errors.Is against the error of any Client method. The
+// returned error is an *APIError carrying the status and server message.
+var (
+	// ErrNotFound means the secret (or field) does not exist or is not visible
+	// to the key (404).
+	ErrNotFound = errors.New("not found")
+	// ErrDeleted means the secret is in the Vaultwarden trash (410).
+	ErrDeleted = errors.New("secret deleted")
+	// ErrUnauthorized means the API key was missing, wrong, or not allowed to
+	// use the endpoint (401 or 403).
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited means the server asked the client to slow down (429).
+	ErrRateLimited = errors.New("rate limited")
+	// ErrServer means the service or Vaultwarden behind it failed (5xx).
+	ErrServer = errors.New("server error")
+)
+
+// DefaultTimeout bounds each HTTP request when WithHTTPClient is not used.
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseBytes caps the response bodies the client reads.
+const maxResponseBytes = 10 << 20
+
+// APIError is a non-2xx response from the service.
+type APIError struct {
+	StatusCode int
+	// Message is the server's error message, e.g. "secret not found".
+	Message string
+	// RequestID identifies the request in the server logs, when it sent one.
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("vaultwarden-api: HTTP %d", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Unwrap maps the status code to one of the package errors.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusGone:
+		return ErrDeleted
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+	return nil
+}
+
+// Client calls the Vaultwarden API service. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	retry      RetryPolicy
+	userAgent  string
+}
+
+// Option configures New.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, e.g. one with a
+// custom transport or TLS configuration. Its Timeout applies as-is.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request (DefaultTimeout). Retries
+// get a fresh timeout; use the context to bound the whole call. A client set
+// with WithHTTPClient is copied, not modified.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		hc := *c.httpClient
+		hc.Timeout = d
+		c.httpClient = &hc
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// New returns a client for the service at baseURL (scheme and host, optionally
+// a path prefix) authenticating with apiKey.
+func New(baseURL, apiKey string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q (want http(s)://host[:port])", baseURL)
+	}
+	if apiKey == "" {
+		return nil, errors.New("API key is empty")
+	}
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retry:      DefaultRetryPolicy,
+		userAgent:  "vaultwarden-api-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// GetSecret returns the value of the secret named name, picked by the
+// server's extraction order (GET /secret/:name).
+func (c *Client) GetSecret(ctx context.Context, name string) (string, error) {
+	return c.getValue(ctx, "/secret/"+url.PathEscape(name), nil)
+}
+
+// GetSecretField returns one field of a secret: username, password, notes,
+// uri, totp or a custom field name (GET /secret/:name?field=).
+func (c *Client) GetSecretField(ctx context.Context, name, field string) (string, error) {
+	return c.getValue(ctx, "/secret/"+url.PathEscape(name), url.Values{"field": {field}})
+}
+
+func (c *Client) getValue(ctx context.Context, path string, query url.Values) (string, error) {
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, query, &out); err != nil {
+		return "", err
+	}
+	return out.Value, nil
+}
+
+// ListSecrets returns the names of the secrets visible to the key (GET /secrets).
+func (c *Client) ListSecrets(ctx context.Context) ([]string, error) {
+	var out struct {
+		Names []string `json:"names"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/secrets", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Names, nil
+}
+
+// RefreshCache makes the service sync the vault now (POST /refresh).
+func (c *Client) RefreshCache(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/refresh", nil, nil)
+}
+
+// do sends one API call, retrying per c.retry, and decodes a success body
+// (unwrapping the response envelope) into out when out is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out any) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	attempts := max(c.retry.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		body, err := c.send(ctx, method, target)
+		if err == nil {
+			if out == nil {
+				return nil
+			}
+			if err := json.Unmarshal(unwrapEnvelope(body), out); err != nil {
+				return fmt.Errorf("vaultwarden-api: decode response: %w", err)
+			}
+			return nil
+		}
+
+		if attempt == attempts || ctx.Err() != nil || !c.retry.shouldRetry(err) {
+			return err
+		}
+		delay := c.retry.BaseDelay << (attempt - 1)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		if c.retry.OnRetry != nil {
+			c.retry.OnRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("vaultwarden-api: %w (last error: %v)", ctx.Err(), err)
+		}
+	}
+}
+
+// send performs one request and returns the body of a 2xx response, or an
+// *APIError for any other status.
+func (c *Client) send(ctx context.Context, method, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("vaultwarden-api: create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vaultwarden-api: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("vaultwarden-api: read response: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return body, nil
+	}
+	return nil, parseError(resp.StatusCode, body)
+}
+
+// parseError builds an *APIError from an error body in either shape:
+// {"error": "msg", "request_id": "..."} or the envelope's
+// {"success": false, "error": {"message": "msg", "request_id": "..."}}.
+func parseError(status int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: status}
+	var plain struct {
+		Error     json.RawMessage `json:"error"`
+		RequestID string          `json:"request_id"`
+	}
+	if json.Unmarshal(body, &plain) != nil {
+		return apiErr
+	}
+	var detail struct {
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	switch {
+	case json.Unmarshal(plain.Error, &apiErr.Message) == nil:
+		apiErr.RequestID = plain.RequestID
+	case json.Unmarshal(plain.Error, &detail) == nil:
+		apiErr.Message, apiErr.RequestID = detail.Message, detail.RequestID
+	}
+	return apiErr
+}
+
+// unwrapEnvelope returns the "data" member of an enveloped success body
+// ({"success": true, "data": ...}), or body unchanged.
+func unwrapEnvelope(body []byte) []byte {
+	var env struct {
+		Success *bool           `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(body, &env) == nil && env.Success != nil && env.Data != nil {
+		return env.Data
+	}
+	return body
+}
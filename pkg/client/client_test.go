@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testKey = "client-test-key-000000000000000000000000"
+
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, testKey, append([]Option{WithRetry(RetryPolicy{Attempts: 3})}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid API key"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /secret/db%2Fpassword":
+			if r.URL.Query().Get("field") == "username" {
+				_, _ = w.Write([]byte(`{"name":"db/password","field":"username","value":"dbuser"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"db/password","value":"s3cret"}`))
+		case "GET /secrets":
+			_, _ = w.Write([]byte(`{"success":true,"data":{"names":["a","b"]}}`))
+		case "POST /refresh":
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		case "GET /secret/retired":
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"success":false,"error":{"message":"secret deleted","request_id":"req-1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"secret not found","request_id":"req-2"}`))
+		}
+	})
+	ctx := t.Context()
+
+	if v, err := c.GetSecret(ctx, "db/password"); err != nil || v != "s3cret" {
+		t.Errorf("GetSecret = %q, %v", v, err)
+	}
+	if v, err := c.GetSecretField(ctx, "db/password", "username"); err != nil || v != "dbuser" {
+		t.Errorf("GetSecretField = %q, %v", v, err)
+	}
+	if names, err := c.ListSecrets(ctx); err != nil || !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("ListSecrets = %v, %v (enveloped response)", names, err)
+	}
+	if err := c.RefreshCache(ctx); err != nil {
+		t.Errorf("RefreshCache: %v", err)
+	}
+
+	_, err := c.GetSecret(ctx, "missing")
+	var apiErr *APIError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Message != "secret not found" || apiErr.RequestID != "req-2" {
+		t.Errorf("missing secret: err = %v, want ErrNotFound with message and request ID", err)
+	}
+	if _, err := c.GetSecret(ctx, "retired"); !errors.Is(err, ErrDeleted) || !errors.As(err, &apiErr) || apiErr.RequestID != "req-1" {
+		t.Errorf("deleted secret: err = %v, want ErrDeleted from the envelope", err)
+	}
+
+	wrongKey, _ := New(c.baseURL, "wrong", WithRetry(RetryPolicy{Attempts: 3}))
+	if _, err := wrongKey.ListSecrets(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("wrong key: err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	t.Run("recovers from 5xx", func(t *testing.T) {
+		var hits atomic.Int32
+		var retries []int
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"value":"v"}`))
+		}, WithRetry(RetryPolicy{Attempts: 3, OnRetry: func(attempt int, _ time.Duration, err error) {
+			if !errors.Is(err, ErrServer) {
+				t.Errorf("OnRetry err = %v, want ErrServer", err)
+			}
+			retries = append(retries, attempt)
+		}}))
+
+		if v, err := c.GetSecret(t.Context(), "x"); err != nil || v != "v" {
+			t.Errorf("GetSecret = %q, %v", v, err)
+		}
+		if !slices.Equal(retries, []int{1, 2}) {
+			t.Errorf("OnRetry called for attempts %v, want [1 2]", retries)
+		}
+	})
+
+	t.Run("not found is not retried", func(t *testing.T) {
+		var hits atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		})
+		if _, err := c.GetSecret(t.Context(), "x"); !errors.Is(err, ErrNotFound) || hits.Load() != 1 {
+			t.Errorf("err = %v after %d requests, want ErrNotFound after 1", err, hits.Load())
+		}
+	})
+
+	t.Run("stops at context deadline", func(t *testing.T) {
+		var hits atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, WithRetry(RetryPolicy{Attempts: 3, BaseDelay: time.Second}))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+		defer cancel()
+		if _, err := c.GetSecret(ctx, "x"); !errors.Is(err, ErrServer) || hits.Load() != 1 {
+			t.Errorf("err = %v after %d requests, want ErrServer after 1", err, hits.Load())
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, base := range []string{"", "vault.example.com", "ftp://vault.example.com"} {
+		if _, err := New(base, testKey); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", base)
+		}
+	}
+	if _, err := New("https://vault.example.com", ""); err == nil {
+		t.Error("New accepted an empty API key")
+	}
+
+	hc := &http.Client{}
+	c, err := New("https://vault.example.com/", testKey, WithHTTPClient(hc), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if c.baseURL != "https://vault.example.com" || c.httpClient.Timeout != time.Second || hc.Timeout != 0 {
+		t.Errorf("baseURL %q, timeout %v, caller's client timeout %v", c.baseURL, c.httpClient.Timeout, hc.Timeout)
+	}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultRetryPolicy tries each call three times, waiting 500ms then 1s, when
+// the service is unreachable, rate limits the client or answers 5xx.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 500 * time.Millisecond}
+
+// RetryPolicy controls how failed calls are retried. Each retry waits twice as
+// long as the one before; a retry whose wait would end past the context
+// deadline is not attempted.
+type RetryPolicy struct {
+	// Attempts is the total number of tries per call; 1 or less disables retries.
+	Attempts  int
+	BaseDelay time.Duration
+	// ShouldRetry decides whether err is worth retrying. Nil retries network
+	// errors, ErrRateLimited and ErrServer.
+	ShouldRetry func(err error) bool
+	// OnRetry, when set, is called before each retry, e.g. to log or count it.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+func (p RetryPolicy) shouldRetry(err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return true // the request did not get an answer
+	}
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer)
+}
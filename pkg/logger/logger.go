@@ -2,9 +2,17 @@
 package logger
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -14,18 +22,221 @@ var (
 	Error *log.Logger
 )
 
+// Level is a log severity. Loggers below the configured level discard their
+// output.
+type Level int
+
+// Log levels, from most to least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a LOG_LEVEL value: debug, info, warn (or warning) or
+// error, case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		s = "warn"
+	}
+	if i := slices.Index(levelNames[:], s); i >= 0 {
+		return Level(i), nil
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", s)
+}
+
+var (
+	minLevel  Level
+	newLogger func(out io.Writer, level string, fields ...Field) *log.Logger
+)
+
 func init() {
-	// Check if DEBUG mode is enabled
-	debugEnabled := os.Getenv("DEBUG") == "true"
+	// LOG_LEVEL sets the least severe level written; DEBUG=true is kept as
+	// an alias for LOG_LEVEL=debug. An explicit LOG_LEVEL wins.
+	minLevel = LevelInfo
+	if os.Getenv("DEBUG") == "true" {
+		minLevel = LevelDebug
+	}
+	var levelErr error
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if level, err := ParseLevel(raw); err != nil {
+			levelErr = err
+		} else {
+			minLevel = level
+		}
+	}
+
+	// LOG_FORMAT=json emits one JSON object per line for log shippers;
+	// anything else keeps the human-readable text format.
+	newLogger = newTextLogger
+	if os.Getenv("LOG_FORMAT") == "json" {
+		newLogger = newJSONLogger
+	}
+
+	scoped := newScoped()
+	Debug, Info, Warn, Error = scoped.Debug, scoped.Info, scoped.Warn, scoped.Error
+	if levelErr != nil {
+		Error.Printf("LOG_LEVEL: %v; using %s", levelErr, minLevel)
+	}
+}
+
+var redactNames atomic.Bool
+
+// SetRedactNames makes Name hash the names it is given, unless the log level
+// is debug.
+func SetRedactNames(enabled bool) {
+	redactNames.Store(enabled)
+}
+
+// Name returns a secret name for a log line. With SetRedactNames(true) and a
+// level above debug it returns a short hash instead ("name:3f2a9c41b7d0"): the
+// same name always hashes the same, so lines can still be correlated, but the
+// name itself (an internal hostname, say) stays out of aggregated logs.
+func Name(name string) string {
+	if !redactNames.Load() || minLevel == LevelDebug {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return "name:" + hex.EncodeToString(sum[:6])
+}
+
+// Field is a key/value pair attached to every line of a Scoped logger.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Scoped holds leveled loggers that tag every line with the same fields, such
+// as a request ID.
+type Scoped struct {
+	Debug *log.Logger
+	Info  *log.Logger
+	Warn  *log.Logger
+	Error *log.Logger
+}
+
+// With returns loggers that add key=value to every line: appended to the
+// message in the text format, as a top-level property in JSON. An empty value
+// returns the package-level loggers.
+func With(key, value string) *Scoped {
+	if value == "" {
+		return &Scoped{Debug: Debug, Info: Info, Warn: Warn, Error: Error}
+	}
+	return newScoped(Field{Key: key, Value: value})
+}
+
+func newScoped(fields ...Field) *Scoped {
+	return &Scoped{
+		Debug: leveled(LevelDebug, os.Stdout, "debug", fields),
+		Info:  leveled(LevelInfo, os.Stdout, "info", fields),
+		Warn:  leveled(LevelWarn, os.Stdout, "warn", fields),
+		Error: leveled(LevelError, os.Stderr, "error", fields),
+	}
+}
+
+// leveled returns a logger writing to out, or discarding everything when
+// level is below the configured minimum. Fatal* still exits either way.
+func leveled(level Level, out io.Writer, name string, fields []Field) *log.Logger {
+	if level < minLevel {
+		return log.New(io.Discard, "", 0)
+	}
+	return newLogger(out, name, fields...)
+}
+
+// newTextLogger returns a logger in the default "LEVEL: date time file:line msg"
+// format, with any fields appended as " key=value".
+func newTextLogger(out io.Writer, level string, fields ...Field) *log.Logger {
+	if len(fields) > 0 {
+		var suffix strings.Builder
+		for _, f := range fields {
+			fmt.Fprintf(&suffix, " %s=%s", f.Key, f.Value)
+		}
+		out = &suffixWriter{out: out, suffix: suffix.String()}
+	}
+	return log.New(out, strings.ToUpper(level)+": ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// newJSONLogger returns a logger whose lines are formatted by jsonWriter. The
+// standard logger still resolves the caller, so Printf/Fatalf etc. keep working.
+func newJSONLogger(out io.Writer, level string, fields ...Field) *log.Logger {
+	return log.New(&jsonWriter{out: out, level: level, fields: fields}, "", log.Lshortfile)
+}
+
+// suffixWriter appends a fixed suffix to each log line, before its newline.
+type suffixWriter struct {
+	out    io.Writer
+	suffix string
+}
+
+func (w *suffixWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	if _, err := io.WriteString(w.out, line+w.suffix+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// jsonEntry is a single JSON log line.
+type jsonEntry struct {
+	Level     string `json:"level"`
+	Timestamp string `json:"timestamp"`
+	Msg       string `json:"msg"`
+	Caller    string `json:"caller,omitempty"`
+}
 
-	if debugEnabled {
-		Debug = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
-	} else {
-		// Discard debug logs in production
-		Debug = log.New(io.Discard, "", 0)
+// jsonWriter converts the "file:line: msg\n" lines produced by a log.Logger
+// with only Lshortfile set into JSON objects. Encoding escapes embedded
+// newlines, so a message cannot forge additional log entries.
+type jsonWriter struct {
+	out    io.Writer
+	level  string
+	fields []Field
+	now    func() time.Time // for tests; nil means time.Now
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	now := time.Now
+	if w.now != nil {
+		now = w.now
+	}
+
+	line := strings.TrimSuffix(string(p), "\n")
+	entry := jsonEntry{
+		Level:     w.level,
+		Timestamp: now().UTC().Format(time.RFC3339Nano),
+		Msg:       line,
+	}
+	// "file.go:12: msg" - the caller never contains ": ".
+	if caller, msg, ok := strings.Cut(line, ": "); ok && strings.Contains(caller, ".go:") {
+		entry.Caller, entry.Msg = caller, msg
 	}
 
-	Info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Warn = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Error = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	// Fields become extra top-level properties: splice them in before the
+	// closing brace (entry always marshals to a non-empty object).
+	for _, f := range w.fields {
+		k, _ := json.Marshal(f.Key)
+		v, _ := json.Marshal(f.Value)
+		b = append(b[:len(b)-1], ',')
+		b = append(append(append(b, k...), ':'), v...)
+		b = append(b, '}')
+	}
+	if _, err := w.out.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
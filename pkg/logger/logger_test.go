@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := &jsonWriter{out: &buf, level: "warn", now: func() time.Time {
+		return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	}}
+	l := log.New(w, "", log.Lshortfile)
+
+	l.Printf("sync failed: %s", "timeout\nINFO: forged")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("want exactly one line, got %d: %q", len(lines), buf.String())
+	}
+
+	var got jsonEntry
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	want := jsonEntry{
+		Level:     "warn",
+		Timestamp: "2024-05-01T12:00:00Z",
+		Msg:       "sync failed: timeout\nINFO: forged",
+	}
+	if !strings.HasPrefix(got.Caller, "logger_test.go:") {
+		t.Errorf("Caller = %q, want logger_test.go:<line>", got.Caller)
+	}
+	got.Caller = ""
+	if got != want {
+		t.Errorf("entry = %+v, want %+v", got, want)
+	}
+}
+
+func TestFields(t *testing.T) {
+	t.Parallel()
+
+	fields := []Field{{Key: "request_id", Value: `abc"1`}}
+
+	var jsonBuf bytes.Buffer
+	w := &jsonWriter{out: &jsonBuf, level: "info", fields: fields}
+	log.New(w, "", log.Lshortfile).Print("secret fetched")
+
+	var got map[string]string
+	if err := json.Unmarshal(jsonBuf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", jsonBuf.String(), err)
+	}
+	if got["request_id"] != `abc"1` || got["msg"] != "secret fetched" {
+		t.Errorf("entry = %v, want request_id and msg", got)
+	}
+
+	var textBuf bytes.Buffer
+	newTextLogger(&textBuf, "info", fields...).Print("secret fetched")
+	if line := textBuf.String(); !strings.HasSuffix(line, "secret fetched request_id=abc\"1\n") {
+		t.Errorf("text line = %q, want the field appended", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+
+	for raw, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, " warn ": LevelWarn, "warning": LevelWarn, "error": LevelError} {
+		if got, err := ParseLevel(raw); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "trace", "fatal"} {
+		if _, err := ParseLevel(raw); err == nil {
+			t.Errorf("ParseLevel(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	defer SetRedactNames(false)
+	prevLevel := minLevel
+	defer func() { minLevel = prevLevel }()
+	minLevel = LevelInfo
+
+	if got := Name("db.internal"); got != "db.internal" {
+		t.Errorf("Name without redaction = %q", got)
+	}
+
+	SetRedactNames(true)
+	got := Name("db.internal")
+	if got == "db.internal" || !strings.HasPrefix(got, "name:") || len(got) != len("name:")+12 {
+		t.Errorf("redacted Name = %q, want name: and 12 hex digits", got)
+	}
+	if Name("db.internal") != got || Name("db.external") == got {
+		t.Error("redacted names are not stable per name")
+	}
+
+	minLevel = LevelDebug
+	if got := Name("db.internal"); got != "db.internal" {
+		t.Errorf("Name at debug level = %q, want the full name", got)
+	}
+}